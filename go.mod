@@ -4,7 +4,9 @@ go 1.14
 
 require (
 	github.com/matoous/go-nanoid v1.3.0
+	github.com/prometheus/client_golang v1.7.1
 	go.mongodb.org/mongo-driver v1.3.1
 	golang.org/x/crypto v0.0.0-20200323165209-0ec3e9974c59
+	golang.org/x/net v0.0.0-20190613194153-d28f0bde5980
 	golang.org/x/xerrors v0.0.0-20191204190536-9bdfabe68543
 )
@@ -0,0 +1,222 @@
+package domainfilter
+
+import (
+	"bufio"
+	"fmt"
+	"github.com/nethruster/linksh/pkg/interfaces/link_repository"
+	"golang.org/x/net/idna"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Kind represents how the rules of a list are matched against a domain
+type Kind string
+
+const (
+	//Exact rules only match the same domain
+	Exact Kind = "exact"
+	//Suffix rules match the domain and all its subdomains
+	Suffix Kind = "suffix"
+	//Regex rules match the domains accepted by a regular expression
+	Regex Kind = "regex"
+)
+
+//Action represents what happens to the domains matched by the rules of a list
+type Action string
+
+const (
+	//Block rejects the matching domains
+	Block Action = "block"
+	//Allow accepts the matching domains, once there is an allow rule the domains not matching any of them are rejected
+	Allow Action = "allow"
+)
+
+//List is a file with one rule per line
+//Empty lines and the ones starting with # are ignored
+type List struct {
+	Path   string
+	Kind   Kind
+	Action Action
+}
+
+type rule struct {
+	kind   Kind
+	value  string
+	regex  *regexp.Regexp
+	source string
+}
+
+func (r rule) matches(domain string) bool {
+	switch r.kind {
+	case Exact:
+		return domain == r.value
+	case Suffix:
+		return domain == r.value || strings.HasSuffix(domain, "."+r.value)
+	default:
+		return r.regex.MatchString(domain)
+	}
+}
+
+//Filter implements IDomainFilter with rules loaded from local files
+//Blocking rules are checked first, so a domain matched by both a blocking and an allowing rule is rejected
+type Filter struct {
+	Lists []List
+	//OnError is called with the errors found while watching the lists, if nil they are ignored
+	OnError func(error)
+
+	mutex     sync.RWMutex
+	block     []rule
+	allow     []rule
+	reloading sync.Mutex
+	states    map[string]fileState
+}
+
+//fileState is used to tell if a list was modified
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+//New creates a Filter and loads its lists
+func New(lists ...List) (*Filter, error) {
+	filter := &Filter{Lists: lists}
+	if err := filter.Reload(); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+//Check returns nil if links can point to the domain
+//If the domain is rejected a DomainRejectedError would be returned
+func (f *Filter) Check(domain string) error {
+	f.mutex.RLock()
+	defer f.mutex.RUnlock()
+
+	for _, r := range f.block {
+		if r.matches(domain) {
+			return link_repository.DomainRejectedError{Domain: domain, Rule: r.value, Source: r.source}
+		}
+	}
+	if len(f.allow) == 0 {
+		return nil
+	}
+	for _, r := range f.allow {
+		if r.matches(domain) {
+			return nil
+		}
+	}
+	return link_repository.DomainRejectedError{Domain: domain}
+}
+
+//Reload loads the lists again if any of them was modified since the last load
+//If a list can't be loaded the previous rules are kept
+func (f *Filter) Reload() error {
+	f.reloading.Lock()
+	defer f.reloading.Unlock()
+
+	states := make(map[string]fileState, len(f.Lists))
+	changed := f.states == nil
+	for _, list := range f.Lists {
+		info, err := os.Stat(list.Path)
+		if err != nil {
+			return fmt.Errorf("error reading the domain list %s:%w", list.Path, err)
+		}
+		state := fileState{modTime: info.ModTime(), size: info.Size()}
+		previous, ok := f.states[list.Path]
+		if !ok || !previous.modTime.Equal(state.modTime) || previous.size != state.size {
+			changed = true
+		}
+		states[list.Path] = state
+	}
+	if !changed {
+		return nil
+	}
+
+	var block, allow []rule
+	for _, list := range f.Lists {
+		rules, err := loadList(list)
+		if err != nil {
+			return err
+		}
+		if list.Action == Allow {
+			allow = append(allow, rules...)
+		} else {
+			block = append(block, rules...)
+		}
+	}
+
+	f.mutex.Lock()
+	f.block, f.allow = block, allow
+	f.mutex.Unlock()
+	f.states = states
+	return nil
+}
+
+//Watch checks the lists for changes every interval and reloads them
+//The returned function stops watching
+func (f *Filter) Watch(interval time.Duration) (stop func()) {
+	ticker := time.NewTicker(interval)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				if err := f.Reload(); err != nil && f.OnError != nil {
+					f.OnError(err)
+				}
+			case <-done:
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+func loadList(list List) ([]rule, error) {
+	file, err := os.Open(list.Path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading the domain list %s:%w", list.Path, err)
+	}
+	defer file.Close()
+
+	var rules []rule
+	scanner := bufio.NewScanner(file)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		r := rule{kind: list.Kind, source: fmt.Sprintf("%s:%d", list.Path, lineNumber)}
+		switch list.Kind {
+		case Exact, Suffix:
+			line = strings.TrimPrefix(strings.TrimPrefix(line, "*"), ".")
+			r.value, err = idna.Lookup.ToASCII(strings.TrimSuffix(line, "."))
+			if err != nil {
+				return nil, fmt.Errorf("invalid domain at %s:%w", r.source, err)
+			}
+		case Regex:
+			r.value = line
+			r.regex, err = regexp.Compile(line)
+			if err != nil {
+				return nil, fmt.Errorf("invalid regular expression at %s:%w", r.source, err)
+			}
+		default:
+			return nil, fmt.Errorf("unknown kind of domain list %q for %s", list.Kind, list.Path)
+		}
+		rules = append(rules, r)
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading the domain list %s:%w", list.Path, err)
+	}
+
+	return rules, nil
+}
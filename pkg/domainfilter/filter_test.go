@@ -0,0 +1,101 @@
+package domainfilter
+
+import (
+	"errors"
+	"github.com/nethruster/linksh/pkg/interfaces/link_repository"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeList(t *testing.T, path, content string) {
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFilter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "linksh_domainfilter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	exact := filepath.Join(dir, "exact.txt")
+	suffix := filepath.Join(dir, "suffix.txt")
+	regex := filepath.Join(dir, "regex.txt")
+	allow := filepath.Join(dir, "allow.txt")
+	writeList(t, exact, "# phishing\nlogin-example.tld\n")
+	writeList(t, suffix, "*.evil.tld\nbücher.example\n")
+	writeList(t, regex, "^paypa1\\.\n")
+	writeList(t, allow, "")
+
+	filter, err := New(
+		List{Path: exact, Kind: Exact, Action: Block},
+		List{Path: suffix, Kind: Suffix, Action: Block},
+		List{Path: regex, Kind: Regex, Action: Block},
+		List{Path: allow, Kind: Suffix, Action: Allow},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("block", func(t *testing.T) {
+		cases := map[string]string{
+			"login-example.tld":          exact + ":2",
+			"evil.tld":                   suffix + ":1",
+			"www.evil.tld":               suffix + ":1",
+			"shop.xn--bcher-kva.example": suffix + ":2",
+			"paypa1.tld":                 regex + ":1",
+		}
+		for domain, source := range cases {
+			err := filter.Check(domain)
+			var rejected link_repository.DomainRejectedError
+			if !errors.As(err, &rejected) {
+				t.Errorf("%s should be blocked, got %v", domain, err)
+				continue
+			}
+			if rejected.Source != source {
+				t.Errorf("%s should be blocked by %s, got %s", domain, source, rejected.Source)
+			}
+		}
+
+		for _, domain := range []string{"example-login-example.tld", "notevil.tld", "paypal.tld"} {
+			if err := filter.Check(domain); err != nil {
+				t.Errorf("%s should be accepted, got %v", domain, err)
+			}
+		}
+	})
+
+	t.Run("allow", func(t *testing.T) {
+		writeList(t, allow, "company.tld\n")
+		//Ensure the change is noticed even on file systems with a coarse modification time
+		future := time.Now().Add(time.Minute)
+		if err := os.Chtimes(allow, future, future); err != nil {
+			t.Fatal(err)
+		}
+		if err := filter.Reload(); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := filter.Check("docs.company.tld"); err != nil {
+			t.Errorf("docs.company.tld should be allowed, got %v", err)
+		}
+		err := filter.Check("example.tld")
+		if !errors.Is(err, link_repository.ErrDomainRejected) {
+			t.Errorf("example.tld should be rejected for not being allowed, got %v", err)
+		}
+	})
+
+	t.Run("invalid list", func(t *testing.T) {
+		writeList(t, regex, "(\n")
+		if err := filter.Reload(); err == nil {
+			t.Error("An invalid regular expression should not be loaded")
+		}
+		if err := filter.Check("paypa1.tld"); err == nil {
+			t.Error("The previous rules should be kept when a list can't be loaded")
+		}
+	})
+}
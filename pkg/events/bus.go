@@ -0,0 +1,115 @@
+package events
+
+import (
+	"fmt"
+	"sync"
+)
+
+//Handler handles the events a subscriber is subscribed to
+//The events are published once the operation is done, so a handler can't undo it
+type Handler func(Event)
+
+//Bus delivers the events published by the repositories to their subscribers within the process
+//Publish and Wait can be called on a nil Bus, then the events are discarded
+type Bus struct {
+	//OnError is called with the panics of the handlers, if nil they are ignored
+	OnError func(error)
+
+	mutex         sync.RWMutex
+	subscriptions []*subscription
+	inFlight      sync.WaitGroup
+}
+
+type subscription struct {
+	handler Handler
+	names   map[string]bool
+	async   bool
+}
+
+//New creates an empty Bus
+func New() *Bus {
+	return &Bus{}
+}
+
+//Subscribe calls the handler with the events of the specified names, or with every event if none is specified
+//The handler runs before Publish returns, in the order the events are published, so it should be fast
+//The returned function cancels the subscription
+func (b *Bus) Subscribe(handler Handler, names ...string) (unsubscribe func()) {
+	return b.subscribe(handler, names, false)
+}
+
+//SubscribeAsync calls the handler with the events of the specified names, or with every event if none is specified
+//The handler runs in the background, once per event, so it could receive the events out of order
+//The returned function cancels the subscription
+func (b *Bus) SubscribeAsync(handler Handler, names ...string) (unsubscribe func()) {
+	return b.subscribe(handler, names, true)
+}
+
+//Publish delivers an event to its subscribers
+func (b *Bus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+	b.mutex.RLock()
+	subscriptions := b.subscriptions
+	b.mutex.RUnlock()
+
+	for _, sub := range subscriptions {
+		if len(sub.names) != 0 && !sub.names[event.Name()] {
+			continue
+		}
+		if !sub.async {
+			b.handle(sub.handler, event)
+			continue
+		}
+		b.inFlight.Add(1)
+		go func(handler Handler) {
+			defer b.inFlight.Done()
+			b.handle(handler, event)
+		}(sub.handler)
+	}
+}
+
+//Wait blocks until the asynchronous handlers of the events published so far return
+func (b *Bus) Wait() {
+	if b != nil {
+		b.inFlight.Wait()
+	}
+}
+
+func (b *Bus) subscribe(handler Handler, names []string, async bool) func() {
+	sub := &subscription{handler: handler, async: async}
+	if len(names) != 0 {
+		sub.names = make(map[string]bool, len(names))
+		for _, name := range names {
+			sub.names[name] = true
+		}
+	}
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	//The slice is copied so the publishers iterating the previous one are not affected
+	b.subscriptions = append(b.subscriptions[:len(b.subscriptions):len(b.subscriptions)], sub)
+
+	return func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		subscriptions := make([]*subscription, 0, len(b.subscriptions))
+		for _, current := range b.subscriptions {
+			if current != sub {
+				subscriptions = append(subscriptions, current)
+			}
+		}
+		b.subscriptions = subscriptions
+	}
+}
+
+//handle calls a handler, reporting its panic instead of propagating it to the publisher
+func (b *Bus) handle(handler Handler, event Event) {
+	defer func() {
+		if recovered := recover(); recovered != nil && b.OnError != nil {
+			b.OnError(fmt.Errorf("error handling the event %s:%v", event.Name(), recovered))
+		}
+	}()
+	handler(event)
+}
@@ -0,0 +1,71 @@
+package events
+
+import (
+	"github.com/nethruster/linksh/pkg/models"
+	"sync"
+	"testing"
+)
+
+func TestPublish(t *testing.T) {
+	bus := New()
+	var received []string
+	unsubscribe := bus.Subscribe(func(event Event) {
+		received = append(received, event.(LinkCreated).Link.ID)
+	}, LinkCreatedName)
+	var all []string
+	bus.Subscribe(func(event Event) { all = append(all, event.Name()) })
+
+	bus.Publish(LinkCreated{Link: models.Link{ID: "a"}})
+	bus.Publish(LinkDeleted{Link: models.Link{ID: "a"}})
+	bus.Publish(LinkCreated{Link: models.Link{ID: "b"}})
+	unsubscribe()
+	bus.Publish(LinkCreated{Link: models.Link{ID: "c"}})
+
+	if len(received) != 2 || received[0] != "a" || received[1] != "b" {
+		t.Errorf("Expected the links a and b, got %v", received)
+	}
+	if len(all) != 4 || all[1] != LinkDeletedName {
+		t.Errorf("Expected every event, got %v", all)
+	}
+
+	var nilBus *Bus
+	nilBus.Publish(LinkCreated{})
+	nilBus.Wait()
+}
+
+func TestPublishAsync(t *testing.T) {
+	bus := New()
+	var mutex sync.Mutex
+	hits := make(map[string]int)
+	bus.SubscribeAsync(func(event Event) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		hits[event.(LinkHit).Link.ID]++
+	}, LinkHitName)
+
+	for i := 0; i < 10; i++ {
+		bus.Publish(LinkHit{Link: models.Link{ID: "a"}})
+	}
+	bus.Publish(UserCreated{})
+	bus.Wait()
+	if hits["a"] != 10 {
+		t.Errorf("Expected 10 hits, got %d", hits["a"])
+	}
+}
+
+func TestHandlerPanic(t *testing.T) {
+	bus := New()
+	var errs []error
+	bus.OnError = func(err error) { errs = append(errs, err) }
+	bus.Subscribe(func(Event) { panic("broken") })
+	called := false
+	bus.Subscribe(func(Event) { called = true })
+
+	bus.Publish(SessionRevoked{})
+	if len(errs) != 1 {
+		t.Errorf("Expected the panic to be reported, got %v", errs)
+	}
+	if !called {
+		t.Error("A panic should not prevent the other handlers from running")
+	}
+}
@@ -0,0 +1,194 @@
+package events
+
+import "github.com/nethruster/linksh/pkg/models"
+
+//The names of the events, used to subscribe to them
+const (
+	LinkCreatedName          = "link.created"
+	LinkUpdatedName          = "link.updated"
+	LinkContentUpdatedName   = "link.content_updated"
+	LinkDeletedName          = "link.deleted"
+	LinkHitName              = "link.hit"
+	LinkTransferCreatedName  = "link_transfer.created"
+	LinkTransferResolvedName = "link_transfer.resolved"
+	QuotaUpdatedName         = "quota.updated"
+	QuotaResetName           = "quota.reset"
+	UserCreatedName          = "user.created"
+	UserUpdatedName          = "user.updated"
+	UserDeletedName          = "user.deleted"
+	SessionCreatedName       = "session.created"
+	SessionRevokedName       = "session.revoked"
+	AccessDeniedName         = "access.denied"
+)
+
+//Event is something that happened in a repository, the handlers tell them apart by their type
+type Event interface {
+	//Name returns the name used to subscribe to the event
+	Name() string
+}
+
+//Actor is who performed the operation of an event and for which request
+//The ID is empty for the operations performed by the instance itself
+type Actor struct {
+	ID      string
+	Request models.RequestMetadata
+}
+
+//LinkCreated is published when a link is created or restored from the trash
+type LinkCreated struct {
+	Link models.Link
+	//Restored tells whether the link was restored from the trash
+	Restored bool
+	Actor    Actor
+}
+
+//Name implements Event
+func (LinkCreated) Name() string { return LinkCreatedName }
+
+//LinkUpdated is published when the settings, the aliases or the owner of a link change
+//The changes of the content are published as a LinkContentUpdated instead
+type LinkUpdated struct {
+	//Link is the link as read after the update
+	Link     models.Link
+	Previous models.Link
+	Actor    Actor
+}
+
+//Name implements Event
+func (LinkUpdated) Name() string { return LinkUpdatedName }
+
+//LinkContentUpdated is published when the content of a link changes, including when a previous version is restored
+type LinkContentUpdated struct {
+	//Link is the link with its new content
+	Link            models.Link
+	PreviousContent string
+	Actor           Actor
+}
+
+//Name implements Event
+func (LinkContentUpdated) Name() string { return LinkContentUpdatedName }
+
+//LinkDeleted is published when a link is moved to the trash
+type LinkDeleted struct {
+	Link  models.Link
+	Actor Actor
+}
+
+//Name implements Event
+func (LinkDeleted) Name() string { return LinkDeletedName }
+
+//LinkHit is published when a visit to a link is counted
+type LinkHit struct {
+	//Link is the link as read before counting the visit
+	Link models.Link
+	//Variant and Rule are the variant and the rule that counted the visit, if any
+	Variant string
+	Rule    string
+}
+
+//Name implements Event
+func (LinkHit) Name() string { return LinkHitName }
+
+//LinkTransferCreated is published when a link transfer is requested, or saved as completed when an admin transfers the links directly
+//The changes of the owners of the links are published as a LinkUpdated for each one
+type LinkTransferCreated struct {
+	Transfer models.LinkTransfer
+	Actor    Actor
+}
+
+//Name implements Event
+func (LinkTransferCreated) Name() string { return LinkTransferCreatedName }
+
+//LinkTransferResolved is published when a pending link transfer is accepted or rejected
+type LinkTransferResolved struct {
+	//Transfer is the transfer with its new status and resolution time
+	Transfer models.LinkTransfer
+	Actor    Actor
+}
+
+//Name implements Event
+func (LinkTransferResolved) Name() string { return LinkTransferResolvedName }
+
+//QuotaUpdated is published when the quota of an user is set
+type QuotaUpdated struct {
+	Quota models.UserQuota
+	//Previous is the quota set before, or the zero value if the one of the role applied
+	Previous models.UserQuota
+	Actor    Actor
+}
+
+//Name implements Event
+func (QuotaUpdated) Name() string { return QuotaUpdatedName }
+
+//QuotaReset is published when the quota set for an user is removed, so the one of its role applies again
+type QuotaReset struct {
+	//Quota is the removed quota
+	Quota models.UserQuota
+	Actor Actor
+}
+
+//Name implements Event
+func (QuotaReset) Name() string { return QuotaResetName }
+
+//UserCreated is published when an user is created or restored from the trash
+type UserCreated struct {
+	User models.User
+	//Restored tells whether the user was restored from the trash
+	Restored bool
+	Actor    Actor
+}
+
+//Name implements Event
+func (UserCreated) Name() string { return UserCreatedName }
+
+//UserUpdated is published when an user changes
+type UserUpdated struct {
+	//User is the user as read after the update
+	User     models.User
+	Previous models.User
+	//PasswordChanged tells whether the password was changed, as the users carry no password out of the storage
+	PasswordChanged bool
+	Actor           Actor
+}
+
+//Name implements Event
+func (UserUpdated) Name() string { return UserUpdatedName }
+
+//UserDeleted is published when an user is moved to the trash
+type UserDeleted struct {
+	User  models.User
+	Actor Actor
+}
+
+//Name implements Event
+func (UserDeleted) Name() string { return UserDeletedName }
+
+//SessionCreated is published when an user logs in
+type SessionCreated struct {
+	Session models.Session
+	Actor   Actor
+}
+
+//Name implements Event
+func (SessionCreated) Name() string { return SessionCreatedName }
+
+//SessionRevoked is published when a session is deleted before it expires
+type SessionRevoked struct {
+	Session models.Session
+	Actor   Actor
+}
+
+//Name implements Event
+func (SessionRevoked) Name() string { return SessionRevokedName }
+
+//AccessDenied is published when an user lacks the privileges to perform an operation
+type AccessDenied struct {
+	Action     models.AuditAction
+	TargetType models.AuditTargetType
+	//TargetID is empty for the operations over several elements, like the listings
+	TargetID string
+	Actor    Actor
+}
+
+//Name implements Event
+func (AccessDenied) Name() string { return AccessDeniedName }
@@ -0,0 +1,207 @@
+package healthcheck
+
+import (
+	"errors"
+	"fmt"
+	sto "github.com/nethruster/linksh/pkg/interfaces/storage"
+	"github.com/nethruster/linksh/pkg/models"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	//DefaultTimeout is the time a check waits for a response
+	DefaultTimeout = 10 * time.Second
+	//DefaultBatchSize is the number of links loaded from the storage at once
+	DefaultBatchSize = 100
+	//DefaultConcurrency is the number of links checked in parallel
+	DefaultConcurrency = 4
+)
+
+//Checker periodically requests the content of every link and records the result as the health of the link
+//The zero values of its settings use the defaults
+type Checker struct {
+	Storage sto.IStorage
+	//Client makes the requests of the checks, if nil a client with the DefaultTimeout is used
+	Client *http.Client
+	//BatchSize is the number of links loaded from the storage at once
+	BatchSize uint
+	//Concurrency is the number of links checked in parallel
+	Concurrency uint
+	//OnError is called with the errors found while checking the links in the background, if nil they are ignored
+	OnError func(error)
+
+	//now returns the current time, if nil time.Now is used
+	now func() time.Time
+}
+
+var defaultClient = &http.Client{Timeout: DefaultTimeout}
+
+//New creates a Checker with the default settings
+func New(storage sto.IStorage) *Checker {
+	return &Checker{
+		Storage:     storage,
+		Client:      &http.Client{Timeout: DefaultTimeout},
+		BatchSize:   DefaultBatchSize,
+		Concurrency: DefaultConcurrency,
+		now:         time.Now,
+	}
+}
+
+//Start checks all the links every interval in the background
+//The returned function stops the checks
+func (c *Checker) Start(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if err := c.CheckAll(); err != nil && c.OnError != nil {
+				c.OnError(err)
+			}
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+//CheckAll checks every link in the storage and saves the results
+//The links that are not http or https URLs are skipped, as well as the prefix links, whose content is a template
+func (c *Checker) CheckAll() error {
+	links := make(chan models.Link)
+	errs := make(chan error, 1)
+	var wg sync.WaitGroup
+	concurrency := c.Concurrency
+	if concurrency == 0 {
+		concurrency = DefaultConcurrency
+	}
+	for i := uint(0); i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for link := range links {
+				err := c.Storage.UpdateLinkHealth(link.ID, link.Content, c.Check(link.Content))
+				//The content changed or the link was deleted during the check, the result is outdated
+				if errors.As(err, &sto.ConflictError{}) || errors.As(err, &sto.NotFoundError{}) {
+					err = nil
+				}
+				if err != nil {
+					select {
+					case errs <- fmt.Errorf("error saving the health of the link with id \"%s\":%w", link.ID, err):
+					default:
+					}
+				}
+			}
+		}()
+	}
+
+	batchSize := c.BatchSize
+	if batchSize == 0 {
+		batchSize = DefaultBatchSize
+	}
+	var err error
+	//The links are paged by ID, so the ones created during the run don't shift the pages
+	for afterID := ""; ; {
+		var batch []models.Link
+		batch, err = c.Storage.ListLinksAfter(afterID, batchSize)
+		if err != nil {
+			break
+		}
+		for _, link := range batch {
+			if link.Type != models.LinkTypePrefix && isCheckable(link.Content) {
+				links <- link
+			}
+		}
+		if uint(len(batch)) < batchSize {
+			break
+		}
+		afterID = batch[len(batch)-1].ID
+	}
+	close(links)
+	wg.Wait()
+
+	if err != nil {
+		return err
+	}
+	select {
+	case err = <-errs:
+		return err
+	default:
+		return nil
+	}
+}
+
+//Check requests the content and returns its health
+//It tries a HEAD request first and falls back to GET for the servers that don't support it
+//The content is dead if it can't be reached, or the server answers with a 404, a 410 or a 5XX status
+func (c *Checker) Check(content string) models.LinkHealth {
+	now := time.Now
+	if c.now != nil {
+		now = c.now
+	}
+	health := models.LinkHealth{CheckedAt: now().Unix()}
+
+	response, err := c.request(http.MethodHead, content)
+	if err == nil && (response.StatusCode == http.StatusMethodNotAllowed || response.StatusCode == http.StatusNotImplemented) {
+		response, err = c.request(http.MethodGet, content)
+	}
+	if err != nil {
+		health.Dead = true
+		health.Error = err.Error()
+		return health
+	}
+
+	health.StatusCode = response.StatusCode
+	health.FinalURL = response.Request.URL.String()
+	health.Dead = response.StatusCode == http.StatusNotFound ||
+		response.StatusCode == http.StatusGone ||
+		response.StatusCode >= http.StatusInternalServerError
+	health.HostChanged = !sameHost(content, response.Request.URL)
+	return health
+}
+
+func (c *Checker) request(method, content string) (*http.Response, error) {
+	request, err := http.NewRequest(method, content, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("User-Agent", "linksh-healthcheck")
+
+	client := c.Client
+	if client == nil {
+		client = defaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	response.Body.Close()
+	return response, nil
+}
+
+func isCheckable(content string) bool {
+	return strings.HasPrefix(content, "http://") || strings.HasPrefix(content, "https://")
+}
+
+//sameHost returns if the final URL is in the same host as the content, a www. prefix is ignored
+func sameHost(content string, final *url.URL) bool {
+	original, err := url.Parse(content)
+	if err != nil {
+		return false
+	}
+	trim := func(host string) string {
+		return strings.TrimPrefix(strings.ToLower(host), "www.")
+	}
+	return trim(original.Hostname()) == trim(final.Hostname())
+}
@@ -0,0 +1,196 @@
+package healthcheck
+
+import (
+	"fmt"
+	istorage "github.com/nethruster/linksh/pkg/interfaces/storage"
+	"github.com/nethruster/linksh/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+//fakeStorage implements the link methods of IStorage used by the checker
+type fakeStorage struct {
+	istorage.IStorage
+	mutex  sync.Mutex
+	links  []models.Link
+	health map[string]models.LinkHealth
+}
+
+func (fs *fakeStorage) ListLinksAfter(afterID string, limit uint) ([]models.Link, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	sort.Slice(fs.links, func(i, j int) bool { return fs.links[i].ID < fs.links[j].ID })
+	var links []models.Link
+	for _, link := range fs.links {
+		if link.ID > afterID && (limit == 0 || uint(len(links)) < limit) {
+			links = append(links, link)
+		}
+	}
+	return links, nil
+}
+
+func (fs *fakeStorage) UpdateLinkHealth(id, content string, health models.LinkHealth) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	for _, link := range fs.links {
+		if link.ID != id {
+			continue
+		}
+		if link.Content != content {
+			return istorage.NewConflictError("links", id)
+		}
+		fs.health[id] = health
+		return nil
+	}
+	return istorage.NewNotFoundError("links", "id", id)
+}
+
+func (fs *fakeStorage) setContent(id, content string) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	for i := range fs.links {
+		if fs.links[i].ID == id {
+			fs.links[i].Content = content
+		}
+	}
+}
+
+func TestChecker(t *testing.T) {
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer other.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/ok":
+			w.WriteHeader(http.StatusOK)
+		case "/get-only":
+			if r.Method != http.MethodGet {
+				w.WriteHeader(http.StatusMethodNotAllowed)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		case "/moved":
+			http.Redirect(w, r, "/ok", http.StatusMovedPermanently)
+		case "/elsewhere":
+			http.Redirect(w, r, strings.Replace(other.URL, "127.0.0.1", "localhost", 1)+"/landing", http.StatusFound)
+		case "/gone":
+			w.WriteHeader(http.StatusGone)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	storage := &fakeStorage{
+		links: []models.Link{
+			{ID: "ok", Content: server.URL + "/ok"},
+			{ID: "getOnly", Content: server.URL + "/get-only"},
+			{ID: "moved", Content: server.URL + "/moved"},
+			{ID: "elsewhere", Content: server.URL + "/elsewhere"},
+			{ID: "gone", Content: server.URL + "/gone"},
+			{ID: "missing", Content: server.URL + "/missing"},
+			{ID: "unreachable", Content: "http://127.0.0.1:1/"},
+			{ID: "mail", Content: "mailto:someone@example.tld"},
+			{ID: "prefix", Type: models.LinkTypePrefix, Content: server.URL + "/{path}"},
+		},
+		health: make(map[string]models.LinkHealth),
+	}
+	checker := New(storage)
+	checker.BatchSize = 3
+
+	if err := checker.CheckAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string]struct {
+		statusCode  int
+		dead        bool
+		hostChanged bool
+	}{
+		"ok":          {http.StatusOK, false, false},
+		"getOnly":     {http.StatusOK, false, false},
+		"moved":       {http.StatusOK, false, false},
+		"elsewhere":   {http.StatusOK, false, true},
+		"gone":        {http.StatusGone, true, false},
+		"missing":     {http.StatusNotFound, true, false},
+		"unreachable": {0, true, false},
+	}
+	for id, expected := range cases {
+		health, ok := storage.health[id]
+		if !ok {
+			t.Errorf("The link %s was not checked", id)
+			continue
+		}
+		if health.StatusCode != expected.statusCode || health.Dead != expected.dead || health.HostChanged != expected.hostChanged {
+			t.Errorf("The health of the link %s was not the expected %+v", id, health)
+		}
+		if health.CheckedAt == 0 {
+			t.Errorf("The check time of the link %s was not recorded", id)
+		}
+	}
+	if health := storage.health["moved"]; health.FinalURL != server.URL+"/ok" {
+		t.Errorf("The final URL of the redirect was not recorded, got %s", health.FinalURL)
+	}
+	if _, ok := storage.health["mail"]; ok {
+		t.Error("The mailto links should not be checked")
+	}
+	if _, ok := storage.health["prefix"]; ok {
+		t.Error("The prefix links should not be checked")
+	}
+}
+
+func TestCheckerKeepsChangedContents(t *testing.T) {
+	var storage *fakeStorage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		//The link is edited while its old content is being checked
+		storage.setContent("edited", "https://example.tld")
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	storage = &fakeStorage{
+		links:  []models.Link{{ID: "edited", Content: server.URL}},
+		health: make(map[string]models.LinkHealth),
+	}
+	if err := New(storage).CheckAll(); err != nil {
+		t.Fatal(err)
+	}
+	if health, ok := storage.health["edited"]; ok {
+		t.Errorf("The health of the old content was saved over the new content: %+v", health)
+	}
+}
+
+func TestCheckerPagesByID(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	storage := &fakeStorage{health: make(map[string]models.LinkHealth)}
+	for i := 0; i < 7; i++ {
+		storage.links = append(storage.links, models.Link{ID: fmt.Sprintf("link%d", i), Content: server.URL})
+	}
+	//The zero value Checker must work with the default settings
+	checker := &Checker{Storage: storage}
+	if err := checker.CheckAll(); err != nil {
+		t.Fatal(err)
+	}
+	if len(storage.health) != len(storage.links) {
+		t.Errorf("Expected %d checked links, got %d", len(storage.links), len(storage.health))
+	}
+
+	storage.health = make(map[string]models.LinkHealth)
+	checker.BatchSize = 3
+	if err := checker.CheckAll(); err != nil {
+		t.Fatal(err)
+	}
+	if len(storage.health) != len(storage.links) {
+		t.Errorf("Expected %d checked links with batches of 3, got %d", len(storage.links), len(storage.health))
+	}
+}
@@ -0,0 +1,42 @@
+package idgen
+
+import (
+	sto "github.com/nethruster/linksh/pkg/interfaces/storage"
+)
+
+const base62Alphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+//Counter implements IDGenerator with sequential IDs, the base62 encoding of a counter kept in the storage
+//The counter is shared by all the instances using the same storage and name
+type Counter struct {
+	Storage sto.IStorage
+	//Name identifies the counter in the storage
+	Name string
+	//Offset is added to the counter, so the first IDs are not too short
+	Offset uint64
+}
+
+//Generate increases the counter and returns its value as the new ID
+func (c *Counter) Generate() (string, error) {
+	value, err := c.Storage.IncreaseCounter(c.Name)
+	if err != nil {
+		return "", err
+	}
+
+	return encodeBase62(value + c.Offset), nil
+}
+
+func encodeBase62(value uint64) string {
+	if value == 0 {
+		return base62Alphabet[:1]
+	}
+
+	var encoded []byte
+	for ; value > 0; value /= 62 {
+		encoded = append(encoded, base62Alphabet[value%62])
+	}
+	for i, j := 0, len(encoded)-1; i < j; i, j = i+1, j-1 {
+		encoded[i], encoded[j] = encoded[j], encoded[i]
+	}
+	return string(encoded)
+}
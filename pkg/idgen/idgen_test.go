@@ -0,0 +1,93 @@
+package idgen
+
+import (
+	istorage "github.com/nethruster/linksh/pkg/interfaces/storage"
+	"strings"
+	"testing"
+)
+
+//fakeStorage implements the counter methods of IStorage
+type fakeStorage struct {
+	istorage.IStorage
+	counters map[string]uint64
+}
+
+func (fs *fakeStorage) IncreaseCounter(name string) (uint64, error) {
+	fs.counters[name]++
+	return fs.counters[name], nil
+}
+
+func TestNanoid(t *testing.T) {
+	t.Run("default", func(t *testing.T) {
+		id, err := (&Nanoid{}).Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(id) != DefaultLength {
+			t.Errorf("Expected an ID of length %v, got %q", DefaultLength, id)
+		}
+	})
+
+	t.Run("lookalike free", func(t *testing.T) {
+		generator := NewLookalikeFree(50)
+		for i := 0; i < 20; i++ {
+			id, err := generator.Generate()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(id) != 50 {
+				t.Errorf("Expected an ID of length 50, got %q", id)
+			}
+			if strings.ContainsAny(id, "0Oo1lI") {
+				t.Errorf("The ID %q contains lookalike characters", id)
+			}
+		}
+	})
+}
+
+func TestCounter(t *testing.T) {
+	storage := &fakeStorage{counters: make(map[string]uint64)}
+	generator := &Counter{Storage: storage, Name: "links", Offset: 60}
+
+	for _, expected := range []string{"Z", "10", "11"} {
+		id, err := generator.Generate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != expected {
+			t.Errorf("Expected the ID %q, got %q", expected, id)
+		}
+	}
+
+	if encoded := encodeBase62(0); encoded != "0" {
+		t.Errorf("Expected 0 to be encoded as \"0\", got %q", encoded)
+	}
+	if encoded := encodeBase62(62*62 - 1); encoded != "ZZ" {
+		t.Errorf("Expected 3843 to be encoded as \"ZZ\", got %q", encoded)
+	}
+}
+
+func TestWords(t *testing.T) {
+	generator := &Words{List: []string{"a", "b"}, Count: 3, Separator: "."}
+	id, err := generator.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(id, ".")
+	if len(parts) != 3 {
+		t.Fatalf("Expected 3 words, got %q", id)
+	}
+	for _, part := range parts {
+		if part != "a" && part != "b" {
+			t.Errorf("The word %q is not in the list", part)
+		}
+	}
+
+	id, err = (&Words{}).Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(id, "-") != 1 {
+		t.Errorf("Expected two words separated by a hyphen, got %q", id)
+	}
+}
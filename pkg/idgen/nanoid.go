@@ -0,0 +1,56 @@
+package idgen
+
+import (
+	gonanoid "github.com/matoous/go-nanoid"
+	"sync"
+)
+
+const (
+	//DefaultLength is the length of the IDs generated by a Nanoid without a length
+	DefaultLength = 7
+	//DefaultAlphabet is the alphabet used by a Nanoid without an alphabet
+	DefaultAlphabet = "_-0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	//LookalikeFreeAlphabet is an alphabet without the characters easily mistaken for others, like 0, O, o, 1, l or I
+	LookalikeFreeAlphabet = "23456789abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ"
+)
+
+//Nanoid implements GrowableIDGenerator with random IDs of a fixed length
+type Nanoid struct {
+	//Length is the length of the IDs, if 0 DefaultLength is used
+	Length int
+	//Alphabet contains the characters of the IDs, if empty DefaultAlphabet is used
+	Alphabet string
+
+	mutex sync.RWMutex
+}
+
+//NewLookalikeFree creates a Nanoid whose IDs don't contain characters easily mistaken for others
+func NewLookalikeFree(length int) *Nanoid {
+	return &Nanoid{Length: length, Alphabet: LookalikeFreeAlphabet}
+}
+
+//Generate returns a new random ID
+func (n *Nanoid) Generate() (string, error) {
+	n.mutex.RLock()
+	length := n.Length
+	n.mutex.RUnlock()
+	if length == 0 {
+		length = DefaultLength
+	}
+	alphabet := n.Alphabet
+	if alphabet == "" {
+		alphabet = DefaultAlphabet
+	}
+
+	return gonanoid.Generate(alphabet, length)
+}
+
+//Grow makes the following IDs one character longer
+func (n *Nanoid) Grow() {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if n.Length == 0 {
+		n.Length = DefaultLength
+	}
+	n.Length++
+}
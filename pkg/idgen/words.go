@@ -0,0 +1,87 @@
+package idgen
+
+import (
+	"crypto/rand"
+	"math/big"
+	"strings"
+	"sync"
+)
+
+const defaultWordCount = 2
+
+//DefaultWordList is the list of short and easy to pronounce words used by a Words without a list
+var DefaultWordList = []string{
+	"able", "acid", "aged", "also", "area", "army", "away", "baby", "back", "bald", "band", "bank",
+	"base", "bath", "bear", "beat", "bell", "belt", "best", "bird", "blue", "boat", "body", "bold",
+	"bone", "book", "boot", "born", "boss", "both", "bowl", "busy", "cake", "calm", "camp", "card",
+	"care", "cart", "case", "cash", "cast", "cave", "chef", "chip", "city", "clay", "coal", "coat",
+	"code", "cold", "cook", "cool", "copy", "corn", "cozy", "crew", "crop", "cube", "cute", "dark",
+	"dawn", "deal", "deep", "deer", "desk", "dish", "dock", "dove", "down", "draw", "drum", "duck",
+	"dune", "dusk", "east", "easy", "echo", "edge", "epic", "even", "exit", "face", "fair", "fame",
+	"farm", "fast", "fern", "film", "fine", "fire", "firm", "fish", "five", "flag", "flat", "foam",
+	"fold", "folk", "fond", "food", "fork", "form", "fort", "fox", "free", "frog", "full", "fuzzy",
+	"gale", "game", "gift", "glad", "glow", "goat", "gold", "golf", "good", "gray", "grid", "grin",
+	"half", "hall", "hand", "hare", "harp", "hawk", "heat", "herb", "hero", "high", "hill", "hint",
+	"home", "hope", "horn", "huge", "idea", "iron", "jade", "jazz", "jolly", "jump", "kale", "keen",
+	"kind", "king", "kite", "kiwi", "lake", "lamp", "land", "last", "lava", "lazy", "leaf", "lime",
+	"line", "lion", "live", "loud", "luck", "lush", "main", "mango", "maple", "mars", "mild", "mint",
+	"mist", "moon", "moss", "mute", "navy", "neat", "nest", "next", "nice", "note", "nova", "oak",
+	"oasis", "ocean", "olive", "open", "oval", "owl", "palm", "park", "path", "peak", "pear", "pine",
+	"pink", "plum", "pond", "pony", "pure", "quick", "quiet", "rain", "rare", "raven", "real", "reef",
+	"rich", "ring", "river", "road", "rock", "roof", "rose", "ruby", "rush", "safe", "sage", "sail",
+	"salt", "sand", "seal", "seed", "shy", "silk", "sing", "slow", "snow", "soft", "solar", "song",
+	"soup", "star", "stone", "sun", "swan", "tall", "teal", "tide", "tidy", "tiger", "toad", "tree",
+	"true", "tulip", "tuna", "vast", "warm", "wave", "west", "wide", "wild", "wind", "wise", "wolf",
+	"wood", "yarn", "yeti", "zany", "zebra", "zinc", "zone",
+}
+
+//Words implements GrowableIDGenerator with IDs made of random words, like "bold-fox"
+type Words struct {
+	//List contains the words to choose from, if empty DefaultWordList is used
+	List []string
+	//Count is the number of words of each ID, if 0 two words are used
+	Count int
+	//Separator is placed between the words, if empty a hyphen is used
+	Separator string
+
+	mutex sync.RWMutex
+}
+
+//Generate returns a new ID made of random words
+func (w *Words) Generate() (string, error) {
+	list := w.List
+	if len(list) == 0 {
+		list = DefaultWordList
+	}
+	w.mutex.RLock()
+	count := w.Count
+	w.mutex.RUnlock()
+	if count == 0 {
+		count = defaultWordCount
+	}
+	separator := w.Separator
+	if separator == "" {
+		separator = "-"
+	}
+
+	max := big.NewInt(int64(len(list)))
+	chosen := make([]string, count)
+	for i := range chosen {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		chosen[i] = list[n.Int64()]
+	}
+	return strings.Join(chosen, separator), nil
+}
+
+//Grow adds another word to the following IDs
+func (w *Words) Grow() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.Count == 0 {
+		w.Count = defaultWordCount
+	}
+	w.Count++
+}
@@ -0,0 +1,24 @@
+package audit_repository
+
+import (
+	"github.com/nethruster/linksh/pkg/models"
+	"io"
+)
+
+//IAuditRepository represents all the possible actions performed over the audit log
+//The records are appended by the other repositories, they can't be modified nor deleted
+//The methods with the suffix 'ByUser' will only be perform if the requester is an admin, if not an pkg/interfaces/user_repository.ErrForbidden would be returned
+type IAuditRepository interface {
+	//List lists the audit records selected by the filter, the oldest first
+	//If the limit is set to 0, no limit will be established, the same applies to the offset
+	List(filter models.AuditFilter, limit, offset uint) ([]models.AuditRecord, error)
+	//Export writes the audit records selected by the filter to the writer as JSON Lines, the oldest first
+	Export(w io.Writer, filter models.AuditFilter) error
+	//ListByUser lists the audit records selected by the filter, the oldest first
+	//If the limit is set to 0, no limit will be established, the same applies to the offset
+	//The requester must be an admin to perform this action
+	ListByUser(requesterID string, filter models.AuditFilter, limit, offset uint) ([]models.AuditRecord, error)
+	//ExportByUser writes the audit records selected by the filter to the writer as JSON Lines, the oldest first
+	//The requester must be an admin to perform this action
+	ExportByUser(requesterID string, w io.Writer, filter models.AuditFilter) error
+}
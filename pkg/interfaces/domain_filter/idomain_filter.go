@@ -0,0 +1,9 @@
+package domain_filter
+
+//IDomainFilter decides which domains can be the target of a link
+type IDomainFilter interface {
+	//Check returns nil if links can point to the domain
+	//The domain must be lowercased and in punycode
+	//If the domain is rejected a pkg/interfaces/link_repository.DomainRejectedError would be returned
+	Check(domain string) error
+}
@@ -0,0 +1,15 @@
+package id_generator
+
+//IDGenerator generates the IDs assigned to the links created without one
+type IDGenerator interface {
+	//Generate returns a new ID
+	//The IDs are not guaranteed to be unique, so the storage will still check for conflicts
+	Generate() (string, error)
+}
+
+//GrowableIDGenerator is an IDGenerator whose IDs can be made longer when they collide too often
+type GrowableIDGenerator interface {
+	IDGenerator
+	//Grow makes the following IDs longer, enlarging the space of possible IDs
+	Grow()
+}
@@ -1,12 +1,130 @@
 package link_repository
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+)
 
 var (
 	//ErrInvalidID is returned when the provided username doesn't accomplish the requirements of models.Link.ID
+	//It is usually wrapped in an InvalidIDError explaining the reason
 	ErrInvalidID = errors.New("Invalid ID")
 	//ErrInvalidContent is returned when the provided content doesn't accomplish the requirements of models.Link.Content
+	//It is usually wrapped in an InvalidContentError explaining the reason
 	ErrInvalidContent = errors.New("Invalid content")
+	//ErrInvalidType is returned when the provided type is not one of the models.LinkType values
+	ErrInvalidType = errors.New("Invalid type")
+	//ErrInvalidQueryPassthrough is returned when the provided query passthrough is not one of the models.QueryPassthrough values
+	ErrInvalidQueryPassthrough = errors.New("Invalid query passthrough")
+	//ErrInvalidRedirectMode is returned when the redirect mode is not one of the defined in pkg/models
+	ErrInvalidRedirectMode = errors.New("Invalid redirect mode")
+	//ErrInvalidVariants is returned when any of the variants has an empty, too long or repeated name or a weight of 0
+	//The contents of the variants produce an ErrInvalidContent instead
+	ErrInvalidVariants = errors.New("Invalid variants")
+	//ErrInvalidRules is returned when any of the rules has an empty, too long or repeated name or no valid platforms
+	//The contents of the rules produce an ErrInvalidContent instead
+	ErrInvalidRules = errors.New("Invalid rules")
+	//ErrInvalidRotation is returned when the rotation is not one of the defined in pkg/models
+	ErrInvalidRotation = errors.New("Invalid rotation")
+	//ErrInvalidSchedule is returned when the link would deactivate before activating
+	ErrInvalidSchedule = errors.New("Invalid schedule")
+	//ErrInvalidUTM is returned when any of the provided UTM tags is longer than 200 characters
+	ErrInvalidUTM = errors.New("Invalid UTM tags")
 	//ErrForbidden is returned when an ser user request to perform an action without enough privileges
 	ErrForbidden = errors.New("Forbidden")
+	//ErrInvalidTransfer is returned when a link transfer has no links or its recipient already owns them
+	ErrInvalidTransfer = errors.New("Invalid transfer")
+	//ErrTransferNotPending is returned when trying to accept or reject a link transfer that was already resolved
+	ErrTransferNotPending = errors.New("The transfer is not pending")
+	//ErrAliasID is returned when trying to delete a link through one of its aliases, which are removed with RemoveAlias instead
+	ErrAliasID = errors.New("The ID is an alias")
+	//ErrDomainRejected is returned when the domain of the content is blocked or not allowed
+	//It is usually wrapped in a DomainRejectedError explaining the reason
+	ErrDomainRejected = errors.New("Domain rejected")
 )
+
+//ErrQuotaExceeded is returned when creating a link or receiving a transfer would exceed the quota of the user
+type ErrQuotaExceeded struct {
+	//UserID is the ID of the user whose quota was exceeded
+	UserID string
+	//Limit is the name of the exceeded limit, it can be "links" or "links per day"
+	Limit string
+	//Max is the value of the exceeded limit
+	Max uint
+}
+
+func (err ErrQuotaExceeded) Error() string {
+	return fmt.Sprintf("The user %s has reached its quota of %d %s", err.UserID, err.Max, err.Limit)
+}
+
+//InvalidIDError is an ErrInvalidID describing why the ID was rejected
+type InvalidIDError struct {
+	ID     string
+	Reason string
+}
+
+func (err InvalidIDError) Error() string {
+	return fmt.Sprintf("Invalid ID %q: %s", err.ID, err.Reason)
+}
+
+//Unwrap allows to check an InvalidIDError against ErrInvalidID
+func (err InvalidIDError) Unwrap() error {
+	return ErrInvalidID
+}
+
+//InvalidContentError is an ErrInvalidContent describing why the content was rejected
+type InvalidContentError struct {
+	Content string
+	Reason  string
+}
+
+func (err InvalidContentError) Error() string {
+	return fmt.Sprintf("Invalid content %q: %s", err.Content, err.Reason)
+}
+
+//Unwrap allows to check an InvalidContentError against ErrInvalidContent
+func (err InvalidContentError) Unwrap() error {
+	return ErrInvalidContent
+}
+
+//DomainRejectedError is an ErrDomainRejected describing which rule rejected the domain
+type DomainRejectedError struct {
+	Domain string
+	//Rule is the rule that blocked the domain, it is empty when the domain was rejected for not matching any allow rule
+	Rule string
+	//Source is where the rule was defined
+	Source string
+}
+
+func (err DomainRejectedError) Error() string {
+	if err.Rule == "" {
+		return fmt.Sprintf("The domain %s is not allowed by any rule", err.Domain)
+	}
+	return fmt.Sprintf("The domain %s is blocked by the rule %q at %s", err.Domain, err.Rule, err.Source)
+}
+
+//Unwrap allows to check a DomainRejectedError against ErrDomainRejected
+func (err DomainRejectedError) Unwrap() error {
+	return ErrDomainRejected
+}
+
+//UnknownIDError is returned when resolving an ID that matches no link, carrying the existing IDs closest to it
+//It wraps the pkg/interfaces/storage.NotFoundError of the storage
+type UnknownIDError struct {
+	ID string
+	//Suggestions are the closest existing IDs, the closest first, it can be empty
+	Suggestions []string
+	Err         error
+}
+
+func (err UnknownIDError) Error() string {
+	if len(err.Suggestions) == 0 {
+		return fmt.Sprintf("Unknown ID %q", err.ID)
+	}
+	return fmt.Sprintf("Unknown ID %q, did you mean %q?", err.ID, err.Suggestions[0])
+}
+
+//Unwrap allows to check an UnknownIDError against the error of the storage
+func (err UnknownIDError) Unwrap() error {
+	return err.Err
+}
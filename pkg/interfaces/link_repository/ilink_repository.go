@@ -6,32 +6,130 @@ import "github.com/nethruster/linksh/pkg/models"
 //The implementations of this interface will not be attached to an specific storage
 //The methods with the suffix 'ByUser' will only be perform if the requester has enough privileges, if not an pkg/interfaces/user_repository.ErrForbidden would be returned
 type ILinkRepository interface {
+	//WithRequest returns a view of the repository recording the metadata of the request in the audit log
+	//The operations of the view are recorded as performed for the request, and the ones of the methods with the suffix 'ByUser' by the requester
+	WithRequest(request models.RequestMetadata) ILinkRepository
 	//Create creates a link and save it to the storage
 	//This methods will permorn validations over the provided data
-	//If the id is left blank, a random one would be assigned
-	//The data validations in this method can produce an ErrInvalidID or an ErrInvalidContent
-	Create(id, content, ownerID string) (models.Link, error)
-	//Get returns the link with specified ID from the storage
+	//If the id is left blank, a random one would be assigned, retrying with another one if it was already in use
+	//The content is validated as set by the type of the link, so the prefix links can use placeholders
+	//The data validations in this method can produce an ErrInvalidID, an ErrInvalidType or an ErrInvalidContent
+	//The ID is rejected if it is reserved or contains characters not allowed, and if the IDs are case insensitive it is saved lowercased
+	//The content is saved normalized, with its host lowercased and in punycode
+	//If the domain of the content is rejected by the domain filter an ErrDomainRejected would be returned
+	//If the owner has reached its quota an ErrQuotaExceeded would be returned
+	//The content is recorded as the first version of the link, with the owner as its editor
+	Create(id, content, ownerID string, linkType models.LinkType) (models.Link, error)
+	//Get returns the link with specified ID or alias from the storage
 	//If the link does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
 	Get(id string) (models.Link, error)
 	//GetContentAndIncreaseHitCount return the link content and increases the hits number of a link in the storage
-	//If the link does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
+	//The ID is resolved as a visit without query, so the content is the target returned by Resolve, like the expanded template of the prefix links
+	//Outside of its activation window the fallback of the link is returned instead, counted apart from its hits
+	//The unknown IDs, and the links outside of their window without a fallback, return the fallback of the owner or the one of the instance
+	//If there is no fallback an error pkg/interfaces/storage.NotFoundError would be returned
 	GetContentAndIncreaseHitCount(id string) (string, error)
+	//Resolve finds the link matching the requested path, increases its hits number and returns where the visitor must be sent
+	//The link whose ID equals the path is preferred, otherwise the prefix link with the longest ID matching the start of the path is used
+	//The query and the fragment of the visit are merged into the target as set by the query passthrough of the link
+	//The UTM tags of the link, completed with the ones of its owner, are appended to the target unless it already has them
+	//Outside of its activation window the visitor is sent to the fallback of the link, counted apart from its hits
+	//The unknown IDs, and the links outside of their window without a fallback, are sent to the fallback of the owner or to the one of the instance
+	//The fallback hits of the owners and the instance are counted apart too
+	//The first rule of the link matching the user agent of the visit provides the target, and the hit is also attributed to it
+	//Otherwise, when the link has variants one of them is chosen as set by its rotation, and the hit is also attributed to it
+	//The resolution carries the redirect mode of the link
+	//If no link matches the path and there is no fallback an error pkg/interfaces/storage.NotFoundError would be returned
+	//It may be wrapped in an UnknownIDError with the closest existing IDs, so the visitor can pick one or create the link
+	Resolve(request ResolveRequest) (Resolution, error)
+	//SuggestIDs returns up to limit existing link IDs close to the provided one, the closest first
+	//An ID is close if it starts with the provided one or its edit distance to it is small, ignoring the case and the separators
+	//Only the links without an owner and the ones of the owners that allow it with models.User.SuggestLinks are suggested
+	SuggestIDs(id string, limit uint) ([]string, error)
+	//IndexSuggestions sets the suggestion keys of the links saved without them, like the ones created before the keys existed
+	//It goes through all the links, so it is meant to be run once after upgrading
+	IndexSuggestions() error
+	//FallbackHits returns the number of visits sent to the fallback of the specified user, or to the one of the instance if ownerID is empty
+	FallbackHits(ownerID string) (uint64, error)
 	//List lits the users
 	//If the limit is set to 0, no limit will be established, the same applies to the offset
 	//if the ownerID is not empty the search would be limited to the ones owned by the specified user
+	//The state of every link is set according to its activation window
 	List(ownerID string, limit, offset uint) ([]models.Link, error)
+	//ListBroken lists the links whose last health check found them dead or redirecting to another host
+	//If the limit is set to 0, no limit will be established, the same applies to the offset
+	//if the ownerID is not empty the search would be limited to the ones owned by the specified user
+	ListBroken(ownerID string, limit, offset uint) ([]models.Link, error)
 	//UpdateContent replaces  the content of an existing link
 	//If the link doesn't exists in the Link an error would be returned
 	//This methods will permorn validations over the provided data
-	//The data validations in this method can produce an ErrInvalidContent
+	//The data validations in this method can produce an ErrInvalidContent or an ErrDomainRejected
+	//The change is recorded as a new version of the link without an editor
 	UpdateContent(id, content string) error
-	//Delete deletes a link from the storage
+	//Update replaces the settings of an existing link with the not null values of the payload
+	//If the link does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
+	//This methods will permorn validations over the provided data
+	//The content, the variants and the rules of the link are validated again when its type changes, which can produce an ErrInvalidContent
+	//The content is then saved in the form of the new type, which is recorded as a new version of the link if it changes
+	//The variants can also produce an ErrInvalidVariants, the rules an ErrInvalidRules and the rotation an ErrInvalidRotation
+	//A link deactivating before activating produces an ErrInvalidSchedule, and its fallback is validated as a content
+	//UTM tags longer than 200 characters produce an ErrInvalidUTM
+	//An unknown redirect mode produces an ErrInvalidRedirectMode
+	Update(payload UpdatePayload) error
+	//Delete moves a link to the trash, where it can be restored until it is purged
+	//Its ID and aliases stay in use until then, so nobody else can take them
+	//It must be deleted through its ID, an alias produces an ErrAliasID
 	//If the link does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
 	Delete(id string) error
+	//Restore restores a deleted link that was not purged yet
+	//If the link does not exists in the storage, or it is not deleted, an error pkg/interfaces/storage.NotFoundError would be returned
+	Restore(id string) error
+	//ListTrash lists the deleted links that were not purged yet, the last deleted first
+	//If the limit is set to 0, no limit will be established, the same applies to the offset
+	//if the ownerID is not empty the search would be limited to the ones owned by the specified user
+	ListTrash(ownerID string, limit, offset uint) ([]models.Link, error)
 	//IncreaseHitCount increases the hits number of a link in the storage
 	//If the link does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
 	IncreaseHitCount(id string) error
+	//AddAlias adds another ID to an existing link, resolving to the same content and adding to the same hits
+	//The alias follows the same rules as the IDs, so it can produce an ErrInvalidID
+	//If the alias is already used as the ID or an alias of any link an error pkg/interfaces/storage.AlreadyExistsError would be returned
+	AddAlias(id, alias string) error
+	//RemoveAlias removes an alias from a link
+	//If the link does not exists in the storage or it has not the alias an error pkg/interfaces/storage.NotFoundError would be returned
+	RemoveAlias(id, alias string) error
+	//ListVersions lists the changes of the content of a link, the newest first
+	//If the limit is set to 0, no limit will be established, the same applies to the offset
+	//If the link does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
+	ListVersions(id string, limit, offset uint) ([]models.LinkVersion, error)
+	//RestoreVersion sets the content of a link back to the one set by the specified version, recording it as a new version
+	//The content is validated again, so it can produce an ErrInvalidContent or an ErrDomainRejected
+	//If the link or the version does not exists in the storage, or the version belongs to another link, an error pkg/interfaces/storage.NotFoundError would be returned
+	RestoreVersion(id, versionID string) error
+	//Transfer changes the owner of a link and records the transfer
+	//If the link or the new owner does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
+	Transfer(id, newOwnerID string) (models.LinkTransfer, error)
+	//TransferMany changes the owner of several links at once and records the transfer
+	//If any of the links or the new owner does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
+	//If no links are provided or the new owner already owns all of them an ErrInvalidTransfer would be returned
+	//If the new owner can't own that many more links an ErrQuotaExceeded would be returned
+	TransferMany(ids []string, newOwnerID string) (models.LinkTransfer, error)
+	//GetTransfer returns the link transfer with the specified ID from the storage
+	//If the transfer does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
+	GetTransfer(id string) (models.LinkTransfer, error)
+	//ListTransfers lists the link transfers
+	//If the limit is set to 0, no limit will be established, the same applies to the offset
+	//if the userID is not empty the search would be limited to the ones where the specified user is the requester, a previous owner or the recipient
+	ListTransfers(userID string, limit, offset uint) ([]models.LinkTransfer, error)
+	//GetUsage returns the quota in effect for an user and how much of it is in use
+	//If the user does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
+	GetUsage(userID string) (models.QuotaUsage, error)
+	//SetQuota sets a quota for an user, overriding the one of its role
+	//If the user does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
+	SetQuota(userID string, quota models.Quota) error
+	//ResetQuota removes the quota set for an user, so the one of its role applies again
+	//If the user has no quota set an error pkg/interfaces/storage.NotFoundError would be returned
+	ResetQuota(userID string) error
 
 	//GetByUser returns the link with specified ID from the storage
 	//If the link does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
@@ -40,16 +138,101 @@ type ILinkRepository interface {
 	//ListByUser lits the users
 	//If the limit is set to 0, no limit will be established, the same applies to the offset
 	//if the ownerID is not empty the search would be limited to the ones owned by the specified user
+	//The state of every link is set according to its activation window
 	//The requester must be the owner of the links or an admin to perform this action
 	ListByUser(requesterID, ownerID string, limit, offset uint) ([]models.Link, error)
+	//ListBrokenByUser lists the links whose last health check found them dead or redirecting to another host
+	//If the limit is set to 0, no limit will be established, the same applies to the offset
+	//if the ownerID is not empty the search would be limited to the ones owned by the specified user
+	//The requester must be the owner of the links or an admin to perform this action
+	ListBrokenByUser(requesterID, ownerID string, limit, offset uint) ([]models.Link, error)
+	//FallbackHitsByUser returns the number of visits sent to the fallback of the specified user, or to the one of the instance if ownerID is empty
+	//The requester must be the specified user or an admin to perform this action
+	FallbackHitsByUser(requesterID, ownerID string) (uint64, error)
 	//UpdateContentByUser replaces  the content of an existing link
 	//If the link doesn't exists in the Link an error would be returned
 	//This methods will permorn validations over the provided data
-	//The data validations in this method can produce an ErrInvalidContent
+	//The data validations in this method can produce an ErrInvalidContent or an ErrDomainRejected
+	//The change is recorded as a new version of the link, with the requester as its editor
 	//The requester must own the link or be an admin to perform this action
 	UpdateContentByUser(requesterID, id, content string) error
-	//DeleteByUser deletes a link from the storage
+	//UpdateByUser replaces the settings of an existing link with the not null values of the payload
+	//If the link does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
+	//This methods will permorn validations over the provided data
+	//The content, the variants and the rules of the link are validated again when its type changes, which can produce an ErrInvalidContent
+	//The content is then saved in the form of the new type, which is recorded as a new version of the link if it changes
+	//The variants can also produce an ErrInvalidVariants, the rules an ErrInvalidRules and the rotation an ErrInvalidRotation
+	//A link deactivating before activating produces an ErrInvalidSchedule, and its fallback is validated as a content
+	//UTM tags longer than 200 characters produce an ErrInvalidUTM
+	//An unknown redirect mode produces an ErrInvalidRedirectMode
+	//The requester must own the link or be an admin to perform this action
+	UpdateByUser(requesterID string, payload UpdatePayload) error
+	//DeleteByUser moves a link to the trash, where it can be restored until it is purged
+	//Its ID and aliases stay in use until then, so nobody else can take them
+	//It must be deleted through its ID, an alias produces an ErrAliasID
 	//If the link does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
 	//The requester must own the link or be an admin to perform this action
 	DeleteByUser(requesterID, id string) error
+	//RestoreByUser restores a deleted link that was not purged yet
+	//If the link does not exists in the storage, or it is not deleted, an error pkg/interfaces/storage.NotFoundError would be returned
+	//The requester must own the link or be an admin to perform this action
+	RestoreByUser(requesterID, id string) error
+	//ListTrashByUser lists the deleted links that were not purged yet, the last deleted first
+	//If the limit is set to 0, no limit will be established, the same applies to the offset
+	//if the ownerID is not empty the search would be limited to the ones owned by the specified user
+	//The requester must be the owner of the links or an admin to perform this action
+	ListTrashByUser(requesterID, ownerID string, limit, offset uint) ([]models.Link, error)
+	//AddAliasByUser adds another ID to an existing link, resolving to the same content and adding to the same hits
+	//The alias follows the same rules as the IDs, so it can produce an ErrInvalidID
+	//If the alias is already used as the ID or an alias of any link an error pkg/interfaces/storage.AlreadyExistsError would be returned
+	//The requester must own the link or be an admin to perform this action
+	AddAliasByUser(requesterID, id, alias string) error
+	//RemoveAliasByUser removes an alias from a link
+	//If the link does not exists in the storage or it has not the alias an error pkg/interfaces/storage.NotFoundError would be returned
+	//The requester must own the link or be an admin to perform this action
+	RemoveAliasByUser(requesterID, id, alias string) error
+	//ListVersionsByUser lists the changes of the content of a link, the newest first
+	//If the limit is set to 0, no limit will be established, the same applies to the offset
+	//If the link does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
+	//The requester must own the link or be an admin to perform this action
+	ListVersionsByUser(requesterID, id string, limit, offset uint) ([]models.LinkVersion, error)
+	//RestoreVersionByUser sets the content of a link back to the one set by the specified version, recording it as a new version
+	//The content is validated again, so it can produce an ErrInvalidContent or an ErrDomainRejected
+	//If the link or the version does not exists in the storage, or the version belongs to another link, an error pkg/interfaces/storage.NotFoundError would be returned
+	//The requester must own the link or be an admin to perform this action
+	RestoreVersionByUser(requesterID, id, versionID string) error
+	//TransferByUser requests the transfer of a link to another user
+	//If the requester is an admin the transfer is completed immediately, if the requester owns the link the transfer stays pending until the recipient accepts it
+	//The requester must own the link or be an admin to perform this action
+	TransferByUser(requesterID, id, newOwnerID string) (models.LinkTransfer, error)
+	//TransferManyByUser requests the transfer of several links to another user
+	//If the requester is an admin the transfer is completed immediately, if the requester owns all the links the transfer stays pending until the recipient accepts it
+	//The requester must own all the links or be an admin to perform this action
+	TransferManyByUser(requesterID string, ids []string, newOwnerID string) (models.LinkTransfer, error)
+	//AcceptTransferByUser accepts a pending link transfer and changes the owner of its links
+	//If the transfer is not pending an ErrTransferNotPending would be returned
+	//If the recipient can't own that many more links an ErrQuotaExceeded would be returned
+	//The requester must be the recipient of the transfer or an admin to perform this action
+	AcceptTransferByUser(requesterID, transferID string) error
+	//RejectTransferByUser rejects a pending link transfer, leaving its links untouched
+	//If the transfer is not pending an ErrTransferNotPending would be returned
+	//The requester must be the recipient or the requester of the transfer or an admin to perform this action
+	RejectTransferByUser(requesterID, transferID string) error
+	//ListTransfersByUser lists the link transfers
+	//If the limit is set to 0, no limit will be established, the same applies to the offset
+	//if the userID is not empty the search would be limited to the ones where the specified user is the requester, a previous owner or the recipient
+	//The requester must be the specified user or an admin to perform this action
+	ListTransfersByUser(requesterID, userID string, limit, offset uint) ([]models.LinkTransfer, error)
+	//GetUsageByUser returns the quota in effect for an user and how much of it is in use
+	//If the user does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
+	//The requester must only request information about himself or be an admin to perform this action
+	GetUsageByUser(requesterID, userID string) (models.QuotaUsage, error)
+	//SetQuotaByUser sets a quota for an user, overriding the one of its role
+	//If the user does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
+	//The requester must be an admin to perform this action
+	SetQuotaByUser(requesterID, userID string, quota models.Quota) error
+	//ResetQuotaByUser removes the quota set for an user, so the one of its role applies again
+	//If the user has no quota set an error pkg/interfaces/storage.NotFoundError would be returned
+	//The requester must be an admin to perform this action
+	ResetQuotaByUser(requesterID, userID string) error
 }
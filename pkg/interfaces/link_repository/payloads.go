@@ -0,0 +1,71 @@
+package link_repository
+
+import "github.com/nethruster/linksh/pkg/models"
+
+//UpdatePayload contains the settings of a link to update, only the not null fields will be updated
+type UpdatePayload struct {
+	ID               string                   `json:"id,omitempty"`
+	Type             *models.LinkType         `json:"type,omitempty"`
+	QueryPassthrough *models.QueryPassthrough `json:"queryPassthrough,omitempty"`
+	UTM              *models.UTMTags          `json:"utm,omitempty"`
+	RedirectMode     *models.RedirectMode     `json:"redirectMode,omitempty"`
+	//Variants replaces all the variants of the link, an empty slice removes them
+	//The hits of the variants are ignored, the ones of the existing variants with the same name are kept
+	Variants *[]models.LinkVariant `json:"variants,omitempty"`
+	Rotation *models.Rotation      `json:"rotation,omitempty"`
+	//Rules replaces all the rules of the link, an empty slice removes them
+	//The hits of the rules are ignored, the ones of the existing rules with the same name are kept
+	Rules *[]models.LinkRule `json:"rules,omitempty"`
+	//ActivatesAt and DeactivatesAt set the activation window of the link, 0 removes the bound
+	ActivatesAt   *int64  `json:"activatesAt,omitempty"`
+	DeactivatesAt *int64  `json:"deactivatesAt,omitempty"`
+	Fallback      *string `json:"fallback,omitempty"`
+}
+
+//ResolveRequest describes a visit to a short link
+type ResolveRequest struct {
+	//OwnerID is the user whose links are being visited, like the owner of the domain of the request
+	//When set, the fallback of the user is used for the unknown IDs
+	OwnerID string
+	//Path is the requested path unescaped and without the leading slash, like "gh/nethruster/linksh"
+	Path string
+	//RawQuery is the encoded query of the request, without the '?'
+	RawQuery string
+	//Fragment is the fragment of the visited URL, without the '#'
+	//Browsers don't send it to the server, so it is only known when the client provides it
+	Fragment string
+	//UserAgent is the User-Agent header of the request, used to evaluate the rules of the link
+	UserAgent string
+}
+
+//Resolution tells where the visitor of a short link must be sent
+type Resolution struct {
+	//Link is the link that matched the requested path
+	Link models.Link
+	//Target is the URL the visitor must be redirected to
+	Target string
+	//Mode is how the visitor must be sent to the target, models.RedirectMode.Respond serves it
+	Mode models.RedirectMode
+	//Variant is the name of the variant of the link chosen for the visit, it is empty when the link has no variants
+	Variant string
+	//Rule is the name of the rule of the link that matched the visit, it is empty when none did
+	//When a rule matches no variant is chosen
+	Rule string
+	//Fallback tells which fallback the target comes from, it is empty when the link was served
+	//The link of the resolution is empty when the fallback is used for an unknown ID
+	Fallback FallbackKind
+}
+
+//FallbackKind represents where the fallback of a resolution was configured
+type FallbackKind string
+
+const (
+	//FallbackNone is the kind of the resolutions served by their link
+	FallbackNone FallbackKind = ""
+	//FallbackLink is used for the links outside of their activation window
+	FallbackLink FallbackKind = "link"
+	//FallbackOwner is used for the unknown IDs of an owner, or for its links outside of their window without a fallback
+	FallbackOwner FallbackKind = "owner"
+	//FallbackInstance is used when there is no other fallback
+	FallbackInstance FallbackKind = "instance"
+)
@@ -0,0 +1,33 @@
+package rate_limiter
+
+import (
+	"strconv"
+	"time"
+)
+
+//IRateLimiter represents a token bucket rate limiter
+//Each key has its own bucket, so the same limiter can be shared by all the clients of a kind (IPs, users, tokens...)
+type IRateLimiter interface {
+	//Allow consumes a token from the bucket of the key
+	//If the bucket is empty the action is not allowed and the Result tells how long to wait before retrying
+	Allow(key string) (Result, error)
+}
+
+//Result is the outcome of a call to IRateLimiter.Allow
+type Result struct {
+	Allowed bool
+	//Remaining is the number of tokens left in the bucket
+	Remaining uint
+	//RetryAfter is the time until the next token is available, it is 0 when the action was allowed
+	RetryAfter time.Duration
+}
+
+//RetryAfterHeader returns the value of the Retry-After HTTP header for the result, in whole seconds rounded up
+//It is at least 1, as a Retry-After of 0 would tell the client to retry at once
+func (r Result) RetryAfterHeader() string {
+	seconds := int64(r.RetryAfter / time.Second)
+	if r.RetryAfter%time.Second != 0 || seconds < 1 {
+		seconds++
+	}
+	return strconv.FormatInt(seconds, 10)
+}
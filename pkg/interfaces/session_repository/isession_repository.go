@@ -6,6 +6,8 @@ import (
 
 //ISessionRepository represents all the possible actions performed over the sessions
 type ISessionRepository interface {
+	// WithRequest returns a view of the repository recording the metadata of the request in the audit log
+	WithRequest(request models.RequestMetadata) ISessionRepository
 	// Create creates a session and save it to the storage
 	// if the expire date is set 0 the session will not expire
 	Create(userID string, expireDate int64) (models.Session, error)
@@ -29,6 +31,6 @@ type ISessionRepository interface {
 	// If the session does not exists in the storage an error pkg/interfaces/storage.NotFoundError will be returned
 	Delete(id string) error
 	// Delete deletes a session
-	// The requester must own the session to perform this action, otherwise an pkg/interfaces/user_repository.ErrForbidden will be returned
+	// The requester must own the session or be an admin to perform this action, otherwise an pkg/interfaces/user_repository.ErrForbidden will be returned
 	DeleteByUser(userID, id string) error
 }
@@ -0,0 +1,25 @@
+package istorage
+
+import "fmt"
+
+//The counters of a link are named after its ID, so DeleteLink and PurgeLinks can remove them with the link
+
+//LinkVersionsCounterName returns the name of the counter numbering the versions of a link
+func LinkVersionsCounterName(linkID string) string {
+	return "versions:" + linkID
+}
+
+//LinkRotationCounterName returns the name of the counter rotating the variants of a link
+func LinkRotationCounterName(linkID string) string {
+	return "rotation:" + linkID
+}
+
+//LinkMilestoneCounterName returns the name of the counter recording that a link reached a number of hits
+func LinkMilestoneCounterName(linkID string, milestone uint) string {
+	return fmt.Sprintf("%s%d", LinkMilestoneCountersPrefix(linkID), milestone)
+}
+
+//LinkMilestoneCountersPrefix returns the prefix of the names of the milestone counters of a link, followed by the hits
+func LinkMilestoneCountersPrefix(linkID string) string {
+	return "milestone:" + linkID + ":"
+}
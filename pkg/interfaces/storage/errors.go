@@ -40,3 +40,25 @@ type AlreadyExistsError struct {
 func (err *AlreadyExistsError) Error() string {
 	return fmt.Sprintf("There is already a/an %s with the same %s", err.Model, err.Field)
 }
+
+//ConflictError is the error generated by an IStorage when an element was modified by someone else since it was read
+type ConflictError struct {
+	//Model represents which model was in use in the operation
+	Model string
+	//Key represents the ID of the element
+	Key string
+}
+
+func (err ConflictError) Error() string {
+	return fmt.Sprintf("The %s with ID %s was modified concurrently", err.Model, err.Key)
+}
+
+//NewConflictError creates a new ConflictError
+//model represents which model was in use in the operation
+//key represents the ID of the element
+func NewConflictError(model, key string) ConflictError {
+	return ConflictError{
+		Model: model,
+		Key:   key,
+	}
+}
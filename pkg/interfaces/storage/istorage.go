@@ -1,6 +1,7 @@
 package istorage
 
 import (
+	"github.com/nethruster/linksh/pkg/interfaces/link_repository"
 	"github.com/nethruster/linksh/pkg/interfaces/user_repository"
 	"github.com/nethruster/linksh/pkg/models"
 )
@@ -29,29 +30,210 @@ type IStorage interface {
 	//DeleteUser deletes the user specified user from the storage
 	//If the user does not exists in the storage an NotFoundError would be returned
 	DeleteUser(id string) error
+	//TrashUser marks an user as deleted at the specified Unix EPOCH, hiding it from the other methods until it is restored or purged
+	//If the user does not exists in the storage, or it is already deleted, an NotFoundError would be returned
+	TrashUser(id string, deletedAt int64) error
+	//RestoreUser removes the deleted mark of an user
+	//If the user does not exists in the storage, or it is not deleted, an NotFoundError would be returned
+	RestoreUser(id string) error
+	//ListTrashedUsers list the users marked as deleted, the last deleted first
+	//If the limit is set to 0, no limit will be established, the same applies to the offset
+	ListTrashedUsers(limit, offset uint) ([]models.User, error)
+	//PurgeUsers removes the users marked as deleted before the specified Unix EPOCH and returns how many were removed
+	PurgeUsers(deletedBefore int64) (uint, error)
 
 	//Link related methods
 
 	//SaveLink save the link in the storage
-	//If there is a conflicting unique field this method will return an AlreadyExistsError
+	//If there is a conflicting unique field this method will return an AlreadyExistsError, the ID also conflicts with the aliases of the links
 	SaveLink(link models.Link) error
-	//GetLink returns the link with specified ID from the storage
+	//GetLink returns the link with specified ID or alias from the storage
 	//If the link does not exists in the storage an NotFoundError would be returned
 	GetLink(id string) (models.Link, error)
+	//GetLinks returns the links with the specified IDs or aliases from the storage
+	//The IDs not found in the storage are ignored, so the result can be shorter than the IDs
+	GetLinks(ids []string) ([]models.Link, error)
 	//ListLinks list the links in the storage with a limit and an offset
 	//if the ownerID is not empty the search would be limited to the ones owned by the specified user
 	//If the limit is set to 0, no limit will be established, the same applies to the offset
 	ListLinks(ownerID string, limit, offset uint) ([]models.Link, error)
-	//UpdateLinkContent replaces the values of the user in the storage with the non empty ones of the provided user
+	//ListLinksAfter lists the links whose ID comes after the specified one, sorted by ID
+	//Unlike the offset of ListLinks, paging with the last ID listed doesn't skip or repeat links when links are created in between
+	//If the afterID is empty the list starts at the first link, if the limit is set to 0, no limit will be established
+	ListLinksAfter(afterID string, limit uint) ([]models.Link, error)
+	//ListLinksBySuggestionKeys lists the links having any of the specified suggestion keys, or one starting with the prefix if it is not empty
+	//If the limit is set to 0, no limit will be established
+	ListLinksBySuggestionKeys(keys []string, prefix string, limit uint) ([]models.Link, error)
+	//UpdateLinkSuggestionKeys replaces the suggestion keys of a link
 	//If the link does not exists in the storage an NotFoundError would be returned
+	UpdateLinkSuggestionKeys(id string, keys []string) error
+	//UpdateLinkContent replaces the values of the user in the storage with the non empty ones of the provided user
+	//If the link does not exists in the storage, or it is deleted, an NotFoundError would be returned
 	//If there is a conflicting unique field this method will return an AlreadyExistsError
+	//The health of the link is reset as it belongs to the previous content
 	UpdateLinkContent(id, content string) error
+	//UpdateLink replaces the settings of the link in the storage with the not null ones of the provided payload
+	//The hits of the provided variants and rules are ignored, the stored ones of the items with the same name are kept in the same write
+	//If the link does not exists in the storage, or it is deleted, an NotFoundError would be returned
+	UpdateLink(payload link_repository.UpdatePayload) error
 	//DeleteLink deletes the link specified user from the storage
+	//Its versions, counters and places in the transfers are removed with it
 	//If the link does not exists in the storage an NotFoundError would be returned
 	DeleteLink(id string) error
+	//TrashLink marks a link as deleted at the specified Unix EPOCH, hiding it from the other methods until it is restored or purged
+	//The ID and the aliases of the link stay in use until it is purged
+	//If the link does not exists in the storage, or it is already deleted, an NotFoundError would be returned
+	TrashLink(id string, deletedAt int64) error
+	//RestoreLink removes the deleted mark of a link
+	//If the link does not exists in the storage, or it is not deleted, an NotFoundError would be returned
+	RestoreLink(id string) error
+	//GetTrashedLink returns the link marked as deleted with the specified ID or alias
+	//If the link does not exists in the storage, or it is not deleted, an NotFoundError would be returned
+	GetTrashedLink(id string) (models.Link, error)
+	//ListTrashedLinks list the links marked as deleted, the last deleted first
+	//if the ownerID is not empty the search would be limited to the ones owned by the specified user
+	//If the limit is set to 0, no limit will be established, the same applies to the offset
+	ListTrashedLinks(ownerID string, limit, offset uint) ([]models.Link, error)
+	//PurgeLinks removes the links marked as deleted before the specified Unix EPOCH and returns how many were removed
+	//Their versions, counters and places in the transfers are removed too, so their IDs and aliases can be used again from scratch
+	PurgeLinks(deletedBefore int64) (uint, error)
 	//IncreaseLinkHitCount increases the hits number of a link in the storage
-	//If the user does not exists in the storage an NotFoundError would be returned
+	//If the link does not exists in the storage, or it is deleted, an NotFoundError would be returned
 	IncreaseLinkHitCount(id string) error
+	//AddLinkAlias adds an alias to the link with the specified ID
+	//If the link does not exists in the storage, or it is deleted, an NotFoundError would be returned
+	//If the alias is already used as the ID or an alias of any link an AlreadyExistsError would be returned
+	//The check must hold against concurrent calls to SaveLink and AddLinkAlias, as the IDs and the aliases share the same namespace
+	AddLinkAlias(id, alias string) error
+	//RemoveLinkAlias removes an alias from the link with the specified ID
+	//If the link does not exists in the storage or it has not the alias an NotFoundError would be returned
+	RemoveLinkAlias(id, alias string) error
+	//IncreaseLinkVariantHitCount increases the hits number of a link and the one of its variant with the specified name
+	//If the link or the variant does not exists in the storage, or the link is deleted, an NotFoundError would be returned
+	IncreaseLinkVariantHitCount(id, variant string) error
+	//IncreaseLinkRuleHitCount increases the hits number of a link and the one of its rule with the specified name
+	//If the link or the rule does not exists in the storage, or the link is deleted, an NotFoundError would be returned
+	IncreaseLinkRuleHitCount(id, rule string) error
+	//IncreaseLinkFallbackHitCount increases the number of visits of a link sent to its fallback
+	//If the link does not exists in the storage, or it is deleted, an NotFoundError would be returned
+	IncreaseLinkFallbackHitCount(id string) error
+	//UpdateLinksOwner sets the owner of the links of the items, as long as every one is still owned by the previous owner of its item
+	//If none of the links exists in the storage an NotFoundError would be returned
+	//If any of them changed hands or was deleted a ConflictError would be returned, and the owners of the rest are left unchanged
+	UpdateLinksOwner(items []models.LinkTransferItem, ownerID string) error
+	//CountLinks counts the links in the storage created at or after createdSince
+	//if the ownerID is not empty the count would be limited to the ones owned by the specified user
+	//If createdSince is set to 0 all the links will be counted
+	//The links marked as deleted are counted until they are purged
+	CountLinks(ownerID string, createdSince int64) (uint, error)
+	//UpdateLinkHealth replaces the result of the last health check of a link whose content is still the checked one
+	//If the link does not exists in the storage an NotFoundError would be returned
+	//If the content of the link changed since it was checked a ConflictError would be returned and the health is not saved
+	UpdateLinkHealth(id, content string, health models.LinkHealth) error
+	//ListBrokenLinks list the links whose last health check found them dead or redirecting to another host
+	//if the ownerID is not empty the search would be limited to the ones owned by the specified user
+	//If the limit is set to 0, no limit will be established, the same applies to the offset
+	ListBrokenLinks(ownerID string, limit, offset uint) ([]models.Link, error)
+
+	//Link transfer related methods
+
+	//SaveLinkTransfer saves the link transfer in the storage
+	//If there is a conflicting unique field this method will return an AlreadyExistsError
+	SaveLinkTransfer(transfer models.LinkTransfer) error
+	//GetLinkTransfer returns the link transfer with specified ID from the storage
+	//If the transfer does not exists in the storage an NotFoundError would be returned
+	GetLinkTransfer(id string) (models.LinkTransfer, error)
+	//ListLinkTransfers list the link transfers in the storage with a limit and an offset
+	//if the userID is not empty the search would be limited to the ones where the specified user is the requester, a previous owner or the recipient
+	//If the limit is set to 0, no limit will be established, the same applies to the offset
+	ListLinkTransfers(userID string, limit, offset uint) ([]models.LinkTransfer, error)
+	//UpdateLinkTransferStatus sets the status and the resolution date of a pending link transfer
+	//If the transfer does not exists in the storage an NotFoundError would be returned
+	//If the transfer is no longer pending a ConflictError would be returned, so only one resolution succeeds
+	UpdateLinkTransferStatus(id string, status models.LinkTransferStatus, resolvedAt int64) error
+
+	//Link version related methods
+
+	//SaveLinkVersion saves the link version in the storage
+	//If there is a conflicting unique field this method will return an AlreadyExistsError
+	SaveLinkVersion(version models.LinkVersion) error
+	//GetLinkVersion returns the link version with specified ID from the storage
+	//If the version does not exists in the storage an NotFoundError would be returned
+	GetLinkVersion(id string) (models.LinkVersion, error)
+	//ListLinkVersions list the versions of the link with the specified ID, the newest first
+	//If the limit is set to 0, no limit will be established, the same applies to the offset
+	ListLinkVersions(linkID string, limit, offset uint) ([]models.LinkVersion, error)
+	//DeleteLinkVersion deletes the link version with the specified ID from the storage
+	//If the version does not exists in the storage an NotFoundError would be returned
+	DeleteLinkVersion(id string) error
+
+	//Audit related methods
+
+	//SaveAuditRecord appends the audit record to the storage, the records can't be modified nor deleted afterwards
+	//If there is a conflicting unique field this method will return an AlreadyExistsError
+	SaveAuditRecord(record models.AuditRecord) error
+	//ListAuditRecords list the audit records selected by the filter, the oldest first
+	//If the limit is set to 0, no limit will be established, the same applies to the offset
+	ListAuditRecords(filter models.AuditFilter, limit, offset uint) ([]models.AuditRecord, error)
+
+	//Webhook related methods
+
+	//SaveWebhook saves the webhook in the storage
+	//If there is a conflicting unique field this method will return an AlreadyExistsError
+	SaveWebhook(webhook models.Webhook) error
+	//GetWebhook returns the webhook with specified ID from the storage
+	//If the webhook does not exists in the storage an NotFoundError would be returned
+	GetWebhook(id string) (models.Webhook, error)
+	//ListWebhooks list the webhooks, the oldest first
+	//if the ownerID is not empty the search would be limited to the ones owned by the specified user
+	//If the limit is set to 0, no limit will be established, the same applies to the offset
+	ListWebhooks(ownerID string, limit, offset uint) ([]models.Webhook, error)
+	//ListWebhooksByEvent list all the webhooks subscribed to the event owned by the specified user or by nobody
+	ListWebhooksByEvent(event models.WebhookEvent, ownerID string) ([]models.Webhook, error)
+	//DeleteWebhook deletes the webhook with the specified ID from the storage, its deliveries are kept
+	//If the webhook does not exists in the storage an NotFoundError would be returned
+	DeleteWebhook(id string) error
+	//SaveWebhookDelivery saves the webhook delivery in the storage, replacing the one with the same ID if it exists
+	SaveWebhookDelivery(delivery models.WebhookDelivery) error
+	//GetWebhookDelivery returns the webhook delivery with specified ID from the storage
+	//If the delivery does not exists in the storage an NotFoundError would be returned
+	GetWebhookDelivery(id string) (models.WebhookDelivery, error)
+	//ListWebhookDeliveries list the deliveries of the webhook with the specified ID, the newest first
+	//If the limit is set to 0, no limit will be established, the same applies to the offset
+	ListWebhookDeliveries(webhookID string, limit, offset uint) ([]models.WebhookDelivery, error)
+	//ListPendingWebhookDeliveries lists the pending deliveries of every webhook whose ID comes after the specified one, sorted by ID
+	//If the afterID is empty the list starts at the first delivery, if the limit is set to 0, no limit will be established
+	ListPendingWebhookDeliveries(afterID string, limit uint) ([]models.WebhookDelivery, error)
+
+	//Quota related methods
+
+	//SaveUserQuota saves the quota of an user in the storage, replacing the previous one if any
+	SaveUserQuota(quota models.UserQuota) error
+	//GetUserQuota returns the quota of the user with the specified ID from the storage
+	//If the user has no quota in the storage an NotFoundError would be returned
+	GetUserQuota(userID string) (models.UserQuota, error)
+	//DeleteUserQuota deletes the quota of the user with the specified ID from the storage
+	//If the user has no quota in the storage an NotFoundError would be returned
+	DeleteUserQuota(userID string) error
+
+	//Counter related methods
+
+	//IncreaseCounter increases by one the counter with the specified name and returns its new value
+	//If the counter does not exists in the storage it is created, so the first value is 1
+	IncreaseCounter(name string) (uint64, error)
+	//GetCounter returns the value of the counter with the specified name
+	//If the counter does not exists in the storage 0 is returned
+	GetCounter(name string) (uint64, error)
+
+	//Rate limit related methods
+
+	//GetRateLimitBucket returns the rate limit bucket with the specified key from the storage
+	//If the bucket does not exists in the storage an NotFoundError would be returned
+	GetRateLimitBucket(key string) (models.RateLimitBucket, error)
+	//SaveRateLimitBucket saves the rate limit bucket in the storage if it was not modified since it was read
+	//previousUpdatedAt must be the UpdatedAt value read from the storage, or 0 if the bucket did not exist
+	//If the bucket was modified or created in the meantime a ConflictError would be returned
+	SaveRateLimitBucket(bucket models.RateLimitBucket, previousUpdatedAt int64) error
 
 	// Session related methods
 
@@ -7,6 +7,10 @@ var (
 	ErrInvalidName = errors.New("Invalid username")
 	//ErrInvalidPassword is returned when the provided password doesn't accomplish the requirements of models.User.Password
 	ErrInvalidPassword = errors.New("Invalid password")
+	//ErrInvalidFallback is returned when the fallback is not a valid link content
+	ErrInvalidFallback = errors.New("Invalid fallback")
+	//ErrInvalidUTM is returned when any of the provided UTM tags is longer than 200 characters
+	ErrInvalidUTM = errors.New("Invalid UTM tags")
 	//ErrForbidden is returned when an ser user request to perform an action without enough privileges
 	ErrForbidden = errors.New("Forbidden")
 )
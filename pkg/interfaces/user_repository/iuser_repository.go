@@ -8,6 +8,9 @@ import (
 //The implementations of this interface will not be attached to an specific storage
 //The methods with the suffix 'ByUser' will only be perform if the requester has enough privileges, if not an ErrForbidden would be returned
 type IUserRepository interface {
+	//WithRequest returns a view of the repository recording the metadata of the request in the audit log
+	//The operations of the view are recorded as performed for the request, and the ones of the methods with the suffix 'ByUser' by the requester
+	WithRequest(request models.RequestMetadata) IUserRepository
 	//CheckLoginCredentials checks if the provided credentials are valid to perform a login
 	CheckLoginCredentials(name string, password []byte) (bool, error)
 	//Create creates an user and save it to the storage
@@ -22,12 +25,19 @@ type IUserRepository interface {
 	List(limit, offset uint) ([]models.User, error)
 	//Update replaces the values of the user in the storage with the values of the user provided by parameter
 	//This methods will permorn validations over the provided data
-	//The data validations in this method can produce an ErrInvalidName or an ErrInvalidPassword
+	//The data validations in this method can produce an ErrInvalidName, an ErrInvalidPassword, an ErrInvalidUTM or an ErrInvalidFallback
+	//If the domain of the fallback is rejected by the domain filter an error pkg/interfaces/link_repository.ErrDomainRejected would be returned
 	//If the user does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
 	Update(user UpdatePayload) error
-	//Delete deletes an user from the storage
+	//Delete moves an user to the trash, where it can be restored until it is purged
 	//If the user does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
 	Delete(id string) error
+	//Restore restores a deleted user that was not purged yet
+	//If the user does not exists in the storage, or it is not deleted, an error pkg/interfaces/storage.NotFoundError would be returned
+	Restore(id string) error
+	//ListTrash lists the deleted users that were not purged yet, the last deleted first
+	//If the limit is set to 0, no limit will be established, the same applies to the offset
+	ListTrash(limit, offset uint) ([]models.User, error)
 
 	//CreateByUser creates an user and save it to the storage
 	//This methods will permorn validations over the provided data
@@ -44,14 +54,23 @@ type IUserRepository interface {
 	ListByUser(requesterID string, limit, offset uint) ([]models.User, error)
 	//UpdateByUser replaces the values of the user in the storage with the values of the user provided by parameter
 	//This methods will permorn validations over the provided data
-	//The data validations in this method can produce an ErrInvalidName or an ErrInvalidPassword
+	//The data validations in this method can produce an ErrInvalidName, an ErrInvalidPassword, an ErrInvalidUTM or an ErrInvalidFallback
+	//If the domain of the fallback is rejected by the domain filter an error pkg/interfaces/link_repository.ErrDomainRejected would be returned
 	//If the user does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
 	//The requestor can only modify information about himself or otherwise be an admin to perform this action. The isAdmin property can only be changed by other admins.
 	UpdateByUser(requesterID string, user UpdatePayload) error
-	//DeleteByUser deletes an user from the storage
+	//DeleteByUser moves an user to the trash, where it can be restored until it is purged
 	//If the user does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
 	//The requester must only delete himself or be an admin to perform this action
-	DeleteByUser(id string) error
+	DeleteByUser(requesterID, id string) error
+	//RestoreByUser restores a deleted user that was not purged yet
+	//If the user does not exists in the storage, or it is not deleted, an error pkg/interfaces/storage.NotFoundError would be returned
+	//The requester must be an admin to perform this action
+	RestoreByUser(requesterID, id string) error
+	//ListTrashByUser lists the deleted users that were not purged yet, the last deleted first
+	//If the limit is set to 0, no limit will be established, the same applies to the offset
+	//The requester must be an admin to perform this action
+	ListTrashByUser(requesterID string, limit, offset uint) ([]models.User, error)
 }
 
 //UpdatePayload is a clone of models.User with nullable fields used to perform operations as only the not null fields will be the ones updated
@@ -60,4 +79,7 @@ type UpdatePayload struct {
 	Name     *string `json:"name,omitempty"`
 	Password []byte  `json:"password,omitempty"`
 	IsAdmin  *bool   `json:"isAdmin"`
+	UTM      *models.UTMTags `json:"utm,omitempty"`
+	Fallback *string         `json:"fallback,omitempty"`
+	SuggestLinks *bool       `json:"suggestLinks,omitempty"`
 }
@@ -0,0 +1,10 @@
+package webhook_repository
+
+import "errors"
+
+var (
+	//ErrInvalidURL is returned when the URL of a webhook is not an absolute http or https URL, or it points to a loopback, link-local or private address
+	ErrInvalidURL = errors.New("Invalid URL")
+	//ErrInvalidEvents is returned when a webhook has no events or any of them is not one of the models.WebhookEvent values
+	ErrInvalidEvents = errors.New("Invalid events")
+)
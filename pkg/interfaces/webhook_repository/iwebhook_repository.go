@@ -0,0 +1,61 @@
+package webhook_repository
+
+import (
+	"github.com/nethruster/linksh/pkg/models"
+)
+
+//IWebhookRepository represents all the possible actions performed over the webhooks and their deliveries
+//The implementations of this interface will not be attached to an specific storage
+//The methods with the suffix 'ByUser' will only be perform if the requester has enough privileges, if not an pkg/interfaces/user_repository.ErrForbidden would be returned
+type IWebhookRepository interface {
+	//Create creates a webhook with a random secret and save it to the storage
+	//If the ownerID is empty the webhook is triggered by every link and user, otherwise only by the ones of the owner
+	//The data validations in this method can produce an ErrInvalidURL or an ErrInvalidEvents
+	//If the owner does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
+	Create(ownerID, url string, events []models.WebhookEvent) (models.Webhook, error)
+	//Get returns the webhook with specified ID from the storage
+	//If the webhook does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
+	Get(id string) (models.Webhook, error)
+	//List lists the webhooks, the oldest first
+	//If the limit is set to 0, no limit will be established, the same applies to the offset
+	//if the ownerID is not empty the search would be limited to the ones owned by the specified user
+	List(ownerID string, limit, offset uint) ([]models.Webhook, error)
+	//Delete deletes a webhook from the storage, its deliveries are kept
+	//If the webhook does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
+	Delete(id string) error
+	//ListDeliveries lists the deliveries of a webhook, the newest first
+	//If the limit is set to 0, no limit will be established, the same applies to the offset
+	//If the webhook does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
+	ListDeliveries(webhookID string, limit, offset uint) ([]models.WebhookDelivery, error)
+	//Redeliver sends again the payload of a delivery as a new delivery, which is returned before being sent
+	//If the delivery or its webhook does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
+	//If the instance sends no webhooks an error pkg/webhook.ErrNoDispatcher would be returned
+	Redeliver(deliveryID string) (models.WebhookDelivery, error)
+	//CreateByUser creates a webhook with a random secret and save it to the storage
+	//If the ownerID is empty the webhook is triggered by every link and user, otherwise only by the ones of the owner
+	//The data validations in this method can produce an ErrInvalidURL or an ErrInvalidEvents
+	//The requester must be the owner or an admin to perform this action
+	CreateByUser(requesterID, ownerID, url string, events []models.WebhookEvent) (models.Webhook, error)
+	//GetByUser returns the webhook with specified ID from the storage
+	//If the webhook does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
+	//The requester must own the webhook or be an admin to perform this action
+	GetByUser(requesterID, id string) (models.Webhook, error)
+	//ListByUser lists the webhooks, the oldest first
+	//If the limit is set to 0, no limit will be established, the same applies to the offset
+	//if the ownerID is not empty the search would be limited to the ones owned by the specified user
+	//The requester must be the owner of the webhooks or an admin to perform this action
+	ListByUser(requesterID, ownerID string, limit, offset uint) ([]models.Webhook, error)
+	//DeleteByUser deletes a webhook from the storage, its deliveries are kept
+	//If the webhook does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
+	//The requester must own the webhook or be an admin to perform this action
+	DeleteByUser(requesterID, id string) error
+	//ListDeliveriesByUser lists the deliveries of a webhook, the newest first
+	//If the limit is set to 0, no limit will be established, the same applies to the offset
+	//If the webhook does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
+	//The requester must own the webhook or be an admin to perform this action
+	ListDeliveriesByUser(requesterID, webhookID string, limit, offset uint) ([]models.WebhookDelivery, error)
+	//RedeliverByUser sends again the payload of a delivery as a new delivery, which is returned before being sent
+	//If the delivery or its webhook does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
+	//The requester must own the webhook of the delivery or be an admin to perform this action
+	RedeliverByUser(requesterID, deliveryID string) (models.WebhookDelivery, error)
+}
@@ -0,0 +1,109 @@
+package metrics
+
+import (
+	"errors"
+	istorage "github.com/nethruster/linksh/pkg/interfaces/storage"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+//The types of the storage errors
+const (
+	ErrorNotFound      = "not_found"
+	ErrorAlreadyExists = "already_exists"
+	ErrorOther         = "other"
+)
+
+//DefaultBuckets are the upper bounds, in seconds, of the buckets of the storage latency
+var DefaultBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+//Metrics are the metrics of linksh, served in the Prometheus text format by Handler
+//Every method but Handler can be called on a nil Metrics, then nothing is recorded
+type Metrics struct {
+	registry        *prometheus.Registry
+	storageDuration *prometheus.HistogramVec
+	storageErrors   *prometheus.CounterVec
+	redirects       *prometheus.CounterVec
+}
+
+//New creates the metrics of linksh in their own registry
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		storageDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "linksh_storage_duration_seconds",
+			Help:    "Latency of the calls to the storage by method.",
+			Buckets: DefaultBuckets,
+		}, []string{"method"}),
+		storageErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "linksh_storage_errors_total",
+			Help: "Errors returned by the storage by method and type.",
+		}, []string{"method", "type"}),
+		redirects: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "linksh_redirects_total",
+			Help: "Responses of the redirect handler by status.",
+		}, []string{"status"}),
+	}
+	m.registry.MustRegister(m.storageDuration, m.storageErrors, m.redirects)
+	return m
+}
+
+//Handler returns the handler serving the metrics, it should be mounted on /metrics
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+//ObserveStorage records the latency of a call to the storage and its error, if any
+func (m *Metrics) ObserveStorage(method string, duration time.Duration, err error) {
+	if m == nil {
+		return
+	}
+	m.storageDuration.WithLabelValues(method).Observe(duration.Seconds())
+	if err != nil {
+		m.storageErrors.WithLabelValues(method, errorType(err)).Inc()
+	}
+}
+
+//ObserveRedirect counts a response of the redirect handler
+func (m *Metrics) ObserveRedirect(status int) {
+	if m != nil {
+		m.redirects.WithLabelValues(strconv.Itoa(status)).Inc()
+	}
+}
+
+//RedirectMiddleware counts the responses served by the redirect handler by their status
+func (m *Metrics) RedirectMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(recorder, r)
+		m.ObserveRedirect(recorder.status)
+	})
+}
+
+//statusRecorder remembers the status written to a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if !sr.wroteHeader {
+		sr.status, sr.wroteHeader = status, true
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func errorType(err error) string {
+	var alreadyExistsError *istorage.AlreadyExistsError
+	switch {
+	case errors.As(err, &istorage.NotFoundError{}):
+		return ErrorNotFound
+	case errors.As(err, &alreadyExistsError):
+		return ErrorAlreadyExists
+	}
+	return ErrorOther
+}
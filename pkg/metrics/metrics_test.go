@@ -0,0 +1,93 @@
+package metrics
+
+import (
+	"errors"
+	istorage "github.com/nethruster/linksh/pkg/interfaces/storage"
+	"github.com/nethruster/linksh/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+//fakeStorage fails the calls with the errors of the test
+type fakeStorage struct {
+	istorage.IStorage
+	err error
+}
+
+func (fs *fakeStorage) GetLink(id string) (models.Link, error) {
+	return models.Link{ID: id}, fs.err
+}
+
+func scrape(t *testing.T, m *Metrics) string {
+	recorder := httptest.NewRecorder()
+	m.Handler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if contentType := recorder.Header().Get("Content-Type"); !strings.HasPrefix(contentType, "text/plain") {
+		t.Errorf("Expected the text format, got %s", contentType)
+	}
+	return recorder.Body.String()
+}
+
+func expectLines(t *testing.T, body string, lines ...string) {
+	for _, line := range lines {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected the line %q in:\n%s", line, body)
+		}
+	}
+}
+
+func TestStorage(t *testing.T) {
+	m := New()
+	fake := &fakeStorage{}
+	storage := InstrumentStorage(fake, m)
+
+	if link, err := storage.GetLink("abc"); err != nil || link.ID != "abc" {
+		t.Errorf("The calls should be passed to the storage, got %+v %v", link, err)
+	}
+	fake.err = istorage.NewNotFoundError("link", "ID", "abc")
+	if _, err := storage.GetLink("abc"); !errors.As(err, &istorage.NotFoundError{}) {
+		t.Errorf("The errors should be returned unchanged, got %v", err)
+	}
+	fake.err = &istorage.AlreadyExistsError{Model: "link", Field: "ID"}
+	storage.GetLink("abc")
+	fake.err = errors.New("connection refused")
+	storage.GetLink("abc")
+
+	expectLines(t, scrape(t, m),
+		"# TYPE linksh_storage_duration_seconds histogram",
+		`linksh_storage_duration_seconds_bucket{method="GetLink",le="+Inf"} 4`,
+		`linksh_storage_duration_seconds_count{method="GetLink"} 4`,
+		"# TYPE linksh_storage_errors_total counter",
+		`linksh_storage_errors_total{method="GetLink",type="already_exists"} 1`,
+		`linksh_storage_errors_total{method="GetLink",type="not_found"} 1`,
+		`linksh_storage_errors_total{method="GetLink",type="other"} 1`,
+	)
+}
+
+func TestRedirects(t *testing.T) {
+	m := New()
+	handler := m.RedirectMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/docs":
+			http.Redirect(w, r, "https://docs.example.tld/", http.StatusFound)
+		case "/ok":
+			w.Write([]byte("ok"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	for _, path := range []string{"/docs", "/docs", "/missing", "/ok"} {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	expectLines(t, scrape(t, m),
+		`linksh_redirects_total{status="200"} 1`,
+		`linksh_redirects_total{status="302"} 2`,
+		`linksh_redirects_total{status="404"} 1`,
+	)
+
+	var nilMetrics *Metrics
+	nilMetrics.ObserveStorage("GetLink", 0, nil)
+	nilMetrics.RedirectMiddleware(http.NotFoundHandler()).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+}
@@ -0,0 +1,377 @@
+package metrics
+
+import (
+	"github.com/nethruster/linksh/pkg/interfaces/link_repository"
+	istorage "github.com/nethruster/linksh/pkg/interfaces/storage"
+	"github.com/nethruster/linksh/pkg/interfaces/user_repository"
+	"github.com/nethruster/linksh/pkg/models"
+	"time"
+)
+
+//Storage wraps an IStorage, such as a mongo.Storage, recording the latency and the errors of every call in the metrics
+//Every method is wrapped explicitly, so the build fails until a method added to IStorage is wrapped too
+type Storage struct {
+	storage istorage.IStorage
+	Metrics *Metrics
+}
+
+var _ istorage.IStorage = (*Storage)(nil)
+
+//InstrumentStorage wraps a storage so its calls are recorded in the metrics
+func InstrumentStorage(storage istorage.IStorage, metrics *Metrics) *Storage {
+	return &Storage{storage: storage, Metrics: metrics}
+}
+
+func (s *Storage) observe(method string, start time.Time, err *error) {
+	s.Metrics.ObserveStorage(method, time.Since(start), *err)
+}
+
+//User related methods
+
+func (s *Storage) SaveUser(user models.User) (err error) {
+	defer s.observe("SaveUser", time.Now(), &err)
+	return s.storage.SaveUser(user)
+}
+
+func (s *Storage) GetUser(id string) (user models.User, err error) {
+	defer s.observe("GetUser", time.Now(), &err)
+	return s.storage.GetUser(id)
+}
+
+func (s *Storage) GetUserByName(name string) (user models.User, err error) {
+	defer s.observe("GetUserByName", time.Now(), &err)
+	return s.storage.GetUserByName(name)
+}
+
+func (s *Storage) ListUsers(limit, offset uint) (users []models.User, err error) {
+	defer s.observe("ListUsers", time.Now(), &err)
+	return s.storage.ListUsers(limit, offset)
+}
+
+func (s *Storage) UpdateUser(user user_repository.UpdatePayload) (err error) {
+	defer s.observe("UpdateUser", time.Now(), &err)
+	return s.storage.UpdateUser(user)
+}
+
+func (s *Storage) DeleteUser(id string) (err error) {
+	defer s.observe("DeleteUser", time.Now(), &err)
+	return s.storage.DeleteUser(id)
+}
+
+func (s *Storage) TrashUser(id string, deletedAt int64) (err error) {
+	defer s.observe("TrashUser", time.Now(), &err)
+	return s.storage.TrashUser(id, deletedAt)
+}
+
+func (s *Storage) RestoreUser(id string) (err error) {
+	defer s.observe("RestoreUser", time.Now(), &err)
+	return s.storage.RestoreUser(id)
+}
+
+func (s *Storage) ListTrashedUsers(limit, offset uint) (users []models.User, err error) {
+	defer s.observe("ListTrashedUsers", time.Now(), &err)
+	return s.storage.ListTrashedUsers(limit, offset)
+}
+
+func (s *Storage) PurgeUsers(deletedBefore int64) (count uint, err error) {
+	defer s.observe("PurgeUsers", time.Now(), &err)
+	return s.storage.PurgeUsers(deletedBefore)
+}
+
+//Link related methods
+
+func (s *Storage) SaveLink(link models.Link) (err error) {
+	defer s.observe("SaveLink", time.Now(), &err)
+	return s.storage.SaveLink(link)
+}
+
+func (s *Storage) GetLink(id string) (link models.Link, err error) {
+	defer s.observe("GetLink", time.Now(), &err)
+	return s.storage.GetLink(id)
+}
+
+func (s *Storage) GetLinks(ids []string) (links []models.Link, err error) {
+	defer s.observe("GetLinks", time.Now(), &err)
+	return s.storage.GetLinks(ids)
+}
+
+func (s *Storage) ListLinks(ownerID string, limit, offset uint) (links []models.Link, err error) {
+	defer s.observe("ListLinks", time.Now(), &err)
+	return s.storage.ListLinks(ownerID, limit, offset)
+}
+
+func (s *Storage) ListLinksAfter(afterID string, limit uint) (links []models.Link, err error) {
+	defer s.observe("ListLinksAfter", time.Now(), &err)
+	return s.storage.ListLinksAfter(afterID, limit)
+}
+
+func (s *Storage) ListLinksBySuggestionKeys(keys []string, prefix string, limit uint) (links []models.Link, err error) {
+	defer s.observe("ListLinksBySuggestionKeys", time.Now(), &err)
+	return s.storage.ListLinksBySuggestionKeys(keys, prefix, limit)
+}
+
+func (s *Storage) UpdateLinkSuggestionKeys(id string, keys []string) (err error) {
+	defer s.observe("UpdateLinkSuggestionKeys", time.Now(), &err)
+	return s.storage.UpdateLinkSuggestionKeys(id, keys)
+}
+
+func (s *Storage) UpdateLinkContent(id, content string) (err error) {
+	defer s.observe("UpdateLinkContent", time.Now(), &err)
+	return s.storage.UpdateLinkContent(id, content)
+}
+
+func (s *Storage) UpdateLink(payload link_repository.UpdatePayload) (err error) {
+	defer s.observe("UpdateLink", time.Now(), &err)
+	return s.storage.UpdateLink(payload)
+}
+
+func (s *Storage) DeleteLink(id string) (err error) {
+	defer s.observe("DeleteLink", time.Now(), &err)
+	return s.storage.DeleteLink(id)
+}
+
+func (s *Storage) TrashLink(id string, deletedAt int64) (err error) {
+	defer s.observe("TrashLink", time.Now(), &err)
+	return s.storage.TrashLink(id, deletedAt)
+}
+
+func (s *Storage) RestoreLink(id string) (err error) {
+	defer s.observe("RestoreLink", time.Now(), &err)
+	return s.storage.RestoreLink(id)
+}
+
+func (s *Storage) GetTrashedLink(id string) (link models.Link, err error) {
+	defer s.observe("GetTrashedLink", time.Now(), &err)
+	return s.storage.GetTrashedLink(id)
+}
+
+func (s *Storage) ListTrashedLinks(ownerID string, limit, offset uint) (links []models.Link, err error) {
+	defer s.observe("ListTrashedLinks", time.Now(), &err)
+	return s.storage.ListTrashedLinks(ownerID, limit, offset)
+}
+
+func (s *Storage) PurgeLinks(deletedBefore int64) (count uint, err error) {
+	defer s.observe("PurgeLinks", time.Now(), &err)
+	return s.storage.PurgeLinks(deletedBefore)
+}
+
+func (s *Storage) IncreaseLinkHitCount(id string) (err error) {
+	defer s.observe("IncreaseLinkHitCount", time.Now(), &err)
+	return s.storage.IncreaseLinkHitCount(id)
+}
+
+func (s *Storage) AddLinkAlias(id, alias string) (err error) {
+	defer s.observe("AddLinkAlias", time.Now(), &err)
+	return s.storage.AddLinkAlias(id, alias)
+}
+
+func (s *Storage) RemoveLinkAlias(id, alias string) (err error) {
+	defer s.observe("RemoveLinkAlias", time.Now(), &err)
+	return s.storage.RemoveLinkAlias(id, alias)
+}
+
+func (s *Storage) IncreaseLinkVariantHitCount(id, variant string) (err error) {
+	defer s.observe("IncreaseLinkVariantHitCount", time.Now(), &err)
+	return s.storage.IncreaseLinkVariantHitCount(id, variant)
+}
+
+func (s *Storage) IncreaseLinkRuleHitCount(id, rule string) (err error) {
+	defer s.observe("IncreaseLinkRuleHitCount", time.Now(), &err)
+	return s.storage.IncreaseLinkRuleHitCount(id, rule)
+}
+
+func (s *Storage) IncreaseLinkFallbackHitCount(id string) (err error) {
+	defer s.observe("IncreaseLinkFallbackHitCount", time.Now(), &err)
+	return s.storage.IncreaseLinkFallbackHitCount(id)
+}
+
+func (s *Storage) UpdateLinksOwner(items []models.LinkTransferItem, ownerID string) (err error) {
+	defer s.observe("UpdateLinksOwner", time.Now(), &err)
+	return s.storage.UpdateLinksOwner(items, ownerID)
+}
+
+func (s *Storage) CountLinks(ownerID string, createdSince int64) (count uint, err error) {
+	defer s.observe("CountLinks", time.Now(), &err)
+	return s.storage.CountLinks(ownerID, createdSince)
+}
+
+func (s *Storage) UpdateLinkHealth(id, content string, health models.LinkHealth) (err error) {
+	defer s.observe("UpdateLinkHealth", time.Now(), &err)
+	return s.storage.UpdateLinkHealth(id, content, health)
+}
+
+func (s *Storage) ListBrokenLinks(ownerID string, limit, offset uint) (links []models.Link, err error) {
+	defer s.observe("ListBrokenLinks", time.Now(), &err)
+	return s.storage.ListBrokenLinks(ownerID, limit, offset)
+}
+
+//Link transfer related methods
+
+func (s *Storage) SaveLinkTransfer(transfer models.LinkTransfer) (err error) {
+	defer s.observe("SaveLinkTransfer", time.Now(), &err)
+	return s.storage.SaveLinkTransfer(transfer)
+}
+
+func (s *Storage) GetLinkTransfer(id string) (linkTransfer models.LinkTransfer, err error) {
+	defer s.observe("GetLinkTransfer", time.Now(), &err)
+	return s.storage.GetLinkTransfer(id)
+}
+
+func (s *Storage) ListLinkTransfers(userID string, limit, offset uint) (linkTransfers []models.LinkTransfer, err error) {
+	defer s.observe("ListLinkTransfers", time.Now(), &err)
+	return s.storage.ListLinkTransfers(userID, limit, offset)
+}
+
+func (s *Storage) UpdateLinkTransferStatus(id string, status models.LinkTransferStatus, resolvedAt int64) (err error) {
+	defer s.observe("UpdateLinkTransferStatus", time.Now(), &err)
+	return s.storage.UpdateLinkTransferStatus(id, status, resolvedAt)
+}
+
+//Link version related methods
+
+func (s *Storage) SaveLinkVersion(version models.LinkVersion) (err error) {
+	defer s.observe("SaveLinkVersion", time.Now(), &err)
+	return s.storage.SaveLinkVersion(version)
+}
+
+func (s *Storage) GetLinkVersion(id string) (linkVersion models.LinkVersion, err error) {
+	defer s.observe("GetLinkVersion", time.Now(), &err)
+	return s.storage.GetLinkVersion(id)
+}
+
+func (s *Storage) ListLinkVersions(linkID string, limit, offset uint) (linkVersions []models.LinkVersion, err error) {
+	defer s.observe("ListLinkVersions", time.Now(), &err)
+	return s.storage.ListLinkVersions(linkID, limit, offset)
+}
+
+func (s *Storage) DeleteLinkVersion(id string) (err error) {
+	defer s.observe("DeleteLinkVersion", time.Now(), &err)
+	return s.storage.DeleteLinkVersion(id)
+}
+
+//Audit related methods
+
+func (s *Storage) SaveAuditRecord(record models.AuditRecord) (err error) {
+	defer s.observe("SaveAuditRecord", time.Now(), &err)
+	return s.storage.SaveAuditRecord(record)
+}
+
+func (s *Storage) ListAuditRecords(filter models.AuditFilter, limit, offset uint) (auditRecords []models.AuditRecord, err error) {
+	defer s.observe("ListAuditRecords", time.Now(), &err)
+	return s.storage.ListAuditRecords(filter, limit, offset)
+}
+
+//Webhook related methods
+
+func (s *Storage) SaveWebhook(webhook models.Webhook) (err error) {
+	defer s.observe("SaveWebhook", time.Now(), &err)
+	return s.storage.SaveWebhook(webhook)
+}
+
+func (s *Storage) GetWebhook(id string) (webhook models.Webhook, err error) {
+	defer s.observe("GetWebhook", time.Now(), &err)
+	return s.storage.GetWebhook(id)
+}
+
+func (s *Storage) ListWebhooks(ownerID string, limit, offset uint) (webhooks []models.Webhook, err error) {
+	defer s.observe("ListWebhooks", time.Now(), &err)
+	return s.storage.ListWebhooks(ownerID, limit, offset)
+}
+
+func (s *Storage) ListWebhooksByEvent(event models.WebhookEvent, ownerID string) (webhooks []models.Webhook, err error) {
+	defer s.observe("ListWebhooksByEvent", time.Now(), &err)
+	return s.storage.ListWebhooksByEvent(event, ownerID)
+}
+
+func (s *Storage) DeleteWebhook(id string) (err error) {
+	defer s.observe("DeleteWebhook", time.Now(), &err)
+	return s.storage.DeleteWebhook(id)
+}
+
+func (s *Storage) SaveWebhookDelivery(delivery models.WebhookDelivery) (err error) {
+	defer s.observe("SaveWebhookDelivery", time.Now(), &err)
+	return s.storage.SaveWebhookDelivery(delivery)
+}
+
+func (s *Storage) GetWebhookDelivery(id string) (webhookDelivery models.WebhookDelivery, err error) {
+	defer s.observe("GetWebhookDelivery", time.Now(), &err)
+	return s.storage.GetWebhookDelivery(id)
+}
+
+func (s *Storage) ListWebhookDeliveries(webhookID string, limit, offset uint) (webhookDeliveries []models.WebhookDelivery, err error) {
+	defer s.observe("ListWebhookDeliveries", time.Now(), &err)
+	return s.storage.ListWebhookDeliveries(webhookID, limit, offset)
+}
+
+func (s *Storage) ListPendingWebhookDeliveries(afterID string, limit uint) (webhookDeliveries []models.WebhookDelivery, err error) {
+	defer s.observe("ListPendingWebhookDeliveries", time.Now(), &err)
+	return s.storage.ListPendingWebhookDeliveries(afterID, limit)
+}
+
+//Quota related methods
+
+func (s *Storage) SaveUserQuota(quota models.UserQuota) (err error) {
+	defer s.observe("SaveUserQuota", time.Now(), &err)
+	return s.storage.SaveUserQuota(quota)
+}
+
+func (s *Storage) GetUserQuota(userID string) (userQuota models.UserQuota, err error) {
+	defer s.observe("GetUserQuota", time.Now(), &err)
+	return s.storage.GetUserQuota(userID)
+}
+
+func (s *Storage) DeleteUserQuota(userID string) (err error) {
+	defer s.observe("DeleteUserQuota", time.Now(), &err)
+	return s.storage.DeleteUserQuota(userID)
+}
+
+//Counter related methods
+
+func (s *Storage) IncreaseCounter(name string) (value uint64, err error) {
+	defer s.observe("IncreaseCounter", time.Now(), &err)
+	return s.storage.IncreaseCounter(name)
+}
+
+func (s *Storage) GetCounter(name string) (value uint64, err error) {
+	defer s.observe("GetCounter", time.Now(), &err)
+	return s.storage.GetCounter(name)
+}
+
+//Rate limit related methods
+
+func (s *Storage) GetRateLimitBucket(key string) (rateLimitBucket models.RateLimitBucket, err error) {
+	defer s.observe("GetRateLimitBucket", time.Now(), &err)
+	return s.storage.GetRateLimitBucket(key)
+}
+
+func (s *Storage) SaveRateLimitBucket(bucket models.RateLimitBucket, previousUpdatedAt int64) (err error) {
+	defer s.observe("SaveRateLimitBucket", time.Now(), &err)
+	return s.storage.SaveRateLimitBucket(bucket, previousUpdatedAt)
+}
+
+//Session related methods
+
+func (s *Storage) SaveSession(session models.Session) (err error) {
+	defer s.observe("SaveSession", time.Now(), &err)
+	return s.storage.SaveSession(session)
+}
+
+func (s *Storage) GetSession(id string) (session models.Session, err error) {
+	defer s.observe("GetSession", time.Now(), &err)
+	return s.storage.GetSession(id)
+}
+
+func (s *Storage) ListSessions(ownerID string, limit, offset uint) (sessions []models.Session, err error) {
+	defer s.observe("ListSessions", time.Now(), &err)
+	return s.storage.ListSessions(ownerID, limit, offset)
+}
+
+func (s *Storage) UpdateSessionToken(id string, tokenID string) (err error) {
+	defer s.observe("UpdateSessionToken", time.Now(), &err)
+	return s.storage.UpdateSessionToken(id, tokenID)
+}
+
+func (s *Storage) DeleteSession(id string) (err error) {
+	defer s.observe("DeleteSession", time.Now(), &err)
+	return s.storage.DeleteSession(id)
+}
@@ -0,0 +1,77 @@
+package models
+
+//AuditAction represents the kind of operation recorded in an AuditRecord
+type AuditAction string
+
+const (
+	AuditCreate  AuditAction = "create"
+	AuditUpdate  AuditAction = "update"
+	AuditDelete  AuditAction = "delete"
+	AuditRestore AuditAction = "restore"
+	//AuditRead is only recorded when the read was denied
+	AuditRead AuditAction = "read"
+)
+
+//AuditTargetType represents the kind of element affected by an AuditRecord
+type AuditTargetType string
+
+const (
+	AuditTargetLink     AuditTargetType = "link"
+	AuditTargetUser     AuditTargetType = "user"
+	AuditTargetSession  AuditTargetType = "session"
+	AuditTargetQuota    AuditTargetType = "quota"
+	AuditTargetTransfer AuditTargetType = "transfer"
+	//AuditTargetAudit is the target of the denied reads of the audit log
+	AuditTargetAudit AuditTargetType = "audit"
+)
+
+//AuditRecord records an operation that changed the storage, or that was denied for lack of privileges
+//The records are never updated nor deleted
+type AuditRecord struct {
+	ID string `json:"id" bson:"_id"`
+	//Number is the position of the record in the log, starting at 1
+	Number uint64 `json:"number" bson:"number"`
+	//ActorID is the ID of the user who performed the operation, it is empty when it was performed by the system
+	ActorID    string          `json:"actorId" bson:"actorId"`
+	Action     AuditAction     `json:"action" bson:"action"`
+	TargetType AuditTargetType `json:"targetType" bson:"targetType"`
+	//TargetID is the ID of the affected element, it is empty when it was not known, like for the denied listings
+	TargetID string `json:"targetId" bson:"targetId"`
+	//Changes are the fields of the target modified by the operation
+	Changes []AuditChange `json:"changes,omitempty" bson:"changes,omitempty"`
+	//Denied tells the operation was not performed because the actor lacked the privileges
+	Denied  bool            `json:"denied,omitempty" bson:"denied,omitempty"`
+	Request RequestMetadata `json:"request" bson:"request"`
+	//CreatedAt must be an Unix EPOCH
+	CreatedAt int64 `json:"createdAt" bson:"createdAt"`
+}
+
+//AuditChange describes the change of a field of the target of an AuditRecord
+type AuditChange struct {
+	Field string `json:"field" bson:"field"`
+	//Before and After are the JSON encoding of the value of the field, they are empty when the field was not set
+	//The secret fields, like the passwords, are recorded without their values
+	Before string `json:"before,omitempty" bson:"before,omitempty"`
+	After  string `json:"after,omitempty" bson:"after,omitempty"`
+}
+
+//RequestMetadata describes the request an operation was performed for
+type RequestMetadata struct {
+	//RequestID is the identifier given to the request by the caller, like the one of its logs
+	RequestID string `json:"requestId,omitempty" bson:"requestId,omitempty"`
+	IP        string `json:"ip,omitempty" bson:"ip,omitempty"`
+	UserAgent string `json:"userAgent,omitempty" bson:"userAgent,omitempty"`
+}
+
+//AuditFilter selects AuditRecords, only the not empty fields are taken into account
+type AuditFilter struct {
+	ActorID    string          `json:"actorId,omitempty"`
+	Action     AuditAction     `json:"action,omitempty"`
+	TargetType AuditTargetType `json:"targetType,omitempty"`
+	TargetID   string          `json:"targetId,omitempty"`
+	//DeniedOnly limits the selection to the denied operations
+	DeniedOnly bool `json:"deniedOnly,omitempty"`
+	//Since and Until must be Unix EPOCHs, the records created at Until are excluded
+	Since int64 `json:"since,omitempty"`
+	Until int64 `json:"until,omitempty"`
+}
@@ -1,13 +1,131 @@
 package models
 
+import "net/http"
+
+//LinkType represents how a link is matched against the requested paths
+type LinkType string
+
+const (
+	//LinkTypeStatic links only match their own ID, it is the default type
+	LinkTypeStatic LinkType = ""
+	//LinkTypePrefix links also match the paths starting with their ID followed by a slash, like "gh/nethruster/linksh" for "gh"
+	//Their content is a template where the rest of the path and the query can be placed
+	LinkTypePrefix LinkType = "prefix"
+)
+
+//QueryPassthrough represents how the query and the fragment of a visit are passed to the content of a link
+type QueryPassthrough string
+
+const (
+	//QueryPassthroughNone drops the query and the fragment of the visit, it is the default
+	QueryPassthroughNone QueryPassthrough = ""
+	//QueryPassthroughOverride merges the query of the visit into the one of the content, replacing the parameters present in both
+	//The fragment of the visit also replaces the one of the content
+	QueryPassthroughOverride QueryPassthrough = "override"
+	//QueryPassthroughKeepExisting merges the query of the visit into the one of the content, keeping the parameters of the content
+	//The fragment of the visit is only used if the content has none
+	QueryPassthroughKeepExisting QueryPassthrough = "keep"
+)
+
+//RedirectMode represents how the visitor of a link is sent to its target
+type RedirectMode string
+
+const (
+	//RedirectTemporary redirects with a 302 Found, it is the default
+	RedirectTemporary RedirectMode = ""
+	//RedirectTemporaryKeepMethod redirects with a 307 Temporary Redirect
+	RedirectTemporaryKeepMethod RedirectMode = "307"
+	//RedirectPermanent redirects with a 301 Moved Permanently
+	RedirectPermanent RedirectMode = "301"
+	//RedirectPermanentKeepMethod redirects with a 308 Permanent Redirect
+	RedirectPermanentKeepMethod RedirectMode = "308"
+	//RedirectMetaRefresh serves an HTML page that sends the visitor to the target with a meta refresh
+	RedirectMetaRefresh RedirectMode = "meta-refresh"
+	//RedirectInterstitial serves an HTML page warning the visitor that they are leaving, showing the target
+	RedirectInterstitial RedirectMode = "interstitial"
+)
+
+//StatusCode returns the HTTP status code of the response for the mode, pages are served with a 200 OK
+func (m RedirectMode) StatusCode() int {
+	switch m {
+	case RedirectTemporaryKeepMethod:
+		return http.StatusTemporaryRedirect
+	case RedirectPermanent:
+		return http.StatusMovedPermanently
+	case RedirectPermanentKeepMethod:
+		return http.StatusPermanentRedirect
+	case RedirectMetaRefresh, RedirectInterstitial:
+		return http.StatusOK
+	}
+	return http.StatusFound
+}
+
+//IsPage reports whether the mode serves an HTML page instead of a redirect
+func (m RedirectMode) IsPage() bool {
+	return m == RedirectMetaRefresh || m == RedirectInterstitial
+}
+
+//LinkState represents if a link is being served at a given moment according to its activation window
+type LinkState string
+
+const (
+	//LinkActive links are served, it is the state of the links without an activation window
+	LinkActive LinkState = "active"
+	//LinkScheduled links will be served once their ActivatesAt is reached
+	LinkScheduled LinkState = "scheduled"
+	//LinkExpired links are not served anymore as their DeactivatesAt was reached
+	LinkExpired LinkState = "expired"
+)
+
 //Link represents a link in the core logic
 type Link struct {
 	//ID must be unique and no longer that 100 characters
 	ID        string   `json:"id" bson:"_id"`
-	//Content must be no longer that 2000 characters
+	//DisplayID is the ID as it was typed by its creator, it is only set when the IDs are case insensitive, as ID is then lowercased
+	DisplayID string `json:"displayId,omitempty" bson:"displayId,omitempty"`
+	Type      LinkType `json:"type,omitempty" bson:"type,omitempty"`
+	//Aliases are other IDs of the link, they must be unique among the IDs and the aliases of all the links
+	Aliases []string `json:"aliases,omitempty" bson:"aliases,omitempty"`
+	//SuggestionKeys are the forms of the ID under which the link is found when suggesting the IDs close to an unknown one
+	SuggestionKeys []string `json:"-" bson:"suggestionKeys,omitempty"`
+	//Content must be an absolute URL no longer that 2000 characters
 	Content   string   `json:"content" bson:"content"`
 	Hits      uint     `json:"hits" bson:"hits"`
 	//CreatedAt must be an Unix EPOCH
 	CreatedAt int64 `json:"createdAt" bson:"createdAt"`
 	OwnerID   string    `json:"ownerId" bson:"ownerId"`
+	QueryPassthrough QueryPassthrough `json:"queryPassthrough,omitempty" bson:"queryPassthrough,omitempty"`
+	RedirectMode     RedirectMode     `json:"redirectMode,omitempty" bson:"redirectMode,omitempty"`
+	//Variants replace the content when present, every visit is sent to one of them as set by the rotation
+	Variants []LinkVariant `json:"variants,omitempty" bson:"variants,omitempty"`
+	Rotation Rotation      `json:"rotation,omitempty" bson:"rotation,omitempty"`
+	//Rules are evaluated before the variants, the visits matching one of them are sent to its content
+	Rules []LinkRule `json:"rules,omitempty" bson:"rules,omitempty"`
+	//UTM are appended to the target on every visit, the parameters already in the target win
+	UTM UTMTags `json:"utm" bson:"utm,omitempty"`
+	//Health is the result of the last health check of the content
+	Health LinkHealth `json:"health" bson:"health"`
+	//ActivatesAt must be an Unix EPOCH, the link is not served before it, 0 means the link is active since its creation
+	ActivatesAt int64 `json:"activatesAt,omitempty" bson:"activatesAt,omitempty"`
+	//DeactivatesAt must be an Unix EPOCH, the link is not served since it, 0 means the link never expires
+	DeactivatesAt int64 `json:"deactivatesAt,omitempty" bson:"deactivatesAt,omitempty"`
+	//Fallback is where the visitors are sent outside of the activation window, if empty the link is treated as nonexistent
+	Fallback string `json:"fallback,omitempty" bson:"fallback,omitempty"`
+	//FallbackHits counts the visits sent to the fallback, they are not included in Hits
+	FallbackHits uint `json:"fallbackHits,omitempty" bson:"fallbackHits,omitempty"`
+	//DeletedAt must be an Unix EPOCH, it is 0 unless the link was deleted and is waiting to be purged
+	DeletedAt int64 `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+	//State is computed when the link is read from the repository, it is not stored
+	State LinkState `json:"state,omitempty" bson:"-"`
+}
+
+//StateAt returns the state of the link at the specified Unix EPOCH
+func (l Link) StateAt(now int64) LinkState {
+	switch {
+	case l.ActivatesAt != 0 && now < l.ActivatesAt:
+		return LinkScheduled
+	case l.DeactivatesAt != 0 && now >= l.DeactivatesAt:
+		return LinkExpired
+	}
+	return LinkActive
 }
@@ -0,0 +1,22 @@
+package models
+
+//LinkHealth is the result of checking if the content of a link is still reachable
+type LinkHealth struct {
+	//StatusCode is the HTTP status of the last response, it is 0 when no response was received
+	StatusCode int `json:"statusCode" bson:"statusCode"`
+	//FinalURL is the URL reached after following the redirects
+	FinalURL string `json:"finalUrl" bson:"finalUrl"`
+	//Error describes why the request failed, if it did
+	Error string `json:"error,omitempty" bson:"error,omitempty"`
+	//Dead is true when the content could not be reached or the server answered that it is gone
+	Dead bool `json:"dead" bson:"dead"`
+	//HostChanged is true when the content redirects to a different host
+	HostChanged bool `json:"hostChanged" bson:"hostChanged"`
+	//CheckedAt must be an Unix EPOCH, it is 0 if the link was never checked
+	CheckedAt int64 `json:"checkedAt" bson:"checkedAt"`
+}
+
+//Broken returns if the link needs the attention of its owner
+func (h LinkHealth) Broken() bool {
+	return h.Dead || h.HostChanged
+}
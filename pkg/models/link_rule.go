@@ -0,0 +1,27 @@
+package models
+
+//Platform represents a kind of client detected from the user agent of a visit
+type Platform string
+
+const (
+	//PlatformIOS matches the iPhones, iPads and iPods
+	PlatformIOS Platform = "ios"
+	//PlatformAndroid matches the Android devices
+	PlatformAndroid Platform = "android"
+	//PlatformDesktop matches the browsers that are not mobile nor bots
+	PlatformDesktop Platform = "desktop"
+	//PlatformBot matches the known bots that fetch links to show their previews, like the ones of the social networks and chats
+	PlatformBot Platform = "bot"
+)
+
+//LinkRule sends the visits from the specified platforms to its own content
+//The rules of a link are evaluated in order, and the first one matching the visit is used
+type LinkRule struct {
+	//Name must be unique in the link and no longer that 100 characters
+	Name string `json:"name" bson:"name"`
+	//Platforms must not be empty, the rule matches a visit from any of them
+	Platforms []Platform `json:"platforms" bson:"platforms"`
+	//Content follows the same rules as the content of the link
+	Content string `json:"content" bson:"content"`
+	Hits    uint   `json:"hits" bson:"hits"`
+}
@@ -0,0 +1,34 @@
+package models
+
+//LinkTransferStatus represents the state of a LinkTransfer
+type LinkTransferStatus string
+
+const (
+	//LinkTransferPending is the status of a transfer waiting to be accepted by the recipient
+	LinkTransferPending LinkTransferStatus = "pending"
+	//LinkTransferCompleted is the status of a transfer whose links already belong to the recipient
+	LinkTransferCompleted LinkTransferStatus = "completed"
+	//LinkTransferRejected is the status of a transfer declined by the recipient or cancelled by the requester
+	LinkTransferRejected LinkTransferStatus = "rejected"
+)
+
+//LinkTransfer records a change of ownership of one or more links
+type LinkTransfer struct {
+	ID    string             `json:"id" bson:"_id"`
+	Items []LinkTransferItem `json:"items" bson:"items"`
+	//ToID is the ID of the user that will own the links
+	ToID string `json:"toId" bson:"toId"`
+	//RequesterID is the ID of the user who requested the transfer, it is empty when the transfer was performed by the system
+	RequesterID string             `json:"requesterId" bson:"requesterId"`
+	Status      LinkTransferStatus `json:"status" bson:"status"`
+	//CreatedAt must be an Unix EPOCH
+	CreatedAt int64 `json:"createdAt" bson:"createdAt"`
+	//ResolvedAt must be an Unix EPOCH, it is 0 while the transfer is pending
+	ResolvedAt int64 `json:"resolvedAt" bson:"resolvedAt"`
+}
+
+//LinkTransferItem represents a link included in a LinkTransfer
+type LinkTransferItem struct {
+	LinkID          string `json:"linkId" bson:"linkId"`
+	PreviousOwnerID string `json:"previousOwnerId" bson:"previousOwnerId"`
+}
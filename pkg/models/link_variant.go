@@ -0,0 +1,22 @@
+package models
+
+//Rotation represents how one of the variants of a link is chosen on every visit
+type Rotation string
+
+const (
+	//RotationWeighted chooses a variant at random, with a probability proportional to its weight, it is the default
+	RotationWeighted Rotation = ""
+	//RotationRoundRobin goes through the variants in order, visiting each of them as many times as its weight
+	RotationRoundRobin Rotation = "round-robin"
+)
+
+//LinkVariant is one of the destinations of a link that splits its visits between several of them
+type LinkVariant struct {
+	//Name must be unique in the link and no longer that 100 characters
+	Name string `json:"name" bson:"name"`
+	//Content follows the same rules as the content of the link
+	Content string `json:"content" bson:"content"`
+	//Weight must be greater than 0
+	Weight uint `json:"weight" bson:"weight"`
+	Hits   uint `json:"hits" bson:"hits"`
+}
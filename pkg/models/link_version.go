@@ -0,0 +1,17 @@
+package models
+
+//LinkVersion records a change of the content of a link
+type LinkVersion struct {
+	ID     string `json:"id" bson:"_id"`
+	LinkID string `json:"linkId" bson:"linkId"`
+	//Number is the position of the version in the history of the link, starting at 1
+	Number uint64 `json:"number" bson:"number"`
+	//Content is the content set by the change
+	Content string `json:"content" bson:"content"`
+	//PreviousContent is the content before the change, it is empty for the version created with the link
+	PreviousContent string `json:"previousContent" bson:"previousContent"`
+	//EditorID is the ID of the user who made the change, it is empty when the change was made by the system
+	EditorID string `json:"editorId" bson:"editorId"`
+	//CreatedAt must be an Unix EPOCH
+	CreatedAt int64 `json:"createdAt" bson:"createdAt"`
+}
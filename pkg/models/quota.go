@@ -0,0 +1,29 @@
+package models
+
+//Quota represents the limits on the links an user can create
+//A limit set to 0 means that there is no limit
+type Quota struct {
+	//MaxLinks is the maximum number of links an user can own
+	MaxLinks uint `json:"maxLinks" bson:"maxLinks"`
+	//MaxLinksPerDay is the maximum number of links an user can create in the last 24 hours
+	MaxLinksPerDay uint `json:"maxLinksPerDay" bson:"maxLinksPerDay"`
+}
+
+//UserQuota is a Quota set to a specific user, it overrides the one of the role of the user
+type UserQuota struct {
+	UserID string `json:"userId" bson:"_id"`
+	Quota  `bson:",inline"`
+}
+
+//QuotaUsage represents the current usage of the quota of an user
+type QuotaUsage struct {
+	UserID string `json:"userId"`
+	//Quota is the quota in effect for the user
+	Quota Quota `json:"quota"`
+	//Overridden is true when the quota was set specifically for the user instead of coming from its role
+	Overridden bool `json:"overridden"`
+	//Links is the number of links owned by the user
+	Links uint `json:"links"`
+	//LinksLastDay is the number of links created by the user in the last 24 hours
+	LinksLastDay uint `json:"linksLastDay"`
+}
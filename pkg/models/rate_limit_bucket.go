@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+//RateLimitBucket represents the state of a token bucket of a rate limiter
+type RateLimitBucket struct {
+	Key    string  `json:"key" bson:"_id"`
+	Tokens float64 `json:"tokens" bson:"tokens"`
+	//UpdatedAt must be an Unix EPOCH in nanoseconds
+	UpdatedAt int64 `json:"updatedAt" bson:"updatedAt"`
+	//ExpiresAt is when the bucket will be full again, so it can be removed from then on as a new bucket is equivalent
+	//It is the zero time if the bucket never refills
+	ExpiresAt time.Time `json:"expiresAt" bson:"expiresAt,omitempty"`
+}
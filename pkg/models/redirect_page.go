@@ -0,0 +1,57 @@
+package models
+
+import (
+	"html/template"
+	"io"
+	"net/http"
+)
+
+//redirectPages are the HTML pages of the modes that don't redirect, the target is escaped by html/template
+var redirectPages = template.Must(template.New(string(RedirectMetaRefresh)).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="0; url={{.}}">
+<title>Redirecting</title>
+</head>
+<body>
+<p>Redirecting to <a href="{{.}}">{{.}}</a></p>
+</body>
+</html>
+`))
+
+func init() {
+	template.Must(redirectPages.New(string(RedirectInterstitial)).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="robots" content="noindex">
+<title>You are leaving</title>
+</head>
+<body>
+<p>This link is taking you to another site:</p>
+<p><a href="{{.}}" rel="noopener noreferrer">{{.}}</a></p>
+</body>
+</html>
+`))
+}
+
+//WritePage writes the HTML page of the mode sending the visitor to the target
+//It only writes the body, the modes that don't serve a page write nothing
+func (m RedirectMode) WritePage(w io.Writer, target string) error {
+	if !m.IsPage() {
+		return nil
+	}
+	return redirectPages.ExecuteTemplate(w, string(m), target)
+}
+
+//Respond sends the visitor to the target as set by the mode, with a redirect or an HTML page
+func (m RedirectMode) Respond(w http.ResponseWriter, r *http.Request, target string) error {
+	if !m.IsPage() {
+		http.Redirect(w, r, target, m.StatusCode())
+		return nil
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(m.StatusCode())
+	return m.WritePage(w, target)
+}
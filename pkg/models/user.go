@@ -6,4 +6,12 @@ type User struct {
 	Name     string `json:"name" bson:"name"`  //must be unique and no longer that 100 characters
 	Password []byte `json:"-" bson:"password"` //must be at least than six characters long
 	IsAdmin  bool   `json:"isAdmin"`
+	//UTM are the default UTM parameters of the links owned by the user
+	UTM      UTMTags `json:"utm" bson:"utm,omitempty"`
+	//Fallback is where the visitors of the unknown or expired links of the user are sent, if empty the instance fallback is used
+	Fallback string `json:"fallback,omitempty" bson:"fallback,omitempty"`
+	//SuggestLinks allows suggesting the IDs of the links of the user to the visitors of the unknown IDs, they are not suggested by default
+	SuggestLinks bool `json:"suggestLinks,omitempty" bson:"suggestLinks,omitempty"`
+	//DeletedAt must be an Unix EPOCH, it is 0 unless the user was deleted and is waiting to be purged
+	DeletedAt int64 `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
 }
@@ -0,0 +1,38 @@
+package models
+
+//UTMTags are the UTM parameters appended to the target of a link on every visit
+//The empty fields are not appended
+type UTMTags struct {
+	Source   string `json:"source,omitempty" bson:"source,omitempty"`
+	Medium   string `json:"medium,omitempty" bson:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty" bson:"campaign,omitempty"`
+}
+
+//WithDefaults returns the tags filling the empty fields with the ones of defaults
+func (t UTMTags) WithDefaults(defaults UTMTags) UTMTags {
+	if t.Source == "" {
+		t.Source = defaults.Source
+	}
+	if t.Medium == "" {
+		t.Medium = defaults.Medium
+	}
+	if t.Campaign == "" {
+		t.Campaign = defaults.Campaign
+	}
+	return t
+}
+
+//Parameters returns the tags as query parameters, skipping the empty ones
+func (t UTMTags) Parameters() map[string]string {
+	parameters := make(map[string]string, 3)
+	if t.Source != "" {
+		parameters["utm_source"] = t.Source
+	}
+	if t.Medium != "" {
+		parameters["utm_medium"] = t.Medium
+	}
+	if t.Campaign != "" {
+		parameters["utm_campaign"] = t.Campaign
+	}
+	return parameters
+}
@@ -0,0 +1,81 @@
+package models
+
+// WebhookEvent represents a kind of event notified to the webhooks
+type WebhookEvent string
+
+const (
+	//WebhookLinkCreated is also sent when a deleted link is restored
+	WebhookLinkCreated WebhookEvent = "link.created"
+	WebhookLinkUpdated WebhookEvent = "link.updated"
+	WebhookLinkDeleted WebhookEvent = "link.deleted"
+	//WebhookLinkMilestone is sent when the hits of a link reach one of the milestones of the dispatcher
+	WebhookLinkMilestone WebhookEvent = "link.milestone"
+	//WebhookUserCreated is also sent when a deleted user is restored
+	WebhookUserCreated WebhookEvent = "user.created"
+	WebhookUserUpdated WebhookEvent = "user.updated"
+	WebhookUserDeleted WebhookEvent = "user.deleted"
+)
+
+// Webhook is an endpoint receiving a signed JSON payload for every event it is subscribed to
+type Webhook struct {
+	ID string `json:"id" bson:"_id"`
+	//OwnerID is the user whose links and account trigger the webhook, if empty the webhook is triggered by every link and user
+	OwnerID string `json:"ownerId" bson:"ownerId"`
+	//URL must be an absolute http or https URL, the payloads are sent to it with a POST request
+	URL    string         `json:"url" bson:"url"`
+	Events []WebhookEvent `json:"events" bson:"events"`
+	//Secret is the key of the HMAC-SHA256 signature of the payloads, it is generated when the webhook is created
+	Secret string `json:"secret" bson:"secret"`
+	//CreatedAt must be an Unix EPOCH
+	CreatedAt int64 `json:"createdAt" bson:"createdAt"`
+}
+
+// WebhookDeliveryStatus represents the state of a WebhookDelivery
+type WebhookDeliveryStatus string
+
+const (
+	//WebhookDeliveryPending is the status of a delivery that has not succeeded yet but will be retried
+	WebhookDeliveryPending WebhookDeliveryStatus = "pending"
+	//WebhookDeliverySucceeded is the status of a delivery answered with a 2XX status
+	WebhookDeliverySucceeded WebhookDeliveryStatus = "succeeded"
+	//WebhookDeliveryFailed is the status of a delivery that ran out of attempts
+	WebhookDeliveryFailed WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery records the sending of an event to a webhook
+type WebhookDelivery struct {
+	ID        string       `json:"id" bson:"_id"`
+	WebhookID string       `json:"webhookId" bson:"webhookId"`
+	Event     WebhookEvent `json:"event" bson:"event"`
+	//Payload is the JSON body sent to the webhook
+	Payload string                `json:"payload" bson:"payload"`
+	Status  WebhookDeliveryStatus `json:"status" bson:"status"`
+	//Attempts is the number of times the payload was sent
+	Attempts uint `json:"attempts" bson:"attempts"`
+	//StatusCode is the status of the response to the last attempt, it is 0 if there was no response
+	StatusCode int `json:"statusCode,omitempty" bson:"statusCode,omitempty"`
+	//Error describes why the last attempt failed
+	Error string `json:"error,omitempty" bson:"error,omitempty"`
+	//RedeliveryOf is the ID of the delivery this one sends again, it is empty for the original deliveries
+	RedeliveryOf string `json:"redeliveryOf,omitempty" bson:"redeliveryOf,omitempty"`
+	//CreatedAt and LastAttemptAt must be Unix EPOCHs
+	CreatedAt     int64 `json:"createdAt" bson:"createdAt"`
+	LastAttemptAt int64 `json:"lastAttemptAt,omitempty" bson:"lastAttemptAt,omitempty"`
+}
+
+// WebhookPayload is the JSON body sent to the webhooks
+type WebhookPayload struct {
+	//DeliveryID is the ID of the original delivery of the event, it can be used to ignore the redeliveries already received
+	DeliveryID string       `json:"deliveryId"`
+	Event      WebhookEvent `json:"event"`
+	//CreatedAt must be an Unix EPOCH, it is when the event happened
+	CreatedAt int64 `json:"createdAt"`
+	//Data is the link or the user of the event, the milestones carry a WebhookMilestone
+	Data interface{} `json:"data"`
+}
+
+// WebhookMilestone is the data of the WebhookLinkMilestone events
+type WebhookMilestone struct {
+	Link Link `json:"link"`
+	Hits uint `json:"hits"`
+}
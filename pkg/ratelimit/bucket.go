@@ -0,0 +1,73 @@
+package ratelimit
+
+import (
+	"github.com/nethruster/linksh/pkg/interfaces/rate_limiter"
+	errors "golang.org/x/xerrors"
+	"math"
+	"time"
+)
+
+//ErrInvalidLimit is returned when a limiter is built or used with a Limit without an Interval, as its buckets would never refill
+var ErrInvalidLimit = errors.New("Invalid rate limit")
+
+//Limit sets the size and the refill rate of a token bucket
+type Limit struct {
+	//Burst is the maximum number of tokens in the bucket
+	Burst uint
+	//Interval is the time needed to refill a token, it must be greater than 0
+	Interval time.Duration
+}
+
+//validate checks that the buckets of the limit refill
+func (l Limit) validate() error {
+	if l.Interval <= 0 {
+		return ErrInvalidLimit
+	}
+	return nil
+}
+
+//take refills a bucket with the tokens generated since the last update and tries to consume one of them
+//It returns the tokens left in the bucket and the outcome
+func (l Limit) take(tokens float64, updatedAt, now time.Time) (float64, rate_limiter.Result) {
+	if l.Interval > 0 && now.After(updatedAt) {
+		tokens += float64(now.Sub(updatedAt)) / float64(l.Interval)
+	}
+	if burst := float64(l.Burst); tokens > burst {
+		tokens = burst
+	}
+
+	if tokens >= 1 {
+		tokens--
+		return tokens, rate_limiter.Result{Allowed: true, Remaining: uint(tokens)}
+	}
+	retryAfter := time.Duration(math.Ceil((1 - tokens) * float64(l.Interval)))
+	return tokens, rate_limiter.Result{RetryAfter: retryAfter}
+}
+
+//fullAt returns when a bucket will be full again, or the zero time if it never refills
+func (l Limit) fullAt(tokens float64, updatedAt time.Time) time.Time {
+	if l.Interval <= 0 {
+		return time.Time{}
+	}
+	missing := float64(l.Burst) - tokens
+	if missing <= 0 {
+		return updatedAt
+	}
+	return updatedAt.Add(time.Duration(math.Ceil(missing * float64(l.Interval))))
+}
+
+//full returns if a bucket would be full at the specified time, so it can be forgotten
+func (l Limit) full(tokens float64, updatedAt, now time.Time) bool {
+	if l.Interval <= 0 {
+		return tokens >= float64(l.Burst)
+	}
+	return tokens+float64(now.Sub(updatedAt))/float64(l.Interval) >= float64(l.Burst)
+}
+
+//clock returns the current time as told by now, or by time.Now if it is not set
+func clock(now func() time.Time) time.Time {
+	if now == nil {
+		return time.Now()
+	}
+	return now()
+}
@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"github.com/nethruster/linksh/pkg/interfaces/rate_limiter"
+	"net"
+	"net/http"
+	"strings"
+)
+
+//KeyFunc returns the key of the bucket a request consumes from, if it returns an empty key the request is not limited
+type KeyFunc func(r *http.Request) string
+
+//ClientIP is a KeyFunc that limits the requests by the IP of the client
+//It relies on http.Request.RemoteAddr, so behind a proxy the real address must be restored before reaching it
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+//SessionUser returns a KeyFunc that limits the requests by the user of the bearer token in their Authorization header,
+//so the users sharing an IP, like the ones behind a NAT, have their own buckets
+//The requests without a valid token are limited by the IP of the client, so an invented token doesn't get a bucket of its own
+//validate returns the ID of the user of a token, like session_repository.ISessionRepository.ValidateToken does
+func SessionUser(validate func(token string) (string, error)) KeyFunc {
+	return func(r *http.Request) string {
+		header := r.Header.Get("Authorization")
+		if len(header) > len("Bearer ") && strings.EqualFold(header[:len("Bearer ")], "Bearer ") {
+			if userID, err := validate(header[len("Bearer "):]); err == nil && userID != "" {
+				return "user:" + userID
+			}
+		}
+		return ClientIP(r)
+	}
+}
+
+//WritesOnly wraps a KeyFunc so only the requests with a method other than GET, HEAD or OPTIONS are limited
+func WritesOnly(key KeyFunc) KeyFunc {
+	return func(r *http.Request) string {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			return ""
+		}
+		return key(r)
+	}
+}
+
+//Middleware limits the requests served by next, the ones exceeding the limit get a 429 status with a Retry-After header
+//If the limiter fails the request is served anyway, so an unavailable storage doesn't take the service down
+func Middleware(limiter rate_limiter.IRateLimiter, key KeyFunc, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		k := key(r)
+		if k == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		result, err := limiter.Allow(k)
+		if err == nil && !result.Allowed {
+			w.Header().Set("Retry-After", result.RetryAfterHeader())
+			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
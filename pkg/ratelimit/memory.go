@@ -0,0 +1,79 @@
+package ratelimit
+
+import (
+	"github.com/nethruster/linksh/pkg/interfaces/rate_limiter"
+	"sync"
+	"time"
+)
+
+//pruneEvery is the number of calls to Allow between each removal of the full buckets
+const pruneEvery = 1024
+
+//MemoryLimiter implements IRateLimiter keeping the buckets in memory
+//It is only suitable for single instance deployments, otherwise use a StorageLimiter
+//The zero value is ready to use once the Limit is set, until then Allow returns an ErrInvalidLimit
+type MemoryLimiter struct {
+	Limit Limit
+
+	mutex   sync.Mutex
+	buckets map[string]*memoryBucket
+	calls   uint
+	now     func() time.Time
+}
+
+type memoryBucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+//NewMemoryLimiter creates a MemoryLimiter
+//If the limit has no Interval an ErrInvalidLimit would be returned
+func NewMemoryLimiter(limit Limit) (*MemoryLimiter, error) {
+	if err := limit.validate(); err != nil {
+		return nil, err
+	}
+	return &MemoryLimiter{
+		Limit:   limit,
+		buckets: make(map[string]*memoryBucket),
+		now:     time.Now,
+	}, nil
+}
+
+//Allow consumes a token from the bucket of the key
+//If the Limit has no Interval an ErrInvalidLimit would be returned
+func (ml *MemoryLimiter) Allow(key string) (rate_limiter.Result, error) {
+	if err := ml.Limit.validate(); err != nil {
+		return rate_limiter.Result{}, err
+	}
+	ml.mutex.Lock()
+	defer ml.mutex.Unlock()
+
+	if ml.buckets == nil {
+		ml.buckets = make(map[string]*memoryBucket)
+	}
+	now := clock(ml.now)
+	ml.calls++
+	if ml.calls%pruneEvery == 0 {
+		ml.prune(now)
+	}
+
+	bucket, ok := ml.buckets[key]
+	if !ok {
+		bucket = &memoryBucket{tokens: float64(ml.Limit.Burst), updatedAt: now}
+		ml.buckets[key] = bucket
+	}
+	var result rate_limiter.Result
+	bucket.tokens, result = ml.Limit.take(bucket.tokens, bucket.updatedAt, now)
+	bucket.updatedAt = now
+
+	return result, nil
+}
+
+//prune removes the buckets that are already full as they are equivalent to a new one
+func (ml *MemoryLimiter) prune(now time.Time) {
+	for key, bucket := range ml.buckets {
+		if ml.Limit.full(bucket.tokens, bucket.updatedAt, now) {
+			delete(ml.buckets, key)
+		}
+	}
+}
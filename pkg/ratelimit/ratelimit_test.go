@@ -0,0 +1,257 @@
+package ratelimit
+
+import (
+	"errors"
+	"github.com/nethruster/linksh/pkg/interfaces/rate_limiter"
+	sto "github.com/nethruster/linksh/pkg/interfaces/storage"
+	"github.com/nethruster/linksh/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+//bucketStorage implements the rate limit methods of IStorage keeping the buckets in memory
+type bucketStorage struct {
+	sto.IStorage
+	buckets map[string]models.RateLimitBucket
+	//conflicts is the number of saves that fail as if another instance had modified the bucket first
+	conflicts int
+}
+
+func (bs *bucketStorage) GetRateLimitBucket(key string) (models.RateLimitBucket, error) {
+	bucket, ok := bs.buckets[key]
+	if !ok {
+		return bucket, sto.NewNotFoundError("rate limit bucket", "Key", key)
+	}
+	return bucket, nil
+}
+
+func (bs *bucketStorage) SaveRateLimitBucket(bucket models.RateLimitBucket, previousUpdatedAt int64) error {
+	if bs.conflicts > 0 {
+		bs.conflicts--
+		//The other instance consumed a token
+		current := bs.buckets[bucket.Key]
+		if previousUpdatedAt == 0 {
+			current = models.RateLimitBucket{Key: bucket.Key, Tokens: 2}
+		}
+		current.Tokens--
+		current.UpdatedAt = bucket.UpdatedAt
+		bs.buckets[bucket.Key] = current
+		return sto.NewConflictError("rate limit bucket", bucket.Key)
+	}
+	if bs.buckets[bucket.Key].UpdatedAt != previousUpdatedAt {
+		return sto.NewConflictError("rate limit bucket", bucket.Key)
+	}
+	bs.buckets[bucket.Key] = bucket
+	return nil
+}
+
+func TestMemoryLimiter(t *testing.T) {
+	now := time.Unix(1000, 0)
+	limiter, err := NewMemoryLimiter(Limit{Burst: 2, Interval: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter.now = func() time.Time { return now }
+
+	t.Run("burst", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			result, err := limiter.Allow("abc")
+			if err != nil {
+				t.Error(err)
+			}
+			if !result.Allowed {
+				t.Errorf("Request %v should be allowed", i)
+			}
+		}
+
+		result, _ := limiter.Allow("abc")
+		if result.Allowed {
+			t.Error("The bucket should be empty")
+		}
+		if result.RetryAfter != time.Second {
+			t.Errorf("Expected to retry after 1s, got %v", result.RetryAfter)
+		}
+		if header := result.RetryAfterHeader(); header != "1" {
+			t.Errorf("Expected a Retry-After of 1, got %s", header)
+		}
+	})
+
+	t.Run("other key", func(t *testing.T) {
+		result, _ := limiter.Allow("abcd")
+		if !result.Allowed {
+			t.Error("Each key should have its own bucket")
+		}
+	})
+
+	t.Run("refill", func(t *testing.T) {
+		now = now.Add(1500 * time.Millisecond)
+		result, _ := limiter.Allow("abc")
+		if !result.Allowed {
+			t.Error("A token should have been refilled")
+		}
+
+		result, _ = limiter.Allow("abc")
+		if result.Allowed {
+			t.Error("Only one token should have been refilled")
+		}
+		if result.RetryAfter != 500*time.Millisecond {
+			t.Errorf("Expected to retry after 500ms, got %v", result.RetryAfter)
+		}
+		if header := result.RetryAfterHeader(); header != "1" {
+			t.Errorf("Expected a Retry-After rounded up to 1, got %s", header)
+		}
+	})
+
+	t.Run("prune", func(t *testing.T) {
+		now = now.Add(time.Hour)
+		limiter.prune(now)
+		if len(limiter.buckets) != 0 {
+			t.Errorf("The full buckets should have been removed, %v left", len(limiter.buckets))
+		}
+	})
+}
+
+func TestZeroValueLimiters(t *testing.T) {
+	memory := &MemoryLimiter{Limit: Limit{Burst: 1, Interval: time.Minute}}
+	if result, err := memory.Allow("abc"); err != nil || !result.Allowed {
+		t.Errorf("The first request should be allowed, got %+v %v", result, err)
+	}
+	storage := &StorageLimiter{Storage: &bucketStorage{buckets: make(map[string]models.RateLimitBucket)}, Limit: Limit{Burst: 1, Interval: time.Minute}}
+	if result, err := storage.Allow("abc"); err != nil || !result.Allowed {
+		t.Errorf("The first request should be allowed, got %+v %v", result, err)
+	}
+
+	if _, err := (&MemoryLimiter{}).Allow("abc"); !errors.Is(err, ErrInvalidLimit) {
+		t.Errorf("Expected an ErrInvalidLimit without an Interval, got %v", err)
+	}
+	if _, err := (&StorageLimiter{Storage: storage.Storage}).Allow("abc"); !errors.Is(err, ErrInvalidLimit) {
+		t.Errorf("Expected an ErrInvalidLimit without an Interval, got %v", err)
+	}
+}
+
+func TestInvalidLimit(t *testing.T) {
+	if _, err := NewMemoryLimiter(Limit{Burst: 1}); !errors.Is(err, ErrInvalidLimit) {
+		t.Errorf("Expected an ErrInvalidLimit without an Interval, got %v", err)
+	}
+	if _, err := NewStorageLimiter(&bucketStorage{}, Limit{Burst: 1}); !errors.Is(err, ErrInvalidLimit) {
+		t.Errorf("Expected an ErrInvalidLimit without an Interval, got %v", err)
+	}
+	if header := (rate_limiter.Result{RetryAfter: time.Millisecond}).RetryAfterHeader(); header != "1" {
+		t.Errorf("Expected a Retry-After of 1, got %s", header)
+	}
+	if header := (rate_limiter.Result{}).RetryAfterHeader(); header != "1" {
+		t.Errorf("The Retry-After should be at least 1, got %s", header)
+	}
+}
+
+func TestStorageLimiter(t *testing.T) {
+	now := time.Unix(1000, 0)
+	storage := &bucketStorage{buckets: make(map[string]models.RateLimitBucket)}
+	limiter, err := NewStorageLimiter(storage, Limit{Burst: 2, Interval: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	limiter.now = func() time.Time { return now }
+
+	t.Run("burst", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			result, err := limiter.Allow("abc")
+			if err != nil {
+				t.Error(err)
+			}
+			if !result.Allowed {
+				t.Errorf("Request %v should be allowed", i)
+			}
+		}
+		result, _ := limiter.Allow("abc")
+		if result.Allowed || result.RetryAfter != time.Second {
+			t.Errorf("The bucket should be empty for 1s, got %+v", result)
+		}
+		//The updates within the same nanosecond are told apart by shifting them a nanosecond
+		if expiresAt := storage.buckets["abc"].ExpiresAt; expiresAt.Before(now.Add(2*time.Second)) || expiresAt.After(now.Add(2*time.Second+time.Microsecond)) {
+			t.Errorf("The bucket should expire once full again, got %v", expiresAt)
+		}
+	})
+
+	t.Run("conflict", func(t *testing.T) {
+		storage.conflicts = 1
+		result, err := limiter.Allow("def")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Allowed || result.Remaining != 0 {
+			t.Errorf("The retry should see the token consumed by the other instance, got %+v", result)
+		}
+		if tokens := storage.buckets["def"].Tokens; tokens != 0 {
+			t.Errorf("Expected an empty bucket, got %v tokens", tokens)
+		}
+	})
+
+	t.Run("too many conflicts", func(t *testing.T) {
+		now = now.Add(time.Hour)
+		storage.conflicts = int(limiter.MaxRetries) + 1
+		_, err := limiter.Allow("ghi")
+		if !errors.As(err, &sto.ConflictError{}) {
+			t.Errorf("Expected a ConflictError after %d retries, got %v", limiter.MaxRetries, err)
+		}
+	})
+}
+
+func TestMiddleware(t *testing.T) {
+	limiter, err := NewMemoryLimiter(Limit{Burst: 1, Interval: time.Minute})
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := Middleware(limiter, WritesOnly(ClientIP), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	serve := func(method string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(method, "/abc", nil)
+		request.RemoteAddr = "192.0.2.1:1234"
+		handler.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	if code := serve(http.MethodPost).Code; code != http.StatusNoContent {
+		t.Errorf("The first write should be served, got status %v", code)
+	}
+	recorder := serve(http.MethodPost)
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Errorf("The second write should be limited, got status %v", recorder.Code)
+	}
+	if header := recorder.Header().Get("Retry-After"); header != "60" {
+		t.Errorf("Expected a Retry-After of 60, got %q", header)
+	}
+	if code := serve(http.MethodGet).Code; code != http.StatusNoContent {
+		t.Errorf("Reads should not be limited, got status %v", code)
+	}
+}
+
+func TestSessionUser(t *testing.T) {
+	key := SessionUser(func(token string) (string, error) {
+		if token != "valid" {
+			return "", errors.New("invalid token")
+		}
+		return "abc", nil
+	})
+
+	cases := map[string]string{
+		"Bearer valid":   "user:abc",
+		"bearer valid":   "user:abc",
+		"Bearer invalid": "192.0.2.1",
+		"Basic valid":    "192.0.2.1",
+		"":               "192.0.2.1",
+	}
+	for header, expected := range cases {
+		request := httptest.NewRequest(http.MethodPost, "/abc", nil)
+		request.RemoteAddr = "192.0.2.1:1234"
+		request.Header.Set("Authorization", header)
+		if k := key(request); k != expected {
+			t.Errorf("The Authorization %q should give the key %q, got %q", header, expected, k)
+		}
+	}
+}
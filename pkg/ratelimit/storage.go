@@ -0,0 +1,81 @@
+package ratelimit
+
+import (
+	"github.com/nethruster/linksh/pkg/interfaces/rate_limiter"
+	sto "github.com/nethruster/linksh/pkg/interfaces/storage"
+	"github.com/nethruster/linksh/pkg/models"
+	errors "golang.org/x/xerrors"
+	"time"
+)
+
+//DefaultMaxRetries is the number of times a StorageLimiter retries an update that conflicted with another instance
+const DefaultMaxRetries = 5
+
+//StorageLimiter implements IRateLimiter keeping the buckets in the storage, so they are shared between instances
+//The buckets are saved with the time they will be full again, so the storage can expire them
+type StorageLimiter struct {
+	Storage sto.IStorage
+	Limit   Limit
+	//MaxRetries is the number of times a conflicting update is retried before giving up
+	MaxRetries uint
+
+	now func() time.Time
+}
+
+//NewStorageLimiter creates a StorageLimiter
+//If the limit has no Interval an ErrInvalidLimit would be returned
+func NewStorageLimiter(storage sto.IStorage, limit Limit) (*StorageLimiter, error) {
+	if err := limit.validate(); err != nil {
+		return nil, err
+	}
+	return &StorageLimiter{
+		Storage:    storage,
+		Limit:      limit,
+		MaxRetries: DefaultMaxRetries,
+		now:        time.Now,
+	}, nil
+}
+
+//Allow consumes a token from the bucket of the key
+//If the bucket keeps being modified by other instances after MaxRetries attempts a ConflictError would be returned
+//If the Limit has no Interval an ErrInvalidLimit would be returned
+func (sl *StorageLimiter) Allow(key string) (rate_limiter.Result, error) {
+	if err := sl.Limit.validate(); err != nil {
+		return rate_limiter.Result{}, err
+	}
+	for attempt := uint(0); attempt <= sl.MaxRetries; attempt++ {
+		now := clock(sl.now)
+		lastUpdate := now
+		bucket, err := sl.Storage.GetRateLimitBucket(key)
+		if errors.As(err, &sto.NotFoundError{}) {
+			bucket = models.RateLimitBucket{Key: key, Tokens: float64(sl.Limit.Burst)}
+		} else if err != nil {
+			return rate_limiter.Result{}, err
+		} else {
+			lastUpdate = time.Unix(0, bucket.UpdatedAt)
+		}
+		//The clock of another instance could be ahead of ours
+		if lastUpdate.After(now) {
+			now = lastUpdate
+		}
+
+		previousUpdatedAt := bucket.UpdatedAt
+		var result rate_limiter.Result
+		bucket.Tokens, result = sl.Limit.take(bucket.Tokens, lastUpdate, now)
+		bucket.UpdatedAt = now.UnixNano()
+		if bucket.UpdatedAt == previousUpdatedAt {
+			bucket.UpdatedAt++
+		}
+		bucket.ExpiresAt = sl.Limit.fullAt(bucket.Tokens, now)
+
+		err = sl.Storage.SaveRateLimitBucket(bucket, previousUpdatedAt)
+		if err == nil {
+			return result, nil
+		}
+		if !errors.As(err, &sto.ConflictError{}) {
+			return rate_limiter.Result{}, err
+		}
+	}
+
+	return rate_limiter.Result{}, sto.NewConflictError("rate limit bucket", key)
+}
@@ -0,0 +1,265 @@
+package repositories
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	gonanoid "github.com/matoous/go-nanoid"
+	"github.com/nethruster/linksh/pkg/events"
+	sto "github.com/nethruster/linksh/pkg/interfaces/storage"
+	"github.com/nethruster/linksh/pkg/interfaces/user_repository"
+	"github.com/nethruster/linksh/pkg/models"
+	errors "golang.org/x/xerrors"
+	"io"
+	"log"
+	"sort"
+	"time"
+)
+
+//auditExportBatchSize is the number of records loaded from the storage at once while exporting
+const auditExportBatchSize = 100
+
+//auditCounterName is the counter numbering the audit records
+const auditCounterName = "audit"
+
+//unauditedFields are the fields changed by the visits and the health checks, so they are left out of the changes
+var unauditedFields = map[string]bool{"hits": true, "fallbackHits": true, "health": true, "state": true}
+
+//secretFields are the fields whose changes are recorded without their values, like the passwords
+var secretFields = map[string]bool{"last_token": true, "secret": true}
+
+//passwordChange is the change recorded for the passwords, which the users don't carry out of the storage
+var passwordChange = models.AuditChange{Field: "password"}
+
+//AuditRepository implements IAuditRepository
+//It records the operations published to the buses it is subscribed to, see Subscribe
+type AuditRepository struct {
+	Storage sto.IStorage
+	//OnError is called with the errors saving the records, if nil they are written to the standard logger
+	//The operations are not undone when their record can't be saved
+	OnError func(error)
+}
+
+//Subscribe records in the audit log the operations published to the bus, including the denied ones
+//The records are saved before Publish returns, so they keep the order of the operations
+//The returned function cancels the subscription
+func (ar *AuditRepository) Subscribe(bus *events.Bus) (unsubscribe func()) {
+	return bus.Subscribe(ar.handle)
+}
+
+//List lists the audit records selected by the filter, the oldest first
+//If the limit is set to 0, no limit will be established, the same applies to the offset
+func (ar *AuditRepository) List(filter models.AuditFilter, limit, offset uint) ([]models.AuditRecord, error) {
+	return ar.Storage.ListAuditRecords(filter, limit, offset)
+}
+
+//Export writes the audit records selected by the filter to the writer as JSON Lines, the oldest first
+func (ar *AuditRepository) Export(w io.Writer, filter models.AuditFilter) error {
+	encoder := json.NewEncoder(w)
+	for offset := uint(0); ; offset += auditExportBatchSize {
+		records, err := ar.Storage.ListAuditRecords(filter, auditExportBatchSize, offset)
+		if err != nil {
+			return err
+		}
+		for _, record := range records {
+			if err = encoder.Encode(record); err != nil {
+				return err
+			}
+		}
+		if len(records) < auditExportBatchSize {
+			return nil
+		}
+	}
+}
+
+//ListByUser lists the audit records selected by the filter, the oldest first
+//If the limit is set to 0, no limit will be established, the same applies to the offset
+//The requester must be an admin to perform this action
+func (ar *AuditRepository) ListByUser(requesterID string, filter models.AuditFilter, limit, offset uint) ([]models.AuditRecord, error) {
+	if err := ar.authorize(requesterID); err != nil {
+		return nil, err
+	}
+
+	return ar.List(filter, limit, offset)
+}
+
+//ExportByUser writes the audit records selected by the filter to the writer as JSON Lines, the oldest first
+//The requester must be an admin to perform this action
+func (ar *AuditRepository) ExportByUser(requesterID string, w io.Writer, filter models.AuditFilter) error {
+	if err := ar.authorize(requesterID); err != nil {
+		return err
+	}
+
+	return ar.Export(w, filter)
+}
+
+//authorize checks that the requester is an admin, recording the denial in the audit log otherwise
+func (ar *AuditRepository) authorize(requesterID string) error {
+	err := checkIfRequesterIsAdmin(ar.Storage, requesterID)
+	if errors.Is(err, user_repository.ErrForbidden) {
+		ar.deny(events.Actor{ID: requesterID}, models.AuditRead, models.AuditTargetAudit, "")
+	}
+	return err
+}
+
+//handle records an event in the audit log, the events that are not operations, like the hits, are ignored
+func (ar *AuditRepository) handle(event events.Event) {
+	switch event := event.(type) {
+	case events.LinkCreated:
+		action := models.AuditCreate
+		if event.Restored {
+			action = models.AuditRestore
+		}
+		ar.recordChanges(event.Actor, action, models.AuditTargetLink, event.Link.ID, models.Link{}, event.Link)
+	case events.LinkUpdated:
+		ar.recordChanges(event.Actor, models.AuditUpdate, models.AuditTargetLink, event.Link.ID, event.Previous, event.Link)
+	case events.LinkContentUpdated:
+		before := event.Link
+		before.Content = event.PreviousContent
+		ar.recordChanges(event.Actor, models.AuditUpdate, models.AuditTargetLink, event.Link.ID, before, event.Link)
+	case events.LinkDeleted:
+		ar.recordChanges(event.Actor, models.AuditDelete, models.AuditTargetLink, event.Link.ID, event.Link, models.Link{})
+	case events.LinkTransferCreated:
+		ar.recordChanges(event.Actor, models.AuditCreate, models.AuditTargetTransfer, event.Transfer.ID, models.LinkTransfer{}, event.Transfer)
+	case events.LinkTransferResolved:
+		before := event.Transfer
+		before.Status, before.ResolvedAt = models.LinkTransferPending, 0
+		ar.recordChanges(event.Actor, models.AuditUpdate, models.AuditTargetTransfer, event.Transfer.ID, before, event.Transfer)
+	case events.QuotaUpdated:
+		ar.recordChanges(event.Actor, models.AuditUpdate, models.AuditTargetQuota, event.Quota.UserID, event.Previous, event.Quota)
+	case events.QuotaReset:
+		ar.recordChanges(event.Actor, models.AuditDelete, models.AuditTargetQuota, event.Quota.UserID, event.Quota, models.UserQuota{})
+	case events.UserCreated:
+		if event.Restored {
+			ar.recordChanges(event.Actor, models.AuditRestore, models.AuditTargetUser, event.User.ID, models.User{}, event.User)
+		} else {
+			ar.recordChanges(event.Actor, models.AuditCreate, models.AuditTargetUser, event.User.ID, models.User{}, event.User, passwordChange)
+		}
+	case events.UserUpdated:
+		var extra []models.AuditChange
+		if event.PasswordChanged {
+			extra = append(extra, passwordChange)
+		}
+		ar.recordChanges(event.Actor, models.AuditUpdate, models.AuditTargetUser, event.User.ID, event.Previous, event.User, extra...)
+	case events.UserDeleted:
+		ar.recordChanges(event.Actor, models.AuditDelete, models.AuditTargetUser, event.User.ID, event.User, models.User{})
+	case events.SessionCreated:
+		ar.recordChanges(event.Actor, models.AuditCreate, models.AuditTargetSession, event.Session.ID, models.Session{}, event.Session)
+	case events.SessionRevoked:
+		ar.recordChanges(event.Actor, models.AuditDelete, models.AuditTargetSession, event.Session.ID, event.Session, models.Session{})
+	case events.AccessDenied:
+		ar.deny(event.Actor, event.Action, event.TargetType, event.TargetID)
+	}
+}
+
+//deny records in the audit log that the actor lacked the privileges to perform an operation
+func (ar *AuditRepository) deny(actor events.Actor, action models.AuditAction, targetType models.AuditTargetType, targetID string) {
+	ar.record(actor, models.AuditRecord{Action: action, TargetType: targetType, TargetID: targetID, Denied: true})
+}
+
+//recordChanges records an operation in the audit log along with the fields that changed between the target before and after it
+//before and after must be of the same type, the zero value is used for the targets that didn't exist before or don't exist after
+func (ar *AuditRepository) recordChanges(actor events.Actor, action models.AuditAction, targetType models.AuditTargetType, targetID string, before, after interface{}, extra ...models.AuditChange) {
+	if ar == nil {
+		return
+	}
+	changes, err := diff(before, after)
+	if err != nil {
+		ar.fail(err)
+		return
+	}
+	ar.record(actor, models.AuditRecord{Action: action, TargetType: targetType, TargetID: targetID, Changes: append(changes, extra...)})
+}
+
+//record completes a record with its ID, number, actor, request and creation time and appends it to the audit log
+//It can be called on a nil AuditRepository, then nothing is recorded
+func (ar *AuditRepository) record(actor events.Actor, record models.AuditRecord) {
+	if ar == nil {
+		return
+	}
+
+	var err error
+	if record.ID, err = gonanoid.Nanoid(); err != nil {
+		ar.fail(err)
+		return
+	}
+	if record.Number, err = ar.Storage.IncreaseCounter(auditCounterName); err != nil {
+		ar.fail(err)
+		return
+	}
+	record.ActorID = actor.ID
+	record.Request = actor.Request
+	record.CreatedAt = time.Now().Unix()
+	if err = ar.Storage.SaveAuditRecord(record); err != nil {
+		ar.fail(err)
+	}
+}
+
+func (ar *AuditRepository) fail(err error) {
+	err = fmt.Errorf("error recording an audit record:%w", err)
+	if ar.OnError != nil {
+		ar.OnError(err)
+	} else {
+		log.Print(err)
+	}
+}
+
+//diff returns the top level fields whose JSON encoding differs between two values, sorted by their name
+func diff(before, after interface{}) ([]models.AuditChange, error) {
+	beforeFields, err := jsonFields(before)
+	if err != nil {
+		return nil, err
+	}
+	afterFields, err := jsonFields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []models.AuditChange
+	for field, value := range beforeFields {
+		if !bytes.Equal(value, afterFields[field]) {
+			changes = append(changes, change(field, string(value), string(afterFields[field])))
+		}
+	}
+	for field, value := range afterFields {
+		if _, ok := beforeFields[field]; !ok {
+			changes = append(changes, change(field, "", string(value)))
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Field < changes[j].Field })
+	return changes, nil
+}
+
+//change returns the change of a field, leaving out its values if it is secret
+func change(field, before, after string) models.AuditChange {
+	if secretFields[field] {
+		return models.AuditChange{Field: field}
+	}
+	return models.AuditChange{Field: field, Before: before, After: after}
+}
+
+//jsonFields returns the JSON encoding of the top level fields of a value, leaving out the empty and the unaudited ones
+func jsonFields(value interface{}) (map[string]json.RawMessage, error) {
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(encoded, &fields); err != nil {
+		return nil, err
+	}
+	for field, value := range fields {
+		if unauditedFields[field] || isEmptyJSON(value) {
+			delete(fields, field)
+		}
+	}
+	return fields, nil
+}
+
+func isEmptyJSON(value json.RawMessage) bool {
+	switch string(value) {
+	case `""`, "0", "false", "null", "[]", "{}":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package repositories
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/nethruster/linksh/pkg/events"
+	"github.com/nethruster/linksh/pkg/interfaces/user_repository"
+	"github.com/nethruster/linksh/pkg/models"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	storage := newLinkStorage()
+	storage.users["owner"] = models.User{ID: "owner"}
+	storage.users["other"] = models.User{ID: "other"}
+	storage.users["admin"] = models.User{ID: "admin", IsAdmin: true}
+	audit := &AuditRepository{Storage: storage, OnError: func(err error) { t.Error(err) }}
+	bus := events.New()
+	audit.Subscribe(bus)
+	repository := &LinkRepository{Storage: storage, Events: bus}
+	request := models.RequestMetadata{RequestID: "42", IP: "192.0.2.1"}
+
+	if _, err := repository.Create("docs", "https://docs.example.tld/", "owner", models.LinkTypeStatic); err != nil {
+		t.Fatal(err)
+	}
+	if err := repository.WithRequest(request).UpdateContentByUser("owner", "docs", "https://docs.example.tld/v2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repository.WithRequest(request).DeleteByUser("other", "docs"); !errors.Is(err, user_repository.ErrForbidden) {
+		t.Fatalf("Expected Forbidden, got %v", err)
+	}
+
+	records, err := audit.List(models.AuditFilter{TargetID: "docs"}, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("Expected the creation, the update and the denied deletion, got %+v", records)
+	}
+	created, updated, denied := records[0], records[1], records[2]
+	if created.Action != models.AuditCreate || created.ActorID != "" || created.Number != 1 || len(created.Changes) == 0 {
+		t.Errorf("The creation should be recorded without an actor, got %+v", created)
+	}
+	expectedChanges := []models.AuditChange{{Field: "content", Before: `"https://docs.example.tld/"`, After: `"https://docs.example.tld/v2"`}}
+	if updated.Action != models.AuditUpdate || updated.ActorID != "owner" || updated.Request != request || !reflect.DeepEqual(updated.Changes, expectedChanges) {
+		t.Errorf("The update should be recorded with its actor, request and changes, got %+v", updated)
+	}
+	if denied.Action != models.AuditDelete || !denied.Denied || denied.ActorID != "other" || denied.Request != request {
+		t.Errorf("The denial should be recorded with its actor and request, got %+v", denied)
+	}
+	if _, err := repository.Get("docs"); err != nil {
+		t.Errorf("The denied deletion should not be performed, got %v", err)
+	}
+
+	if _, err = audit.ListByUser("owner", models.AuditFilter{}, 0, 0); !errors.Is(err, user_repository.ErrForbidden) {
+		t.Errorf("Only the admins should read the audit log, got %v", err)
+	}
+	var exported bytes.Buffer
+	if err = audit.ExportByUser("admin", &exported, models.AuditFilter{}); err != nil {
+		t.Fatal(err)
+	}
+	scanner := bufio.NewScanner(&exported)
+	var lines []models.AuditRecord
+	for scanner.Scan() {
+		var record models.AuditRecord
+		if err = json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Every line should be a JSON record, got %q: %v", scanner.Text(), err)
+		}
+		lines = append(lines, record)
+	}
+	if len(lines) != 4 || lines[3].TargetType != models.AuditTargetAudit || !lines[3].Denied {
+		t.Errorf("Expected the 3 link records and the denied read of the audit log, got %+v", lines)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	before := models.User{ID: "abc", Name: "old", Password: []byte("secret"), Fallback: "https://example.tld/"}
+	after := models.User{ID: "abc", Name: "new", Password: []byte("changed"), IsAdmin: true}
+	changes, err := diff(before, after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []models.AuditChange{
+		{Field: "fallback", Before: `"https://example.tld/"`},
+		{Field: "isAdmin", After: "true"},
+		{Field: "name", Before: `"old"`, After: `"new"`},
+	}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("Expected %+v got %+v", expected, changes)
+	}
+}
+
+func TestDiffSecrets(t *testing.T) {
+	changes, err := diff(models.Session{ID: "abc", LastToken: "token"}, models.Session{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []models.AuditChange{{Field: "id", Before: `"abc"`}, {Field: "last_token"}}
+	if !reflect.DeepEqual(changes, expected) {
+		t.Errorf("The secret fields should be recorded without their values, expected %+v got %+v", expected, changes)
+	}
+}
+
+func TestAuditLogsErrors(t *testing.T) {
+	var output bytes.Buffer
+	log.SetOutput(&output)
+	defer log.SetOutput(os.Stderr)
+
+	audit := &AuditRepository{Storage: &failingStorage{linkStorage: newLinkStorage(), failAudit: true}}
+	audit.record(events.Actor{}, models.AuditRecord{Action: models.AuditCreate})
+	if !strings.Contains(output.String(), "error recording an audit record") {
+		t.Errorf("The errors should be logged without OnError, got %q", output.String())
+	}
+}
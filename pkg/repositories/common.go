@@ -1,8 +1,10 @@
 package repositories
 
 import (
+	"github.com/nethruster/linksh/pkg/events"
 	sto "github.com/nethruster/linksh/pkg/interfaces/storage"
 	"github.com/nethruster/linksh/pkg/interfaces/user_repository"
+	"github.com/nethruster/linksh/pkg/models"
 	errors "golang.org/x/xerrors"
 )
 
@@ -18,3 +20,20 @@ func checkIfRequesterIsAdmin(storage sto.IStorage, requesterID string) (err erro
 	}
 	return
 }
+
+//authorize checks that the actor is an admin, publishing the denial to the bus otherwise
+func authorize(storage sto.IStorage, bus *events.Bus, actor events.Actor, action models.AuditAction, targetType models.AuditTargetType, targetID string) error {
+	err := checkIfRequesterIsAdmin(storage, actor.ID)
+	if errors.Is(err, user_repository.ErrForbidden) {
+		bus.Publish(events.AccessDenied{Action: action, TargetType: targetType, TargetID: targetID, Actor: actor})
+	}
+	return err
+}
+
+const maxUTMTagLength = 200
+
+func utmTagsAreValid(tags models.UTMTags) bool {
+	return len(tags.Source) <= maxUTMTagLength &&
+		len(tags.Medium) <= maxUTMTagLength &&
+		len(tags.Campaign) <= maxUTMTagLength
+}
@@ -0,0 +1,83 @@
+package repositories
+
+import "github.com/nethruster/linksh/pkg/models"
+
+//AddAlias adds another ID to an existing link, resolving to the same content and adding to the same hits
+//The alias follows the same rules as the IDs, so it can produce an ErrInvalidID
+//If the alias is already used as the ID or an alias of any link an AlreadyExistsError would be returned
+func (lr *LinkRepository) AddAlias(id, alias string) error {
+	if err := lr.IDs.validate(alias); err != nil {
+		return err
+	}
+	link, err := lr.Get(id)
+	if err != nil {
+		return err
+	}
+
+	if err = lr.Storage.AddLinkAlias(link.ID, lr.IDs.key(alias)); err != nil {
+		return err
+	}
+	if err = lr.indexAliases(link.ID); err != nil {
+		return err
+	}
+	return lr.updated(link)
+}
+
+//RemoveAlias removes an alias from a link
+//If the link does not exists in the storage or it has not the alias an NotFoundError would be returned
+func (lr *LinkRepository) RemoveAlias(id, alias string) error {
+	link, err := lr.Get(id)
+	if err != nil {
+		return err
+	}
+
+	//The aliases added before the IDs were case insensitive keep their case
+	key := lr.IDs.key(alias)
+	for _, existing := range link.Aliases {
+		if existing == alias {
+			key = alias
+		}
+	}
+	if err = lr.Storage.RemoveLinkAlias(link.ID, key); err != nil {
+		return err
+	}
+	if err = lr.indexAliases(link.ID); err != nil {
+		return err
+	}
+	return lr.updated(link)
+}
+
+//AddAliasByUser adds another ID to an existing link, resolving to the same content and adding to the same hits
+//The alias follows the same rules as the IDs, so it can produce an ErrInvalidID
+//If the alias is already used as the ID or an alias of any link an AlreadyExistsError would be returned
+//The requester must own the link or be an admin to perform this action
+func (lr *LinkRepository) AddAliasByUser(requesterID, id, alias string) error {
+	link, err := lr.Get(id)
+	if err != nil {
+		return err
+	}
+	if link.OwnerID != requesterID {
+		if err = lr.authorize(requesterID, models.AuditUpdate, models.AuditTargetLink, link.ID); err != nil {
+			return err
+		}
+	}
+
+	return lr.as(requesterID).AddAlias(link.ID, alias)
+}
+
+//RemoveAliasByUser removes an alias from a link
+//If the link does not exists in the storage or it has not the alias an NotFoundError would be returned
+//The requester must own the link or be an admin to perform this action
+func (lr *LinkRepository) RemoveAliasByUser(requesterID, id, alias string) error {
+	link, err := lr.Get(id)
+	if err != nil {
+		return err
+	}
+	if link.OwnerID != requesterID {
+		if err = lr.authorize(requesterID, models.AuditUpdate, models.AuditTargetLink, link.ID); err != nil {
+			return err
+		}
+	}
+
+	return lr.as(requesterID).RemoveAlias(link.ID, alias)
+}
@@ -0,0 +1,66 @@
+package repositories
+
+import (
+	"errors"
+	"github.com/nethruster/linksh/pkg/interfaces/link_repository"
+	istorage "github.com/nethruster/linksh/pkg/interfaces/storage"
+	"github.com/nethruster/linksh/pkg/models"
+	"testing"
+)
+
+func TestAliases(t *testing.T) {
+	storage := newLinkStorage(
+		models.Link{ID: "docs", Content: "https://docs.example.tld/"},
+		models.Link{ID: "gh", Type: models.LinkTypePrefix, Content: "https://github.com"},
+	)
+	repository := &LinkRepository{Storage: storage, IDs: IDPolicy{CaseInsensitive: true}}
+
+	for _, alias := range []string{"documentation", "D"} {
+		if err := repository.AddAlias("docs", alias); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, alias := range []string{"docs", "d", "gh"} {
+		err := repository.AddAlias("gh", alias)
+		var alreadyExistsError *istorage.AlreadyExistsError
+		if !errors.As(err, &alreadyExistsError) {
+			t.Errorf("%q is already in use and should produce an AlreadyExistsError, got %v", alias, err)
+		}
+	}
+	if err := repository.AddAlias("docs", "login"); !errors.Is(err, link_repository.ErrInvalidID) {
+		t.Errorf("The aliases should follow the rules of the IDs, got %v", err)
+	}
+	if err := repository.AddAlias("code", "github"); !errors.As(err, &istorage.NotFoundError{}) {
+		t.Errorf("Expected NotFound, got %v", err)
+	}
+	if err := repository.AddAlias("gh", "github"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"docs", "documentation", "D", "d"} {
+		resolution, err := repository.Resolve(link_repository.ResolveRequest{Path: path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resolution.Link.ID != "docs" || resolution.Target != "https://docs.example.tld/" {
+			t.Errorf("%q should be resolved through the link docs, got %+v", path, resolution)
+		}
+	}
+	if hits := storage.links["docs"].Hits; hits != 4 {
+		t.Errorf("The hits of the aliases should be aggregated, expected 4 got %v", hits)
+	}
+	resolution, err := repository.Resolve(link_repository.ResolveRequest{Path: "github/nethruster"})
+	if err != nil || resolution.Target != "https://github.com/nethruster" {
+		t.Errorf("The aliases of the prefix links should match the paths starting with them, got %+v %v", resolution, err)
+	}
+
+	if err = repository.RemoveAlias("documentation", "d"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = repository.Get("d"); !errors.As(err, &istorage.NotFoundError{}) {
+		t.Errorf("The removed alias should not be found, got %v", err)
+	}
+	if err = repository.RemoveAlias("docs", "d"); !errors.As(err, &istorage.NotFoundError{}) {
+		t.Errorf("Removing a missing alias should produce a NotFound, got %v", err)
+	}
+}
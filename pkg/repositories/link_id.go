@@ -0,0 +1,257 @@
+package repositories
+
+import (
+	"github.com/nethruster/linksh/pkg/idgen"
+	"github.com/nethruster/linksh/pkg/interfaces/id_generator"
+	"github.com/nethruster/linksh/pkg/interfaces/link_repository"
+	sto "github.com/nethruster/linksh/pkg/interfaces/storage"
+	"github.com/nethruster/linksh/pkg/models"
+	errors "golang.org/x/xerrors"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+const (
+	//DefaultIDAttempts is the number of generated IDs tried before giving up when they keep colliding
+	DefaultIDAttempts = 10
+	//DefaultIDGrowthThreshold is the collision rate that makes the generated IDs grow
+	DefaultIDGrowthThreshold = 0.1
+	//DefaultIDGrowthWindow is the number of generated IDs considered to calculate the collision rate
+	DefaultIDGrowthWindow = 100
+
+	maxIDLength = 100
+	//maxIDSegments is the number of segments separated by slashes an ID can have, if the pattern allows them
+	maxIDSegments = 10
+)
+
+var (
+	//DefaultReservedIDs are the IDs that can't be used by the links as they would clash with the routes of the server
+	DefaultReservedIDs = []string{"api", "admin", "login", "logout", "static", "assets", "metrics", "health", "favicon.ico", "robots.txt"}
+	//DefaultIDPattern accepts the characters that don't need to be escaped in an URL path
+	DefaultIDPattern = regexp.MustCompile(`^[A-Za-z0-9._~-]+$`)
+)
+
+//IDPolicy sets the requirements of the IDs and how the generated ones are retried and grown when they collide with existing ones
+//The zero value uses the defaults
+type IDPolicy struct {
+	//Reserved are the IDs that can't be used, they are compared ignoring the case, if nil DefaultReservedIDs is used
+	Reserved []string
+	//Pattern must match the IDs, if nil DefaultIDPattern is used
+	Pattern *regexp.Regexp
+	//CaseInsensitive makes the custom IDs and aliases that only differ in their case the same one
+	//They are then saved lowercased, keeping the original one in models.Link.DisplayID
+	//The generated IDs keep their case, so their alphabet is not reduced, and they are only found by their exact ID
+	//The links saved before enabling it are also found by their exact ID, so it can be enabled without migrating them
+	CaseInsensitive bool
+
+	//Attempts is the number of generated IDs tried before giving up, if 0 DefaultIDAttempts is used
+	//If half of the attempts collide the IDs are grown right away
+	Attempts uint
+	//GrowthThreshold is the collision rate, between 0 and 1, that makes the IDs grow, if 0 DefaultIDGrowthThreshold is used
+	GrowthThreshold float64
+	//GrowthWindow is the number of generated IDs considered to calculate the collision rate, if 0 DefaultIDGrowthWindow is used
+	GrowthWindow uint
+}
+
+//validate checks that a custom or generated ID accomplishes the requirements of models.Link.ID
+//If it doesn't an InvalidIDError would be returned
+func (ip IDPolicy) validate(id string) error {
+	if length := len(id); length == 0 || length > maxIDLength {
+		return link_repository.InvalidIDError{ID: id, Reason: "the length must be between 1 and 100 characters"}
+	}
+	if strings.Count(id, "/") >= maxIDSegments {
+		return link_repository.InvalidIDError{ID: id, Reason: "it has more than 10 segments"}
+	}
+	pattern := ip.Pattern
+	if pattern == nil {
+		pattern = DefaultIDPattern
+	}
+	if !pattern.MatchString(id) {
+		return link_repository.InvalidIDError{ID: id, Reason: "it contains characters that are not allowed"}
+	}
+	reserved := ip.Reserved
+	if reserved == nil {
+		reserved = DefaultReservedIDs
+	}
+	for _, word := range reserved {
+		if strings.EqualFold(id, word) {
+			return link_repository.InvalidIDError{ID: id, Reason: "it is reserved"}
+		}
+	}
+	return nil
+}
+
+//key returns the ID a link with a custom ID or alias is saved with in the storage
+func (ip IDPolicy) key(id string) string {
+	if ip.CaseInsensitive {
+		return strings.ToLower(id)
+	}
+	return id
+}
+
+//keys returns the IDs a link could be saved with in the storage, the exact one first
+func (ip IDPolicy) keys(id string) []string {
+	if key := ip.key(id); key != id {
+		return []string{id, key}
+	}
+	return []string{id}
+}
+
+//assignID sets the custom ID of a link, keeping the display one if the IDs are case insensitive
+func (ip IDPolicy) assignID(link *models.Link, id string) {
+	link.ID = ip.key(id)
+	if ip.CaseInsensitive {
+		link.DisplayID = id
+	}
+}
+
+//getLink returns the link saved with any of the keys of the ID, trying the exact one first
+func (lr *LinkRepository) getLink(id string, get func(id string) (models.Link, error)) (link models.Link, err error) {
+	for _, key := range lr.IDs.keys(id) {
+		link, err = get(key)
+		if !errors.As(err, &sto.NotFoundError{}) {
+			return
+		}
+	}
+	return
+}
+
+//shadowed returns if the ID would be found as another link, as the exact IDs are tried before the case insensitive ones
+//The custom IDs are shadowed by a generated one with the same case, and the generated ones by a custom one lowercased
+func (lr *LinkRepository) shadowed(id string) (bool, error) {
+	key := lr.IDs.key(id)
+	if key == id {
+		return false, nil
+	}
+	_, err := lr.Storage.GetLink(key)
+	if errors.As(err, &sto.NotFoundError{}) {
+		_, err = lr.Storage.GetLink(id)
+	}
+	if errors.As(err, &sto.NotFoundError{}) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+//idState keeps track of the collisions of the generated IDs
+type idState struct {
+	once             sync.Once
+	defaultGenerator id_generator.IDGenerator
+
+	mutex      sync.Mutex
+	generated  uint
+	collisions uint
+}
+
+//idStatesMutex guards the creation of the idState of the repositories
+var idStatesMutex sync.Mutex
+
+//idState returns the state of the generated IDs, shared by the repository and its views
+func (lr *LinkRepository) idState() *idState {
+	idStatesMutex.Lock()
+	defer idStatesMutex.Unlock()
+	if lr.ids == nil {
+		lr.ids = &idState{}
+	}
+	return lr.ids
+}
+
+func (lr *LinkRepository) idGenerator() id_generator.IDGenerator {
+	if lr.IDGenerator != nil {
+		return lr.IDGenerator
+	}
+	ids := lr.idState()
+	ids.once.Do(func() {
+		ids.defaultGenerator = &idgen.Nanoid{Length: 7}
+	})
+	return ids.defaultGenerator
+}
+
+//saveWithGeneratedID assigns a generated ID to the link and saves it, retrying with another ID when it collides
+//The reserved and shadowed IDs count as collisions, so only the exhaustion of the attempts produces an error
+func (lr *LinkRepository) saveWithGeneratedID(link *models.Link) (err error) {
+	attempts := lr.IDs.Attempts
+	if attempts == 0 {
+		attempts = DefaultIDAttempts
+	}
+
+	for attempt := uint(1); attempt <= attempts; attempt++ {
+		var id string
+		id, err = lr.idGenerator().Generate()
+		if err != nil {
+			return
+		}
+		link.ID = id
+		setSuggestionKeys(link)
+		//The generator could produce a reserved ID
+		if lr.IDs.validate(id) != nil {
+			err = &sto.AlreadyExistsError{Model: "link", Field: "ID"}
+		} else {
+			var shadowed bool
+			if shadowed, err = lr.shadowed(id); err != nil {
+				return
+			}
+			if shadowed {
+				err = &sto.AlreadyExistsError{Model: "link", Field: "ID"}
+			} else {
+				err = lr.Storage.SaveLink(*link)
+			}
+		}
+
+		var alreadyExistsErr *sto.AlreadyExistsError
+		collided := errors.As(err, &alreadyExistsErr)
+		lr.recordGeneratedID(collided)
+		if !collided {
+			return
+		}
+		if attempt == attempts/2 {
+			lr.growIDs()
+		}
+	}
+	return
+}
+
+//recordGeneratedID updates the collision rate and grows the IDs if it exceeds the threshold
+func (lr *LinkRepository) recordGeneratedID(collided bool) {
+	window := lr.IDs.GrowthWindow
+	if window == 0 {
+		window = DefaultIDGrowthWindow
+	}
+	threshold := lr.IDs.GrowthThreshold
+	if threshold == 0 {
+		threshold = DefaultIDGrowthThreshold
+	}
+
+	ids := lr.idState()
+	ids.mutex.Lock()
+	ids.generated++
+	if collided {
+		ids.collisions++
+	}
+	if ids.generated < window {
+		ids.mutex.Unlock()
+		return
+	}
+	rate := float64(ids.collisions) / float64(ids.generated)
+	ids.generated, ids.collisions = 0, 0
+	ids.mutex.Unlock()
+
+	if rate > threshold {
+		lr.growIDs()
+	}
+}
+
+//growIDs makes the generated IDs longer if the generator supports it, and starts measuring the collision rate again
+func (lr *LinkRepository) growIDs() {
+	generator, ok := lr.idGenerator().(id_generator.GrowableIDGenerator)
+	if !ok {
+		return
+	}
+
+	ids := lr.idState()
+	ids.mutex.Lock()
+	ids.generated, ids.collisions = 0, 0
+	ids.mutex.Unlock()
+	generator.Grow()
+}
@@ -0,0 +1,216 @@
+package repositories
+
+import (
+	"errors"
+	"github.com/nethruster/linksh/pkg/idgen"
+	"github.com/nethruster/linksh/pkg/interfaces/link_repository"
+	istorage "github.com/nethruster/linksh/pkg/interfaces/storage"
+	"github.com/nethruster/linksh/pkg/models"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+//collidingStorage rejects the links whose ID is shorter than minLength as if they were already in use
+type collidingStorage struct {
+	istorage.IStorage
+	minLength int
+	saved     []models.Link
+	attempts  int
+}
+
+func (cs *collidingStorage) SaveLink(link models.Link) error {
+	cs.attempts++
+	if len(link.ID) < cs.minLength {
+		return &istorage.AlreadyExistsError{Model: "link", Field: "ID"}
+	}
+	for _, saved := range cs.saved {
+		if saved.ID == link.ID {
+			return &istorage.AlreadyExistsError{Model: "link", Field: "ID"}
+		}
+	}
+	cs.saved = append(cs.saved, link)
+	return nil
+}
+
+func (cs *collidingStorage) GetLink(id string) (models.Link, error) {
+	for _, link := range cs.saved {
+		if link.ID == id {
+			return link, nil
+		}
+	}
+	return models.Link{}, istorage.NewNotFoundError("link", "ID", id)
+}
+
+//fixedGenerator generates the IDs in order
+type fixedGenerator struct {
+	ids []string
+}
+
+func (fg *fixedGenerator) Generate() (string, error) {
+	id := fg.ids[0]
+	fg.ids = fg.ids[1:]
+	return id, nil
+}
+
+func TestSaveWithGeneratedID(t *testing.T) {
+	t.Run("grows when half of the attempts collide", func(t *testing.T) {
+		storage := &collidingStorage{minLength: 4}
+		repository := &LinkRepository{
+			Storage:     storage,
+			IDGenerator: &idgen.Nanoid{Length: 3},
+			IDs:         IDPolicy{Attempts: 4},
+		}
+
+		link := models.Link{Content: "https://example.tld"}
+		if err := repository.saveWithGeneratedID(&link); err != nil {
+			t.Fatal(err)
+		}
+		if len(link.ID) != 4 {
+			t.Errorf("Expected the ID to grow to 4 characters, got %q", link.ID)
+		}
+		if storage.attempts != 3 {
+			t.Errorf("Expected 3 attempts, got %v", storage.attempts)
+		}
+	})
+
+	t.Run("grows when the collision rate exceeds the threshold", func(t *testing.T) {
+		generator := &idgen.Nanoid{Length: 3}
+		storage := &collidingStorage{}
+		repository := &LinkRepository{
+			Storage:     storage,
+			IDGenerator: generator,
+			IDs:         IDPolicy{GrowthWindow: 10, GrowthThreshold: 0.2},
+		}
+
+		for i := 0; i < 7; i++ {
+			repository.recordGeneratedID(false)
+		}
+		for i := 0; i < 3; i++ {
+			repository.recordGeneratedID(true)
+		}
+		if generator.Length != 4 {
+			t.Errorf("Expected the IDs to grow to 4 characters, got %v", generator.Length)
+		}
+
+		for i := 0; i < 8; i++ {
+			repository.recordGeneratedID(false)
+		}
+		for i := 0; i < 2; i++ {
+			repository.recordGeneratedID(true)
+		}
+		if generator.Length != 4 {
+			t.Errorf("The IDs should not grow when the rate equals the threshold, got %v characters", generator.Length)
+		}
+	})
+
+	t.Run("gives up after the attempts", func(t *testing.T) {
+		storage := &collidingStorage{minLength: 100}
+		repository := &LinkRepository{Storage: storage, IDs: IDPolicy{Attempts: 3}}
+
+		link := models.Link{Content: "https://example.tld"}
+		err := repository.saveWithGeneratedID(&link)
+		if _, ok := err.(*istorage.AlreadyExistsError); !ok {
+			t.Errorf("Expected an AlreadyExistsError, got %v", err)
+		}
+		if storage.attempts != 3 {
+			t.Errorf("Expected 3 attempts, got %v", storage.attempts)
+		}
+	})
+
+	t.Run("retries the reserved IDs", func(t *testing.T) {
+		repository := &LinkRepository{
+			Storage:     &collidingStorage{},
+			IDGenerator: &fixedGenerator{ids: []string{"api", "admin", "abc"}},
+			IDs:         IDPolicy{Attempts: 2},
+		}
+
+		link := models.Link{Content: "https://example.tld"}
+		err := repository.saveWithGeneratedID(&link)
+		if errors.As(err, &link_repository.InvalidIDError{}) {
+			t.Errorf("A reserved generated ID should not reach the caller, got %v", err)
+		}
+
+		repository.IDs.Attempts = 3
+		repository.IDGenerator = &fixedGenerator{ids: []string{"api", "admin", "abc"}}
+		if err = repository.saveWithGeneratedID(&link); err != nil {
+			t.Fatal(err)
+		}
+		if link.ID != "abc" {
+			t.Errorf("Expected the ID \"abc\", got %q", link.ID)
+		}
+	})
+}
+
+func TestIDPolicyValidate(t *testing.T) {
+	policy := IDPolicy{}
+	for _, id := range []string{"docs", "Docs", "my-link_2", "v1.2", "abc~"} {
+		if err := policy.validate(id); err != nil {
+			t.Errorf("%q should be valid, got %v", id, err)
+		}
+	}
+	for _, id := range []string{"", strings.Repeat("a", 101), "api", "Admin", "LOGIN", "static", "a/b", "a b", "a?b", "émoji"} {
+		err := policy.validate(id)
+		var idErr link_repository.InvalidIDError
+		if !errors.As(err, &idErr) || !errors.Is(err, link_repository.ErrInvalidID) {
+			t.Errorf("%q should be rejected with an InvalidIDError, got %v", id, err)
+		}
+	}
+
+	custom := IDPolicy{Reserved: []string{}, Pattern: regexp.MustCompile(`^[a-z]+$`)}
+	if err := custom.validate("api"); err != nil {
+		t.Errorf("An empty reserved list should allow \"api\", got %v", err)
+	}
+	if err := custom.validate("Docs"); err == nil {
+		t.Error("The custom pattern should reject uppercase letters")
+	}
+
+	slashes := IDPolicy{Pattern: regexp.MustCompile(`^[a-z/]+$`)}
+	if err := slashes.validate("a/b/c"); err != nil {
+		t.Errorf("A pattern allowing slashes should accept \"a/b/c\", got %v", err)
+	}
+	if err := slashes.validate(strings.Repeat("a/", 10) + "a"); err == nil {
+		t.Error("An ID with more than 10 segments should be rejected")
+	}
+}
+
+func TestIDPolicyCaseInsensitive(t *testing.T) {
+	storage := &collidingStorage{}
+	repository := &LinkRepository{Storage: storage, IDs: IDPolicy{CaseInsensitive: true}}
+
+	link := models.Link{}
+	repository.IDs.assignID(&link, "Docs")
+	if link.ID != "docs" || link.DisplayID != "Docs" {
+		t.Errorf("Expected the ID \"docs\" displayed as \"Docs\", got %+v", link)
+	}
+
+	storage.saved = append(storage.saved, models.Link{ID: "Legacy"}, link)
+
+	repository.IDGenerator = &fixedGenerator{ids: []string{"DOCS", "AbCdEf"}}
+	generated := models.Link{}
+	if err := repository.saveWithGeneratedID(&generated); err != nil {
+		t.Fatal(err)
+	}
+	if generated.ID != "AbCdEf" {
+		t.Errorf("The generated ID should keep its case and skip the one shadowed by \"docs\", got %q", generated.ID)
+	}
+
+	for id, expected := range map[string]string{"DOCS": "docs", "docs": "docs", "AbCdEf": "AbCdEf", "Legacy": "Legacy"} {
+		found, err := repository.Get(id)
+		if err != nil {
+			t.Errorf("The link %s was not found: %v", id, err)
+			continue
+		}
+		if found.ID != expected {
+			t.Errorf("Expected %s to find the link %s, got %s", id, expected, found.ID)
+		}
+	}
+	if _, err := repository.Get("abcdef"); !errors.As(err, &istorage.NotFoundError{}) {
+		t.Errorf("The generated IDs should only be found by their exact ID, got %v", err)
+	}
+
+	var alreadyExistsErr *istorage.AlreadyExistsError
+	if _, err := repository.Create("AbCdEf", "https://example.tld", "", models.LinkTypeStatic); !errors.As(err, &alreadyExistsErr) {
+		t.Errorf("A custom ID shadowed by a generated one should be rejected, got %v", err)
+	}
+}
@@ -1,105 +1,343 @@
 package repositories
 
 import (
-	gonanoid "github.com/matoous/go-nanoid"
+	"github.com/nethruster/linksh/pkg/events"
+	"github.com/nethruster/linksh/pkg/interfaces/domain_filter"
+	"github.com/nethruster/linksh/pkg/interfaces/id_generator"
 	"github.com/nethruster/linksh/pkg/interfaces/link_repository"
 	sto "github.com/nethruster/linksh/pkg/interfaces/storage"
 	"github.com/nethruster/linksh/pkg/models"
+	errors "golang.org/x/xerrors"
 	"time"
 )
 
 //LinkRepository implements ILinkRepository
 type LinkRepository struct {
 	Storage sto.IStorage
+	//Quotas sets the quota of the users without one of their own
+	Quotas QuotaPolicy
+	//Targets sets which contents are accepted as link targets
+	Targets TargetPolicy
+	//Domains decides which domains the links can point to, if nil every domain is accepted
+	Domains domain_filter.IDomainFilter
+	//IDGenerator generates the IDs of the links created without one, if nil 7 characters long nanoids are used
+	IDGenerator id_generator.IDGenerator
+	//IDs sets how the generated IDs are retried and grown when they collide
+	IDs IDPolicy
+	//Fallback is where the visitors of the unknown IDs are sent when their owner has no fallback, if empty they get a NotFoundError
+	//It is validated as a content when it is served, so the targets and the domains rejected for the links are not served either
+	Fallback string
+	//Suggestions is the number of existing IDs suggested when resolving an unknown ID, 0 disables the suggestions
+	Suggestions uint
+	//Events receives every change of the links, their quotas and their transfers, the hits and the denied operations
+	//The audit log and the webhooks subscribe to it, if nil the events are not published
+	Events *events.Bus
+
+	ids   *idState
+	actor events.Actor
+}
+
+//WithRequest returns a view of the repository publishing the metadata of the request along with the events
+//The view shares the settings and the state of the repository, so a view can be created for every request
+func (lr *LinkRepository) WithRequest(request models.RequestMetadata) link_repository.ILinkRepository {
+	view := lr.view()
+	view.actor.Request = request
+	return view
+}
+
+//as returns a view of the repository whose operations are published as performed by the specified user
+func (lr *LinkRepository) as(actorID string) *LinkRepository {
+	view := lr.view()
+	view.actor.ID = actorID
+	return view
+}
+
+func (lr *LinkRepository) view() *LinkRepository {
+	lr.idState()
+	view := *lr
+	return &view
+}
+
+//authorize checks that the requester is an admin, publishing the denial otherwise
+func (lr *LinkRepository) authorize(requesterID string, action models.AuditAction, targetType models.AuditTargetType, targetID string) error {
+	return authorize(lr.Storage, lr.Events, events.Actor{ID: requesterID, Request: lr.actor.Request}, action, targetType, targetID)
+}
+
+//updated publishes the update of a link, reading it again to know what changed
+//The link is already saved when reading it fails, so the error says so
+func (lr *LinkRepository) updated(before models.Link) error {
+	if lr.Events == nil {
+		return nil
+	}
+	after, err := lr.Storage.GetLink(before.ID)
+	if err != nil {
+		return errors.Errorf("the link was updated, but it could not be read again to publish the update:%w", err)
+	}
+	lr.Events.Publish(events.LinkUpdated{Link: after, Previous: before, Actor: lr.actor})
+	return nil
 }
 
 //Create creates a link and save it to the storage
 //This methods will permorn validations over the provided data
-//If the id is left blank, a random one would be assigned
-//The data validations in this method can produce an ErrInvalidID or an ErrInvalidContent
-func (lr *LinkRepository) Create(id, content, ownerID string) (link models.Link, err error) {
+//If the id is left blank, a random one would be assigned, retrying with another one if it was already in use
+//The content is validated as set by the type of the link, so the prefix links can use placeholders
+//The data validations in this method can produce an ErrInvalidID, an ErrInvalidType or an ErrInvalidContent
+//If the domain of the content is rejected by the domain filter an ErrDomainRejected would be returned
+//If the owner has reached its quota an ErrQuotaExceeded would be returned
+//The content is recorded as the first version of the link, with the owner as its editor
+func (lr *LinkRepository) Create(id, content, ownerID string, linkType models.LinkType) (link models.Link, err error) {
 	mustGenerateID := id == ""
-	if mustGenerateID {
-		id, err = generateLinkID()
-	} else {
-		err = validateID(id)
+	if !mustGenerateID {
+		if err = lr.IDs.validate(id); err != nil {
+			return
+		}
 	}
-	if err != nil {
+	if err = validateType(linkType); err != nil {
 		return
 	}
-	err = validateContent(content)
+	content, err = lr.validateContent(content, linkType)
 	if err != nil {
 		return
 	}
+	if ownerID != "" {
+		if err = lr.checkQuota(ownerID); err != nil {
+			return
+		}
+	}
 	link = models.Link{
-		ID:      id,
+		Type:    linkType,
 		Content: content,
 		OwnerID: ownerID,
 		CreatedAt: time.Now().Unix(),
 	}
 
-	err = lr.Storage.SaveLink(link)
+	if mustGenerateID {
+		err = lr.saveWithGeneratedID(&link)
+	} else {
+		lr.IDs.assignID(&link, id)
+		setSuggestionKeys(&link)
+		var shadowed bool
+		if shadowed, err = lr.shadowed(id); err == nil {
+			if shadowed {
+				err = &sto.AlreadyExistsError{Model: "link", Field: "ID"}
+			} else {
+				err = lr.Storage.SaveLink(link)
+			}
+		}
+	}
+	if err != nil {
+		return
+	}
+
+	//The first version is only known once the ID is, so the link is removed again if it can't be recorded
+	if _, err = lr.recordVersion(ownerID, link.ID, "", content); err != nil {
+		if deleteErr := lr.Storage.DeleteLink(link.ID); deleteErr != nil {
+			err = errors.Errorf("%w, and the link could not be removed afterwards: %v", err, deleteErr)
+		}
+		return
+	}
+	lr.Events.Publish(events.LinkCreated{Link: link, Actor: lr.actor})
 	return
 }
 
-//Get returns the link with specified ID from the storage
+//Get returns the link with specified ID or alias from the storage
 //If the link does not exists in the storage an NotFoundError would be returned
 func (lr *LinkRepository) Get(id string) (models.Link, error) {
 	if id == "" {
 		return models.Link{}, link_repository.ErrInvalidID
 	}
 
-	return lr.Storage.GetLink(id)
+	link, err := lr.getLink(id, lr.Storage.GetLink)
+	if err != nil {
+		return link, err
+	}
+	link.State = link.StateAt(time.Now().Unix())
+
+	return link, nil
 }
 
 //GetContentAndIncreaseHitCount return the link content and increases the hits number of a link in the storage
-//If the link does not exists in the storage an NotFoundError would be returned
+//The ID is resolved as a visit without query, so the content is the target returned by Resolve, like the expanded template of the prefix links
+//Outside of its activation window the fallback of the link is returned instead, counted apart from its hits
+//The unknown IDs, and the links outside of their window without a fallback, return the fallback of the owner or the one of the instance
+//If there is no fallback an NotFoundError would be returned
 func (lr *LinkRepository) GetContentAndIncreaseHitCount(id string) (string, error) {
-	link, err := lr.Get(id)
-	if err != nil {
-		return "", err
-	}
-	if err = lr.IncreaseHitCount(id); err != nil {
-		return "", err
-	}
-
-	return link.Content, nil
+	resolution, err := lr.Resolve(link_repository.ResolveRequest{Path: id})
+	return resolution.Target, err
 }
 
 //List lits the users
 //If the limit is set to 0, no limit will be established, the same applies to the offset
 //if the ownerID is not empty the search would be limited to the owned by the specified user
+//The state of every link is set according to its activation window
 func (lr *LinkRepository) List(ownerID string, limit, offset uint) ([]models.Link, error) {
-	return lr.Storage.ListLinks(ownerID, limit, offset)
+	return withStates(lr.Storage.ListLinks(ownerID, limit, offset))
+}
+
+//ListBroken lists the links whose last health check found them dead or redirecting to another host
+//If the limit is set to 0, no limit will be established, the same applies to the offset
+//if the ownerID is not empty the search would be limited to the ones owned by the specified user
+func (lr *LinkRepository) ListBroken(ownerID string, limit, offset uint) ([]models.Link, error) {
+	return withStates(lr.Storage.ListBrokenLinks(ownerID, limit, offset))
 }
 
 //UpdateContent replaces  the content of an existing link
 //If the link doesn't exists in the Link an error would be returned
 //This methods will permorn validations over the provided data
-//The data validations in this method can produce an ErrInvalidContent
+//The data validations in this method can produce an ErrInvalidContent or an ErrDomainRejected
+//The change is recorded as a new version of the link without an editor
 func (lr *LinkRepository) UpdateContent(id, content string) error {
-	err := validateContent(content)
+	link, err := lr.Get(id)
 	if err != nil {
 		return err
 	}
-	err = lr.Storage.UpdateLinkContent(id, content)
+
+	return lr.updateContent("", link, content)
+}
+
+//Update replaces the settings of an existing link with the not null values of the payload
+//If the link does not exists in the storage an NotFoundError would be returned
+//This methods will permorn validations over the provided data
+//The content, the variants and the rules of the link are validated again when its type changes, which can produce an ErrInvalidContent
+//The content is then saved in the form of the new type, which is recorded as a new version of the link if it changes
+//The variants can also produce an ErrInvalidVariants, the rules an ErrInvalidRules and the rotation an ErrInvalidRotation
+//A link deactivating before activating produces an ErrInvalidSchedule, and its fallback is validated as a content
+//UTM tags longer than 200 characters produce an ErrInvalidUTM
+//An unknown redirect mode produces an ErrInvalidRedirectMode
+func (lr *LinkRepository) Update(payload link_repository.UpdatePayload) error {
+	link, err := lr.Get(payload.ID)
 	if err != nil {
 		return err
 	}
+	payload.ID = link.ID
+
+	linkType := link.Type
+	if payload.Type != nil && *payload.Type != link.Type {
+		if err = validateType(*payload.Type); err != nil {
+			return err
+		}
+		if _, err = lr.validateContent(link.Content, *payload.Type); err != nil {
+			return err
+		}
+		linkType = *payload.Type
+		if payload.Variants == nil {
+			if _, err = lr.validateVariants(link.Variants, linkType); err != nil {
+				return err
+			}
+		}
+		if payload.Rules == nil {
+			if _, err = lr.validateRules(link.Rules, linkType); err != nil {
+				return err
+			}
+		}
+	}
+	if payload.Variants != nil {
+		variants, err := lr.validateVariants(*payload.Variants, linkType)
+		if err != nil {
+			return err
+		}
+		payload.Variants = &variants
+	}
+	if payload.Rules != nil {
+		rules, err := lr.validateRules(*payload.Rules, linkType)
+		if err != nil {
+			return err
+		}
+		payload.Rules = &rules
+	}
+	if payload.Rotation != nil {
+		if err = validateRotation(*payload.Rotation); err != nil {
+			return err
+		}
+	}
+	if payload.ActivatesAt != nil || payload.DeactivatesAt != nil {
+		activatesAt, deactivatesAt := link.ActivatesAt, link.DeactivatesAt
+		if payload.ActivatesAt != nil {
+			activatesAt = *payload.ActivatesAt
+		}
+		if payload.DeactivatesAt != nil {
+			deactivatesAt = *payload.DeactivatesAt
+		}
+		if err = validateSchedule(activatesAt, deactivatesAt); err != nil {
+			return err
+		}
+	}
+	if payload.Fallback != nil && *payload.Fallback != "" {
+		fallback, err := lr.validateContent(*payload.Fallback, models.LinkTypeStatic)
+		if err != nil {
+			return err
+		}
+		payload.Fallback = &fallback
+	}
+	if payload.QueryPassthrough != nil {
+		if err = validateQueryPassthrough(*payload.QueryPassthrough); err != nil {
+			return err
+		}
+	}
+	if payload.UTM != nil && !utmTagsAreValid(*payload.UTM) {
+		return link_repository.ErrInvalidUTM
+	}
+	if payload.RedirectMode != nil {
+		if err = validateRedirectMode(*payload.RedirectMode); err != nil {
+			return err
+		}
+	}
+
+	if err = lr.Storage.UpdateLink(payload); err != nil {
+		return err
+	}
+	if err = lr.updated(link); err != nil {
+		return err
+	}
 
+	//The content is normalized differently by every type, so it is saved again in the form of the new one
+	if linkType != link.Type {
+		if link, err = lr.Get(link.ID); err != nil {
+			return err
+		}
+		return lr.updateContent(lr.actor.ID, link, link.Content)
+	}
 	return nil
 }
 
-//Delete deletes a link from the storage
+//Delete moves a link to the trash, where it can be restored until it is purged
+//Its ID and aliases stay in use until then, so nobody else can take them
+//It must be deleted through its ID, an alias produces an ErrAliasID
 //If the link does not exists in the storage an NotFoundError would be returned
 func (lr *LinkRepository) Delete(id string) error {
-	return lr.Storage.DeleteLink(id)
+	link, err := lr.Get(id)
+	if err != nil {
+		return err
+	}
+	if link.ID != id && link.ID != lr.IDs.key(id) {
+		return link_repository.ErrAliasID
+	}
+
+	if err = lr.Storage.TrashLink(link.ID, time.Now().Unix()); err != nil {
+		return err
+	}
+	lr.Events.Publish(events.LinkDeleted{Link: link, Actor: lr.actor})
+	return nil
 }
 
 //IncreaseHitCount increases the hits number of a link in the storage
 //If the link does not exists in the storage an NotFoundError would be returned
 func (lr *LinkRepository) IncreaseHitCount(id string) error {
-	return lr.Storage.IncreaseLinkHitCount(id)
+	link, err := lr.Get(id)
+	if err != nil {
+		return err
+	}
+
+	if err = lr.Storage.IncreaseLinkHitCount(link.ID); err != nil {
+		return err
+	}
+	lr.hit(link, "", "")
+	return nil
+}
+
+//hit publishes a counted visit to a link, which must be the one read before counting it
+func (lr *LinkRepository) hit(link models.Link, variant, rule string) {
+	lr.Events.Publish(events.LinkHit{Link: link, Variant: variant, Rule: rule})
 }
 
 //GetByUser returns the link with specified ID from the storage
@@ -111,7 +349,7 @@ func (lr *LinkRepository) GetByUser(requesterID, id string) (models.Link, error)
 		return link, err
 	}
 	if link.OwnerID != requesterID {
-		if err = checkIfRequesterIsAdmin(lr.Storage, requesterID); err != nil {
+		if err = lr.authorize(requesterID, models.AuditRead, models.AuditTargetLink, link.ID); err != nil {
 			return link, err
 		}
 	}
@@ -126,7 +364,7 @@ func (lr *LinkRepository) GetByUser(requesterID, id string) (models.Link, error)
 func (lr *LinkRepository) ListByUser(requesterID, ownerID string, limit, offset uint) ([]models.Link, error) {
 	var err error
 	if requesterID != ownerID {
-		if err = checkIfRequesterIsAdmin(lr.Storage, requesterID); err != nil {
+		if err = lr.authorize(requesterID, models.AuditRead, models.AuditTargetLink, ""); err != nil {
 			return nil, err
 		}
 	}
@@ -134,10 +372,25 @@ func (lr *LinkRepository) ListByUser(requesterID, ownerID string, limit, offset
 	return lr.List(ownerID, limit, offset)
 }
 
+//ListBrokenByUser lists the links whose last health check found them dead or redirecting to another host
+//If the limit is set to 0, no limit will be established, the same applies to the offset
+//if the ownerID is not empty the search would be limited to the ones owned by the specified user
+//The requester must be the owner of the links or an admin to perform this action
+func (lr *LinkRepository) ListBrokenByUser(requesterID, ownerID string, limit, offset uint) ([]models.Link, error) {
+	if requesterID != ownerID {
+		if err := lr.authorize(requesterID, models.AuditRead, models.AuditTargetLink, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return lr.ListBroken(ownerID, limit, offset)
+}
+
 //UpdateContentByUser replaces  the content of an existing link
 //If the link doesn't exists in the Link an error would be returned
 //This methods will permorn validations over the provided data
-//The data validations in this method can produce an ErrInvalidContent
+//The data validations in this method can produce an ErrInvalidContent or an ErrDomainRejected
+//The change is recorded as a new version of the link, with the requester as its editor
 //The requester must own the link or be an admin to perform this action
 func (lr *LinkRepository) UpdateContentByUser(requesterID, id, content string) error {
 	link, err := lr.Get(id)
@@ -145,15 +398,41 @@ func (lr *LinkRepository) UpdateContentByUser(requesterID, id, content string) e
 		return err
 	}
 	if link.OwnerID != requesterID {
-		if err = checkIfRequesterIsAdmin(lr.Storage, requesterID); err != nil {
+		if err = lr.authorize(requesterID, models.AuditUpdate, models.AuditTargetLink, link.ID); err != nil {
+			return err
+		}
+	}
+
+	return lr.as(requesterID).updateContent(requesterID, link, content)
+}
+
+//UpdateByUser replaces the settings of an existing link with the not null values of the payload
+//If the link does not exists in the storage an NotFoundError would be returned
+//This methods will permorn validations over the provided data
+//The content, the variants and the rules of the link are validated again when its type changes, which can produce an ErrInvalidContent
+//The content is then saved in the form of the new type, which is recorded as a new version of the link if it changes
+//The variants can also produce an ErrInvalidVariants, the rules an ErrInvalidRules and the rotation an ErrInvalidRotation
+//A link deactivating before activating produces an ErrInvalidSchedule, and its fallback is validated as a content
+//UTM tags longer than 200 characters produce an ErrInvalidUTM
+//An unknown redirect mode produces an ErrInvalidRedirectMode
+//The requester must own the link or be an admin to perform this action
+func (lr *LinkRepository) UpdateByUser(requesterID string, payload link_repository.UpdatePayload) error {
+	link, err := lr.Get(payload.ID)
+	if err != nil {
+		return err
+	}
+	if link.OwnerID != requesterID {
+		if err = lr.authorize(requesterID, models.AuditUpdate, models.AuditTargetLink, link.ID); err != nil {
 			return err
 		}
 	}
 
-	return lr.UpdateContent(id, content)
+	return lr.as(requesterID).Update(payload)
 }
 
-//DeleteByUser deletes a link from the storage
+//DeleteByUser moves a link to the trash, where it can be restored until it is purged
+//Its ID and aliases stay in use until then, so nobody else can take them
+//It must be deleted through its ID, an alias produces an ErrAliasID
 //If the link does not exists in the storage an NotFoundError would be returned
 //The requester must own the link or be an admin to perform this action
 func (lr *LinkRepository) DeleteByUser(requesterID, id string) error {
@@ -162,28 +441,84 @@ func (lr *LinkRepository) DeleteByUser(requesterID, id string) error {
 		return err
 	}
 	if link.OwnerID != requesterID {
-		if err = checkIfRequesterIsAdmin(lr.Storage, requesterID); err != nil {
+		if err = lr.authorize(requesterID, models.AuditDelete, models.AuditTargetLink, link.ID); err != nil {
 			return err
 		}
 	}
 
-	return lr.Delete(id)
+	return lr.as(requesterID).Delete(id)
+}
+
+//validateContent validates and normalizes the content of a link of the specified type, and checks its domain
+func (lr *LinkRepository) validateContent(content string, linkType models.LinkType) (string, error) {
+	var err error
+	if linkType == models.LinkTypePrefix {
+		content, err = lr.Targets.normalizeTemplate(content)
+	} else {
+		content, err = lr.Targets.normalize(content)
+	}
+	if err != nil {
+		return "", err
+	}
+	if err = checkDomains(lr.Domains, content); err != nil {
+		return "", err
+	}
+	return content, nil
 }
 
-func validateID(id string) error {
-	if length := len(id); length == 0 || length > 100 {
-		return link_repository.ErrInvalidID
+//checkDomains checks every domain of a normalized content against the domain filter, if any
+func checkDomains(domains domain_filter.IDomainFilter, content string) error {
+	if domains == nil {
+		return nil
+	}
+	for _, domain := range targetDomains(content) {
+		if err := domains.Check(domain); err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
-func validateContent(content string) error {
-	if length := len(content); length == 0 || length > 2000 {
-		return link_repository.ErrInvalidContent
+func validateType(linkType models.LinkType) error {
+	switch linkType {
+	case models.LinkTypeStatic, models.LinkTypePrefix:
+		return nil
+	}
+	return link_repository.ErrInvalidType
+}
+
+func validateQueryPassthrough(passthrough models.QueryPassthrough) error {
+	switch passthrough {
+	case models.QueryPassthroughNone, models.QueryPassthroughOverride, models.QueryPassthroughKeepExisting:
+		return nil
+	}
+	return link_repository.ErrInvalidQueryPassthrough
+}
+
+func validateRedirectMode(mode models.RedirectMode) error {
+	switch mode {
+	case models.RedirectTemporary, models.RedirectTemporaryKeepMethod, models.RedirectPermanent,
+		models.RedirectPermanentKeepMethod, models.RedirectMetaRefresh, models.RedirectInterstitial:
+		return nil
+	}
+	return link_repository.ErrInvalidRedirectMode
+}
+
+func validateSchedule(activatesAt, deactivatesAt int64) error {
+	if activatesAt < 0 || deactivatesAt < 0 || (activatesAt != 0 && deactivatesAt != 0 && deactivatesAt <= activatesAt) {
+		return link_repository.ErrInvalidSchedule
 	}
 	return nil
 }
 
-func generateLinkID() (string, error) {
-	return gonanoid.Nanoid(7)
+//withStates sets the state of the listed links according to their activation window
+func withStates(links []models.Link, err error) ([]models.Link, error) {
+	if err != nil {
+		return links, err
+	}
+	now := time.Now().Unix()
+	for i := range links {
+		links[i].State = links[i].StateAt(now)
+	}
+	return links, nil
 }
@@ -0,0 +1,330 @@
+package repositories
+
+import (
+	"github.com/nethruster/linksh/pkg/interfaces/link_repository"
+	sto "github.com/nethruster/linksh/pkg/interfaces/storage"
+	"github.com/nethruster/linksh/pkg/models"
+	errors "golang.org/x/xerrors"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+//Resolve finds the link matching the requested path, increases its hits number and returns where the visitor must be sent
+//The link whose ID equals the path is preferred, otherwise the prefix link with the longest ID matching the start of the path is used
+//The query and the fragment of the visit are merged into the target as set by the query passthrough of the link
+//The UTM tags of the link, completed with the ones of its owner, are appended to the target unless it already has them
+//Outside of its activation window the visitor is sent to the fallback of the link, counted apart from its hits
+//The unknown IDs, and the links outside of their window without a fallback, are sent to the fallback of the owner or to the one of the instance
+//The fallback hits of the owners and the instance are counted apart too
+//The first rule of the link matching the user agent of the visit provides the target, and the hit is also attributed to it
+//Otherwise, when the link has variants one of them is chosen as set by its rotation, and the hit is also attributed to it
+//The resolution carries the redirect mode of the link
+//If no link matches the path and there is no fallback an NotFoundError would be returned
+//It is wrapped in an UnknownIDError with the closest existing IDs when the suggestions are enabled
+func (lr *LinkRepository) Resolve(request link_repository.ResolveRequest) (resolution link_repository.Resolution, err error) {
+	path := strings.Trim(request.Path, "/")
+	link, rest, err := lr.match(path)
+	if errors.As(err, &sto.NotFoundError{}) {
+		resolution, err = lr.fallback(request.OwnerID, err)
+		if errors.As(err, &sto.NotFoundError{}) && lr.Suggestions != 0 {
+			err = lr.unknownID(path, err)
+		}
+		return
+	}
+	if err != nil {
+		return
+	}
+	link.State = link.StateAt(time.Now().Unix())
+	if link.State != models.LinkActive {
+		return lr.inactive(link)
+	}
+
+	target, variant, ruleName := link.Content, "", ""
+	if rule, ok := matchRule(link.Rules, request.UserAgent); ok {
+		target, ruleName = rule.Content, rule.Name
+	} else if len(link.Variants) > 0 {
+		var chosen models.LinkVariant
+		if chosen, err = lr.chooseVariant(link); err != nil {
+			return
+		}
+		target, variant = chosen.Content, chosen.Name
+	}
+	if link.Type == models.LinkTypePrefix {
+		if target, err = expandTemplate(target, rest, request.RawQuery); err != nil {
+			return
+		}
+	}
+	if target, err = passQuery(target, request, link.QueryPassthrough); err != nil {
+		return
+	}
+	if target, err = lr.tagUTM(target, link); err != nil {
+		return
+	}
+	switch {
+	case ruleName != "":
+		err = lr.Storage.IncreaseLinkRuleHitCount(link.ID, ruleName)
+	case variant != "":
+		err = lr.Storage.IncreaseLinkVariantHitCount(link.ID, variant)
+	default:
+		err = lr.Storage.IncreaseLinkHitCount(link.ID)
+	}
+	if err != nil {
+		return
+	}
+	lr.hit(link, variant, ruleName)
+
+	resolution = link_repository.Resolution{Link: link, Target: target, Mode: link.RedirectMode, Variant: variant, Rule: ruleName}
+	return
+}
+
+//FallbackHits returns the number of visits sent to the fallback of the specified user, or to the one of the instance if ownerID is empty
+func (lr *LinkRepository) FallbackHits(ownerID string) (uint64, error) {
+	return lr.Storage.GetCounter(fallbackCounterName(ownerID))
+}
+
+//FallbackHitsByUser returns the number of visits sent to the fallback of the specified user, or to the one of the instance if ownerID is empty
+//The requester must be the specified user or an admin to perform this action
+func (lr *LinkRepository) FallbackHitsByUser(requesterID, ownerID string) (uint64, error) {
+	if ownerID == "" || requesterID != ownerID {
+		if err := lr.authorize(requesterID, models.AuditRead, models.AuditTargetLink, ""); err != nil {
+			return 0, err
+		}
+	}
+
+	return lr.FallbackHits(ownerID)
+}
+
+//inactive resolves a visit to a link outside of its activation window to its fallback, or the one of its owner or the instance
+func (lr *LinkRepository) inactive(link models.Link) (link_repository.Resolution, error) {
+	if link.Fallback == "" {
+		return lr.fallback(link.OwnerID, sto.NewNotFoundError("link", "ID", link.ID))
+	}
+	if err := lr.Storage.IncreaseLinkFallbackHitCount(link.ID); err != nil {
+		return link_repository.Resolution{}, err
+	}
+	return link_repository.Resolution{Link: link, Target: link.Fallback, Fallback: link_repository.FallbackLink}, nil
+}
+
+//fallback resolves a visit that no link can serve to the fallback of the owner or the one of the instance
+//If there is none the provided notFound error is returned
+func (lr *LinkRepository) fallback(ownerID string, notFound error) (resolution link_repository.Resolution, err error) {
+	if ownerID != "" {
+		owner, err := lr.Storage.GetUser(ownerID)
+		if err != nil && !errors.As(err, &sto.NotFoundError{}) {
+			return resolution, err
+		}
+		if owner.Fallback != "" {
+			if _, err = lr.Storage.IncreaseCounter(fallbackCounterName(ownerID)); err != nil {
+				return resolution, err
+			}
+			return link_repository.Resolution{Target: owner.Fallback, Fallback: link_repository.FallbackOwner}, nil
+		}
+	}
+	if lr.Fallback == "" {
+		return resolution, notFound
+	}
+	target, err := lr.validateContent(lr.Fallback, models.LinkTypeStatic)
+	if err != nil {
+		return resolution, errors.Errorf("invalid fallback of the instance:%w", err)
+	}
+	if _, err = lr.Storage.IncreaseCounter(fallbackCounterName("")); err != nil {
+		return
+	}
+	return link_repository.Resolution{Target: target, Fallback: link_repository.FallbackInstance}, nil
+}
+
+//unknownID wraps the notFound error of an unknown ID in an UnknownIDError with the closest existing IDs
+func (lr *LinkRepository) unknownID(id string, notFound error) error {
+	suggestions, err := lr.SuggestIDs(id, lr.Suggestions)
+	if err != nil {
+		return err
+	}
+	return link_repository.UnknownIDError{ID: id, Suggestions: suggestions, Err: notFound}
+}
+
+func fallbackCounterName(ownerID string) string {
+	if ownerID == "" {
+		return "fallback"
+	}
+	return "fallback:" + ownerID
+}
+
+//match finds the link matching a path and returns the rest of the path after its ID
+func (lr *LinkRepository) match(path string) (models.Link, string, error) {
+	if path == "" {
+		return models.Link{}, "", link_repository.ErrInvalidID
+	}
+
+	//The candidates go from the whole path to its first segment, with the exact keys of every one first
+	//The ones that are too long or have too many segments to be an ID are skipped
+	segments := strings.SplitN(path, "/", maxIDSegments+1)
+	candidates := make([][]string, len(segments))
+	var keys []string
+	for i := range candidates {
+		candidate := strings.Join(segments[:len(segments)-i], "/")
+		if len(candidate) > maxIDLength || len(segments)-i > maxIDSegments {
+			continue
+		}
+		candidates[i] = lr.IDs.keys(candidate)
+		keys = append(keys, candidates[i]...)
+	}
+	if len(keys) == 0 {
+		return models.Link{}, "", sto.NewNotFoundError("link", "ID", path)
+	}
+	links, err := lr.Storage.GetLinks(keys)
+	if err != nil {
+		return models.Link{}, "", err
+	}
+	byID := make(map[string]models.Link, len(links))
+	for _, link := range links {
+		byID[link.ID] = link
+		for _, alias := range link.Aliases {
+			byID[alias] = link
+		}
+	}
+
+	for i, candidate := range candidates {
+		for _, key := range candidate {
+			link, ok := byID[key]
+			if ok && (i == 0 || link.Type == models.LinkTypePrefix) {
+				return link, strings.Join(segments[len(segments)-i:], "/"), nil
+			}
+		}
+	}
+	return models.Link{}, "", sto.NewNotFoundError("link", "ID", path)
+}
+
+//passQuery merges the query and the fragment of the visit into the target as set by the passthrough of the link
+//The query of the target is kept as it is, in its order, and the parameters of the visit are appended to it
+func passQuery(target string, request link_repository.ResolveRequest, passthrough models.QueryPassthrough) (string, error) {
+	if passthrough == models.QueryPassthroughNone || (request.RawQuery == "" && request.Fragment == "") {
+		return target, nil
+	}
+
+	targetURL, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+	incoming := splitQuery(request.RawQuery)
+	if len(incoming) != 0 {
+		overridden := make(map[string]bool, len(incoming))
+		if passthrough == models.QueryPassthroughOverride {
+			for _, parameter := range incoming {
+				overridden[parameter.name] = true
+			}
+		}
+		existing := make(map[string]bool)
+		var query []string
+		for _, parameter := range splitQuery(targetURL.RawQuery) {
+			if !overridden[parameter.name] {
+				existing[parameter.name] = true
+				query = append(query, parameter.raw)
+			}
+		}
+		for _, parameter := range incoming {
+			if !existing[parameter.name] {
+				query = append(query, parameter.encode())
+			}
+		}
+		targetURL.RawQuery = strings.Join(query, "&")
+	}
+	if request.Fragment != "" && (targetURL.Fragment == "" || passthrough == models.QueryPassthroughOverride) {
+		targetURL.Fragment = request.Fragment
+	}
+
+	return targetURL.String(), nil
+}
+
+//queryParameter is a parameter of a query, with its name and value unescaped
+type queryParameter struct {
+	name, value string
+	hasValue    bool
+	//raw is the parameter as it was in the query
+	raw string
+}
+
+//encode returns the parameter escaped, without the '=' if it had no value
+func (qp queryParameter) encode() string {
+	if !qp.hasValue {
+		return url.QueryEscape(qp.name)
+	}
+	return url.QueryEscape(qp.name) + "=" + url.QueryEscape(qp.value)
+}
+
+//splitQuery returns the parameters of a raw query in their order, the malformed ones are skipped as url.ParseQuery does
+func splitQuery(rawQuery string) []queryParameter {
+	var parameters []queryParameter
+	for _, raw := range strings.Split(rawQuery, "&") {
+		if raw == "" {
+			continue
+		}
+		name, value := raw, ""
+		equals := strings.IndexByte(raw, '=')
+		if equals != -1 {
+			name, value = raw[:equals], raw[equals+1:]
+		}
+		name, err := url.QueryUnescape(name)
+		if err != nil {
+			continue
+		}
+		value, err = url.QueryUnescape(value)
+		if err != nil {
+			continue
+		}
+		parameters = append(parameters, queryParameter{name: name, value: value, hasValue: equals != -1, raw: raw})
+	}
+	return parameters
+}
+
+//tagUTM appends the UTM tags of the link to the target, the missing ones are taken from the owner of the link
+//The parameters already present in the target are kept, as well as the targets that are not http or https URLs
+func (lr *LinkRepository) tagUTM(target string, link models.Link) (string, error) {
+	targetURL, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+	if targetURL.Scheme != "http" && targetURL.Scheme != "https" {
+		return target, nil
+	}
+	existing := make(map[string]bool)
+	for _, parameter := range splitQuery(targetURL.RawQuery) {
+		existing[parameter.name] = true
+	}
+
+	tags := link.UTM
+	//The owner is only read when the target would miss a tag that the link doesn't set
+	missing := (tags.Source == "" && !existing["utm_source"]) ||
+		(tags.Medium == "" && !existing["utm_medium"]) ||
+		(tags.Campaign == "" && !existing["utm_campaign"])
+	if missing && link.OwnerID != "" {
+		owner, err := lr.Storage.GetUser(link.OwnerID)
+		if err != nil && !errors.As(err, &sto.NotFoundError{}) {
+			return "", err
+		}
+		tags = tags.WithDefaults(owner.UTM)
+	}
+
+	parameters := tags.Parameters()
+	names := make([]string, 0, len(parameters))
+	for name := range parameters {
+		if !existing[name] {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return target, nil
+	}
+	sort.Strings(names)
+	query := make([]string, 0, len(names)+1)
+	if targetURL.RawQuery != "" {
+		query = append(query, targetURL.RawQuery)
+	}
+	for _, name := range names {
+		query = append(query, url.QueryEscape(name)+"="+url.QueryEscape(parameters[name]))
+	}
+	targetURL.RawQuery = strings.Join(query, "&")
+
+	return targetURL.String(), nil
+}
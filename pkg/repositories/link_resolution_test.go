@@ -0,0 +1,894 @@
+package repositories
+
+import (
+	"errors"
+	"github.com/nethruster/linksh/pkg/interfaces/link_repository"
+	istorage "github.com/nethruster/linksh/pkg/interfaces/storage"
+	"github.com/nethruster/linksh/pkg/models"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// linkStorage keeps the links in memory for the tests of the resolution
+type linkStorage struct {
+	istorage.IStorage
+	links     map[string]models.Link
+	users     map[string]models.User
+	counters  map[string]uint64
+	versions  []models.LinkVersion
+	audit     []models.AuditRecord
+	webhooks  map[string]models.Webhook
+	transfers map[string]models.LinkTransfer
+	quotas    map[string]models.UserQuota
+}
+
+func newLinkStorage(links ...models.Link) *linkStorage {
+	storage := &linkStorage{links: make(map[string]models.Link), users: make(map[string]models.User), counters: make(map[string]uint64)}
+	for _, link := range links {
+		storage.links[link.ID] = link
+	}
+	return storage
+}
+
+func (ls *linkStorage) SaveLink(link models.Link) error {
+	if _, ok := ls.lookup(link.ID); ok {
+		return &istorage.AlreadyExistsError{Model: "link", Field: "ID"}
+	}
+	ls.links[link.ID] = link
+	return nil
+}
+
+func (ls *linkStorage) DeleteLink(id string) error {
+	if _, ok := ls.links[id]; !ok {
+		return istorage.NewNotFoundError("link", "ID", id)
+	}
+	delete(ls.links, id)
+	return nil
+}
+
+func (ls *linkStorage) UpdateLinkContent(id, content string) error {
+	link, ok := ls.links[id]
+	if !ok {
+		return istorage.NewNotFoundError("link", "ID", id)
+	}
+	link.Content = content
+	ls.links[id] = link
+	return nil
+}
+
+//UpdateLink only supports the type of the link
+func (ls *linkStorage) UpdateLink(payload link_repository.UpdatePayload) error {
+	link, ok := ls.links[payload.ID]
+	if !ok {
+		return istorage.NewNotFoundError("link", "ID", payload.ID)
+	}
+	if payload.Type != nil {
+		link.Type = *payload.Type
+	}
+	ls.links[payload.ID] = link
+	return nil
+}
+
+func (ls *linkStorage) SaveLinkVersion(version models.LinkVersion) error {
+	ls.versions = append(ls.versions, version)
+	return nil
+}
+
+func (ls *linkStorage) GetLinkVersion(id string) (models.LinkVersion, error) {
+	for _, version := range ls.versions {
+		if version.ID == id {
+			return version, nil
+		}
+	}
+	return models.LinkVersion{}, istorage.NewNotFoundError("link version", "ID", id)
+}
+
+func (ls *linkStorage) DeleteLinkVersion(id string) error {
+	for i, version := range ls.versions {
+		if version.ID == id {
+			ls.versions = append(ls.versions[:i], ls.versions[i+1:]...)
+			return nil
+		}
+	}
+	return istorage.NewNotFoundError("link version", "ID", id)
+}
+
+func (ls *linkStorage) ListLinkVersions(linkID string, limit, offset uint) ([]models.LinkVersion, error) {
+	var versions []models.LinkVersion
+	for i := len(ls.versions) - 1; i >= 0; i-- {
+		if ls.versions[i].LinkID == linkID {
+			versions = append(versions, ls.versions[i])
+		}
+	}
+	return versions, nil
+}
+
+//lookup finds a link by its ID or one of its aliases, including the trashed ones
+func (ls *linkStorage) lookup(id string) (models.Link, bool) {
+	if link, ok := ls.links[id]; ok {
+		return link, true
+	}
+	for _, link := range ls.links {
+		for _, alias := range link.Aliases {
+			if alias == id {
+				return link, true
+			}
+		}
+	}
+	return models.Link{}, false
+}
+
+func (ls *linkStorage) SaveAuditRecord(record models.AuditRecord) error {
+	ls.audit = append(ls.audit, record)
+	return nil
+}
+
+func (ls *linkStorage) ListAuditRecords(filter models.AuditFilter, limit, offset uint) ([]models.AuditRecord, error) {
+	var records []models.AuditRecord
+	for _, record := range ls.audit {
+		if (filter.ActorID == "" || record.ActorID == filter.ActorID) &&
+			(filter.TargetID == "" || record.TargetID == filter.TargetID) &&
+			(!filter.DeniedOnly || record.Denied) {
+			records = append(records, record)
+		}
+	}
+	if offset >= uint(len(records)) {
+		return nil, nil
+	}
+	records = records[offset:]
+	if limit != 0 && uint(len(records)) > limit {
+		records = records[:limit]
+	}
+	return records, nil
+}
+
+func (ls *linkStorage) SaveWebhook(webhook models.Webhook) error {
+	if ls.webhooks == nil {
+		ls.webhooks = make(map[string]models.Webhook)
+	}
+	ls.webhooks[webhook.ID] = webhook
+	return nil
+}
+
+func (ls *linkStorage) GetWebhook(id string) (models.Webhook, error) {
+	webhook, ok := ls.webhooks[id]
+	if !ok {
+		return webhook, istorage.NewNotFoundError("webhook", "ID", id)
+	}
+	return webhook, nil
+}
+
+func (ls *linkStorage) GetLink(id string) (models.Link, error) {
+	if link, ok := ls.lookup(id); ok && link.DeletedAt == 0 {
+		return link, nil
+	}
+	return models.Link{}, istorage.NewNotFoundError("link", "ID", id)
+}
+
+func (ls *linkStorage) TrashLink(id string, deletedAt int64) error {
+	link, ok := ls.links[id]
+	if !ok || link.DeletedAt != 0 {
+		return istorage.NewNotFoundError("link", "ID", id)
+	}
+	link.DeletedAt = deletedAt
+	ls.links[id] = link
+	return nil
+}
+
+func (ls *linkStorage) GetTrashedLink(id string) (models.Link, error) {
+	if link, ok := ls.lookup(id); ok && link.DeletedAt != 0 {
+		return link, nil
+	}
+	return models.Link{}, istorage.NewNotFoundError("link", "ID", id)
+}
+
+func (ls *linkStorage) RestoreLink(id string) error {
+	link, ok := ls.links[id]
+	if !ok || link.DeletedAt == 0 {
+		return istorage.NewNotFoundError("link", "ID", id)
+	}
+	link.DeletedAt = 0
+	ls.links[id] = link
+	return nil
+}
+
+func (ls *linkStorage) GetLinks(ids []string) ([]models.Link, error) {
+	var links []models.Link
+	for _, id := range ids {
+		if link, err := ls.GetLink(id); err == nil {
+			links = append(links, link)
+		}
+	}
+	return links, nil
+}
+
+func (ls *linkStorage) AddLinkAlias(id, alias string) error {
+	link, ok := ls.links[id]
+	if !ok {
+		return istorage.NewNotFoundError("link", "ID", id)
+	}
+	if _, ok := ls.lookup(alias); ok {
+		return &istorage.AlreadyExistsError{Model: "link", Field: "alias"}
+	}
+	link.Aliases = append(append([]string(nil), link.Aliases...), alias)
+	ls.links[id] = link
+	return nil
+}
+
+func (ls *linkStorage) RemoveLinkAlias(id, alias string) error {
+	link, ok := ls.links[id]
+	if !ok {
+		return istorage.NewNotFoundError("link", "ID", id)
+	}
+	var aliases []string
+	for _, existing := range link.Aliases {
+		if existing != alias {
+			aliases = append(aliases, existing)
+		}
+	}
+	if len(aliases) == len(link.Aliases) {
+		return istorage.NewNotFoundError("link alias", "alias", alias)
+	}
+	link.Aliases = aliases
+	ls.links[id] = link
+	return nil
+}
+
+func (ls *linkStorage) IncreaseLinkVariantHitCount(id, variant string) error {
+	link, ok := ls.links[id]
+	if !ok {
+		return istorage.NewNotFoundError("link", "ID", id)
+	}
+	link.Variants = append([]models.LinkVariant(nil), link.Variants...)
+	for i := range link.Variants {
+		if link.Variants[i].Name == variant {
+			link.Variants[i].Hits++
+			link.Hits++
+			ls.links[id] = link
+			return nil
+		}
+	}
+	return istorage.NewNotFoundError("link", "ID", id)
+}
+
+func (ls *linkStorage) IncreaseLinkRuleHitCount(id, rule string) error {
+	link, ok := ls.links[id]
+	if !ok {
+		return istorage.NewNotFoundError("link", "ID", id)
+	}
+	link.Rules = append([]models.LinkRule(nil), link.Rules...)
+	for i := range link.Rules {
+		if link.Rules[i].Name == rule {
+			link.Rules[i].Hits++
+			link.Hits++
+			ls.links[id] = link
+			return nil
+		}
+	}
+	return istorage.NewNotFoundError("link", "ID", id)
+}
+
+func (ls *linkStorage) IncreaseLinkFallbackHitCount(id string) error {
+	link, ok := ls.links[id]
+	if !ok {
+		return istorage.NewNotFoundError("link", "ID", id)
+	}
+	link.FallbackHits++
+	ls.links[id] = link
+	return nil
+}
+
+func (ls *linkStorage) GetCounter(name string) (uint64, error) {
+	return ls.counters[name], nil
+}
+
+func (ls *linkStorage) IncreaseCounter(name string) (uint64, error) {
+	ls.counters[name]++
+	return ls.counters[name], nil
+}
+
+func (ls *linkStorage) GetUser(id string) (models.User, error) {
+	user, ok := ls.users[id]
+	if !ok {
+		return user, istorage.NewNotFoundError("user", "ID", id)
+	}
+	return user, nil
+}
+
+func (ls *linkStorage) ListLinksBySuggestionKeys(keys []string, prefix string, limit uint) ([]models.Link, error) {
+	var ids []string
+	for id, link := range ls.links {
+		for _, linkKey := range link.SuggestionKeys {
+			matches := prefix != "" && strings.HasPrefix(linkKey, prefix)
+			for _, key := range keys {
+				matches = matches || key == linkKey
+			}
+			if matches {
+				ids = append(ids, id)
+				break
+			}
+		}
+	}
+	sort.Strings(ids)
+	if limit != 0 && uint(len(ids)) > limit {
+		ids = ids[:limit]
+	}
+	links := make([]models.Link, len(ids))
+	for i, id := range ids {
+		links[i] = ls.links[id]
+	}
+	return links, nil
+}
+
+func (ls *linkStorage) ListLinksAfter(afterID string, limit uint) ([]models.Link, error) {
+	var ids []string
+	for id := range ls.links {
+		if id > afterID {
+			ids = append(ids, id)
+		}
+	}
+	sort.Strings(ids)
+	if limit != 0 && uint(len(ids)) > limit {
+		ids = ids[:limit]
+	}
+	links := make([]models.Link, len(ids))
+	for i, id := range ids {
+		links[i] = ls.links[id]
+	}
+	return links, nil
+}
+
+func (ls *linkStorage) UpdateLinkSuggestionKeys(id string, keys []string) error {
+	link, ok := ls.links[id]
+	if !ok {
+		return istorage.NewNotFoundError("link", "ID", id)
+	}
+	link.SuggestionKeys = keys
+	ls.links[id] = link
+	return nil
+}
+
+func (ls *linkStorage) CountLinks(ownerID string, createdSince int64) (count uint, err error) {
+	for _, link := range ls.links {
+		if link.DeletedAt == 0 && (ownerID == "" || link.OwnerID == ownerID) && link.CreatedAt >= createdSince {
+			count++
+		}
+	}
+	return
+}
+
+func (ls *linkStorage) IncreaseLinkHitCount(id string) error {
+	link, ok := ls.links[id]
+	if !ok {
+		return istorage.NewNotFoundError("link", "ID", id)
+	}
+	link.Hits++
+	ls.links[id] = link
+	return nil
+}
+
+func TestResolve(t *testing.T) {
+	storage := newLinkStorage(
+		models.Link{ID: "docs", Content: "https://docs.example.tld/", RedirectMode: models.RedirectPermanent},
+		models.Link{ID: "gh", Type: models.LinkTypePrefix, Content: "https://github.com"},
+		models.Link{ID: "jira", Type: models.LinkTypePrefix, Content: "https://jira.example.tld/browse/{1}?focus={query.focus}"},
+		models.Link{ID: "search", Type: models.LinkTypePrefix, Content: "https://search.example.tld/?q={path}&{query}"},
+	)
+	repository := &LinkRepository{Storage: storage}
+
+	cases := []struct {
+		path, rawQuery, target string
+	}{
+		{"docs", "", "https://docs.example.tld/"},
+		{"/docs/", "", "https://docs.example.tld/"},
+		{"gh", "", "https://github.com"},
+		{"gh/nethruster/linksh", "", "https://github.com/nethruster/linksh"},
+		{"jira/ABC-123", "focus=a b&x=1", "https://jira.example.tld/browse/ABC-123?focus=a+b"},
+		{"jira/ABC-123/extra", "", "https://jira.example.tld/browse/ABC-123?focus="},
+		{"jira", "", "https://jira.example.tld/browse/?focus="},
+		{"search/go links", "lang=en", "https://search.example.tld/?q=go+links&lang=en"},
+		{"search/a&b=c", "", "https://search.example.tld/?q=a%26b%3Dc&"},
+	}
+	for _, c := range cases {
+		resolution, err := repository.Resolve(link_repository.ResolveRequest{Path: c.path, RawQuery: c.rawQuery})
+		if err != nil {
+			t.Errorf("%q should be resolved, got %v", c.path, err)
+			continue
+		}
+		if resolution.Target != c.target {
+			t.Errorf("%q should be resolved to %q, got %q", c.path, c.target, resolution.Target)
+		}
+		if resolution.Mode != resolution.Link.RedirectMode {
+			t.Errorf("%q should be resolved with the mode of its link %q, got %q", c.path, resolution.Link.RedirectMode, resolution.Mode)
+		}
+	}
+
+	if hits := storage.links["gh"].Hits; hits != 2 {
+		t.Errorf("The hits of the prefix link should be increased, expected 2 got %v", hits)
+	}
+
+	content, err := repository.GetContentAndIncreaseHitCount("search")
+	if err != nil || content != "https://search.example.tld/?q=&" {
+		t.Errorf("The content of a prefix link should be its expanded template, got %q %v", content, err)
+	}
+	if content, err = repository.GetContentAndIncreaseHitCount("jira/ABC-1"); err != nil || content != "https://jira.example.tld/browse/ABC-1?focus=" {
+		t.Errorf("The rest of the ID should be placed in the template, got %q %v", content, err)
+	}
+
+	for _, path := range []string{"docs/extra", "unknown", "unknown/gh"} {
+		_, err := repository.Resolve(link_repository.ResolveRequest{Path: path})
+		if !errors.As(err, &istorage.NotFoundError{}) {
+			t.Errorf("%q should not be resolved, got %v", path, err)
+		}
+	}
+}
+
+func TestCreatePrefixLink(t *testing.T) {
+	storage := newLinkStorage()
+	repository := &LinkRepository{Storage: storage}
+
+	link, err := repository.Create("jira", "https://jira.example.tld/browse/{1}", "", models.LinkTypePrefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if link.Type != models.LinkTypePrefix || storage.links["jira"].Content != "https://jira.example.tld/browse/{1}" {
+		t.Errorf("The prefix link should be saved with its template, got %+v", storage.links["jira"])
+	}
+	resolution, err := repository.Resolve(link_repository.ResolveRequest{Path: "jira/ABC-123"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolution.Target != "https://jira.example.tld/browse/ABC-123" {
+		t.Errorf("The template should be expanded, got %q", resolution.Target)
+	}
+
+	if _, err = repository.Create("bad", "https://example.tld/{1}", "", "wildcard"); !errors.Is(err, link_repository.ErrInvalidType) {
+		t.Errorf("An unknown type should be rejected, got %v", err)
+	}
+
+	static := models.LinkTypeStatic
+	if err = repository.Update(link_repository.UpdatePayload{ID: "jira", Type: &static}); err != nil {
+		t.Fatal(err)
+	}
+	if content := storage.links["jira"].Content; content != "https://jira.example.tld/browse/%7B1%7D" {
+		t.Errorf("The content should be saved in the form of the new type, got %q", content)
+	}
+	if len(storage.versions) != 2 {
+		t.Errorf("The new form of the content should be recorded as a version, got %+v", storage.versions)
+	}
+}
+
+//lookupStorage records the IDs requested to the storage
+type lookupStorage struct {
+	*linkStorage
+	requested []string
+}
+
+func (ls *lookupStorage) GetLinks(ids []string) ([]models.Link, error) {
+	ls.requested = append(ls.requested, ids...)
+	return ls.linkStorage.GetLinks(ids)
+}
+
+func TestMatchCandidates(t *testing.T) {
+	storage := &lookupStorage{linkStorage: newLinkStorage(
+		models.Link{ID: "gh", Type: models.LinkTypePrefix, Content: "https://github.com"},
+	)}
+	repository := &LinkRepository{Storage: storage}
+
+	path := "gh/" + strings.Repeat("a/", 5000) + strings.Repeat("b", 200)
+	resolution, err := repository.Resolve(link_repository.ResolveRequest{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(resolution.Target, strings.Repeat("b", 200)) {
+		t.Errorf("The rest of the path should be kept, got %q", resolution.Target)
+	}
+	if len(storage.requested) > maxIDSegments {
+		t.Errorf("Expected at most %d candidates, got %d", maxIDSegments, len(storage.requested))
+	}
+	for _, id := range storage.requested {
+		if len(id) > maxIDLength {
+			t.Errorf("A candidate longer than an ID was requested: %q", id)
+		}
+	}
+
+	storage.requested = nil
+	if _, err = repository.Resolve(link_repository.ResolveRequest{Path: strings.Repeat("c", 200)}); !errors.As(err, &istorage.NotFoundError{}) {
+		t.Errorf("A path longer than an ID should not be found, got %v", err)
+	}
+	if len(storage.requested) != 0 {
+		t.Errorf("A path longer than an ID should not be requested, got %v", storage.requested)
+	}
+}
+
+func TestTargetPolicyNormalizeTemplate(t *testing.T) {
+	policy := TargetPolicy{}
+
+	cases := map[string]string{
+		"https://GitHub.com/{path}":                 "https://github.com/{path}",
+		" https://jira.tld/browse/{1}?q={query.q} ": "https://jira.tld/browse/{1}?q={query.q}",
+		"https://search.tld/?{query}":               "https://search.tld/?{query}",
+		"https://static.tld/without/placeholders":   "https://static.tld/without/placeholders",
+	}
+	for content, expected := range cases {
+		normalized, err := policy.normalizeTemplate(content)
+		if err != nil {
+			t.Errorf("%q should be valid, got %v", content, err)
+		}
+		if normalized != expected {
+			t.Errorf("%q should be normalized to %q, got %q", content, expected, normalized)
+		}
+	}
+
+	for _, content := range []string{"https://{path}", "https://{1}.example.tld/", "{query}", "https://x.tld/{unknown}", "javascript:{path}",
+		"mailto:{1}", "mailto:ops@corp.tld?cc={1}"} {
+		if _, err := policy.normalizeTemplate(content); !errors.Is(err, link_repository.ErrInvalidContent) {
+			t.Errorf("%q should be rejected, got %v", content, err)
+		}
+	}
+}
+
+func TestPassQuery(t *testing.T) {
+	cases := []struct {
+		passthrough        models.QueryPassthrough
+		target             string
+		rawQuery, fragment string
+		expected           string
+	}{
+		{models.QueryPassthroughNone, "https://x.tld/?a=1", "a=2&b=3", "top", "https://x.tld/?a=1"},
+		{models.QueryPassthroughOverride, "https://x.tld/?a=1#old", "a=2&b=3", "top", "https://x.tld/?a=2&b=3#top"},
+		{models.QueryPassthroughKeepExisting, "https://x.tld/?a=1#old", "a=2&b=3", "top", "https://x.tld/?a=1&b=3#old"},
+		{models.QueryPassthroughKeepExisting, "https://x.tld/path", "utm_source=x", "section", "https://x.tld/path?utm_source=x#section"},
+		{models.QueryPassthroughOverride, "https://x.tld/path?a=1", "", "", "https://x.tld/path?a=1"},
+		{models.QueryPassthroughOverride, "https://x.tld/", "q=a%26b", "", "https://x.tld/?q=a%26b"},
+		{models.QueryPassthroughKeepExisting, "https://x.tld/?z=1&a=%7e&flag", "y=3&b=4&flag=1&bare", "", "https://x.tld/?z=1&a=%7e&flag&y=3&b=4&bare"},
+		{models.QueryPassthroughOverride, "https://x.tld/?z=1&a=2&c=3", "a=9&%zz=1", "", "https://x.tld/?z=1&c=3&a=9"},
+	}
+	for _, c := range cases {
+		request := link_repository.ResolveRequest{RawQuery: c.rawQuery, Fragment: c.fragment}
+		target, err := passQuery(c.target, request, c.passthrough)
+		if err != nil {
+			t.Error(err)
+		}
+		if target != c.expected {
+			t.Errorf("Passing %q#%s to %q with %q should produce %q, got %q", c.rawQuery, c.fragment, c.target, c.passthrough, c.expected, target)
+		}
+	}
+}
+
+func TestTagUTM(t *testing.T) {
+	storage := newLinkStorage()
+	storage.users["owner"] = models.User{ID: "owner", UTM: models.UTMTags{Source: "linksh", Medium: "shortlink"}}
+	repository := &LinkRepository{Storage: storage}
+
+	cases := []struct {
+		link     models.Link
+		target   string
+		expected string
+	}{
+		{models.Link{}, "https://x.tld/", "https://x.tld/"},
+		{models.Link{UTM: models.UTMTags{Campaign: "spring"}}, "https://x.tld/?a=1", "https://x.tld/?a=1&utm_campaign=spring"},
+		{models.Link{OwnerID: "owner", UTM: models.UTMTags{Campaign: "spring"}}, "https://x.tld/#top", "https://x.tld/?utm_campaign=spring&utm_medium=shortlink&utm_source=linksh#top"},
+		{models.Link{OwnerID: "owner", UTM: models.UTMTags{Source: "newsletter"}}, "https://x.tld/", "https://x.tld/?utm_medium=shortlink&utm_source=newsletter"},
+		{models.Link{OwnerID: "owner"}, "https://x.tld/?utm_source=visitor", "https://x.tld/?utm_source=visitor&utm_medium=shortlink"},
+		{models.Link{OwnerID: "owner"}, "mailto:someone@x.tld", "mailto:someone@x.tld"},
+		{models.Link{OwnerID: "missing", UTM: models.UTMTags{Medium: "qr"}}, "http://x.tld", "http://x.tld?utm_medium=qr"},
+	}
+	for _, c := range cases {
+		target, err := repository.tagUTM(c.target, c.link)
+		if err != nil {
+			t.Error(err)
+		}
+		if target != c.expected {
+			t.Errorf("Tagging %q with %+v should produce %q, got %q", c.target, c.link.UTM, c.expected, target)
+		}
+	}
+	//The owner is not read when the link, or the target, already has every tag, a storage without methods would panic
+	repository.Storage = struct{ istorage.IStorage }{}
+	complete := models.UTMTags{Source: "a", Medium: "b", Campaign: "c"}
+	if _, err := repository.tagUTM("https://x.tld/", models.Link{OwnerID: "owner", UTM: complete}); err != nil {
+		t.Error(err)
+	}
+	if _, err := repository.tagUTM("https://x.tld/?utm_source=x&utm_medium=y", models.Link{OwnerID: "owner", UTM: models.UTMTags{Campaign: "c"}}); err != nil {
+		t.Error(err)
+	}
+	if _, err := repository.tagUTM("mailto:someone@x.tld", models.Link{OwnerID: "owner"}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRedirectModeStatusCode(t *testing.T) {
+	cases := map[models.RedirectMode]int{
+		models.RedirectTemporary:           302,
+		models.RedirectTemporaryKeepMethod: 307,
+		models.RedirectPermanent:           301,
+		models.RedirectPermanentKeepMethod: 308,
+		models.RedirectMetaRefresh:         200,
+		models.RedirectInterstitial:        200,
+	}
+	for mode, expected := range cases {
+		if err := validateRedirectMode(mode); err != nil {
+			t.Errorf("%q should be valid, got %v", mode, err)
+		}
+		if code := mode.StatusCode(); code != expected {
+			t.Errorf("%q should be served with a %v, got %v", mode, expected, code)
+		}
+	}
+	if err := validateRedirectMode("303"); err != link_repository.ErrInvalidRedirectMode {
+		t.Errorf("Expected ErrInvalidRedirectMode, got %v", err)
+	}
+}
+
+func TestRedirectModeRespond(t *testing.T) {
+	target := `https://x.tld/?a=1&b="><script>alert(1)</script>`
+	for _, mode := range []models.RedirectMode{models.RedirectMetaRefresh, models.RedirectInterstitial} {
+		recorder := httptest.NewRecorder()
+		if err := mode.Respond(recorder, httptest.NewRequest(http.MethodGet, "/docs", nil), target); err != nil {
+			t.Fatal(err)
+		}
+		body := recorder.Body.String()
+		if recorder.Code != http.StatusOK || !strings.HasPrefix(recorder.Header().Get("Content-Type"), "text/html") {
+			t.Errorf("The %q page should be served as HTML with a 200, got %v %q", mode, recorder.Code, recorder.Header().Get("Content-Type"))
+		}
+		if strings.Contains(body, "<script>") || !strings.Contains(body, "https://x.tld/?a=1&amp;b=") {
+			t.Errorf("The target should be escaped in the %q page, got %s", mode, body)
+		}
+	}
+
+	recorder := httptest.NewRecorder()
+	if err := models.RedirectPermanent.Respond(recorder, httptest.NewRequest(http.MethodGet, "/docs", nil), "https://x.tld/"); err != nil {
+		t.Fatal(err)
+	}
+	if recorder.Code != http.StatusMovedPermanently || recorder.Header().Get("Location") != "https://x.tld/" {
+		t.Errorf("Expected a 301 to the target, got %v %q", recorder.Code, recorder.Header().Get("Location"))
+	}
+}
+
+func TestResolveVariants(t *testing.T) {
+	variants := []models.LinkVariant{
+		{Name: "a", Content: "https://a.example.tld/", Weight: 3},
+		{Name: "b", Content: "https://b.example.tld/", Weight: 1},
+	}
+	storage := newLinkStorage(
+		models.Link{ID: "rr", Content: "https://example.tld/", Variants: variants, Rotation: models.RotationRoundRobin},
+		models.Link{ID: "weighted", Content: "https://example.tld/", Variants: variants},
+	)
+	repository := &LinkRepository{Storage: storage}
+
+	expected := []string{"a", "a", "a", "b", "a"}
+	for i, name := range expected {
+		resolution, err := repository.Resolve(link_repository.ResolveRequest{Path: "rr"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resolution.Variant != name || resolution.Target != "https://"+name+".example.tld/" {
+			t.Errorf("Visit %v should be sent to the variant %q, got %q to %q", i, name, resolution.Variant, resolution.Target)
+		}
+	}
+	link := storage.links["rr"]
+	if link.Hits != 5 || link.Variants[0].Hits != 4 || link.Variants[1].Hits != 1 {
+		t.Errorf("The hits should be attributed to the variants, got %+v", link)
+	}
+
+	for i := 0; i < 200; i++ {
+		if _, err := repository.Resolve(link_repository.ResolveRequest{Path: "weighted"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link = storage.links["weighted"]
+	if link.Variants[0].Hits+link.Variants[1].Hits != 200 || link.Variants[0].Hits < link.Variants[1].Hits {
+		t.Errorf("The visits should be split by weight, got %+v", link.Variants)
+	}
+}
+
+func TestValidateVariants(t *testing.T) {
+	repository := &LinkRepository{}
+
+	variants, err := repository.validateVariants([]models.LinkVariant{
+		{Name: "a", Content: "HTTPS://A.Example.TLD./", Weight: 2, Hits: 100},
+		{Name: "b", Content: "https://b.example.tld/", Weight: 1},
+	}, models.LinkTypeStatic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if variants[0].Content != "https://a.example.tld/" || variants[0].Hits != 0 || variants[1].Hits != 0 {
+		t.Errorf("The contents should be normalized and the provided hits dropped, got %+v", variants)
+	}
+
+	invalid := [][]models.LinkVariant{
+		{{Name: "", Content: "https://a.example.tld/", Weight: 1}},
+		{{Name: "a", Content: "https://a.example.tld/", Weight: 0}},
+		{{Name: "a", Content: "https://a.example.tld/", Weight: 1}, {Name: "a", Content: "https://b.example.tld/", Weight: 1}},
+	}
+	for _, variants := range invalid {
+		if _, err = repository.validateVariants(variants, models.LinkTypeStatic); err != link_repository.ErrInvalidVariants {
+			t.Errorf("%+v should produce an ErrInvalidVariants, got %v", variants, err)
+		}
+	}
+	_, err = repository.validateVariants([]models.LinkVariant{{Name: "a", Content: "ftp://a.example.tld/", Weight: 1}}, models.LinkTypeStatic)
+	if !errors.Is(err, link_repository.ErrInvalidContent) {
+		t.Errorf("Expected ErrInvalidContent, got %v", err)
+	}
+}
+
+func TestResolveRules(t *testing.T) {
+	storage := newLinkStorage(models.Link{
+		ID:       "app",
+		Content:  "https://app.example.tld/",
+		Variants: []models.LinkVariant{{Name: "web", Content: "https://web.example.tld/", Weight: 1}},
+		Rules: []models.LinkRule{
+			{Name: "preview", Platforms: []models.Platform{models.PlatformBot}, Content: "https://example.tld/preview"},
+			{Name: "stores", Platforms: []models.Platform{models.PlatformIOS, models.PlatformAndroid}, Content: "https://example.tld/install"},
+		},
+	})
+	repository := &LinkRepository{Storage: storage}
+
+	cases := []struct {
+		userAgent, rule, variant, target string
+	}{
+		{"Mozilla/5.0 (iPhone; CPU iPhone OS 13_3 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148", "stores", "", "https://example.tld/install"},
+		{"Mozilla/5.0 (Linux; Android 10; SM-G973F) AppleWebKit/537.36 Mobile Safari/537.36", "stores", "", "https://example.tld/install"},
+		{"facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)", "preview", "", "https://example.tld/preview"},
+		{"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 Chrome/80.0 Safari/537.36", "", "web", "https://web.example.tld/"},
+		{"", "", "web", "https://web.example.tld/"},
+	}
+	for _, c := range cases {
+		resolution, err := repository.Resolve(link_repository.ResolveRequest{Path: "app", UserAgent: c.userAgent})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resolution.Rule != c.rule || resolution.Variant != c.variant || resolution.Target != c.target {
+			t.Errorf("%q should match the rule %q and the variant %q to %q, got %q, %q and %q", c.userAgent, c.rule, c.variant, c.target, resolution.Rule, resolution.Variant, resolution.Target)
+		}
+	}
+	link := storage.links["app"]
+	if link.Hits != 5 || link.Rules[0].Hits != 1 || link.Rules[1].Hits != 2 || link.Variants[0].Hits != 2 {
+		t.Errorf("The hits should be attributed to the rules, got %+v", link)
+	}
+}
+
+func TestDetectPlatform(t *testing.T) {
+	cases := map[string]models.Platform{
+		"Mozilla/5.0 (iPad; CPU OS 12_2 like Mac OS X) AppleWebKit/605.1.15 Mobile/15E148":                    models.PlatformIOS,
+		"Mozilla/5.0 (Linux; Android 9; Pixel 3) AppleWebKit/537.36 Chrome/80.0 Mobile Safari/537.36":         models.PlatformAndroid,
+		"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_3) AppleWebKit/605.1.15 Version/13.0.5 Safari/605.1.15": models.PlatformDesktop,
+		"Mozilla/5.0 (X11; Linux x86_64; rv:74.0) Gecko/20100101 Firefox/74.0":                                models.PlatformDesktop,
+		"Twitterbot/1.0": models.PlatformBot,
+		"Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)": models.PlatformBot,
+		"WhatsApp/2.19.81 A":                      models.PlatformBot,
+		"Mozilla/5.0 (compatible; Googlebot/2.1)": "",
+		"curl/7.68.0":                             "",
+	}
+	for userAgent, expected := range cases {
+		if platform := detectPlatform(userAgent); platform != expected {
+			t.Errorf("%q should be detected as %q, got %q", userAgent, expected, platform)
+		}
+	}
+}
+
+func TestResolveSchedule(t *testing.T) {
+	now := time.Now().Unix()
+	storage := newLinkStorage(
+		models.Link{ID: "soon", Content: "https://example.tld/", ActivatesAt: now + 3600},
+		models.Link{ID: "soon-fallback", Content: "https://example.tld/", ActivatesAt: now + 3600, Fallback: "https://example.tld/countdown"},
+		models.Link{ID: "expired", Content: "https://example.tld/", ActivatesAt: now - 7200, DeactivatesAt: now - 3600},
+		models.Link{ID: "live", Content: "https://example.tld/", ActivatesAt: now - 3600, DeactivatesAt: now + 3600},
+	)
+	repository := &LinkRepository{Storage: storage}
+
+	for _, path := range []string{"soon", "expired"} {
+		_, err := repository.Resolve(link_repository.ResolveRequest{Path: path})
+		if !errors.As(err, &istorage.NotFoundError{}) {
+			t.Errorf("%q should not be resolved outside of its window, got %v", path, err)
+		}
+	}
+
+	resolution, err := repository.Resolve(link_repository.ResolveRequest{Path: "soon-fallback"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolution.Target != "https://example.tld/countdown" || resolution.Link.State != models.LinkScheduled {
+		t.Errorf("The fallback of the scheduled link should be served, got %+v", resolution)
+	}
+	if link := storage.links["soon-fallback"]; link.Hits != 0 || link.FallbackHits != 1 {
+		t.Errorf("The visits to the fallback should be counted apart from the hits, got %+v", link)
+	}
+
+	if _, err = repository.Resolve(link_repository.ResolveRequest{Path: "live"}); err != nil {
+		t.Errorf("The link inside its window should be resolved, got %v", err)
+	}
+
+	t.Run("content and hit count", func(t *testing.T) {
+		for _, id := range []string{"soon", "expired", "unknown"} {
+			if _, err := repository.GetContentAndIncreaseHitCount(id); !errors.As(err, &istorage.NotFoundError{}) {
+				t.Errorf("%q should not be served outside of its window, got %v", id, err)
+			}
+		}
+		if link := storage.links["expired"]; link.Hits != 0 {
+			t.Errorf("The visits outside of the window should not be counted as hits, got %+v", link)
+		}
+
+		content, err := repository.GetContentAndIncreaseHitCount("soon-fallback")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if content != "https://example.tld/countdown" {
+			t.Errorf("The fallback of the scheduled link should be returned, got %q", content)
+		}
+		if link := storage.links["soon-fallback"]; link.Hits != 0 || link.FallbackHits != 2 {
+			t.Errorf("The visits to the fallback should be counted apart from the hits, got %+v", link)
+		}
+
+		repository.Fallback = "https://example.tld/home"
+		if content, err = repository.GetContentAndIncreaseHitCount("expired"); err != nil || content != repository.Fallback {
+			t.Errorf("The expired link should return the fallback of the instance, got %q %v", content, err)
+		}
+		if content, err = repository.GetContentAndIncreaseHitCount("live"); err != nil || content != "https://example.tld/" {
+			t.Errorf("The link inside its window should return its content, got %q %v", content, err)
+		}
+	})
+}
+
+func TestValidateSchedule(t *testing.T) {
+	valid := [][2]int64{{0, 0}, {10, 0}, {0, 10}, {10, 20}}
+	for _, schedule := range valid {
+		if err := validateSchedule(schedule[0], schedule[1]); err != nil {
+			t.Errorf("%v should be valid, got %v", schedule, err)
+		}
+	}
+	invalid := [][2]int64{{20, 10}, {10, 10}, {-1, 0}}
+	for _, schedule := range invalid {
+		if err := validateSchedule(schedule[0], schedule[1]); err != link_repository.ErrInvalidSchedule {
+			t.Errorf("%v should produce an ErrInvalidSchedule, got %v", schedule, err)
+		}
+	}
+}
+
+func TestResolveFallback(t *testing.T) {
+	now := time.Now().Unix()
+	storage := newLinkStorage(
+		models.Link{ID: "expired", Content: "https://example.tld/", DeactivatesAt: now - 3600, OwnerID: "owner"},
+		models.Link{ID: "orphan", Content: "https://example.tld/", DeactivatesAt: now - 3600, OwnerID: "other"},
+	)
+	storage.users["owner"] = models.User{ID: "owner", Fallback: "https://owner.example.tld/"}
+	storage.users["other"] = models.User{ID: "other"}
+	repository := &LinkRepository{Storage: storage}
+
+	_, err := repository.Resolve(link_repository.ResolveRequest{Path: "unknown"})
+	if !errors.As(err, &istorage.NotFoundError{}) {
+		t.Errorf("Without fallbacks the unknown IDs should not be resolved, got %v", err)
+	}
+
+	repository.Fallback = "https://example.tld/404"
+	cases := []struct {
+		request  link_repository.ResolveRequest
+		target   string
+		fallback link_repository.FallbackKind
+	}{
+		{link_repository.ResolveRequest{Path: "unknown"}, "https://example.tld/404", link_repository.FallbackInstance},
+		{link_repository.ResolveRequest{Path: "unknown", OwnerID: "owner"}, "https://owner.example.tld/", link_repository.FallbackOwner},
+		{link_repository.ResolveRequest{Path: "unknown", OwnerID: "other"}, "https://example.tld/404", link_repository.FallbackInstance},
+		{link_repository.ResolveRequest{Path: "expired"}, "https://owner.example.tld/", link_repository.FallbackOwner},
+		{link_repository.ResolveRequest{Path: "orphan"}, "https://example.tld/404", link_repository.FallbackInstance},
+	}
+	for _, c := range cases {
+		resolution, err := repository.Resolve(c.request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resolution.Target != c.target || resolution.Fallback != c.fallback {
+			t.Errorf("%+v should be sent to the %q fallback %q, got %+v", c.request, c.fallback, c.target, resolution)
+		}
+	}
+
+	if hits, _ := repository.FallbackHits("owner"); hits != 2 {
+		t.Errorf("The fallback hits of the owner should be 2, got %v", hits)
+	}
+	if hits, _ := repository.FallbackHits(""); hits != 3 {
+		t.Errorf("The fallback hits of the instance should be 3, got %v", hits)
+	}
+}
@@ -0,0 +1,91 @@
+package repositories
+
+import (
+	"github.com/nethruster/linksh/pkg/interfaces/link_repository"
+	"github.com/nethruster/linksh/pkg/models"
+	"strings"
+)
+
+const maxRuleNameLength = 100
+
+//previewBots are lowercased fragments of the user agents of the bots fetching links to show their previews
+var previewBots = []string{
+	"facebookexternalhit", "facebot", "twitterbot", "linkedinbot", "slackbot", "slack-imgproxy",
+	"discordbot", "telegrambot", "whatsapp", "pinterest", "redditbot", "skypeuripreview",
+	"vkshare", "embedly", "mastodon", "applebot",
+}
+
+//validateRules validates the rules of a link of the specified type and returns them with their contents normalized
+//Their hits are dropped, the storage keeps the ones of the current rules with the same name
+func (lr *LinkRepository) validateRules(rules []models.LinkRule, linkType models.LinkType) ([]models.LinkRule, error) {
+	validated := make([]models.LinkRule, len(rules))
+	seen := make(map[string]bool, len(rules))
+	for i, rule := range rules {
+		if rule.Name == "" || len(rule.Name) > maxRuleNameLength || seen[rule.Name] || len(rule.Platforms) == 0 {
+			return nil, link_repository.ErrInvalidRules
+		}
+		seen[rule.Name] = true
+		for _, platform := range rule.Platforms {
+			if err := validatePlatform(platform); err != nil {
+				return nil, err
+			}
+		}
+
+		content, err := lr.validateContent(rule.Content, linkType)
+		if err != nil {
+			return nil, err
+		}
+		platforms := append([]models.Platform(nil), rule.Platforms...)
+		validated[i] = models.LinkRule{Name: rule.Name, Platforms: platforms, Content: content}
+	}
+	return validated, nil
+}
+
+//matchRule returns the first rule of the link matching the user agent, the second value is false if none does
+func matchRule(rules []models.LinkRule, userAgent string) (models.LinkRule, bool) {
+	if len(rules) == 0 {
+		return models.LinkRule{}, false
+	}
+
+	platform := detectPlatform(userAgent)
+	for _, rule := range rules {
+		for _, rulePlatform := range rule.Platforms {
+			if rulePlatform == platform {
+				return rule, true
+			}
+		}
+	}
+	return models.LinkRule{}, false
+}
+
+//detectPlatform returns the platform of a user agent, or an empty one if it is unknown
+func detectPlatform(userAgent string) models.Platform {
+	ua := strings.ToLower(userAgent)
+	if ua == "" {
+		return ""
+	}
+	for _, bot := range previewBots {
+		if strings.Contains(ua, bot) {
+			return models.PlatformBot
+		}
+	}
+	switch {
+	case strings.Contains(ua, "iphone"), strings.Contains(ua, "ipad"), strings.Contains(ua, "ipod"):
+		return models.PlatformIOS
+	case strings.Contains(ua, "android"):
+		return models.PlatformAndroid
+	case strings.Contains(ua, "mobile"), strings.Contains(ua, "bot"), strings.Contains(ua, "crawler"), strings.Contains(ua, "spider"):
+		return ""
+	case strings.Contains(ua, "windows"), strings.Contains(ua, "macintosh"), strings.Contains(ua, "x11"), strings.Contains(ua, "cros"):
+		return models.PlatformDesktop
+	}
+	return ""
+}
+
+func validatePlatform(platform models.Platform) error {
+	switch platform {
+	case models.PlatformIOS, models.PlatformAndroid, models.PlatformDesktop, models.PlatformBot:
+		return nil
+	}
+	return link_repository.ErrInvalidRules
+}
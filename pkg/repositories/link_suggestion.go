@@ -0,0 +1,251 @@
+package repositories
+
+import (
+	sto "github.com/nethruster/linksh/pkg/interfaces/storage"
+	"github.com/nethruster/linksh/pkg/models"
+	errors "golang.org/x/xerrors"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	//suggestionCandidates is the maximum number of links close to the unknown ID that are ranked
+	suggestionCandidates = 1000
+	//maxSuggestionKeyLength is the number of characters of an ID used in its suggestion keys
+	maxSuggestionKeyLength = 32
+	//suggestionIndexBatchSize is the number of links loaded from the storage at once by IndexSuggestions
+	suggestionIndexBatchSize = 100
+)
+
+//SuggestIDs returns up to limit existing link IDs or aliases close to the provided one, the closest first
+//An ID is close if it starts with the provided one or its edit distance to it is small, ignoring the case and the separators
+//Only the links without an owner and the ones of the owners that allow it with models.User.SuggestLinks are suggested
+//The links out of their activation window are never suggested, and a link is suggested once by its closest ID or alias
+func (lr *LinkRepository) SuggestIDs(id string, limit uint) ([]string, error) {
+	id = strings.Trim(id, "/")
+	keys := suggestionKeys(id)
+	if len(keys) == 0 || limit == 0 {
+		return nil, nil
+	}
+
+	//The first key is the whole ID squashed, so the IDs starting with it are found by prefix
+	candidates, err := lr.Storage.ListLinksBySuggestionKeys(keys, keys[0], suggestionCandidates)
+	if err != nil {
+		return nil, err
+	}
+
+	type suggestion struct {
+		id       string
+		distance int
+	}
+	squashedKey := strings.ToLower(squashID(id))
+	maxDistance := utf8.RuneCountInString(squashedKey) / 3
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+	closer := func(a, b suggestion) bool {
+		if a.distance != b.distance {
+			return a.distance < b.distance
+		}
+		if len(a.id) != len(b.id) {
+			return len(a.id) < len(b.id)
+		}
+		return a.id < b.id
+	}
+	now := time.Now().Unix()
+	owners := make(map[string]bool)
+	var suggestions []suggestion
+	for _, candidate := range candidates {
+		if candidate.StateAt(now) != models.LinkActive {
+			continue
+		}
+		var closest *suggestion
+		for _, name := range append([]string{candidate.ID}, candidate.Aliases...) {
+			if name == id || name == lr.IDs.key(id) {
+				continue
+			}
+			distance := 0
+			squashedName := strings.ToLower(squashID(name))
+			if !strings.HasPrefix(squashedName, squashedKey) {
+				distance = editDistance(squashedKey, squashedName)
+				if distance > maxDistance {
+					continue
+				}
+			}
+			if current := (suggestion{name, distance}); closest == nil || closer(current, *closest) {
+				closest = &current
+			}
+		}
+		if closest == nil {
+			continue
+		}
+		suggestable, err := lr.suggestable(candidate.OwnerID, owners)
+		if err != nil {
+			return nil, err
+		}
+		if suggestable {
+			suggestions = append(suggestions, *closest)
+		}
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return closer(suggestions[i], suggestions[j])
+	})
+	if uint(len(suggestions)) > limit {
+		suggestions = suggestions[:limit]
+	}
+	ids := make([]string, len(suggestions))
+	for i, suggestion := range suggestions {
+		ids[i] = suggestion.id
+	}
+	return ids, nil
+}
+
+//suggestable returns if the links of the owner can be suggested, remembering the answer of every owner in owners
+func (lr *LinkRepository) suggestable(ownerID string, owners map[string]bool) (bool, error) {
+	if ownerID == "" {
+		return true, nil
+	}
+	if suggestable, ok := owners[ownerID]; ok {
+		return suggestable, nil
+	}
+	owner, err := lr.Storage.GetUser(ownerID)
+	if err != nil && !errors.As(err, &sto.NotFoundError{}) {
+		return false, err
+	}
+	owners[ownerID] = owner.SuggestLinks
+	return owner.SuggestLinks, nil
+}
+
+//IndexSuggestions sets the suggestion keys of the links saved without them or with outdated ones,
+//like the ones created before the keys existed or before the aliases were indexed
+//It goes through all the links, so it is meant to be run once after upgrading
+func (lr *LinkRepository) IndexSuggestions() error {
+	for afterID := ""; ; {
+		links, err := lr.Storage.ListLinksAfter(afterID, suggestionIndexBatchSize)
+		if err != nil {
+			return err
+		}
+		for _, link := range links {
+			keys := linkSuggestionKeys(link)
+			if reflect.DeepEqual(link.SuggestionKeys, keys) {
+				continue
+			}
+			err = lr.Storage.UpdateLinkSuggestionKeys(link.ID, keys)
+			if err != nil && !errors.As(err, &sto.NotFoundError{}) {
+				return err
+			}
+		}
+		if len(links) < suggestionIndexBatchSize {
+			return nil
+		}
+		afterID = links[len(links)-1].ID
+	}
+}
+
+//indexAliases updates the suggestion keys of a link after its aliases changed
+func (lr *LinkRepository) indexAliases(id string) error {
+	link, err := lr.Storage.GetLink(id)
+	if err == nil {
+		err = lr.Storage.UpdateLinkSuggestionKeys(link.ID, linkSuggestionKeys(link))
+	}
+	if err != nil {
+		return errors.Errorf("the aliases were updated, but the suggestion keys of the link could not be updated:%w", err)
+	}
+	return nil
+}
+
+//setSuggestionKeys sets the suggestion keys of a link that is going to be saved
+func setSuggestionKeys(link *models.Link) {
+	link.SuggestionKeys = linkSuggestionKeys(*link)
+}
+
+//linkSuggestionKeys returns the suggestion keys of the ID and the aliases of a link, without repeating any
+func linkSuggestionKeys(link models.Link) []string {
+	var keys []string
+	seen := make(map[string]bool)
+	for _, name := range append([]string{link.ID}, link.Aliases...) {
+		for _, key := range suggestionKeys(name) {
+			if !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+	}
+	return keys
+}
+
+//suggestionKeys returns the keys under which an ID is found when suggesting the IDs close to an unknown one
+//They are the ID squashed and lowercased, and every form of it without one of its characters,
+//so two IDs share a key when they are one deletion, insertion, substitution or transposition apart, or two deletions
+//Only the first characters of the long IDs are used
+func suggestionKeys(id string) []string {
+	runes := []rune(strings.ToLower(squashID(id)))
+	if len(runes) == 0 {
+		return nil
+	}
+	if len(runes) > maxSuggestionKeyLength {
+		runes = runes[:maxSuggestionKeyLength]
+	}
+	keys := []string{string(runes)}
+	seen := map[string]bool{keys[0]: true}
+	for i := range runes {
+		key := string(runes[:i]) + string(runes[i+1:])
+		if key != "" && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+//squashID removes the separators of an ID, so "stand-up" and "standup" are the same
+func squashID(id string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '-', '_', '.', '~', '/':
+			return -1
+		}
+		return r
+	}, id)
+}
+
+//editDistance returns the optimal string alignment distance between two strings
+//It is the Levenshtein distance also counting the transposition of two adjacent characters as one edit, a usual typo
+func editDistance(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	rows := make([][]int, len(ar)+1)
+	for i := range rows {
+		rows[i] = make([]int, len(br)+1)
+		rows[i][0] = i
+	}
+	for j := range rows[0] {
+		rows[0][j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			rows[i][j] = min3(rows[i-1][j]+1, rows[i][j-1]+1, rows[i-1][j-1]+cost)
+			if i > 1 && j > 1 && ar[i-1] == br[j-2] && ar[i-2] == br[j-1] && rows[i-2][j-2]+1 < rows[i][j] {
+				rows[i][j] = rows[i-2][j-2] + 1
+			}
+		}
+	}
+	return rows[len(ar)][len(br)]
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
@@ -0,0 +1,115 @@
+package repositories
+
+import (
+	"errors"
+	"fmt"
+	"github.com/nethruster/linksh/pkg/interfaces/link_repository"
+	istorage "github.com/nethruster/linksh/pkg/interfaces/storage"
+	"github.com/nethruster/linksh/pkg/models"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSuggestIDs(t *testing.T) {
+	storage := newLinkStorage()
+	for _, id := range []string{"standup", "standup-notes", "stats", "status", "docs", "s"} {
+		storage.links[id] = models.Link{ID: id, Content: "https://example.tld/" + id}
+	}
+	//Many IDs before standup alphabetically must not hide it
+	for i := 0; i < 2*suggestionCandidates; i++ {
+		id := fmt.Sprintf("sa%d", i)
+		storage.links[id] = models.Link{ID: id, Content: "https://example.tld/" + id}
+	}
+	storage.users["public"] = models.User{ID: "public", SuggestLinks: true}
+	storage.users["private"] = models.User{ID: "private"}
+	storage.links["roadmap"] = models.Link{ID: "roadmap", Content: "https://example.tld/roadmap", OwnerID: "public"}
+	storage.links["payroll"] = models.Link{ID: "payroll", Content: "https://example.tld/payroll", OwnerID: "private"}
+	now := time.Now().Unix()
+	storage.links["launch"] = models.Link{ID: "launch", Content: "https://example.tld/launch", ActivatesAt: now + 3600}
+	storage.links["promo"] = models.Link{ID: "promo", Content: "https://example.tld/promo", DeactivatesAt: now - 3600}
+	storage.links["kickoff-2020"] = models.Link{ID: "kickoff-2020", Content: "https://example.tld/kickoff", Aliases: []string{"kickoff"}}
+	repository := &LinkRepository{Storage: storage}
+	//The links above were saved without suggestion keys, like the ones created before they existed
+	if err := repository.IndexSuggestions(); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := map[string][]string{
+		"stand-up": {"standup", "standup-notes"},
+		"Stand":    {"standup", "standup-notes"},
+		"statsu":   {"stats", "status"},
+		"dcos":     {"docs"},
+		"xtandup":  {"standup"},
+		"raodmap":  {"roadmap"},
+		"payrol":   {},
+		"lanuch":   {},
+		"prmo":     {},
+		"kikcoff":  {"kickoff"},
+		"kickof":   {"kickoff"},
+		"unknown":  {},
+		"":         {},
+	}
+	for id, expected := range cases {
+		suggestions, err := repository.SuggestIDs(id, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(suggestions) == 0 && len(expected) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(suggestions, expected) {
+			t.Errorf("%q should suggest %q, got %q", id, expected, suggestions)
+		}
+	}
+
+	link, err := repository.Create("retro", "https://example.tld/retro", "", models.LinkTypeStatic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if suggestions, err := repository.SuggestIDs("rerto", 3); err != nil || !reflect.DeepEqual(suggestions, []string{link.ID}) {
+		t.Errorf("The created links should be suggested, got %q %v", suggestions, err)
+	}
+
+	if err = repository.AddAlias("retro", "retrospective"); err != nil {
+		t.Fatal(err)
+	}
+	if suggestions, err := repository.SuggestIDs("retrospectiev", 3); err != nil || !reflect.DeepEqual(suggestions, []string{"retrospective"}) {
+		t.Errorf("The added aliases should be suggested, got %q %v", suggestions, err)
+	}
+	if err = repository.RemoveAlias("retro", "retrospective"); err != nil {
+		t.Fatal(err)
+	}
+	if suggestions, err := repository.SuggestIDs("retrospectiev", 3); err != nil || len(suggestions) != 0 {
+		t.Errorf("The removed aliases should not be suggested, got %q %v", suggestions, err)
+	}
+
+	repository.Suggestions = 1
+	_, err = repository.Resolve(link_repository.ResolveRequest{Path: "stand-up"})
+	var unknownIDError link_repository.UnknownIDError
+	if !errors.As(err, &unknownIDError) || !reflect.DeepEqual(unknownIDError.Suggestions, []string{"standup"}) {
+		t.Errorf("Expected an UnknownIDError suggesting standup, got %v", err)
+	}
+	if !errors.As(err, &istorage.NotFoundError{}) {
+		t.Errorf("The UnknownIDError should wrap the NotFoundError, got %v", err)
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	cases := []struct {
+		a, b     string
+		distance int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"kitten", "sitting", 3},
+		{"statsu", "status", 1},
+		{"dcos", "docs", 1},
+		{"ñandú", "nandu", 2},
+	}
+	for _, c := range cases {
+		if distance := editDistance(c.a, c.b); distance != c.distance {
+			t.Errorf("The distance between %q and %q should be %v, got %v", c.a, c.b, c.distance, distance)
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package repositories
+
+import (
+	"github.com/nethruster/linksh/pkg/interfaces/link_repository"
+	"golang.org/x/net/idna"
+	"net"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+const maxContentLength = 2000
+
+var defaultSchemes = []string{"http", "https", "mailto"}
+
+//TargetPolicy sets which contents are accepted as link targets
+//The zero value accepts http, https and mailto URLs pointing anywhere
+type TargetPolicy struct {
+	//ExtraSchemes are the URL schemes allowed besides http, https and mailto
+	ExtraSchemes []string
+	//OwnHosts are the hosts the shortener is served from, links pointing to them are rejected as they would create redirect loops
+	OwnHosts []string
+}
+
+//normalize validates the content of a link and returns it in its canonical form
+//The host is lowercased and converted to punycode, and the surrounding whitespace is removed
+//If the content is not acceptable an InvalidContentError would be returned
+func (tp TargetPolicy) normalize(content string) (string, error) {
+	invalid := func(reason string) (string, error) {
+		return "", link_repository.InvalidContentError{Content: content, Reason: reason}
+	}
+
+	trimmed := strings.TrimSpace(content)
+	if length := len(trimmed); length == 0 || length > maxContentLength {
+		return invalid("the length must be between 1 and 2000 characters")
+	}
+	if strings.IndexFunc(trimmed, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) != -1 {
+		return invalid("it contains whitespace or control characters")
+	}
+
+	target, err := url.Parse(trimmed)
+	if err != nil {
+		return invalid("it is not a valid URL")
+	}
+	if target.Scheme == "" {
+		return invalid("it is not an absolute URL")
+	}
+	target.Scheme = strings.ToLower(target.Scheme)
+	if !tp.allowsScheme(target.Scheme) {
+		return invalid("the scheme " + target.Scheme + " is not allowed")
+	}
+
+	switch target.Scheme {
+	case "mailto":
+		if target.Opaque == "" {
+			return invalid("it has no recipient")
+		}
+	case "http", "https":
+		if target.Host == "" {
+			return invalid("it has no host")
+		}
+		if target.User != nil {
+			return invalid("it contains credentials")
+		}
+	}
+
+	if target.Host != "" {
+		hostname, err := normalizeHostname(target.Hostname())
+		if err != nil {
+			return invalid("the host is not a valid domain")
+		}
+		if tp.isOwnHost(hostname) {
+			return invalid("it points to the shortener itself")
+		}
+		if port := target.Port(); port != "" {
+			target.Host = net.JoinHostPort(hostname, port)
+		} else if strings.Contains(hostname, ":") {
+			target.Host = "[" + hostname + "]"
+		} else {
+			target.Host = hostname
+		}
+	}
+
+	normalized := target.String()
+	if len(normalized) > maxContentLength {
+		return invalid("the length must be between 1 and 2000 characters")
+	}
+	return normalized, nil
+}
+
+func (tp TargetPolicy) allowsScheme(scheme string) bool {
+	for _, allowed := range defaultSchemes {
+		if scheme == allowed {
+			return true
+		}
+	}
+	for _, allowed := range tp.ExtraSchemes {
+		if strings.EqualFold(scheme, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+func (tp TargetPolicy) isOwnHost(hostname string) bool {
+	for _, own := range tp.OwnHosts {
+		if own, err := normalizeHostname(own); err == nil && own == hostname {
+			return true
+		}
+	}
+	return false
+}
+
+//normalizeHostname lowercases a hostname and converts it to punycode, IP addresses are returned as they are
+func normalizeHostname(hostname string) (string, error) {
+	hostname = strings.TrimSuffix(hostname, ".")
+	if ip := net.ParseIP(hostname); ip != nil {
+		return ip.String(), nil
+	}
+
+	return idna.Lookup.ToASCII(hostname)
+}
+
+//mailtoRecipientFields are the fields of the query of a mailto URL holding more recipients
+var mailtoRecipientFields = []string{"to", "cc", "bcc"}
+
+//targetDomains returns the domains a normalized content points to
+//For the mailto URLs they are the ones of every recipient, including the ones in the to, cc and bcc fields
+func targetDomains(content string) []string {
+	target, err := url.Parse(content)
+	if err != nil {
+		return nil
+	}
+	if target.Scheme != "mailto" {
+		if hostname := target.Hostname(); hostname != "" {
+			return []string{hostname}
+		}
+		return nil
+	}
+
+	recipients, err := url.PathUnescape(target.Opaque)
+	if err != nil {
+		recipients = target.Opaque
+	}
+	lists := []string{recipients}
+	query := target.Query()
+	for field, values := range query {
+		for _, recipientField := range mailtoRecipientFields {
+			if strings.EqualFold(field, recipientField) {
+				lists = append(lists, values...)
+			}
+		}
+	}
+
+	var domains []string
+	for _, list := range lists {
+		for _, address := range strings.Split(list, ",") {
+			i := strings.LastIndexByte(address, '@')
+			if i == -1 {
+				continue
+			}
+			domain := strings.TrimRight(strings.TrimSpace(address[i+1:]), ">")
+			//A domain that can't be normalized is checked as it is rather than skipped
+			if normalized, err := normalizeHostname(domain); err == nil {
+				domain = normalized
+			}
+			domains = append(domains, strings.ToLower(domain))
+		}
+	}
+	return domains
+}
@@ -0,0 +1,121 @@
+package repositories
+
+import (
+	"github.com/nethruster/linksh/pkg/interfaces/link_repository"
+	errors "golang.org/x/xerrors"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//placeholderRegex matches the placeholders of the content of the prefix links:
+//{path} is the rest of the requested path, {1}, {2}... are its segments,
+//{query} is the whole query of the request and {query.name} the value of one of its parameters
+var placeholderRegex = regexp.MustCompile(`\{(path|query|query\.[^{}]+|[1-9][0-9]*)\}`)
+
+//normalizeTemplate validates the content of a prefix link and returns it in its canonical form
+//The placeholders are not allowed in the scheme nor the host, so the domain of the link can't be chosen by the visitors
+//The contents without a host, like the mailto URLs, can't have placeholders at all, as their address would be chosen by the visitors
+//If the content is not acceptable an InvalidContentError would be returned
+func (tp TargetPolicy) normalizeTemplate(content string) (string, error) {
+	invalid := func(reason string) (string, error) {
+		return "", link_repository.InvalidContentError{Content: content, Reason: reason}
+	}
+
+	trimmed := strings.TrimSpace(content)
+	if strings.ContainsAny(placeholderRegex.ReplaceAllString(trimmed, ""), "{}") {
+		return invalid("it contains an unknown placeholder")
+	}
+
+	authorityEnd := 0
+	if i := strings.Index(trimmed, "://"); i != -1 {
+		authorityEnd = i + 3
+		if j := strings.IndexAny(trimmed[authorityEnd:], "/?#"); j != -1 {
+			authorityEnd += j
+		} else {
+			authorityEnd = len(trimmed)
+		}
+	}
+	if strings.Contains(trimmed[:authorityEnd], "{") {
+		return invalid("placeholders can't be used in the scheme or the host")
+	}
+	if authorityEnd == 0 && placeholderRegex.MatchString(trimmed) {
+		return invalid("placeholders can only be used in the URLs with a host")
+	}
+
+	sample, err := tp.normalize(placeholderRegex.ReplaceAllString(trimmed, "x"))
+	if err != nil {
+		var contentErr link_repository.InvalidContentError
+		if errors.As(err, &contentErr) {
+			return invalid(contentErr.Reason)
+		}
+		return "", err
+	}
+	if authorityEnd == 0 {
+		return trimmed, nil
+	}
+
+	//The host of the sample is already normalized and it has no placeholders
+	target, err := url.Parse(sample)
+	if err != nil {
+		return invalid("it is not a valid URL")
+	}
+	return target.Scheme + "://" + target.Host + trimmed[authorityEnd:], nil
+}
+
+//expandTemplate places the rest of the requested path and the query in the content of a prefix link
+//If the content has no placeholders the rest of the path is appended to the path of the content
+func expandTemplate(content, rest, rawQuery string) (string, error) {
+	if !placeholderRegex.MatchString(content) {
+		if rest == "" {
+			return content, nil
+		}
+		target, err := url.Parse(content)
+		if err != nil {
+			return "", err
+		}
+		target.Path = strings.TrimSuffix(target.Path, "/") + "/" + rest
+		target.RawPath = ""
+		return target.String(), nil
+	}
+
+	var segments []string
+	if rest != "" {
+		segments = strings.Split(rest, "/")
+	}
+	query, _ := url.ParseQuery(rawQuery)
+	queryStart := strings.IndexByte(content, '?')
+
+	var expanded strings.Builder
+	last := 0
+	for _, match := range placeholderRegex.FindAllStringSubmatchIndex(content, -1) {
+		expanded.WriteString(content[last:match[0]])
+		last = match[1]
+
+		escape := url.PathEscape
+		if queryStart != -1 && match[0] > queryStart {
+			escape = url.QueryEscape
+		}
+		name := content[match[2]:match[3]]
+		switch {
+		case name == "path":
+			escaped := make([]string, len(segments))
+			for i, segment := range segments {
+				escaped[i] = escape(segment)
+			}
+			expanded.WriteString(strings.Join(escaped, "/"))
+		case name == "query":
+			expanded.WriteString(rawQuery)
+		case strings.HasPrefix(name, "query."):
+			expanded.WriteString(escape(query.Get(strings.TrimPrefix(name, "query."))))
+		default:
+			if n, _ := strconv.Atoi(name); n <= len(segments) {
+				expanded.WriteString(escape(segments[n-1]))
+			}
+		}
+	}
+	expanded.WriteString(content[last:])
+
+	return expanded.String(), nil
+}
@@ -0,0 +1,298 @@
+package repositories
+
+import (
+	gonanoid "github.com/matoous/go-nanoid"
+	"github.com/nethruster/linksh/pkg/events"
+	"github.com/nethruster/linksh/pkg/interfaces/link_repository"
+	sto "github.com/nethruster/linksh/pkg/interfaces/storage"
+	"github.com/nethruster/linksh/pkg/interfaces/user_repository"
+	"github.com/nethruster/linksh/pkg/models"
+	errors "golang.org/x/xerrors"
+	"time"
+)
+
+//Transfer changes the owner of a link and records the transfer
+//If the link or the new owner does not exists in the storage an NotFoundError would be returned
+func (lr *LinkRepository) Transfer(id, newOwnerID string) (models.LinkTransfer, error) {
+	return lr.TransferMany([]string{id}, newOwnerID)
+}
+
+//TransferMany changes the owner of several links at once and records the transfer
+//If any of the links or the new owner does not exists in the storage an NotFoundError would be returned
+//If no links are provided or the new owner already owns all of them an ErrInvalidTransfer would be returned
+//If the new owner can't own that many more links an ErrQuotaExceeded would be returned
+func (lr *LinkRepository) TransferMany(ids []string, newOwnerID string) (transfer models.LinkTransfer, err error) {
+	transfer, err = lr.newTransfer("", ids, newOwnerID)
+	if err != nil {
+		return
+	}
+
+	err = lr.completeTransfer(&transfer)
+	return
+}
+
+//GetTransfer returns the link transfer with the specified ID from the storage
+//If the transfer does not exists in the storage an NotFoundError would be returned
+func (lr *LinkRepository) GetTransfer(id string) (models.LinkTransfer, error) {
+	return lr.Storage.GetLinkTransfer(id)
+}
+
+//ListTransfers lists the link transfers
+//If the limit is set to 0, no limit will be established, the same applies to the offset
+//if the userID is not empty the search would be limited to the ones where the specified user is the requester, a previous owner or the recipient
+func (lr *LinkRepository) ListTransfers(userID string, limit, offset uint) ([]models.LinkTransfer, error) {
+	return lr.Storage.ListLinkTransfers(userID, limit, offset)
+}
+
+//TransferByUser requests the transfer of a link to another user
+//If the requester is an admin the transfer is completed immediately, if the requester owns the link the transfer stays pending until the recipient accepts it
+//The requester must own the link or be an admin to perform this action
+func (lr *LinkRepository) TransferByUser(requesterID, id, newOwnerID string) (models.LinkTransfer, error) {
+	return lr.TransferManyByUser(requesterID, []string{id}, newOwnerID)
+}
+
+//TransferManyByUser requests the transfer of several links to another user
+//If the requester is an admin the transfer is completed immediately, if the requester owns all the links the transfer stays pending until the recipient accepts it
+//The requester must own all the links or be an admin to perform this action
+func (lr *LinkRepository) TransferManyByUser(requesterID string, ids []string, newOwnerID string) (transfer models.LinkTransfer, err error) {
+	transfer, err = lr.newTransfer(requesterID, ids, newOwnerID)
+	if err != nil {
+		return
+	}
+
+	lr = lr.as(requesterID)
+	err = checkIfRequesterIsAdmin(lr.Storage, requesterID)
+	if err == nil {
+		err = lr.completeTransfer(&transfer)
+		return
+	}
+	if err != user_repository.ErrForbidden {
+		return
+	}
+	for _, item := range transfer.Items {
+		if item.PreviousOwnerID != requesterID {
+			lr.Events.Publish(events.AccessDenied{Action: models.AuditUpdate, TargetType: models.AuditTargetLink, TargetID: item.LinkID, Actor: lr.actor})
+			err = user_repository.ErrForbidden
+			return
+		}
+	}
+
+	if err = lr.Storage.SaveLinkTransfer(transfer); err != nil {
+		return
+	}
+	lr.Events.Publish(events.LinkTransferCreated{Transfer: transfer, Actor: lr.actor})
+	return
+}
+
+//AcceptTransferByUser accepts a pending link transfer and changes the owner of its links
+//The links are given back to their previous owners if the transfer was resolved in the meantime, so only one of several concurrent accepts or rejects succeeds
+//If the transfer is not pending an ErrTransferNotPending would be returned
+//If the recipient can't own that many more links an ErrQuotaExceeded would be returned
+//The requester must be the recipient of the transfer or an admin to perform this action
+func (lr *LinkRepository) AcceptTransferByUser(requesterID, transferID string) error {
+	transfer, err := lr.GetTransfer(transferID)
+	if err != nil {
+		return err
+	}
+	if transfer.ToID != requesterID {
+		if err = lr.authorize(requesterID, models.AuditUpdate, models.AuditTargetTransfer, transfer.ID); err != nil {
+			return err
+		}
+	}
+	if transfer.Status != models.LinkTransferPending {
+		return link_repository.ErrTransferNotPending
+	}
+
+	//The links could have changed hands since the transfer was requested
+	ids := make([]string, len(transfer.Items))
+	for i, item := range transfer.Items {
+		link, err := lr.Get(item.LinkID)
+		if err != nil {
+			return err
+		}
+		if link.OwnerID != item.PreviousOwnerID {
+			return link_repository.ErrInvalidTransfer
+		}
+		ids[i] = item.LinkID
+	}
+	if _, err = lr.checkMaxLinks(transfer.ToID, uint(len(ids))); err != nil {
+		return err
+	}
+
+	lr = lr.as(requesterID)
+	if err = lr.moveLinks(transfer); err != nil {
+		return err
+	}
+	if err = lr.updateTransferStatus(transfer, models.LinkTransferCompleted); err != nil {
+		return lr.returnLinks(transfer, err)
+	}
+	return lr.ownerChanged(transfer)
+}
+
+//RejectTransferByUser rejects a pending link transfer, leaving its links untouched
+//If the transfer is not pending an ErrTransferNotPending would be returned
+//The requester must be the recipient or the requester of the transfer or an admin to perform this action
+func (lr *LinkRepository) RejectTransferByUser(requesterID, transferID string) error {
+	transfer, err := lr.GetTransfer(transferID)
+	if err != nil {
+		return err
+	}
+	if transfer.ToID != requesterID && transfer.RequesterID != requesterID {
+		if err = lr.authorize(requesterID, models.AuditUpdate, models.AuditTargetTransfer, transfer.ID); err != nil {
+			return err
+		}
+	}
+	if transfer.Status != models.LinkTransferPending {
+		return link_repository.ErrTransferNotPending
+	}
+
+	return lr.as(requesterID).updateTransferStatus(transfer, models.LinkTransferRejected)
+}
+
+//ListTransfersByUser lists the link transfers
+//If the limit is set to 0, no limit will be established, the same applies to the offset
+//if the userID is not empty the search would be limited to the ones where the specified user is the requester, a previous owner or the recipient
+//The requester must be the specified user or an admin to perform this action
+func (lr *LinkRepository) ListTransfersByUser(requesterID, userID string, limit, offset uint) ([]models.LinkTransfer, error) {
+	if requesterID != userID {
+		if err := lr.authorize(requesterID, models.AuditRead, models.AuditTargetTransfer, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return lr.ListTransfers(userID, limit, offset)
+}
+
+//newTransfer builds a pending transfer of the links not already owned by the new owner
+func (lr *LinkRepository) newTransfer(requesterID string, ids []string, newOwnerID string) (transfer models.LinkTransfer, err error) {
+	if _, err = lr.Storage.GetUser(newOwnerID); err != nil {
+		err = errors.Errorf("Error checking the new owner %w", err)
+		return
+	}
+
+	seen := make(map[string]bool, len(ids))
+	var items []models.LinkTransferItem
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		var link models.Link
+		link, err = lr.Get(id)
+		if err != nil {
+			return
+		}
+		if link.OwnerID != newOwnerID {
+			items = append(items, models.LinkTransferItem{LinkID: link.ID, PreviousOwnerID: link.OwnerID})
+		}
+	}
+	if len(items) == 0 {
+		err = link_repository.ErrInvalidTransfer
+		return
+	}
+
+	transferID, err := generateLinkTransferID()
+	if err != nil {
+		return
+	}
+	transfer = models.LinkTransfer{
+		ID:          transferID,
+		Items:       items,
+		ToID:        newOwnerID,
+		RequesterID: requesterID,
+		Status:      models.LinkTransferPending,
+		CreatedAt:   time.Now().Unix(),
+	}
+	return
+}
+
+//completeTransfer changes the owner of the links and saves the transfer as completed
+//The links are given back to their previous owners if the transfer can't be saved
+func (lr *LinkRepository) completeTransfer(transfer *models.LinkTransfer) error {
+	ids := make([]string, len(transfer.Items))
+	for i, item := range transfer.Items {
+		ids[i] = item.LinkID
+	}
+	if _, err := lr.checkMaxLinks(transfer.ToID, uint(len(ids))); err != nil {
+		return err
+	}
+	if err := lr.moveLinks(*transfer); err != nil {
+		return err
+	}
+
+	transfer.Status = models.LinkTransferCompleted
+	transfer.ResolvedAt = time.Now().Unix()
+	if err := lr.Storage.SaveLinkTransfer(*transfer); err != nil {
+		return lr.returnLinks(*transfer, err)
+	}
+	lr.Events.Publish(events.LinkTransferCreated{Transfer: *transfer, Actor: lr.actor})
+	return lr.ownerChanged(*transfer)
+}
+
+//moveLinks changes the owner of the links of a transfer, as long as they are still owned by their previous owners
+//If any of them changed hands in the meantime an ErrInvalidTransfer would be returned and none is moved
+func (lr *LinkRepository) moveLinks(transfer models.LinkTransfer) error {
+	err := lr.Storage.UpdateLinksOwner(transfer.Items, transfer.ToID)
+	if errors.As(err, &sto.ConflictError{}) {
+		return link_repository.ErrInvalidTransfer
+	}
+	return err
+}
+
+//returnLinks gives the links moved by moveLinks back to their previous owners when the transfer can't be resolved
+//The cause is returned, along with the error giving the links back if that failed too
+func (lr *LinkRepository) returnLinks(transfer models.LinkTransfer, cause error) error {
+	byOwner := make(map[string][]models.LinkTransferItem)
+	for _, item := range transfer.Items {
+		byOwner[item.PreviousOwnerID] = append(byOwner[item.PreviousOwnerID], models.LinkTransferItem{LinkID: item.LinkID, PreviousOwnerID: transfer.ToID})
+	}
+	for ownerID, items := range byOwner {
+		if err := lr.Storage.UpdateLinksOwner(items, ownerID); err != nil {
+			return errors.Errorf("%w, and the links could not be given back to their owners afterwards: %v", cause, err)
+		}
+	}
+	return cause
+}
+
+//updateTransferStatus resolves a pending transfer with the specified status
+//If the transfer was resolved in the meantime an ErrTransferNotPending would be returned
+func (lr *LinkRepository) updateTransferStatus(transfer models.LinkTransfer, status models.LinkTransferStatus) error {
+	resolvedAt := time.Now().Unix()
+	err := lr.Storage.UpdateLinkTransferStatus(transfer.ID, status, resolvedAt)
+	if errors.As(err, &sto.ConflictError{}) {
+		return link_repository.ErrTransferNotPending
+	}
+	if err != nil {
+		return err
+	}
+
+	transfer.Status, transfer.ResolvedAt = status, resolvedAt
+	lr.Events.Publish(events.LinkTransferResolved{Transfer: transfer, Actor: lr.actor})
+	return nil
+}
+
+//ownerChanged publishes the change of the owner of every link of a transfer, reading them again once their owner changed
+//The owners are already changed when reading a link fails, so the rest of them are still published and the first error says so
+func (lr *LinkRepository) ownerChanged(transfer models.LinkTransfer) (err error) {
+	if lr.Events == nil {
+		return nil
+	}
+	for _, item := range transfer.Items {
+		link, readErr := lr.Storage.GetLink(item.LinkID)
+		if readErr != nil {
+			if err == nil {
+				err = errors.Errorf("the owner of the link %s was changed, but it could not be read again to publish the update:%w", item.LinkID, readErr)
+			}
+			continue
+		}
+		previous := link
+		previous.OwnerID = item.PreviousOwnerID
+		lr.Events.Publish(events.LinkUpdated{Link: link, Previous: previous, Actor: lr.actor})
+	}
+	return
+}
+
+func generateLinkTransferID() (string, error) {
+	return gonanoid.Nanoid()
+}
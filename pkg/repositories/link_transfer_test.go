@@ -0,0 +1,244 @@
+package repositories
+
+import (
+	"errors"
+	"github.com/nethruster/linksh/pkg/interfaces/link_repository"
+	istorage "github.com/nethruster/linksh/pkg/interfaces/storage"
+	"github.com/nethruster/linksh/pkg/interfaces/user_repository"
+	"github.com/nethruster/linksh/pkg/models"
+	"testing"
+)
+
+func (ls *linkStorage) SaveLinkTransfer(transfer models.LinkTransfer) error {
+	if ls.transfers == nil {
+		ls.transfers = make(map[string]models.LinkTransfer)
+	}
+	ls.transfers[transfer.ID] = transfer
+	return nil
+}
+
+func (ls *linkStorage) GetLinkTransfer(id string) (models.LinkTransfer, error) {
+	transfer, ok := ls.transfers[id]
+	if !ok {
+		return transfer, istorage.NewNotFoundError("link transfers", "id", id)
+	}
+	return transfer, nil
+}
+
+func (ls *linkStorage) UpdateLinkTransferStatus(id string, status models.LinkTransferStatus, resolvedAt int64) error {
+	transfer, ok := ls.transfers[id]
+	if !ok {
+		return istorage.NewNotFoundError("link transfers", "id", id)
+	}
+	if transfer.Status != models.LinkTransferPending {
+		return istorage.NewConflictError("link transfer", id)
+	}
+	transfer.Status, transfer.ResolvedAt = status, resolvedAt
+	ls.transfers[id] = transfer
+	return nil
+}
+
+func (ls *linkStorage) UpdateLinksOwner(items []models.LinkTransferItem, ownerID string) error {
+	for _, item := range items {
+		if link, ok := ls.links[item.LinkID]; !ok || link.DeletedAt != 0 || link.OwnerID != item.PreviousOwnerID {
+			return istorage.NewConflictError("links", item.LinkID)
+		}
+	}
+	for _, item := range items {
+		link := ls.links[item.LinkID]
+		link.OwnerID = ownerID
+		ls.links[item.LinkID] = link
+	}
+	return nil
+}
+
+func newTransferStorage() *linkStorage {
+	storage := newLinkStorage(
+		models.Link{ID: "docs", OwnerID: "owner", Content: "https://docs.example.tld/"},
+		models.Link{ID: "blog", OwnerID: "owner", Content: "https://blog.example.tld/"},
+	)
+	for _, id := range []string{"owner", "recipient", "other"} {
+		storage.users[id] = models.User{ID: id}
+	}
+	storage.users["admin"] = models.User{ID: "admin", IsAdmin: true}
+	return storage
+}
+
+func TestTransferByUser(t *testing.T) {
+	storage := newTransferStorage()
+	repository := &LinkRepository{Storage: storage}
+
+	if _, err := repository.TransferByUser("other", "docs", "recipient"); !errors.Is(err, user_repository.ErrForbidden) {
+		t.Errorf("Only the owner or an admin should transfer a link, got %v", err)
+	}
+	if _, err := repository.TransferByUser("owner", "docs", "owner"); !errors.Is(err, link_repository.ErrInvalidTransfer) {
+		t.Errorf("A link should not be transferred to its owner, got %v", err)
+	}
+
+	transfer, err := repository.TransferByUser("owner", "docs", "recipient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transfer.Status != models.LinkTransferPending || storage.links["docs"].OwnerID != "owner" {
+		t.Errorf("The transfer of an owner should wait for the recipient, got %+v", transfer)
+	}
+
+	transfer, err = repository.TransferByUser("admin", "blog", "recipient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transfer.Status != models.LinkTransferCompleted || storage.links["blog"].OwnerID != "recipient" {
+		t.Errorf("The transfer of an admin should be completed immediately, got %+v", transfer)
+	}
+}
+
+func TestAcceptTransferByUser(t *testing.T) {
+	storage := newTransferStorage()
+	repository := &LinkRepository{Storage: storage}
+	transfer, err := repository.TransferManyByUser("owner", []string{"docs", "blog"}, "recipient")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, requesterID := range []string{"owner", "other"} {
+		if err = repository.AcceptTransferByUser(requesterID, transfer.ID); !errors.Is(err, user_repository.ErrForbidden) {
+			t.Errorf("%s should not accept the transfer, got %v", requesterID, err)
+		}
+	}
+	if err = repository.AcceptTransferByUser("recipient", transfer.ID); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"docs", "blog"} {
+		if owner := storage.links[id].OwnerID; owner != "recipient" {
+			t.Errorf("The owner of %s should be the recipient, got %s", id, owner)
+		}
+	}
+	if status := storage.transfers[transfer.ID].Status; status != models.LinkTransferCompleted {
+		t.Errorf("Expected the transfer to be completed, got %s", status)
+	}
+
+	if err = repository.AcceptTransferByUser("admin", transfer.ID); !errors.Is(err, link_repository.ErrTransferNotPending) {
+		t.Errorf("A completed transfer should not be accepted again, got %v", err)
+	}
+	if err = repository.RejectTransferByUser("recipient", transfer.ID); !errors.Is(err, link_repository.ErrTransferNotPending) {
+		t.Errorf("A completed transfer should not be rejected, got %v", err)
+	}
+}
+
+func TestRejectTransferByUser(t *testing.T) {
+	storage := newTransferStorage()
+	repository := &LinkRepository{Storage: storage}
+	transfer, err := repository.TransferByUser("owner", "docs", "recipient")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = repository.RejectTransferByUser("other", transfer.ID); !errors.Is(err, user_repository.ErrForbidden) {
+		t.Errorf("Only the participants or an admin should reject the transfer, got %v", err)
+	}
+	if err = repository.RejectTransferByUser("owner", transfer.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err = repository.AcceptTransferByUser("recipient", transfer.ID); !errors.Is(err, link_repository.ErrTransferNotPending) {
+		t.Errorf("A rejected transfer should not be accepted, got %v", err)
+	}
+	if owner := storage.links["docs"].OwnerID; owner != "owner" {
+		t.Errorf("A rejected transfer should not change the owner, got %s", owner)
+	}
+
+	//A transfer resolved between the check and the update of another request
+	transfer, err = repository.TransferByUser("owner", "docs", "recipient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = repository.as("owner").updateTransferStatus(transfer, models.LinkTransferRejected); err != nil {
+		t.Fatal(err)
+	}
+	if err = repository.as("admin").updateTransferStatus(transfer, models.LinkTransferCompleted); !errors.Is(err, link_repository.ErrTransferNotPending) {
+		t.Errorf("Only one resolution of a transfer should succeed, got %v", err)
+	}
+}
+
+func TestTransferQuota(t *testing.T) {
+	storage := newTransferStorage()
+	storage.links["kept"] = models.Link{ID: "kept", OwnerID: "recipient", Content: "https://kept.example.tld/"}
+	repository := &LinkRepository{Storage: storage, Quotas: QuotaPolicy{User: models.Quota{MaxLinks: 2}}}
+
+	var quotaExceeded link_repository.ErrQuotaExceeded
+	if _, err := repository.TransferManyByUser("admin", []string{"docs", "blog"}, "recipient"); !errors.As(err, &quotaExceeded) {
+		t.Errorf("An admin transfer should respect the quota of the recipient, got %v", err)
+	}
+	transfer, err := repository.TransferManyByUser("owner", []string{"docs", "blog"}, "recipient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = repository.AcceptTransferByUser("recipient", transfer.ID); !errors.As(err, &quotaExceeded) {
+		t.Errorf("Accepting a transfer should respect the quota of the recipient, got %v", err)
+	}
+	if status := storage.transfers[transfer.ID].Status; status != models.LinkTransferPending {
+		t.Errorf("A transfer exceeding the quota should stay pending, got %s", status)
+	}
+	if _, err = repository.TransferByUser("admin", "docs", "recipient"); err != nil {
+		t.Errorf("A transfer within the quota should be completed, got %v", err)
+	}
+}
+
+//failingTransferStorage fails the writes of the transfers
+type failingTransferStorage struct {
+	*linkStorage
+	failTransfers bool
+}
+
+func (fs *failingTransferStorage) SaveLinkTransfer(transfer models.LinkTransfer) error {
+	if fs.failTransfers {
+		return errWriteFailed
+	}
+	return fs.linkStorage.SaveLinkTransfer(transfer)
+}
+
+func (fs *failingTransferStorage) UpdateLinkTransferStatus(id string, status models.LinkTransferStatus, resolvedAt int64) error {
+	if fs.failTransfers {
+		return errWriteFailed
+	}
+	return fs.linkStorage.UpdateLinkTransferStatus(id, status, resolvedAt)
+}
+
+func TestTransferFailures(t *testing.T) {
+	storage := &failingTransferStorage{linkStorage: newTransferStorage()}
+	repository := &LinkRepository{Storage: storage}
+	transfer, err := repository.TransferByUser("owner", "docs", "recipient")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	storage.failTransfers = true
+	if _, err = repository.TransferByUser("admin", "blog", "recipient"); !errors.Is(err, errWriteFailed) {
+		t.Errorf("Expected the error saving the transfer, got %v", err)
+	}
+	if err = repository.AcceptTransferByUser("recipient", transfer.ID); !errors.Is(err, errWriteFailed) {
+		t.Errorf("Expected the error resolving the transfer, got %v", err)
+	}
+	for _, id := range []string{"docs", "blog"} {
+		if owner := storage.links[id].OwnerID; owner != "owner" {
+			t.Errorf("The links of a transfer that was not saved should be given back, %s is owned by %s", id, owner)
+		}
+	}
+
+	storage.failTransfers = false
+	if status := storage.transfers[transfer.ID].Status; status != models.LinkTransferPending {
+		t.Fatalf("The transfer should stay pending, got %s", status)
+	}
+	if err = repository.AcceptTransferByUser("recipient", transfer.ID); err != nil {
+		t.Errorf("The transfer should be accepted once the storage recovers, got %v", err)
+	}
+
+	storage.links["blog"] = models.Link{ID: "blog", OwnerID: "other"}
+	transfer, err = repository.TransferByUser("other", "blog", "recipient")
+	if err != nil {
+		t.Fatal(err)
+	}
+	storage.links["blog"] = models.Link{ID: "blog", OwnerID: "owner"}
+	if err = repository.AcceptTransferByUser("recipient", transfer.ID); !errors.Is(err, link_repository.ErrInvalidTransfer) {
+		t.Errorf("A link that changed hands should not be transferred, got %v", err)
+	}
+}
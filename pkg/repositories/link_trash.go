@@ -0,0 +1,65 @@
+package repositories
+
+import (
+	"github.com/nethruster/linksh/pkg/events"
+	"github.com/nethruster/linksh/pkg/models"
+)
+
+//Restore restores a deleted link that was not purged yet
+//If the link does not exists in the storage, or it is not deleted, an NotFoundError would be returned
+func (lr *LinkRepository) Restore(id string) error {
+	link, err := lr.getLink(id, lr.Storage.GetTrashedLink)
+	if err != nil {
+		return err
+	}
+
+	return lr.restore(link)
+}
+
+//ListTrash lists the deleted links that were not purged yet, the last deleted first
+//If the limit is set to 0, no limit will be established, the same applies to the offset
+//if the ownerID is not empty the search would be limited to the ones owned by the specified user
+func (lr *LinkRepository) ListTrash(ownerID string, limit, offset uint) ([]models.Link, error) {
+	return lr.Storage.ListTrashedLinks(ownerID, limit, offset)
+}
+
+//RestoreByUser restores a deleted link that was not purged yet
+//If the link does not exists in the storage, or it is not deleted, an NotFoundError would be returned
+//The requester must own the link or be an admin to perform this action
+func (lr *LinkRepository) RestoreByUser(requesterID, id string) error {
+	link, err := lr.getLink(id, lr.Storage.GetTrashedLink)
+	if err != nil {
+		return err
+	}
+	if link.OwnerID != requesterID {
+		if err = lr.authorize(requesterID, models.AuditRestore, models.AuditTargetLink, link.ID); err != nil {
+			return err
+		}
+	}
+
+	return lr.as(requesterID).restore(link)
+}
+
+func (lr *LinkRepository) restore(link models.Link) error {
+	if err := lr.Storage.RestoreLink(link.ID); err != nil {
+		return err
+	}
+
+	link.DeletedAt = 0
+	lr.Events.Publish(events.LinkCreated{Link: link, Restored: true, Actor: lr.actor})
+	return nil
+}
+
+//ListTrashByUser lists the deleted links that were not purged yet, the last deleted first
+//If the limit is set to 0, no limit will be established, the same applies to the offset
+//if the ownerID is not empty the search would be limited to the ones owned by the specified user
+//The requester must be the owner of the links or an admin to perform this action
+func (lr *LinkRepository) ListTrashByUser(requesterID, ownerID string, limit, offset uint) ([]models.Link, error) {
+	if requesterID != ownerID {
+		if err := lr.authorize(requesterID, models.AuditRead, models.AuditTargetLink, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return lr.ListTrash(ownerID, limit, offset)
+}
@@ -0,0 +1,56 @@
+package repositories
+
+import (
+	"errors"
+	"github.com/nethruster/linksh/pkg/interfaces/link_repository"
+	"github.com/nethruster/linksh/pkg/interfaces/user_repository"
+	istorage "github.com/nethruster/linksh/pkg/interfaces/storage"
+	"github.com/nethruster/linksh/pkg/models"
+	"testing"
+)
+
+func TestTrash(t *testing.T) {
+	storage := newLinkStorage(models.Link{ID: "docs", OwnerID: "owner", Content: "https://docs.example.tld/", Aliases: []string{"d"}})
+	storage.users["admin"] = models.User{ID: "admin", IsAdmin: true}
+	storage.users["other"] = models.User{ID: "other"}
+	repository := &LinkRepository{Storage: storage}
+
+	if err := repository.Delete("d"); !errors.Is(err, link_repository.ErrAliasID) {
+		t.Errorf("A link should not be deleted through an alias, got %v", err)
+	}
+	if _, err := repository.Get("docs"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repository.Delete("docs"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := repository.Get("docs"); !errors.As(err, &istorage.NotFoundError{}) {
+		t.Errorf("A deleted link should not be found, got %v", err)
+	}
+	if _, err := repository.Resolve(link_repository.ResolveRequest{Path: "docs"}); !errors.As(err, &istorage.NotFoundError{}) {
+		t.Errorf("A deleted link should not be resolved, got %v", err)
+	}
+	if err := repository.Delete("docs"); !errors.As(err, &istorage.NotFoundError{}) {
+		t.Errorf("A deleted link should not be deleted again, got %v", err)
+	}
+	for _, id := range []string{"docs", "d"} {
+		err := storage.SaveLink(models.Link{ID: id, Content: "https://evil.example.tld/"})
+		var alreadyExistsError *istorage.AlreadyExistsError
+		if !errors.As(err, &alreadyExistsError) {
+			t.Errorf("%q should stay reserved until the link is purged, got %v", id, err)
+		}
+	}
+
+	if err := repository.RestoreByUser("other", "docs"); !errors.Is(err, user_repository.ErrForbidden) {
+		t.Errorf("Only the owner or an admin should restore a link, got %v", err)
+	}
+	if err := repository.RestoreByUser("admin", "d"); err != nil {
+		t.Fatal(err)
+	}
+	if link, err := repository.Get("docs"); err != nil || link.Content != "https://docs.example.tld/" {
+		t.Errorf("The restored link should be found unchanged, got %+v %v", link, err)
+	}
+	if err := repository.Restore("docs"); !errors.As(err, &istorage.NotFoundError{}) {
+		t.Errorf("A link that is not deleted should not be restored, got %v", err)
+	}
+}
@@ -0,0 +1,74 @@
+package repositories
+
+import (
+	"github.com/nethruster/linksh/pkg/interfaces/link_repository"
+	sto "github.com/nethruster/linksh/pkg/interfaces/storage"
+	"github.com/nethruster/linksh/pkg/models"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const maxVariantNameLength = 100
+
+var (
+	variantRandMutex sync.Mutex
+	variantRand      = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+//validateVariants validates the variants of a link of the specified type and returns them with their contents normalized
+//Their hits are dropped, the storage keeps the ones of the current variants with the same name
+func (lr *LinkRepository) validateVariants(variants []models.LinkVariant, linkType models.LinkType) ([]models.LinkVariant, error) {
+	validated := make([]models.LinkVariant, len(variants))
+	seen := make(map[string]bool, len(variants))
+	for i, variant := range variants {
+		if variant.Name == "" || len(variant.Name) > maxVariantNameLength || seen[variant.Name] || variant.Weight == 0 {
+			return nil, link_repository.ErrInvalidVariants
+		}
+		seen[variant.Name] = true
+
+		content, err := lr.validateContent(variant.Content, linkType)
+		if err != nil {
+			return nil, err
+		}
+		validated[i] = models.LinkVariant{Name: variant.Name, Content: content, Weight: variant.Weight}
+	}
+	return validated, nil
+}
+
+//chooseVariant picks the variant of the link for a visit as set by its rotation
+func (lr *LinkRepository) chooseVariant(link models.Link) (models.LinkVariant, error) {
+	var total uint64
+	for _, variant := range link.Variants {
+		total += uint64(variant.Weight)
+	}
+
+	var position uint64
+	if link.Rotation == models.RotationRoundRobin {
+		visit, err := lr.Storage.IncreaseCounter(sto.LinkRotationCounterName(link.ID))
+		if err != nil {
+			return models.LinkVariant{}, err
+		}
+		position = (visit - 1) % total
+	} else {
+		variantRandMutex.Lock()
+		position = uint64(variantRand.Int63n(int64(total)))
+		variantRandMutex.Unlock()
+	}
+
+	for _, variant := range link.Variants {
+		if position < uint64(variant.Weight) {
+			return variant, nil
+		}
+		position -= uint64(variant.Weight)
+	}
+	return link.Variants[len(link.Variants)-1], nil
+}
+
+func validateRotation(rotation models.Rotation) error {
+	switch rotation {
+	case models.RotationWeighted, models.RotationRoundRobin:
+		return nil
+	}
+	return link_repository.ErrInvalidRotation
+}
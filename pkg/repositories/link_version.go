@@ -0,0 +1,128 @@
+package repositories
+
+import (
+	gonanoid "github.com/matoous/go-nanoid"
+	"github.com/nethruster/linksh/pkg/events"
+	sto "github.com/nethruster/linksh/pkg/interfaces/storage"
+	"github.com/nethruster/linksh/pkg/models"
+	"time"
+)
+
+//ListVersions lists the changes of the content of a link, the newest first
+//If the limit is set to 0, no limit will be established, the same applies to the offset
+//If the link does not exists in the storage an NotFoundError would be returned
+func (lr *LinkRepository) ListVersions(id string, limit, offset uint) ([]models.LinkVersion, error) {
+	link, err := lr.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return lr.Storage.ListLinkVersions(link.ID, limit, offset)
+}
+
+//RestoreVersion sets the content of a link back to the one set by the specified version, recording it as a new version
+//The content is validated again, so it can produce an ErrInvalidContent or an ErrDomainRejected
+//If the link or the version does not exists in the storage, or the version belongs to another link, an NotFoundError would be returned
+func (lr *LinkRepository) RestoreVersion(id, versionID string) error {
+	return lr.restoreVersion("", id, versionID)
+}
+
+//ListVersionsByUser lists the changes of the content of a link, the newest first
+//If the limit is set to 0, no limit will be established, the same applies to the offset
+//If the link does not exists in the storage an NotFoundError would be returned
+//The requester must own the link or be an admin to perform this action
+func (lr *LinkRepository) ListVersionsByUser(requesterID, id string, limit, offset uint) ([]models.LinkVersion, error) {
+	link, err := lr.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	if link.OwnerID != requesterID {
+		if err = lr.authorize(requesterID, models.AuditRead, models.AuditTargetLink, link.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	return lr.Storage.ListLinkVersions(link.ID, limit, offset)
+}
+
+//RestoreVersionByUser sets the content of a link back to the one set by the specified version, recording it as a new version
+//The content is validated again, so it can produce an ErrInvalidContent or an ErrDomainRejected
+//If the link or the version does not exists in the storage, or the version belongs to another link, an NotFoundError would be returned
+//The requester must own the link or be an admin to perform this action
+func (lr *LinkRepository) RestoreVersionByUser(requesterID, id, versionID string) error {
+	link, err := lr.Get(id)
+	if err != nil {
+		return err
+	}
+	if link.OwnerID != requesterID {
+		if err = lr.authorize(requesterID, models.AuditUpdate, models.AuditTargetLink, link.ID); err != nil {
+			return err
+		}
+	}
+
+	return lr.as(requesterID).restoreVersion(requesterID, link.ID, versionID)
+}
+
+func (lr *LinkRepository) restoreVersion(editorID, id, versionID string) error {
+	link, err := lr.Get(id)
+	if err != nil {
+		return err
+	}
+	version, err := lr.Storage.GetLinkVersion(versionID)
+	if err != nil {
+		return err
+	}
+	if version.LinkID != link.ID {
+		return sto.NewNotFoundError("link version", "ID", versionID)
+	}
+
+	return lr.updateContent(editorID, link, version.Content)
+}
+
+//updateContent validates and replaces the content of a link, recording the change as a new version
+func (lr *LinkRepository) updateContent(editorID string, link models.Link, content string) error {
+	content, err := lr.validateContent(content, link.Type)
+	if err != nil {
+		return err
+	}
+	if content == link.Content {
+		return nil
+	}
+	//The version is recorded first, so no change of the content can be saved without it
+	versionID, err := lr.recordVersion(editorID, link.ID, link.Content, content)
+	if err != nil {
+		return err
+	}
+	if err = lr.Storage.UpdateLinkContent(link.ID, content); err != nil {
+		//A version left behind would only list a change that was not made, so failing to remove it is not reported
+		lr.Storage.DeleteLinkVersion(versionID)
+		return err
+	}
+
+	previousContent := link.Content
+	link.Content = content
+	lr.Events.Publish(events.LinkContentUpdated{Link: link, PreviousContent: previousContent, Actor: lr.actor})
+	return nil
+}
+
+//recordVersion saves a change of the content of a link as its next version and returns its ID
+func (lr *LinkRepository) recordVersion(editorID, linkID, previousContent, content string) (string, error) {
+	number, err := lr.Storage.IncreaseCounter(sto.LinkVersionsCounterName(linkID))
+	if err != nil {
+		return "", err
+	}
+	versionID, err := gonanoid.Nanoid()
+	if err != nil {
+		return "", err
+	}
+
+	return versionID, lr.Storage.SaveLinkVersion(models.LinkVersion{
+		ID:              versionID,
+		LinkID:          linkID,
+		Number:          number,
+		Content:         content,
+		PreviousContent: previousContent,
+		EditorID:        editorID,
+		CreatedAt:       time.Now().Unix(),
+	})
+}
@@ -0,0 +1,163 @@
+package repositories
+
+import (
+	"errors"
+	"github.com/nethruster/linksh/pkg/events"
+	istorage "github.com/nethruster/linksh/pkg/interfaces/storage"
+	"github.com/nethruster/linksh/pkg/models"
+	"testing"
+)
+
+func TestVersions(t *testing.T) {
+	storage := newLinkStorage(models.Link{ID: "other", Content: "https://other.example.tld/"})
+	storage.users["owner"] = models.User{ID: "owner"}
+	storage.users["admin"] = models.User{ID: "admin", IsAdmin: true}
+	repository := &LinkRepository{Storage: storage}
+
+	if _, err := repository.Create("standup", "https://meet.example.tld/a", "owner", models.LinkTypeStatic); err != nil {
+		t.Fatal(err)
+	}
+	if err := repository.UpdateContentByUser("admin", "standup", "https://meet.example.tld/wrong"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repository.UpdateContent("standup", "https://meet.example.tld/wrong"); err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := repository.ListVersions("standup", 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != 2 {
+		t.Fatalf("Expected a version for the creation and one for the change, got %+v", versions)
+	}
+	latest, first := versions[0], versions[1]
+	if latest.Number != 2 || latest.EditorID != "admin" || latest.PreviousContent != "https://meet.example.tld/a" || latest.Content != "https://meet.example.tld/wrong" {
+		t.Errorf("The change should be recorded with its editor and previous content, got %+v", latest)
+	}
+	if first.Number != 1 || first.EditorID != "owner" || first.PreviousContent != "" {
+		t.Errorf("The creation should be recorded as the first version, got %+v", first)
+	}
+
+	if err = repository.RestoreVersionByUser("owner", "standup", first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if content := storage.links["standup"].Content; content != "https://meet.example.tld/a" {
+		t.Errorf("The content should be restored, got %q", content)
+	}
+	versions, _ = repository.ListVersions("standup", 0, 0)
+	if len(versions) != 3 || versions[0].EditorID != "owner" || versions[0].Number != 3 {
+		t.Errorf("The restoration should be recorded as a new version, got %+v", versions)
+	}
+
+	if err = repository.RestoreVersion("other", first.ID); !errors.As(err, &istorage.NotFoundError{}) {
+		t.Errorf("The versions of other links should not be restored, got %v", err)
+	}
+}
+
+//failingStorage fails the writes of the versions, the contents of the links or the audit records
+type failingStorage struct {
+	*linkStorage
+	failVersions bool
+	failContents bool
+	failAudit    bool
+}
+
+var errWriteFailed = errors.New("write failed")
+
+func (fs *failingStorage) SaveLinkVersion(version models.LinkVersion) error {
+	if fs.failVersions {
+		return errWriteFailed
+	}
+	return fs.linkStorage.SaveLinkVersion(version)
+}
+
+func (fs *failingStorage) SaveAuditRecord(record models.AuditRecord) error {
+	if fs.failAudit {
+		return errWriteFailed
+	}
+	return fs.linkStorage.SaveAuditRecord(record)
+}
+
+func (fs *failingStorage) UpdateLinkContent(id, content string) error {
+	if fs.failContents {
+		return errWriteFailed
+	}
+	return fs.linkStorage.UpdateLinkContent(id, content)
+}
+
+func TestVersionsFailures(t *testing.T) {
+	storage := &failingStorage{linkStorage: newLinkStorage()}
+	repository := &LinkRepository{Storage: storage}
+
+	storage.failVersions = true
+	if _, err := repository.Create("standup", "https://meet.example.tld/a", "", models.LinkTypeStatic); !errors.Is(err, errWriteFailed) {
+		t.Errorf("Expected the error saving the version, got %v", err)
+	}
+	if _, ok := storage.links["standup"]; ok {
+		t.Error("A link whose first version was not recorded should not be kept")
+	}
+	storage.failVersions = false
+	if _, err := repository.Create("standup", "https://meet.example.tld/a", "", models.LinkTypeStatic); err != nil {
+		t.Fatal(err)
+	}
+
+	storage.failVersions = true
+	if err := repository.UpdateContent("standup", "https://meet.example.tld/b"); !errors.Is(err, errWriteFailed) {
+		t.Errorf("Expected the error saving the version, got %v", err)
+	}
+	if content := storage.links["standup"].Content; content != "https://meet.example.tld/a" {
+		t.Errorf("A change that was not recorded should not be saved, got %q", content)
+	}
+	storage.failVersions, storage.failContents = false, true
+	if err := repository.UpdateContent("standup", "https://meet.example.tld/b"); !errors.Is(err, errWriteFailed) {
+		t.Errorf("Expected the error saving the content, got %v", err)
+	}
+	if versions, _ := repository.ListVersions("standup", 0, 0); len(versions) != 1 {
+		t.Errorf("The version of a change that was not saved should be removed, got %+v", versions)
+	}
+}
+
+func TestLinkEvents(t *testing.T) {
+	storage := newLinkStorage()
+	storage.users["owner"] = models.User{ID: "owner"}
+	bus := events.New()
+	var published []events.Event
+	bus.Subscribe(func(event events.Event) { published = append(published, event) })
+	repository := &LinkRepository{Storage: storage, Events: bus}
+
+	if _, err := repository.Create("standup", "https://meet.example.tld/a", "owner", models.LinkTypeStatic); err != nil {
+		t.Fatal(err)
+	}
+	if err := repository.UpdateContent("standup", "https://meet.example.tld/b"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repository.AddAlias("standup", "daily"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repository.IncreaseHitCount("standup"); err != nil {
+		t.Fatal(err)
+	}
+	if err := repository.Delete("standup"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(published) != 5 {
+		t.Fatalf("Expected 5 events, got %+v", published)
+	}
+	if event, ok := published[0].(events.LinkCreated); !ok || event.Link.ID != "standup" {
+		t.Errorf("Expected the creation of the link, got %+v", published[0])
+	}
+	if event, ok := published[1].(events.LinkContentUpdated); !ok || event.Link.Content != "https://meet.example.tld/b" || event.PreviousContent != "https://meet.example.tld/a" {
+		t.Errorf("Expected the update of the content, got %+v", published[1])
+	}
+	if event, ok := published[2].(events.LinkUpdated); !ok || len(event.Previous.Aliases) != 0 || len(event.Link.Aliases) != 1 {
+		t.Errorf("Expected the update of the aliases, got %+v", published[2])
+	}
+	if event, ok := published[3].(events.LinkHit); !ok || event.Link.Hits != 0 {
+		t.Errorf("Expected the hit of the link as read before counting it, got %+v", published[3])
+	}
+	if _, ok := published[4].(events.LinkDeleted); !ok {
+		t.Errorf("Expected the deletion of the link, got %+v", published[4])
+	}
+}
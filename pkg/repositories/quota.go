@@ -0,0 +1,164 @@
+package repositories
+
+import (
+	"github.com/nethruster/linksh/pkg/events"
+	"github.com/nethruster/linksh/pkg/interfaces/link_repository"
+	sto "github.com/nethruster/linksh/pkg/interfaces/storage"
+	"github.com/nethruster/linksh/pkg/models"
+	errors "golang.org/x/xerrors"
+	"time"
+)
+
+const quotaDayLength = 24 * time.Hour
+
+//QuotaPolicy sets the quota applied to each role when the user has no quota of its own
+//The zero value imposes no limits
+//The quotas are best-effort: the links are counted before saving a new one, so concurrent creations can exceed them by the number of requests in flight
+type QuotaPolicy struct {
+	User  models.Quota
+	Admin models.Quota
+}
+
+//GetUsage returns the quota in effect for an user and how much of it is in use
+//If the user does not exists in the storage an NotFoundError would be returned
+func (lr *LinkRepository) GetUsage(userID string) (usage models.QuotaUsage, err error) {
+	usage.UserID = userID
+	usage.Quota, usage.Overridden, err = lr.quotaOf(userID)
+	if err != nil {
+		return
+	}
+	if usage.Links, err = lr.Storage.CountLinks(userID, 0); err != nil {
+		return
+	}
+	usage.LinksLastDay, err = lr.Storage.CountLinks(userID, time.Now().Add(-quotaDayLength).Unix())
+	return
+}
+
+//SetQuota sets a quota for an user, overriding the one of its role
+//If the user does not exists in the storage an NotFoundError would be returned
+func (lr *LinkRepository) SetQuota(userID string, quota models.Quota) error {
+	if _, err := lr.Storage.GetUser(userID); err != nil {
+		return err
+	}
+	before, err := lr.Storage.GetUserQuota(userID)
+	if err != nil && !errors.As(err, &sto.NotFoundError{}) {
+		return err
+	}
+
+	after := models.UserQuota{UserID: userID, Quota: quota}
+	if err = lr.Storage.SaveUserQuota(after); err != nil {
+		return err
+	}
+	lr.Events.Publish(events.QuotaUpdated{Quota: after, Previous: before, Actor: lr.actor})
+	return nil
+}
+
+//ResetQuota removes the quota set for an user, so the one of its role applies again
+//If the user has no quota set an NotFoundError would be returned
+func (lr *LinkRepository) ResetQuota(userID string) error {
+	before, err := lr.Storage.GetUserQuota(userID)
+	if err != nil {
+		return err
+	}
+	if err = lr.Storage.DeleteUserQuota(userID); err != nil {
+		return err
+	}
+
+	lr.Events.Publish(events.QuotaReset{Quota: before, Actor: lr.actor})
+	return nil
+}
+
+//GetUsageByUser returns the quota in effect for an user and how much of it is in use
+//If the user does not exists in the storage an NotFoundError would be returned
+//The requester must only request information about himself or be an admin to perform this action
+func (lr *LinkRepository) GetUsageByUser(requesterID, userID string) (models.QuotaUsage, error) {
+	if requesterID != userID {
+		if err := lr.authorize(requesterID, models.AuditRead, models.AuditTargetQuota, userID); err != nil {
+			return models.QuotaUsage{}, err
+		}
+	}
+
+	return lr.GetUsage(userID)
+}
+
+//SetQuotaByUser sets a quota for an user, overriding the one of its role
+//If the user does not exists in the storage an NotFoundError would be returned
+//The requester must be an admin to perform this action
+func (lr *LinkRepository) SetQuotaByUser(requesterID, userID string, quota models.Quota) error {
+	if err := lr.authorize(requesterID, models.AuditUpdate, models.AuditTargetQuota, userID); err != nil {
+		return err
+	}
+
+	return lr.as(requesterID).SetQuota(userID, quota)
+}
+
+//ResetQuotaByUser removes the quota set for an user, so the one of its role applies again
+//If the user has no quota set an NotFoundError would be returned
+//The requester must be an admin to perform this action
+func (lr *LinkRepository) ResetQuotaByUser(requesterID, userID string) error {
+	if err := lr.authorize(requesterID, models.AuditDelete, models.AuditTargetQuota, userID); err != nil {
+		return err
+	}
+
+	return lr.as(requesterID).ResetQuota(userID)
+}
+
+//quotaOf returns the quota in effect for an user and if it was set specifically for the user
+func (lr *LinkRepository) quotaOf(userID string) (models.Quota, bool, error) {
+	userQuota, err := lr.Storage.GetUserQuota(userID)
+	if err == nil {
+		return userQuota.Quota, true, nil
+	}
+	if !errors.As(err, &sto.NotFoundError{}) {
+		return models.Quota{}, false, err
+	}
+
+	user, err := lr.Storage.GetUser(userID)
+	if err != nil {
+		return models.Quota{}, false, err
+	}
+	if user.IsAdmin {
+		return lr.Quotas.Admin, false, nil
+	}
+	return lr.Quotas.User, false, nil
+}
+
+//checkQuota returns an ErrQuotaExceeded if the user can't create more links
+func (lr *LinkRepository) checkQuota(userID string) error {
+	quota, err := lr.checkMaxLinks(userID, 1)
+	if err != nil {
+		return err
+	}
+	if quota.MaxLinksPerDay != 0 {
+		count, err := lr.Storage.CountLinks(userID, time.Now().Add(-quotaDayLength).Unix())
+		if err != nil {
+			return err
+		}
+		if count >= quota.MaxLinksPerDay {
+			return link_repository.ErrQuotaExceeded{UserID: userID, Limit: "links per day", Max: quota.MaxLinksPerDay}
+		}
+	}
+
+	return nil
+}
+
+//checkMaxLinks returns an ErrQuotaExceeded if the user can't own the specified number of links more
+//The links received in a transfer only count against MaxLinks, as they were not created that day
+func (lr *LinkRepository) checkMaxLinks(userID string, incoming uint) (models.Quota, error) {
+	quota, _, err := lr.quotaOf(userID)
+	if err != nil {
+		return quota, errors.Errorf("Error checking the quota of the owner %w", err)
+	}
+	if quota.MaxLinks == 0 {
+		return quota, nil
+	}
+
+	count, err := lr.Storage.CountLinks(userID, 0)
+	if err != nil {
+		return quota, err
+	}
+	if count+incoming > quota.MaxLinks {
+		return quota, link_repository.ErrQuotaExceeded{UserID: userID, Limit: "links", Max: quota.MaxLinks}
+	}
+	return quota, nil
+}
@@ -0,0 +1,121 @@
+package repositories
+
+import (
+	"errors"
+	"github.com/nethruster/linksh/pkg/interfaces/link_repository"
+	istorage "github.com/nethruster/linksh/pkg/interfaces/storage"
+	"github.com/nethruster/linksh/pkg/interfaces/user_repository"
+	"github.com/nethruster/linksh/pkg/models"
+	"testing"
+	"time"
+)
+
+func (ls *linkStorage) GetUserQuota(userID string) (models.UserQuota, error) {
+	quota, ok := ls.quotas[userID]
+	if !ok {
+		return quota, istorage.NewNotFoundError("quota", "userID", userID)
+	}
+	return quota, nil
+}
+
+func (ls *linkStorage) SaveUserQuota(quota models.UserQuota) error {
+	if ls.quotas == nil {
+		ls.quotas = make(map[string]models.UserQuota)
+	}
+	ls.quotas[quota.UserID] = quota
+	return nil
+}
+
+func (ls *linkStorage) DeleteUserQuota(userID string) error {
+	if _, ok := ls.quotas[userID]; !ok {
+		return istorage.NewNotFoundError("quota", "userID", userID)
+	}
+	delete(ls.quotas, userID)
+	return nil
+}
+
+func newQuotaStorage() *linkStorage {
+	storage := newLinkStorage()
+	storage.users["user"] = models.User{ID: "user"}
+	storage.users["admin"] = models.User{ID: "admin", IsAdmin: true}
+	return storage
+}
+
+func TestQuota(t *testing.T) {
+	storage := newQuotaStorage()
+	repository := &LinkRepository{Storage: storage, Quotas: QuotaPolicy{User: models.Quota{MaxLinks: 2}}}
+	var quotaExceeded link_repository.ErrQuotaExceeded
+
+	t.Run("max links", func(t *testing.T) {
+		for _, id := range []string{"first", "second"} {
+			if _, err := repository.Create(id, "https://example.tld/"+id, "user", models.LinkTypeStatic); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := repository.Create("third", "https://example.tld/third", "user", models.LinkTypeStatic); !errors.As(err, &quotaExceeded) || quotaExceeded.Limit != "links" {
+			t.Errorf("Expected an ErrQuotaExceeded of the links, got %v", err)
+		}
+		if _, ok := storage.links["third"]; ok {
+			t.Error("The link exceeding the quota should not be saved")
+		}
+		if _, err := repository.Create("", "https://example.tld/generated", "user", models.LinkTypeStatic); !errors.As(err, &quotaExceeded) {
+			t.Errorf("The links with a generated ID should respect the quota too, got %v", err)
+		}
+	})
+
+	t.Run("admin", func(t *testing.T) {
+		for _, id := range []string{"admin-1", "admin-2", "admin-3"} {
+			if _, err := repository.Create(id, "https://example.tld/"+id, "admin", models.LinkTypeStatic); err != nil {
+				t.Errorf("The admins should have no limits unless their role has one, got %v", err)
+			}
+		}
+	})
+
+	t.Run("set", func(t *testing.T) {
+		if err := repository.SetQuotaByUser("user", "user", models.Quota{MaxLinks: 10}); !errors.Is(err, user_repository.ErrForbidden) {
+			t.Errorf("Only the admins should set quotas, got %v", err)
+		}
+		if err := repository.SetQuotaByUser("admin", "user", models.Quota{MaxLinks: 10, MaxLinksPerDay: 3}); err != nil {
+			t.Fatal(err)
+		}
+		usage, err := repository.GetUsageByUser("user", "user")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !usage.Overridden || usage.Quota.MaxLinks != 10 || usage.Links != 2 || usage.LinksLastDay != 2 {
+			t.Errorf("Expected the quota of the user with 2 links in use, got %+v", usage)
+		}
+		if _, err = repository.Create("third", "https://example.tld/third", "user", models.LinkTypeStatic); err != nil {
+			t.Errorf("The quota of the user should override the one of its role, got %v", err)
+		}
+		if _, err = repository.Create("fourth", "https://example.tld/fourth", "user", models.LinkTypeStatic); !errors.As(err, &quotaExceeded) || quotaExceeded.Limit != "links per day" {
+			t.Errorf("Expected an ErrQuotaExceeded of the links per day, got %v", err)
+		}
+		//The links created before the last day don't count against the daily limit
+		link := storage.links["first"]
+		link.CreatedAt = time.Now().Add(-2 * quotaDayLength).Unix()
+		storage.links["first"] = link
+		if _, err = repository.Create("fourth", "https://example.tld/fourth", "user", models.LinkTypeStatic); err != nil {
+			t.Errorf("Only the links of the last day should count against the daily limit, got %v", err)
+		}
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		if err := repository.ResetQuotaByUser("user", "user"); !errors.Is(err, user_repository.ErrForbidden) {
+			t.Errorf("Only the admins should reset quotas, got %v", err)
+		}
+		if err := repository.ResetQuotaByUser("admin", "user"); err != nil {
+			t.Fatal(err)
+		}
+		if err := repository.ResetQuotaByUser("admin", "user"); !errors.As(err, &istorage.NotFoundError{}) {
+			t.Errorf("Expected NotFound resetting a quota not set, got %v", err)
+		}
+		usage, err := repository.GetUsage("user")
+		if err != nil || usage.Overridden || usage.Quota.MaxLinks != 2 {
+			t.Errorf("Expected the quota of the role again, got %+v %v", usage, err)
+		}
+		if _, err = repository.Create("fifth", "https://example.tld/fifth", "user", models.LinkTypeStatic); !errors.As(err, &quotaExceeded) {
+			t.Errorf("The quota of the role should apply again, got %v", err)
+		}
+	})
+}
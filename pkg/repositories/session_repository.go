@@ -3,6 +3,8 @@ package repositories
 import (
 	"fmt"
 	gonanoid "github.com/matoous/go-nanoid"
+	"github.com/nethruster/linksh/pkg/events"
+	"github.com/nethruster/linksh/pkg/interfaces/session_repository"
 	sto "github.com/nethruster/linksh/pkg/interfaces/storage"
 	"github.com/nethruster/linksh/pkg/models"
 	"time"
@@ -10,6 +12,18 @@ import (
 
 type SessionRepository struct {
 	Storage sto.IStorage
+	//Events receives the creations and the revocations of the sessions and the denied operations
+	//The audit log subscribes to it, if nil the events are not published
+	Events *events.Bus
+
+	actor events.Actor
+}
+
+// WithRequest returns a view of the repository publishing the metadata of the request along with the events
+func (sr *SessionRepository) WithRequest(request models.RequestMetadata) session_repository.ISessionRepository {
+	view := *sr
+	view.actor.Request = request
+	return &view
 }
 
 func (sr *SessionRepository) Create(userID string, expireDate int64) (models.Session, error) {
@@ -34,6 +48,8 @@ func (sr *SessionRepository) Create(userID string, expireDate int64) (models.Ses
 	if err != nil {
 		return session, fmt.Errorf("error creating the session%w", err)
 	}
+	// The session is published as created by its user
+	sr.Events.Publish(events.SessionCreated{Session: session, Actor: events.Actor{ID: userID, Request: sr.actor.Request}})
 
 	return session, nil
 }
@@ -55,12 +71,34 @@ func (sr *SessionRepository) ValidateAndRenew(sessionToken string) (string, erro
 }
 
 func (sr *SessionRepository) Delete(id string) error {
-	panic("not implemented")
+	session, err := sr.Storage.GetSession(id)
+	if err != nil {
+		return err
+	}
+	return sr.revoke(sr.actor, session)
 }
 
-
 func (sr *SessionRepository) DeleteByUser(userID, id string) error {
-	panic("not implemented")
+	session, err := sr.Storage.GetSession(id)
+	if err != nil {
+		return err
+	}
+	actor := events.Actor{ID: userID, Request: sr.actor.Request}
+	if session.UserID != userID {
+		if err = authorize(sr.Storage, sr.Events, actor, models.AuditDelete, models.AuditTargetSession, id); err != nil {
+			return err
+		}
+	}
+	return sr.revoke(actor, session)
+}
+
+// revoke deletes a session, publishing a SessionRevoked event
+func (sr *SessionRepository) revoke(actor events.Actor, session models.Session) error {
+	if err := sr.Storage.DeleteSession(session.ID); err != nil {
+		return err
+	}
+	sr.Events.Publish(events.SessionRevoked{Session: session, Actor: actor})
+	return nil
 }
 
 func generateSessionID() (string, error) {
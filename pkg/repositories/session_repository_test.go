@@ -0,0 +1,72 @@
+package repositories
+
+import (
+	"errors"
+	"github.com/nethruster/linksh/pkg/events"
+	istorage "github.com/nethruster/linksh/pkg/interfaces/storage"
+	"github.com/nethruster/linksh/pkg/interfaces/user_repository"
+	"github.com/nethruster/linksh/pkg/models"
+	"testing"
+)
+
+//sessionStorage implements the session methods of IStorage keeping everything in memory
+type sessionStorage struct {
+	*linkStorage
+	sessions map[string]models.Session
+}
+
+func (ss *sessionStorage) GetSession(id string) (models.Session, error) {
+	session, ok := ss.sessions[id]
+	if !ok {
+		return session, istorage.NewNotFoundError("session", "ID", id)
+	}
+	return session, nil
+}
+
+func (ss *sessionStorage) DeleteSession(id string) error {
+	if _, ok := ss.sessions[id]; !ok {
+		return istorage.NewNotFoundError("session", "ID", id)
+	}
+	delete(ss.sessions, id)
+	return nil
+}
+
+func TestDeleteSessionByUser(t *testing.T) {
+	storage := &sessionStorage{linkStorage: newLinkStorage(), sessions: map[string]models.Session{
+		"first":  {ID: "first", UserID: "owner"},
+		"second": {ID: "second", UserID: "owner"},
+	}}
+	storage.users["owner"] = models.User{ID: "owner"}
+	storage.users["other"] = models.User{ID: "other"}
+	storage.users["admin"] = models.User{ID: "admin", IsAdmin: true}
+	bus := events.New()
+	var published []events.Event
+	bus.Subscribe(func(event events.Event) { published = append(published, event) })
+	repository := &SessionRepository{Storage: storage, Events: bus}
+
+	if err := repository.DeleteByUser("other", "first"); !errors.Is(err, user_repository.ErrForbidden) {
+		t.Errorf("Only the owner or an admin should revoke a session, got %v", err)
+	}
+	if err := repository.DeleteByUser("owner", "first"); err != nil {
+		t.Errorf("The owner should revoke the session, got %v", err)
+	}
+	if err := repository.DeleteByUser("admin", "second"); err != nil {
+		t.Errorf("An admin should revoke the session, got %v", err)
+	}
+	if err := repository.Delete("first"); !errors.As(err, &istorage.NotFoundError{}) {
+		t.Errorf("Expected NotFound, got %v", err)
+	}
+	if len(storage.sessions) != 0 {
+		t.Errorf("Expected the sessions to be revoked, got %+v", storage.sessions)
+	}
+
+	if len(published) != 3 {
+		t.Fatalf("Expected the denial and the 2 revocations, got %+v", published)
+	}
+	if event, ok := published[0].(events.AccessDenied); !ok || event.Actor.ID != "other" {
+		t.Errorf("Expected the denial, got %+v", published[0])
+	}
+	if event, ok := published[2].(events.SessionRevoked); !ok || event.Actor.ID != "admin" || event.Session.ID != "second" {
+		t.Errorf("Expected the revocation by the admin, got %+v", published[2])
+	}
+}
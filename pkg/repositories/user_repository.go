@@ -2,16 +2,49 @@ package repositories
 
 import (
 	gonanoid "github.com/matoous/go-nanoid"
+	"github.com/nethruster/linksh/pkg/events"
+	"github.com/nethruster/linksh/pkg/interfaces/domain_filter"
 	sto "github.com/nethruster/linksh/pkg/interfaces/storage"
 	"github.com/nethruster/linksh/pkg/interfaces/user_repository"
 	"github.com/nethruster/linksh/pkg/models"
 	"golang.org/x/crypto/bcrypt"
 	errors "golang.org/x/xerrors"
+	"time"
 )
 
 //UserRepository implements IUserRepository
 type UserRepository struct {
 	Storage sto.IStorage
+	//Targets sets which fallbacks are accepted, it should be the same policy used for the contents of the links
+	Targets TargetPolicy
+	//Domains decides which domains the fallbacks can point to, it should be the same filter used for the links
+	//If nil every domain is accepted
+	Domains domain_filter.IDomainFilter
+	//Events receives every change of the users and the denied operations
+	//The audit log and the webhooks subscribe to it, if nil the events are not published
+	Events *events.Bus
+
+	actor events.Actor
+}
+
+//WithRequest returns a view of the repository publishing the metadata of the request along with the events
+//The view shares the settings of the repository, so a view can be created for every request
+func (ur *UserRepository) WithRequest(request models.RequestMetadata) user_repository.IUserRepository {
+	view := *ur
+	view.actor.Request = request
+	return &view
+}
+
+//as returns a view of the repository whose operations are published as performed by the specified user
+func (ur *UserRepository) as(actorID string) *UserRepository {
+	view := *ur
+	view.actor.ID = actorID
+	return &view
+}
+
+//authorize checks that the requester is an admin, publishing the denial otherwise
+func (ur *UserRepository) authorize(requesterID string, action models.AuditAction, targetID string) error {
+	return authorize(ur.Storage, ur.Events, events.Actor{ID: requesterID, Request: ur.actor.Request}, action, models.AuditTargetUser, targetID)
 }
 
 //CheckLoginCredentials checks if the provided credentials are valid to perform a login
@@ -57,7 +90,10 @@ func (ur *UserRepository) Create(name string, password []byte, isAdmin bool) (us
 		IsAdmin:  isAdmin,
 	}
 
-	err = ur.Storage.SaveUser(user)
+	if err = ur.Storage.SaveUser(user); err != nil {
+		return
+	}
+	ur.Events.Publish(events.UserCreated{User: user, Actor: ur.actor})
 	return
 }
 
@@ -76,6 +112,7 @@ func (ur *UserRepository) List(limit, offset uint) ([]models.User, error) {
 //Update replaces the values of the user in the storage with the values of the user provided by parameter
 //If the user does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
 //This methods will permorn validations over the provided data
+//If the domain of the fallback is rejected by the domain filter an ErrDomainRejected would be returned
 func (ur *UserRepository) Update(payload user_repository.UpdatePayload) (err error) {
 	if payload.Name != nil {
 		err = validateName(*payload.Name)
@@ -89,14 +126,67 @@ func (ur *UserRepository) Update(payload user_repository.UpdatePayload) (err err
 			return
 		}
 	}
+	if payload.UTM != nil && !utmTagsAreValid(*payload.UTM) {
+		return user_repository.ErrInvalidUTM
+	}
+	if payload.Fallback != nil && *payload.Fallback != "" {
+		fallback, err := ur.Targets.normalize(*payload.Fallback)
+		if err != nil {
+			return user_repository.ErrInvalidFallback
+		}
+		if err = checkDomains(ur.Domains, fallback); err != nil {
+			return err
+		}
+		payload.Fallback = &fallback
+	}
+	before, err := ur.Storage.GetUser(payload.ID)
+	if err != nil {
+		return
+	}
 
-	return ur.Storage.UpdateUser(payload)
+	if err = ur.Storage.UpdateUser(payload); err != nil {
+		return
+	}
+	return ur.updated(before, payload.Password != nil)
 }
 
-//Delete deletes an user from the storage
+//Delete moves an user to the trash, where it can be restored until it is purged
 //If the user does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
 func (ur *UserRepository) Delete(id string) error {
-	return ur.Storage.DeleteUser(id)
+	before, err := ur.Storage.GetUser(id)
+	if err != nil {
+		return err
+	}
+	if err = ur.Storage.TrashUser(id, time.Now().Unix()); err != nil {
+		return err
+	}
+
+	ur.Events.Publish(events.UserDeleted{User: before, Actor: ur.actor})
+	return nil
+}
+
+//Restore restores a deleted user that was not purged yet
+//If the user does not exists in the storage, or it is not deleted, an error pkg/interfaces/storage.NotFoundError would be returned
+func (ur *UserRepository) Restore(id string) error {
+	if err := ur.Storage.RestoreUser(id); err != nil {
+		return err
+	}
+	if ur.Events == nil {
+		return nil
+	}
+
+	after, err := ur.Storage.GetUser(id)
+	if err != nil {
+		return errors.Errorf("the user was restored, but it could not be read again to publish the restoration:%w", err)
+	}
+	ur.Events.Publish(events.UserCreated{User: after, Restored: true, Actor: ur.actor})
+	return nil
+}
+
+//ListTrash lists the deleted users that were not purged yet, the last deleted first
+//If the limit is set to 0, no limit will be established, the same applies to the offset
+func (ur *UserRepository) ListTrash(limit, offset uint) ([]models.User, error) {
+	return ur.Storage.ListTrashedUsers(limit, offset)
 }
 
 //CreateByUser creates an user and save it to the storage
@@ -104,12 +194,12 @@ func (ur *UserRepository) Delete(id string) error {
 //The data validations in this method can produce an ErrInvalidName or an ErrInvalidPassword
 //The requester must be an admin to perform this action
 func (ur *UserRepository) CreateByUser(requesterID string, name string, password []byte, isAdmin bool) (user models.User, err error) {
-	err = checkIfRequesterIsAdmin(ur.Storage, requesterID)
+	err = ur.authorize(requesterID, models.AuditCreate, "")
 	if err != nil {
 		return
 	}
 
-	return ur.Create(name, password, isAdmin)
+	return ur.as(requesterID).Create(name, password, isAdmin)
 }
 
 //GetByUser returns an user from the storage
@@ -117,7 +207,7 @@ func (ur *UserRepository) CreateByUser(requesterID string, name string, password
 //The requester must only request information about himself or be an admin to perform this action
 func (ur *UserRepository) GetByUser(requesterID, id string) (user models.User, err error) {
 	if requesterID != id {
-		err = checkIfRequesterIsAdmin(ur.Storage, requesterID)
+		err = ur.authorize(requesterID, models.AuditRead, id)
 		if err != nil {
 			return
 		}
@@ -130,7 +220,7 @@ func (ur *UserRepository) GetByUser(requesterID, id string) (user models.User, e
 //If limit is set to 0, no limit will be established
 //The requester must be an admin to perform this action
 func (ur *UserRepository) ListByUser(requesterID string, limit, offset uint) (users []models.User, err error) {
-	err = checkIfRequesterIsAdmin(ur.Storage, requesterID)
+	err = ur.authorize(requesterID, models.AuditRead, "")
 	if err != nil {
 		return
 	}
@@ -145,27 +235,63 @@ func (ur *UserRepository) ListByUser(requesterID string, limit, offset uint) (us
 //The requestor can only modify information about himself or otherwise be an admin to perform this action. The isAdmin property can only be changed by other admins.
 func (ur *UserRepository) UpdateByUser(requesterID string, user user_repository.UpdatePayload) (err error) {
 	if requesterID != user.ID {
-		err = checkIfRequesterIsAdmin(ur.Storage, requesterID)
+		err = ur.authorize(requesterID, models.AuditUpdate, user.ID)
 		if err != nil {
 			return
 		}
 	}
 
-	return ur.Update(user)
+	return ur.as(requesterID).Update(user)
 }
 
-//DeleteByUser deletes an user from the storage
+//DeleteByUser moves an user to the trash, where it can be restored until it is purged
 //If the user does not exists in the storage an error pkg/interfaces/storage.NotFoundError would be returned
 //The requester must only delete himself or be an admin to perform this action
 func (ur *UserRepository) DeleteByUser(requesterID, id string) (err error) {
 	if requesterID != id {
-		err = checkIfRequesterIsAdmin(ur.Storage, requesterID)
+		err = ur.authorize(requesterID, models.AuditDelete, id)
 		if err != nil {
 			return
 		}
 	}
 
-	return ur.Delete(id)
+	return ur.as(requesterID).Delete(id)
+}
+
+//RestoreByUser restores a deleted user that was not purged yet
+//If the user does not exists in the storage, or it is not deleted, an error pkg/interfaces/storage.NotFoundError would be returned
+//The requester must be an admin to perform this action
+func (ur *UserRepository) RestoreByUser(requesterID, id string) error {
+	if err := ur.authorize(requesterID, models.AuditRestore, id); err != nil {
+		return err
+	}
+
+	return ur.as(requesterID).Restore(id)
+}
+
+//ListTrashByUser lists the deleted users that were not purged yet, the last deleted first
+//If the limit is set to 0, no limit will be established, the same applies to the offset
+//The requester must be an admin to perform this action
+func (ur *UserRepository) ListTrashByUser(requesterID string, limit, offset uint) ([]models.User, error) {
+	if err := ur.authorize(requesterID, models.AuditRead, ""); err != nil {
+		return nil, err
+	}
+
+	return ur.ListTrash(limit, offset)
+}
+
+//updated publishes the update of an user, reading it again to know what changed
+//The user is already saved when reading it fails, so the error says so
+func (ur *UserRepository) updated(before models.User, passwordChanged bool) error {
+	if ur.Events == nil {
+		return nil
+	}
+	after, err := ur.Storage.GetUser(before.ID)
+	if err != nil {
+		return errors.Errorf("the user was updated, but it could not be read again to publish the update:%w", err)
+	}
+	ur.Events.Publish(events.UserUpdated{User: after, Previous: before, PasswordChanged: passwordChanged, Actor: ur.actor})
+	return nil
 }
 
 func generateUserID() (string, error) {
@@ -0,0 +1,220 @@
+package repositories
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	gonanoid "github.com/matoous/go-nanoid"
+	sto "github.com/nethruster/linksh/pkg/interfaces/storage"
+	"github.com/nethruster/linksh/pkg/interfaces/webhook_repository"
+	"github.com/nethruster/linksh/pkg/models"
+	"github.com/nethruster/linksh/pkg/webhook"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+)
+
+//webhookSecretLength is the number of random bytes of the secrets of the webhooks
+const webhookSecretLength = 32
+
+//WebhookRepository implements IWebhookRepository
+type WebhookRepository struct {
+	Storage sto.IStorage
+	//Webhooks sends the redeliveries, it should be the same dispatcher used by the other repositories
+	Webhooks *webhook.Dispatcher
+}
+
+//Create creates a webhook with a random secret and save it to the storage
+//If the ownerID is empty the webhook is triggered by every link and user, otherwise only by the ones of the owner
+//The data validations in this method can produce an ErrInvalidURL or an ErrInvalidEvents
+//If the owner does not exists in the storage an NotFoundError would be returned
+func (wr *WebhookRepository) Create(ownerID, url string, events []models.WebhookEvent) (hook models.Webhook, err error) {
+	if err = validateWebhookURL(url); err != nil {
+		return
+	}
+	if err = validateWebhookEvents(events); err != nil {
+		return
+	}
+	if ownerID != "" {
+		if _, err = wr.Storage.GetUser(ownerID); err != nil {
+			return
+		}
+	}
+
+	id, err := gonanoid.Nanoid()
+	if err != nil {
+		return
+	}
+	secret := make([]byte, webhookSecretLength)
+	if _, err = rand.Read(secret); err != nil {
+		return
+	}
+	hook = models.Webhook{
+		ID:        id,
+		OwnerID:   ownerID,
+		URL:       url,
+		Events:    events,
+		Secret:    hex.EncodeToString(secret),
+		CreatedAt: time.Now().Unix(),
+	}
+
+	err = wr.Storage.SaveWebhook(hook)
+	return
+}
+
+//Get returns the webhook with specified ID from the storage
+//If the webhook does not exists in the storage an NotFoundError would be returned
+func (wr *WebhookRepository) Get(id string) (models.Webhook, error) {
+	return wr.Storage.GetWebhook(id)
+}
+
+//List lists the webhooks, the oldest first
+//If the limit is set to 0, no limit will be established, the same applies to the offset
+//if the ownerID is not empty the search would be limited to the ones owned by the specified user
+func (wr *WebhookRepository) List(ownerID string, limit, offset uint) ([]models.Webhook, error) {
+	return wr.Storage.ListWebhooks(ownerID, limit, offset)
+}
+
+//Delete deletes a webhook from the storage, its deliveries are kept
+//If the webhook does not exists in the storage an NotFoundError would be returned
+func (wr *WebhookRepository) Delete(id string) error {
+	return wr.Storage.DeleteWebhook(id)
+}
+
+//ListDeliveries lists the deliveries of a webhook, the newest first
+//If the limit is set to 0, no limit will be established, the same applies to the offset
+//If the webhook does not exists in the storage an NotFoundError would be returned
+func (wr *WebhookRepository) ListDeliveries(webhookID string, limit, offset uint) ([]models.WebhookDelivery, error) {
+	if _, err := wr.Storage.GetWebhook(webhookID); err != nil {
+		return nil, err
+	}
+
+	return wr.Storage.ListWebhookDeliveries(webhookID, limit, offset)
+}
+
+//Redeliver sends again the payload of a delivery as a new delivery, which is returned before being sent
+//If the delivery or its webhook does not exists in the storage an NotFoundError would be returned
+//Without the Webhooks dispatcher an ErrNoDispatcher would be returned
+func (wr *WebhookRepository) Redeliver(deliveryID string) (models.WebhookDelivery, error) {
+	return wr.Webhooks.Redeliver(deliveryID)
+}
+
+//CreateByUser creates a webhook with a random secret and save it to the storage
+//If the ownerID is empty the webhook is triggered by every link and user, otherwise only by the ones of the owner
+//The data validations in this method can produce an ErrInvalidURL or an ErrInvalidEvents
+//The requester must be the owner or an admin to perform this action
+func (wr *WebhookRepository) CreateByUser(requesterID, ownerID, url string, events []models.WebhookEvent) (models.Webhook, error) {
+	if ownerID == "" || requesterID != ownerID {
+		if err := checkIfRequesterIsAdmin(wr.Storage, requesterID); err != nil {
+			return models.Webhook{}, err
+		}
+	}
+
+	return wr.Create(ownerID, url, events)
+}
+
+//GetByUser returns the webhook with specified ID from the storage
+//If the webhook does not exists in the storage an NotFoundError would be returned
+//The requester must own the webhook or be an admin to perform this action
+func (wr *WebhookRepository) GetByUser(requesterID, id string) (models.Webhook, error) {
+	return wr.getOwnedBy(requesterID, id)
+}
+
+//ListByUser lists the webhooks, the oldest first
+//If the limit is set to 0, no limit will be established, the same applies to the offset
+//if the ownerID is not empty the search would be limited to the ones owned by the specified user
+//The requester must be the owner of the webhooks or an admin to perform this action
+func (wr *WebhookRepository) ListByUser(requesterID, ownerID string, limit, offset uint) ([]models.Webhook, error) {
+	if ownerID == "" || requesterID != ownerID {
+		if err := checkIfRequesterIsAdmin(wr.Storage, requesterID); err != nil {
+			return nil, err
+		}
+	}
+
+	return wr.List(ownerID, limit, offset)
+}
+
+//DeleteByUser deletes a webhook from the storage, its deliveries are kept
+//If the webhook does not exists in the storage an NotFoundError would be returned
+//The requester must own the webhook or be an admin to perform this action
+func (wr *WebhookRepository) DeleteByUser(requesterID, id string) error {
+	if _, err := wr.getOwnedBy(requesterID, id); err != nil {
+		return err
+	}
+
+	return wr.Delete(id)
+}
+
+//ListDeliveriesByUser lists the deliveries of a webhook, the newest first
+//If the limit is set to 0, no limit will be established, the same applies to the offset
+//If the webhook does not exists in the storage an NotFoundError would be returned
+//The requester must own the webhook or be an admin to perform this action
+func (wr *WebhookRepository) ListDeliveriesByUser(requesterID, webhookID string, limit, offset uint) ([]models.WebhookDelivery, error) {
+	if _, err := wr.getOwnedBy(requesterID, webhookID); err != nil {
+		return nil, err
+	}
+
+	return wr.Storage.ListWebhookDeliveries(webhookID, limit, offset)
+}
+
+//RedeliverByUser sends again the payload of a delivery as a new delivery, which is returned before being sent
+//If the delivery or its webhook does not exists in the storage an NotFoundError would be returned
+//The requester must own the webhook of the delivery or be an admin to perform this action
+func (wr *WebhookRepository) RedeliverByUser(requesterID, deliveryID string) (models.WebhookDelivery, error) {
+	delivery, err := wr.Storage.GetWebhookDelivery(deliveryID)
+	if err != nil {
+		return delivery, err
+	}
+	if _, err = wr.getOwnedBy(requesterID, delivery.WebhookID); err != nil {
+		return models.WebhookDelivery{}, err
+	}
+
+	return wr.Redeliver(deliveryID)
+}
+
+//getOwnedBy returns a webhook if the requester owns it or is an admin
+func (wr *WebhookRepository) getOwnedBy(requesterID, id string) (models.Webhook, error) {
+	hook, err := wr.Get(id)
+	if err != nil {
+		return hook, err
+	}
+	if hook.OwnerID == "" || hook.OwnerID != requesterID {
+		if err = checkIfRequesterIsAdmin(wr.Storage, requesterID); err != nil {
+			return models.Webhook{}, err
+		}
+	}
+
+	return hook, nil
+}
+
+//validateWebhookURL checks that the URL is an absolute http or https URL that doesn't point to the instance or its private network
+//The names are only resolved when the deliveries are sent, which is when the client of the dispatcher checks them
+func validateWebhookURL(rawURL string) error {
+	target, err := url.Parse(rawURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return webhook_repository.ErrInvalidURL
+	}
+	host := strings.ToLower(strings.TrimSuffix(target.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return webhook_repository.ErrInvalidURL
+	}
+	if ip := net.ParseIP(host); ip != nil && !webhook.IsPublicIP(ip) {
+		return webhook_repository.ErrInvalidURL
+	}
+	return nil
+}
+
+func validateWebhookEvents(events []models.WebhookEvent) error {
+	if len(events) == 0 {
+		return webhook_repository.ErrInvalidEvents
+	}
+	for _, event := range events {
+		switch event {
+		case models.WebhookLinkCreated, models.WebhookLinkUpdated, models.WebhookLinkDeleted, models.WebhookLinkMilestone,
+			models.WebhookUserCreated, models.WebhookUserUpdated, models.WebhookUserDeleted:
+		default:
+			return webhook_repository.ErrInvalidEvents
+		}
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package repositories
+
+import (
+	"errors"
+	istorage "github.com/nethruster/linksh/pkg/interfaces/storage"
+	"github.com/nethruster/linksh/pkg/interfaces/user_repository"
+	"github.com/nethruster/linksh/pkg/interfaces/webhook_repository"
+	"github.com/nethruster/linksh/pkg/models"
+	"github.com/nethruster/linksh/pkg/webhook"
+	"testing"
+)
+
+func TestWebhook(t *testing.T) {
+	storage := newLinkStorage()
+	storage.users["admin"] = models.User{ID: "admin", IsAdmin: true}
+	storage.users["owner"] = models.User{ID: "owner"}
+	storage.users["other"] = models.User{ID: "other"}
+	repository := &WebhookRepository{Storage: storage}
+	events := []models.WebhookEvent{models.WebhookLinkCreated}
+
+	for _, url := range []string{"", "example.tld/hook", "ftp://example.tld/hook", "https:///hook",
+		"http://169.254.169.254/latest/meta-data", "http://localhost:8080/hook", "http://api.localhost/hook", "http://10.0.0.1/hook", "http://[::1]/hook"} {
+		if _, err := repository.Create("", url, events); !errors.Is(err, webhook_repository.ErrInvalidURL) {
+			t.Errorf("%q should be an invalid URL, got %v", url, err)
+		}
+	}
+	for _, events := range [][]models.WebhookEvent{nil, {models.WebhookLinkCreated, "link.visited"}} {
+		if _, err := repository.Create("", "https://example.tld/hook", events); !errors.Is(err, webhook_repository.ErrInvalidEvents) {
+			t.Errorf("%v should be invalid events, got %v", events, err)
+		}
+	}
+	if _, err := repository.Redeliver("abc"); !errors.Is(err, webhook.ErrNoDispatcher) {
+		t.Errorf("Redelivering without a dispatcher should produce an ErrNoDispatcher, got %v", err)
+	}
+	if _, err := repository.Create("missing", "https://example.tld/hook", events); !errors.As(err, &istorage.NotFoundError{}) {
+		t.Errorf("The owner of a webhook should exist, got %v", err)
+	}
+
+	if _, err := repository.CreateByUser("owner", "", "https://example.tld/hook", events); !errors.Is(err, user_repository.ErrForbidden) {
+		t.Errorf("Only an admin should create a global webhook, got %v", err)
+	}
+	if _, err := repository.CreateByUser("other", "owner", "https://example.tld/hook", events); !errors.Is(err, user_repository.ErrForbidden) {
+		t.Errorf("Only the owner or an admin should create a webhook, got %v", err)
+	}
+	hook, err := repository.CreateByUser("owner", "owner", "https://example.tld/hook", events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hook.Secret) != 2*webhookSecretLength {
+		t.Errorf("Expected a secret of %d bytes, got %q", webhookSecretLength, hook.Secret)
+	}
+	global, err := repository.CreateByUser("admin", "", "https://example.tld/hook", events)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = repository.GetByUser("other", hook.ID); !errors.Is(err, user_repository.ErrForbidden) {
+		t.Errorf("Only the owner or an admin should get a webhook, got %v", err)
+	}
+	if _, err = repository.GetByUser("owner", global.ID); !errors.Is(err, user_repository.ErrForbidden) {
+		t.Errorf("Only an admin should get a global webhook, got %v", err)
+	}
+	for _, requesterID := range []string{"owner", "admin"} {
+		if _, err = repository.GetByUser(requesterID, hook.ID); err != nil {
+			t.Errorf("%s should get the webhook, got %v", requesterID, err)
+		}
+	}
+}
@@ -2,23 +2,40 @@ package mongo
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"github.com/nethruster/linksh/pkg/interfaces/link_repository"
 	istorage "github.com/nethruster/linksh/pkg/interfaces/storage"
 	"github.com/nethruster/linksh/pkg/interfaces/user_repository"
 	"github.com/nethruster/linksh/pkg/models"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
 	mongoOptions "go.mongodb.org/mongo-driver/mongo/options"
+	"regexp"
 	"time"
 )
 
 const (
 	userCollectionName = "users"
 	linksCollectionName = "links"
+	linkKeysCollectionName = "link_keys"
+	linkTransfersCollectionName = "link_transfers"
+	linkVersionsCollectionName = "link_versions"
+	auditRecordsCollectionName = "audit_records"
+	webhooksCollectionName = "webhooks"
+	webhookDeliveriesCollectionName = "webhook_deliveries"
+	quotasCollectionName = "quotas"
+	rateLimitBucketsCollectionName = "rate_limit_buckets"
+	countersCollectionName = "counters"
+	sessionsCollectionName = "sessions"
+
+	duplicateKeyErrorCode = 11000
 )
 
 var (
 	appName = "linksh"
+	//notDeleted filters out the deleted users and links still waiting to be purged
+	notDeleted = bson.M{"$exists": false}
 )
 
 type Storage struct {
@@ -44,10 +61,132 @@ func New(connectionString string, databaseName string, defaultTimeout time.Durat
 	if err != nil {
 		return nil, err
 	}
+	if err = sto.ensureIndexes(); err != nil {
+		return nil, err
+	}
+	if err = sto.reserveExistingLinkKeys(); err != nil {
+		return nil, err
+	}
 
 	return &sto, nil
 }
 
+//ensureIndexes creates the indexes the storage relies on, the existing ones are left untouched
+func (sto *Storage) ensureIndexes() error {
+	if err := sto.dropSparseAliasesIndex(); err != nil {
+		return err
+	}
+	//Only the aliases themselves are indexed, the links without aliases or with an empty list are left out
+	_, err := sto.db().Collection(linksCollectionName).Indexes().CreateOne(sto.newTimeoutContext(), mongo.IndexModel{
+		Keys: bson.M{"aliases": 1},
+		Options: mongoOptions.Index().SetUnique(true).
+			SetPartialFilterExpression(bson.M{"aliases": bson.M{"$type": "string"}}),
+	})
+	if err != nil {
+		return fmt.Errorf("error creating the index of the link aliases:%w", err)
+	}
+	_, err = sto.db().Collection(linkKeysCollectionName).Indexes().CreateOne(sto.newTimeoutContext(), mongo.IndexModel{
+		Keys: bson.M{"linkID": 1},
+	})
+	if err != nil {
+		return fmt.Errorf("error creating the index of the link keys:%w", err)
+	}
+	_, err = sto.db().Collection(linksCollectionName).Indexes().CreateOne(sto.newTimeoutContext(), mongo.IndexModel{
+		Keys: bson.M{"suggestionKeys": 1},
+	})
+	if err != nil {
+		return fmt.Errorf("error creating the index of the link suggestion keys:%w", err)
+	}
+	//The buckets of the clients that stopped sending requests would pile up otherwise
+	_, err = sto.db().Collection(rateLimitBucketsCollectionName).Indexes().CreateOne(sto.newTimeoutContext(), mongo.IndexModel{
+		Keys:    bson.M{"expiresAt": 1},
+		Options: mongoOptions.Index().SetExpireAfterSeconds(0),
+	})
+	if err != nil {
+		return fmt.Errorf("error creating the index of the rate limit buckets expiration:%w", err)
+	}
+	return nil
+}
+
+//dropSparseAliasesIndex drops the sparse index of the aliases created by the previous versions
+//It counted the links left with an empty list of aliases as duplicates of each other
+func (sto *Storage) dropSparseAliasesIndex() error {
+	ctx := sto.newTimeoutContext()
+	cursor, err := sto.db().Collection(linksCollectionName).Indexes().List(ctx)
+	if err != nil {
+		return fmt.Errorf("error listing the indexes of the links:%w", err)
+	}
+	defer cursor.Close(ctx)
+	var indexes []struct {
+		Name   string `bson:"name"`
+		Sparse bool   `bson:"sparse"`
+	}
+	if err = cursor.All(ctx, &indexes); err != nil {
+		return fmt.Errorf("error listing the indexes of the links:%w", err)
+	}
+	for _, index := range indexes {
+		if index.Name == "aliases_1" && index.Sparse {
+			if _, err = sto.db().Collection(linksCollectionName).Indexes().DropOne(sto.newTimeoutContext(), index.Name); err != nil {
+				return fmt.Errorf("error dropping the sparse index of the link aliases:%w", err)
+			}
+		}
+	}
+	return nil
+}
+
+//reserveExistingLinkKeys reserves the IDs and aliases of the links saved before the link keys existed
+//It only runs while there are no link keys, so it is done once
+func (sto *Storage) reserveExistingLinkKeys() error {
+	keys, err := sto.db().Collection(linkKeysCollectionName).EstimatedDocumentCount(sto.newTimeoutContext())
+	if err != nil {
+		return fmt.Errorf("error counting the link keys:%w", err)
+	}
+	if keys != 0 {
+		return nil
+	}
+
+	ctx := sto.newTimeoutContext()
+	cursor, err := sto.db().Collection(linksCollectionName).
+		Find(ctx, bson.M{}, mongoOptions.Find().SetProjection(bson.M{"_id": 1, "aliases": 1}))
+	if err != nil {
+		return fmt.Errorf("error searching the links:%w", err)
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var link models.Link
+		if err = cursor.Decode(&link); err != nil {
+			return fmt.Errorf("error decoding a link:%w", err)
+		}
+		for _, key := range append([]string{link.ID}, link.Aliases...) {
+			_, err = sto.db().Collection(linkKeysCollectionName).UpdateOne(sto.newTimeoutContext(),
+				bson.M{"_id": key},
+				bson.M{"$setOnInsert": bson.M{"linkID": link.ID}},
+				mongoOptions.Update().SetUpsert(true))
+			if err != nil {
+				return fmt.Errorf("error reserving the key \"%s\" of the link \"%s\":%w", key, link.ID, err)
+			}
+		}
+	}
+	return cursor.Err()
+}
+
+//reserveLinkKey reserves an ID or alias for a link
+//The keys are the IDs of the link keys, so two links can't reserve the same one, whether as ID or as alias
+func (sto *Storage) reserveLinkKey(key, linkID string) error {
+	_, err := sto.db().Collection(linkKeysCollectionName).
+		InsertOne(sto.newTimeoutContext(), bson.M{"_id": key, "linkID": linkID})
+	return err
+}
+
+//releaseLinkKeys frees the IDs and aliases matched by the filter, so they can be used by other links
+func (sto *Storage) releaseLinkKeys(filter bson.M) error {
+	_, err := sto.db().Collection(linkKeysCollectionName).DeleteMany(sto.newTimeoutContext(), filter)
+	if err != nil {
+		return fmt.Errorf("error releasing the link keys:%w", err)
+	}
+	return nil
+}
+
 func (sto *Storage) newTimeoutContext() context.Context {
 	ctx, _ := context.WithTimeout(context.Background(),sto.DefaultTimeout)
 	return ctx
@@ -61,6 +200,19 @@ func (sto *Storage) db() *mongo.Database {
 	return sto.client.Database(sto.databaseName)
 }
 
+func isDuplicateKeyError(err error) bool {
+	var writeException mongo.WriteException
+	if !errors.As(err, &writeException) {
+		return false
+	}
+	for _, writeError := range writeException.WriteErrors {
+		if writeError.Code == duplicateKeyErrorCode {
+			return true
+		}
+	}
+	return false
+}
+
 
 //User related methods
 
@@ -75,7 +227,7 @@ func (sto *Storage) SaveUser(user models.User) error {
 }
 
 func (sto *Storage) GetUser(id string) (user models.User, err error) {
-	result := sto.db().Collection(userCollectionName).FindOne(sto.newTimeoutContext(), bson.M{"_id": id})
+	result := sto.db().Collection(userCollectionName).FindOne(sto.newTimeoutContext(), bson.M{"_id": id, "deletedAt": notDeleted})
 	err = result.Err()
 
 	if err == mongo.ErrNoDocuments {
@@ -93,7 +245,7 @@ func (sto *Storage) GetUser(id string) (user models.User, err error) {
 }
 
 func (sto *Storage) GetUserByName(name string) (user models.User, err error) {
-	result := sto.db().Collection(userCollectionName).FindOne(sto.newTimeoutContext(), bson.M{"name": name})
+	result := sto.db().Collection(userCollectionName).FindOne(sto.newTimeoutContext(), bson.M{"name": name, "deletedAt": notDeleted})
 	err = result.Err()
 
 	if err == mongo.ErrNoDocuments {
@@ -120,7 +272,7 @@ func (sto *Storage) ListUsers(limit, offset uint) ([]models.User, error) {
 		options.SetSkip(int64(offset))
 	}
 	ctx := sto.newTimeoutContext()
-	cursor, err := sto.db().Collection(userCollectionName).Find(ctx, bson.D{}, options)
+	cursor, err := sto.db().Collection(userCollectionName).Find(ctx, bson.M{"deletedAt": notDeleted}, options)
 	if err != nil {
 		return nil, err
 	}
@@ -144,6 +296,15 @@ func (sto *Storage) UpdateUser(user user_repository.UpdatePayload) error {
 	if user.IsAdmin != nil {
 		set = append(set, bson.E{"isAdmin", user.IsAdmin})
 	}
+	if user.UTM != nil {
+		set = append(set, bson.E{Key: "utm", Value: user.UTM})
+	}
+	if user.Fallback != nil {
+		set = append(set, bson.E{Key: "fallback", Value: *user.Fallback})
+	}
+	if user.SuggestLinks != nil {
+		set = append(set, bson.E{Key: "suggestLinks", Value: *user.SuggestLinks})
+	}
 	if len(set) == 0 {
 		return nil
 	}
@@ -177,12 +338,71 @@ func (sto *Storage) DeleteUser(id string) error {
 	return nil
 }
 
+func (sto *Storage) TrashUser(id string, deletedAt int64) error {
+	return sto.trash(userCollectionName, "users", id, deletedAt)
+}
+
+func (sto *Storage) RestoreUser(id string) error {
+	return sto.restore(userCollectionName, "users", id)
+}
+
+func (sto *Storage) ListTrashedUsers(limit, offset uint) ([]models.User, error) {
+	options := mongoOptions.Find()
+	options.SetSort(bson.M{"deletedAt": -1})
+	if limit != 0 {
+		options.SetLimit(int64(limit))
+	}
+	if offset != 0 {
+		options.SetSkip(int64(offset))
+	}
+	ctx := sto.newTimeoutContext()
+	cursor, err := sto.db().Collection(userCollectionName).Find(ctx, bson.M{"deletedAt": bson.M{"$exists": true}}, options)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var users []models.User
+	err = cursor.All(ctx, &users)
+	return users, err
+}
+
+func (sto *Storage) PurgeUsers(deletedBefore int64) (uint, error) {
+	return sto.purge(userCollectionName, deletedBefore)
+}
+
 //Link related methods
 
 func (sto *Storage) SaveLink(link models.Link) error {
+	//The unique index of the aliases can't check them against the IDs, so both are reserved as link keys first
+	keys := append([]string{link.ID}, link.Aliases...)
+	for i, key := range keys {
+		err := sto.reserveLinkKey(key, link.ID)
+		if err == nil {
+			continue
+		}
+		if releaseErr := sto.releaseLinkKeys(bson.M{"_id": bson.M{"$in": keys[:i]}, "linkID": link.ID}); releaseErr != nil {
+			return releaseErr
+		}
+		if isDuplicateKeyError(err) {
+			return &istorage.AlreadyExistsError{Model: "link", Field: "ID"}
+		}
+		return fmt.Errorf("error reserving the key \"%s\":%w", key, err)
+	}
+
 	_, err := sto.db().Collection(linksCollectionName).InsertOne(sto.newTimeoutContext(), &link)
+	if isDuplicateKeyError(err) {
+		//The ID was reserved by the link already saved, as reserving it again would have failed otherwise
+		if len(link.Aliases) != 0 {
+			if releaseErr := sto.releaseLinkKeys(bson.M{"_id": bson.M{"$in": link.Aliases}, "linkID": link.ID}); releaseErr != nil {
+				return releaseErr
+			}
+		}
+		return &istorage.AlreadyExistsError{Model: "link", Field: "ID"}
+	}
 	if err != nil {
-		//TODO test for already exists error
+		if releaseErr := sto.releaseLinkKeys(bson.M{"linkID": link.ID}); releaseErr != nil {
+			return releaseErr
+		}
 		return err
 	}
 
@@ -190,7 +410,8 @@ func (sto *Storage) SaveLink(link models.Link) error {
 }
 
 func (sto *Storage) GetLink(id string) (link models.Link, err error) {
-	result := sto.db().Collection(linksCollectionName).FindOne(sto.newTimeoutContext(), bson.M{"_id": id})
+	filter := bson.M{"$or": bson.A{bson.M{"_id": id}, bson.M{"aliases": id}}, "deletedAt": notDeleted}
+	result := sto.db().Collection(linksCollectionName).FindOne(sto.newTimeoutContext(), filter)
 	err = result.Err()
 
 	if err == mongo.ErrNoDocuments {
@@ -207,8 +428,24 @@ func (sto *Storage) GetLink(id string) (link models.Link, err error) {
 	return
 }
 
+func (sto *Storage) GetLinks(ids []string) ([]models.Link, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	ctx := sto.newTimeoutContext()
+	filter := bson.M{"$or": bson.A{bson.M{"_id": bson.M{"$in": ids}}, bson.M{"aliases": bson.M{"$in": ids}}}, "deletedAt": notDeleted}
+	cursor, err := sto.db().Collection(linksCollectionName).Find(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("error searching the links %v:%w", ids, err)
+	}
+	defer cursor.Close(ctx)
+	var links []models.Link
+	err = cursor.All(ctx, &links)
+	return links, err
+}
+
 func (sto *Storage) ListLinks(ownerID string, limit, offset uint) ([]models.Link, error) {
-	filter :=  make(bson.M)
+	filter := bson.M{"deletedAt": notDeleted}
 	options := mongoOptions.Find()
 	options.SetSort(bson.D{{"createdAt", -1}})
 	if limit != 0 {
@@ -231,6 +468,68 @@ func (sto *Storage) ListLinks(ownerID string, limit, offset uint) ([]models.Link
 	return links, err
 }
 
+func (sto *Storage) ListLinksAfter(afterID string, limit uint) ([]models.Link, error) {
+	filter := bson.M{"deletedAt": notDeleted}
+	if afterID != "" {
+		filter["_id"] = bson.M{"$gt": afterID}
+	}
+	options := mongoOptions.Find().SetSort(bson.M{"_id": 1})
+	if limit != 0 {
+		options.SetLimit(int64(limit))
+	}
+	ctx := sto.newTimeoutContext()
+	cursor, err := sto.db().Collection(linksCollectionName).Find(ctx, filter, options)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var links []models.Link
+	err = cursor.All(ctx, &links)
+	return links, err
+}
+
+func (sto *Storage) ListLinksBySuggestionKeys(keys []string, prefix string, limit uint) ([]models.Link, error) {
+	or := bson.A{bson.M{"suggestionKeys": bson.M{"$in": keys}}}
+	if prefix != "" {
+		//An anchored regex without options can use the index of the suggestion keys
+		or = append(or, bson.M{"suggestionKeys": bson.M{"$regex": "^" + regexp.QuoteMeta(prefix)}})
+	}
+	filter := bson.M{"$or": or, "deletedAt": notDeleted}
+	options := mongoOptions.Find()
+	if limit != 0 {
+		options.SetLimit(int64(limit))
+	}
+	ctx := sto.newTimeoutContext()
+	cursor, err := sto.db().Collection(linksCollectionName).Find(ctx, filter, options)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var links []models.Link
+	err = cursor.All(ctx, &links)
+	return links, err
+}
+
+func (sto *Storage) UpdateLinkSuggestionKeys(id string, keys []string) error {
+	if id == "" {
+		return istorage.NewNotFoundError("links", "id", "")
+	}
+
+	result, err := sto.db().Collection(linksCollectionName).
+		UpdateOne(sto.newTimeoutContext(),
+			bson.M{"_id": id},
+			bson.M{"$set": bson.M{"suggestionKeys": keys}})
+	if err != nil {
+		return fmt.Errorf("error updating link with id \"%s\":%w", id, err)
+	}
+
+	if result.MatchedCount == 0 {
+		return istorage.NewNotFoundError("links", "id", id)
+	}
+
+	return nil
+}
+
 func (sto *Storage) UpdateLinkContent(id, content string) error {
 	if id == "" {
 		return istorage.NewNotFoundError("links", "id", "")
@@ -241,8 +540,8 @@ func (sto *Storage) UpdateLinkContent(id, content string) error {
 
 	result, err := sto.db().Collection(linksCollectionName).
 		UpdateOne(sto.newTimeoutContext(),
-			bson.M{"_id": id},
-			bson.D{bson.E{"$set", bson.D{{"content", content}}},})
+			bson.M{"_id": id, "deletedAt": notDeleted},
+			bson.M{"$set": bson.M{"content": content, "health": models.LinkHealth{}}})
 	if err != nil {
 		return fmt.Errorf("error updating link with id \"%s\":%w", id, err)
 	}
@@ -254,19 +553,165 @@ func (sto *Storage) UpdateLinkContent(id, content string) error {
 	return nil
 }
 
+func (sto *Storage) UpdateLink(payload link_repository.UpdatePayload) error {
+	if payload.ID == "" {
+		return istorage.NewNotFoundError("links", "id", "")
+	}
+	//The update is a pipeline so the variants and the rules can keep their hits, the other values must be literals
+	set := make(bson.M)
+	if payload.Type != nil {
+		set["type"] = *payload.Type
+	}
+	if payload.QueryPassthrough != nil {
+		set["queryPassthrough"] = *payload.QueryPassthrough
+	}
+	if payload.UTM != nil {
+		set["utm"] = *payload.UTM
+	}
+	if payload.RedirectMode != nil {
+		set["redirectMode"] = *payload.RedirectMode
+	}
+	if payload.Variants != nil {
+		set["variants"] = keepingHits("variants", *payload.Variants)
+	}
+	if payload.Rotation != nil {
+		set["rotation"] = *payload.Rotation
+	}
+	if payload.Rules != nil {
+		set["rules"] = keepingHits("rules", *payload.Rules)
+	}
+	if payload.ActivatesAt != nil {
+		set["activatesAt"] = *payload.ActivatesAt
+	}
+	if payload.DeactivatesAt != nil {
+		set["deactivatesAt"] = *payload.DeactivatesAt
+	}
+	if payload.Fallback != nil {
+		set["fallback"] = *payload.Fallback
+	}
+	if len(set) == 0 {
+		return nil
+	}
+	for field, value := range set {
+		if field != "variants" && field != "rules" {
+			set[field] = bson.M{"$literal": value}
+		}
+	}
+
+	result, err := sto.db().Collection(linksCollectionName).
+		UpdateOne(sto.newTimeoutContext(),
+			bson.M{"_id": payload.ID, "deletedAt": notDeleted},
+			bson.A{bson.M{"$set": set}})
+	if err != nil {
+		return fmt.Errorf("error updating link with id \"%s\":%w", payload.ID, err)
+	}
+
+	if result.MatchedCount == 0 {
+		return istorage.NewNotFoundError("links", "id", payload.ID)
+	}
+
+	return nil
+}
+
 func (sto *Storage) DeleteLink(id string) error {
 	if id == "" {
 		return istorage.NewNotFoundError("links", "id", "")
 	}
-	result, err := sto.db().Collection(linksCollectionName).DeleteOne(sto.newTimeoutContext(), bson.M{"_id": id})
+	return sto.deleteLink(bson.M{"_id": id})
+}
+
+//deleteLink deletes the link matched by the filter, which must include its ID, along with everything keyed by its ID
+//The rest is removed first, so a failure leaves the link and its keys in place and the deletion can be retried
+func (sto *Storage) deleteLink(filter bson.M) error {
+	id := filter["_id"].(string)
+	_, err := sto.db().Collection(linkVersionsCollectionName).DeleteMany(sto.newTimeoutContext(), bson.M{"linkId": id})
+	if err != nil {
+		return fmt.Errorf("error removing the versions of the link \"%s\":%w", id, err)
+	}
+	_, err = sto.db().Collection(linkTransfersCollectionName).
+		UpdateMany(sto.newTimeoutContext(),
+			bson.M{"items.linkId": id},
+			bson.M{"$pull": bson.M{"items": bson.M{"linkId": id}}})
+	if err != nil {
+		return fmt.Errorf("error removing the link \"%s\" from its transfers:%w", id, err)
+	}
+	_, err = sto.db().Collection(linkTransfersCollectionName).DeleteMany(sto.newTimeoutContext(), bson.M{"items": bson.M{"$size": 0}})
+	if err != nil {
+		return fmt.Errorf("error removing the transfers left without links:%w", err)
+	}
+	_, err = sto.db().Collection(countersCollectionName).DeleteMany(sto.newTimeoutContext(), bson.M{"$or": bson.A{
+		bson.M{"_id": bson.M{"$in": bson.A{istorage.LinkVersionsCounterName(id), istorage.LinkRotationCounterName(id)}}},
+		bson.M{"_id": bson.M{"$regex": "^" + regexp.QuoteMeta(istorage.LinkMilestoneCountersPrefix(id)) + "[0-9]+$"}},
+	}})
+	if err != nil {
+		return fmt.Errorf("error removing the counters of the link \"%s\":%w", id, err)
+	}
+
+	result, err := sto.db().Collection(linksCollectionName).DeleteOne(sto.newTimeoutContext(), filter)
 	if err != nil {
 		return fmt.Errorf("error removing link with id \"%s\":%w", id, err)
 	}
 	if result.DeletedCount == 0 {
-		return  istorage.NewNotFoundError("links", "id", id)
+		return istorage.NewNotFoundError("links", "id", id)
 	}
 
-	return nil
+	return sto.releaseLinkKeys(bson.M{"linkID": id})
+}
+
+func (sto *Storage) AddLinkAlias(id, alias string) error {
+	if id == "" {
+		return istorage.NewNotFoundError("links", "id", "")
+	}
+	//The unique index of the aliases can't check them against the IDs, so the alias is reserved as a link key first
+	err := sto.reserveLinkKey(alias, id)
+	if isDuplicateKeyError(err) {
+		return &istorage.AlreadyExistsError{Model: "link", Field: "alias"}
+	}
+	if err != nil {
+		return fmt.Errorf("error reserving the alias \"%s\":%w", alias, err)
+	}
+
+	result, err := sto.db().Collection(linksCollectionName).
+		UpdateOne(sto.newTimeoutContext(),
+			bson.M{"_id": id, "deletedAt": notDeleted},
+			bson.M{"$addToSet": bson.M{"aliases": alias}})
+	if err == nil && result.MatchedCount == 0 {
+		err = istorage.NewNotFoundError("links", "id", id)
+	}
+	if err != nil {
+		if releaseErr := sto.releaseLinkKeys(bson.M{"_id": alias, "linkID": id}); releaseErr != nil {
+			return releaseErr
+		}
+	}
+	if isDuplicateKeyError(err) {
+		return &istorage.AlreadyExistsError{Model: "link", Field: "alias"}
+	}
+	if err != nil && !errors.As(err, &istorage.NotFoundError{}) {
+		return fmt.Errorf("error updating link with id \"%s\":%w", id, err)
+	}
+
+	return err
+}
+
+func (sto *Storage) RemoveLinkAlias(id, alias string) error {
+	if id == "" {
+		return istorage.NewNotFoundError("links", "id", "")
+	}
+
+	result, err := sto.db().Collection(linksCollectionName).
+		UpdateOne(sto.newTimeoutContext(),
+			bson.M{"_id": id, "aliases": alias},
+			bson.M{"$pull": bson.M{"aliases": alias}})
+	if err != nil {
+		return fmt.Errorf("error updating link with id \"%s\":%w", id, err)
+	}
+
+	if result.MatchedCount == 0 {
+		return istorage.NewNotFoundError("link alias", "alias", alias)
+	}
+
+	//The alias stays reserved if this fails, which keeps it unusable but never lets two links share it
+	return sto.releaseLinkKeys(bson.M{"_id": alias, "linkID": id})
 }
 
 func (sto *Storage) IncreaseLinkHitCount(id string) error {
@@ -276,7 +721,7 @@ func (sto *Storage) IncreaseLinkHitCount(id string) error {
 
 	result, err := sto.db().Collection(linksCollectionName).
 		UpdateOne(sto.newTimeoutContext(),
-			bson.M{"_id": id},
+			bson.M{"_id": id, "deletedAt": notDeleted},
 			bson.D{bson.E{"$inc", bson.D{{"hits", 1}}},})
 	if err != nil {
 		return fmt.Errorf("error updating link with id \"%s\":%w", id, err)
@@ -289,27 +734,851 @@ func (sto *Storage) IncreaseLinkHitCount(id string) error {
 	return nil
 }
 
-// Session related methods
+func (sto *Storage) IncreaseLinkFallbackHitCount(id string) error {
+	if id == "" {
+		return istorage.NewNotFoundError("links", "id", "")
+	}
 
-func (sto *Storage) SaveSession(session models.Session) error {
-	panic("not implemented")
+	result, err := sto.db().Collection(linksCollectionName).
+		UpdateOne(sto.newTimeoutContext(),
+			bson.M{"_id": id, "deletedAt": notDeleted},
+			bson.M{"$inc": bson.M{"fallbackHits": 1}})
+	if err != nil {
+		return fmt.Errorf("error updating link with id \"%s\":%w", id, err)
+	}
+
+	if result.MatchedCount == 0 {
+		return istorage.NewNotFoundError("links", "id", id)
+	}
+
+	return nil
 }
 
-func (sto *Storage) GetSession(id string) (models.Session, error) {
-	panic("not implemented")
+//keepingHits returns the expression of an update pipeline replacing an array of named items with the provided ones
+//Every item gets the hits of the current item with the same name, so the hits counted meanwhile are not lost
+func keepingHits(field string, items interface{}) bson.M {
+	currentHits := bson.M{"$map": bson.M{
+		"input": bson.M{"$filter": bson.M{
+			"input": bson.M{"$ifNull": bson.A{"$" + field, bson.A{}}},
+			"cond":  bson.M{"$eq": bson.A{"$$this.name", "$$item.name"}},
+		}},
+		"in": "$$this.hits",
+	}}
+	return bson.M{"$map": bson.M{
+		"input": bson.M{"$literal": items},
+		"as":    "item",
+		"in":    bson.M{"$mergeObjects": bson.A{"$$item", bson.M{"hits": bson.M{"$sum": currentHits}}}},
+	}}
 }
 
+func (sto *Storage) IncreaseLinkVariantHitCount(id, variant string) error {
+	return sto.increaseLinkItemHitCount(id, "variants", variant)
+}
 
-func (sto *Storage) ListSessions(ownerID string, limit, offset uint) ([]models.Session, error) {
-	panic("not implemented")
+func (sto *Storage) IncreaseLinkRuleHitCount(id, rule string) error {
+	return sto.increaseLinkItemHitCount(id, "rules", rule)
 }
 
+//increaseLinkItemHitCount increases the hits of a link and the ones of the item with the specified name in one of its arrays
+func (sto *Storage) increaseLinkItemHitCount(id, field, name string) error {
+	if id == "" || name == "" {
+		return istorage.NewNotFoundError("links", "id", id)
+	}
 
-func (sto *Storage) UpdateSessionToken(id string, tokenID string) error {
-	panic("not implemented")
+	result, err := sto.db().Collection(linksCollectionName).
+		UpdateOne(sto.newTimeoutContext(),
+			bson.M{"_id": id, field + ".name": name, "deletedAt": notDeleted},
+			bson.M{"$inc": bson.M{"hits": 1, field + ".$.hits": 1}})
+	if err != nil {
+		return fmt.Errorf("error updating link with id \"%s\":%w", id, err)
+	}
+
+	if result.MatchedCount == 0 {
+		return istorage.NewNotFoundError("links", "id", id)
+	}
+
+	return nil
 }
 
+func (sto *Storage) UpdateLinksOwner(items []models.LinkTransferItem, ownerID string) error {
+	if len(items) == 0 {
+		return istorage.NewNotFoundError("links", "id", "")
+	}
 
-func (sto *Storage) DeleteSession(id string) error {
-	panic("not implemented")
+	ids := make([]string, len(items))
+	owned := make(bson.A, len(items))
+	for i, item := range items {
+		ids[i] = item.LinkID
+		owned[i] = bson.M{"_id": item.LinkID, "ownerId": item.PreviousOwnerID}
+	}
+	collection := sto.db().Collection(linksCollectionName)
+	result, err := collection.UpdateMany(sto.newTimeoutContext(),
+		bson.M{"$or": owned, "deletedAt": notDeleted},
+		bson.M{"$set": bson.M{"ownerId": ownerID}})
+	if err != nil {
+		return fmt.Errorf("error updating the owner of the links %v:%w", ids, err)
+	}
+	if result.MatchedCount == int64(len(items)) {
+		return nil
+	}
+
+	//Some of the links changed hands or were deleted in the meantime, so the ones already moved are given back
+	for _, item := range items {
+		_, err = collection.UpdateOne(sto.newTimeoutContext(),
+			bson.M{"_id": item.LinkID, "ownerId": ownerID},
+			bson.M{"$set": bson.M{"ownerId": item.PreviousOwnerID}})
+		if err != nil {
+			return fmt.Errorf("error restoring the owner of the link with id \"%s\":%w", item.LinkID, err)
+		}
+	}
+	count, err := collection.CountDocuments(sto.newTimeoutContext(), bson.M{"_id": bson.M{"$in": ids}, "deletedAt": notDeleted})
+	if err != nil {
+		return fmt.Errorf("error updating the owner of the links %v:%w", ids, err)
+	}
+	if count == 0 {
+		return istorage.NewNotFoundError("links", "id", fmt.Sprint(ids))
+	}
+	return istorage.NewConflictError("links", fmt.Sprint(ids))
+}
+
+func (sto *Storage) CountLinks(ownerID string, createdSince int64) (uint, error) {
+	filter := make(bson.M)
+	if ownerID != "" {
+		filter["ownerId"] = ownerID
+	}
+	if createdSince != 0 {
+		filter["createdAt"] = bson.M{"$gte": createdSince}
+	}
+	count, err := sto.db().Collection(linksCollectionName).CountDocuments(sto.newTimeoutContext(), filter)
+	if err != nil {
+		return 0, fmt.Errorf("error counting links owned by \"%s\":%w", ownerID, err)
+	}
+
+	return uint(count), nil
+}
+
+func (sto *Storage) UpdateLinkHealth(id, content string, health models.LinkHealth) error {
+	if id == "" {
+		return istorage.NewNotFoundError("links", "id", "")
+	}
+
+	collection := sto.db().Collection(linksCollectionName)
+	result, err := collection.UpdateOne(sto.newTimeoutContext(),
+		bson.M{"_id": id, "content": content},
+		bson.M{"$set": bson.M{"health": health}})
+	if err != nil {
+		return fmt.Errorf("error updating link with id \"%s\":%w", id, err)
+	}
+
+	if result.MatchedCount == 0 {
+		count, err := collection.CountDocuments(sto.newTimeoutContext(), bson.M{"_id": id})
+		if err != nil {
+			return fmt.Errorf("error updating link with id \"%s\":%w", id, err)
+		}
+		if count == 0 {
+			return istorage.NewNotFoundError("links", "id", id)
+		}
+		return istorage.NewConflictError("links", id)
+	}
+
+	return nil
+}
+
+func (sto *Storage) ListBrokenLinks(ownerID string, limit, offset uint) ([]models.Link, error) {
+	filter := bson.M{"$or": bson.A{
+		bson.M{"health.dead": true},
+		bson.M{"health.hostChanged": true},
+	}, "deletedAt": notDeleted}
+	options := mongoOptions.Find()
+	options.SetSort(bson.M{"health.checkedAt": -1})
+	if limit != 0 {
+		options.SetLimit(int64(limit))
+	}
+	if offset != 0 {
+		options.SetSkip(int64(offset))
+	}
+	if ownerID != "" {
+		filter["ownerId"] = ownerID
+	}
+	ctx := sto.newTimeoutContext()
+	cursor, err := sto.db().Collection(linksCollectionName).Find(ctx, filter, options)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var links []models.Link
+	err = cursor.All(ctx, &links)
+	return links, err
+}
+
+func (sto *Storage) TrashLink(id string, deletedAt int64) error {
+	return sto.trash(linksCollectionName, "links", id, deletedAt)
+}
+
+func (sto *Storage) RestoreLink(id string) error {
+	return sto.restore(linksCollectionName, "links", id)
+}
+
+func (sto *Storage) GetTrashedLink(id string) (link models.Link, err error) {
+	filter := bson.M{"$or": bson.A{bson.M{"_id": id}, bson.M{"aliases": id}}, "deletedAt": bson.M{"$exists": true}}
+	result := sto.db().Collection(linksCollectionName).FindOne(sto.newTimeoutContext(), filter)
+	err = result.Err()
+
+	if err == mongo.ErrNoDocuments {
+		err = istorage.NewNotFoundError("link", "ID", id)
+	}
+	if err != nil {
+		err = fmt.Errorf("error searching deleted link with id \"%s\":%w", id, err)
+		return
+	}
+	if err = result.Decode(&link); err != nil {
+		err = fmt.Errorf("error deconding link with id \"%s\":%w", id, err)
+		return
+	}
+	return
+}
+
+func (sto *Storage) ListTrashedLinks(ownerID string, limit, offset uint) ([]models.Link, error) {
+	filter := bson.M{"deletedAt": bson.M{"$exists": true}}
+	if ownerID != "" {
+		filter["ownerId"] = ownerID
+	}
+	options := mongoOptions.Find()
+	options.SetSort(bson.M{"deletedAt": -1})
+	if limit != 0 {
+		options.SetLimit(int64(limit))
+	}
+	if offset != 0 {
+		options.SetSkip(int64(offset))
+	}
+	ctx := sto.newTimeoutContext()
+	cursor, err := sto.db().Collection(linksCollectionName).Find(ctx, filter, options)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var links []models.Link
+	err = cursor.All(ctx, &links)
+	return links, err
+}
+
+func (sto *Storage) PurgeLinks(deletedBefore int64) (uint, error) {
+	ctx := sto.newTimeoutContext()
+	filter := bson.M{"deletedAt": bson.M{"$lt": deletedBefore}}
+	cursor, err := sto.db().Collection(linksCollectionName).
+		Find(ctx, filter, mongoOptions.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return 0, fmt.Errorf("error searching the links deleted before %d:%w", deletedBefore, err)
+	}
+	defer cursor.Close(ctx)
+	var links []models.Link
+	if err = cursor.All(ctx, &links); err != nil {
+		return 0, fmt.Errorf("error searching the links deleted before %d:%w", deletedBefore, err)
+	}
+	//The links are deleted one by one along with everything keyed by their IDs, so they can be reused from scratch
+	var purged uint
+	for _, link := range links {
+		err = sto.deleteLink(bson.M{"_id": link.ID, "deletedAt": bson.M{"$lt": deletedBefore}})
+		if errors.As(err, &istorage.NotFoundError{}) {
+			continue
+		}
+		if err != nil {
+			return purged, fmt.Errorf("error purging the link \"%s\":%w", link.ID, err)
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+//trash marks the not deleted element with the specified ID of a collection as deleted
+func (sto *Storage) trash(collection, model, id string, deletedAt int64) error {
+	if id == "" {
+		return istorage.NewNotFoundError(model, "id", "")
+	}
+
+	result, err := sto.db().Collection(collection).
+		UpdateOne(sto.newTimeoutContext(),
+			bson.M{"_id": id, "deletedAt": notDeleted},
+			bson.M{"$set": bson.M{"deletedAt": deletedAt}})
+	if err != nil {
+		return fmt.Errorf("error deleting %s with id \"%s\":%w", model, id, err)
+	}
+
+	if result.MatchedCount == 0 {
+		return istorage.NewNotFoundError(model, "id", id)
+	}
+
+	return nil
+}
+
+//restore removes the deleted mark of the element with the specified ID of a collection
+func (sto *Storage) restore(collection, model, id string) error {
+	if id == "" {
+		return istorage.NewNotFoundError(model, "id", "")
+	}
+
+	result, err := sto.db().Collection(collection).
+		UpdateOne(sto.newTimeoutContext(),
+			bson.M{"_id": id, "deletedAt": bson.M{"$exists": true}},
+			bson.M{"$unset": bson.M{"deletedAt": ""}})
+	if err != nil {
+		return fmt.Errorf("error restoring %s with id \"%s\":%w", model, id, err)
+	}
+
+	if result.MatchedCount == 0 {
+		return istorage.NewNotFoundError(model, "id", id)
+	}
+
+	return nil
+}
+
+//purge removes the elements of a collection deleted before the specified Unix EPOCH
+func (sto *Storage) purge(collection string, deletedBefore int64) (uint, error) {
+	result, err := sto.db().Collection(collection).
+		DeleteMany(sto.newTimeoutContext(), bson.M{"deletedAt": bson.M{"$lt": deletedBefore}})
+	if err != nil {
+		return 0, fmt.Errorf("error purging the %s deleted before %d:%w", collection, deletedBefore, err)
+	}
+
+	return uint(result.DeletedCount), nil
+}
+
+//Link transfer related methods
+
+func (sto *Storage) SaveLinkTransfer(transfer models.LinkTransfer) error {
+	_, err := sto.db().Collection(linkTransfersCollectionName).InsertOne(sto.newTimeoutContext(), &transfer)
+	if err != nil {
+		//TODO test for already exists error
+		return err
+	}
+
+	return nil
+}
+
+func (sto *Storage) GetLinkTransfer(id string) (transfer models.LinkTransfer, err error) {
+	result := sto.db().Collection(linkTransfersCollectionName).FindOne(sto.newTimeoutContext(), bson.M{"_id": id})
+	err = result.Err()
+
+	if err == mongo.ErrNoDocuments {
+		err = istorage.NewNotFoundError("link transfer", "ID", id)
+	}
+	if err != nil {
+		err = fmt.Errorf("error searching link transfer with id \"%s\":%w", id, err)
+		return
+	}
+	if err = result.Decode(&transfer); err != nil {
+		err = fmt.Errorf("error deconding link transfer with id \"%s\":%w", id, err)
+		return
+	}
+	return
+}
+
+func (sto *Storage) ListLinkTransfers(userID string, limit, offset uint) ([]models.LinkTransfer, error) {
+	filter := make(bson.M)
+	options := mongoOptions.Find()
+	options.SetSort(bson.M{"createdAt": -1})
+	if limit != 0 {
+		options.SetLimit(int64(limit))
+	}
+	if offset != 0 {
+		options.SetSkip(int64(offset))
+	}
+	if userID != "" {
+		filter["$or"] = bson.A{
+			bson.M{"requesterId": userID},
+			bson.M{"toId": userID},
+			bson.M{"items.previousOwnerId": userID},
+		}
+	}
+	ctx := sto.newTimeoutContext()
+	cursor, err := sto.db().Collection(linkTransfersCollectionName).Find(ctx, filter, options)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var transfers []models.LinkTransfer
+	err = cursor.All(ctx, &transfers)
+	return transfers, err
+}
+
+func (sto *Storage) UpdateLinkTransferStatus(id string, status models.LinkTransferStatus, resolvedAt int64) error {
+	if id == "" {
+		return istorage.NewNotFoundError("link transfers", "id", "")
+	}
+
+	collection := sto.db().Collection(linkTransfersCollectionName)
+	result, err := collection.UpdateOne(sto.newTimeoutContext(),
+		bson.M{"_id": id, "status": models.LinkTransferPending},
+		bson.M{"$set": bson.M{"status": status, "resolvedAt": resolvedAt}})
+	if err != nil {
+		return fmt.Errorf("error updating link transfer with id \"%s\":%w", id, err)
+	}
+
+	if result.MatchedCount == 0 {
+		count, err := collection.CountDocuments(sto.newTimeoutContext(), bson.M{"_id": id})
+		if err != nil {
+			return fmt.Errorf("error updating link transfer with id \"%s\":%w", id, err)
+		}
+		if count == 0 {
+			return istorage.NewNotFoundError("link transfers", "id", id)
+		}
+		return istorage.NewConflictError("link transfer", id)
+	}
+
+	return nil
+}
+
+//Link version related methods
+
+func (sto *Storage) SaveLinkVersion(version models.LinkVersion) error {
+	_, err := sto.db().Collection(linkVersionsCollectionName).InsertOne(sto.newTimeoutContext(), &version)
+	if isDuplicateKeyError(err) {
+		return &istorage.AlreadyExistsError{Model: "link version", Field: "ID"}
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (sto *Storage) GetLinkVersion(id string) (version models.LinkVersion, err error) {
+	result := sto.db().Collection(linkVersionsCollectionName).FindOne(sto.newTimeoutContext(), bson.M{"_id": id})
+	err = result.Err()
+
+	if err == mongo.ErrNoDocuments {
+		err = istorage.NewNotFoundError("link version", "ID", id)
+	}
+	if err != nil {
+		err = fmt.Errorf("error searching link version with id \"%s\":%w", id, err)
+		return
+	}
+	if err = result.Decode(&version); err != nil {
+		err = fmt.Errorf("error deconding link version with id \"%s\":%w", id, err)
+		return
+	}
+	return
+}
+
+func (sto *Storage) ListLinkVersions(linkID string, limit, offset uint) ([]models.LinkVersion, error) {
+	options := mongoOptions.Find()
+	options.SetSort(bson.M{"number": -1})
+	if limit != 0 {
+		options.SetLimit(int64(limit))
+	}
+	if offset != 0 {
+		options.SetSkip(int64(offset))
+	}
+	ctx := sto.newTimeoutContext()
+	cursor, err := sto.db().Collection(linkVersionsCollectionName).Find(ctx, bson.M{"linkId": linkID}, options)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var versions []models.LinkVersion
+	err = cursor.All(ctx, &versions)
+	return versions, err
+}
+func (sto *Storage) DeleteLinkVersion(id string) error {
+	result, err := sto.db().Collection(linkVersionsCollectionName).DeleteOne(sto.newTimeoutContext(), bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("error removing the link version with id \"%s\":%w", id, err)
+	}
+	if result.DeletedCount == 0 {
+		return istorage.NewNotFoundError("link version", "ID", id)
+	}
+
+	return nil
+}
+
+//Audit related methods
+
+func (sto *Storage) SaveAuditRecord(record models.AuditRecord) error {
+	_, err := sto.db().Collection(auditRecordsCollectionName).InsertOne(sto.newTimeoutContext(), &record)
+	if isDuplicateKeyError(err) {
+		return &istorage.AlreadyExistsError{Model: "audit record", Field: "ID"}
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (sto *Storage) ListAuditRecords(filter models.AuditFilter, limit, offset uint) ([]models.AuditRecord, error) {
+	query := bson.M{}
+	if filter.ActorID != "" {
+		query["actorId"] = filter.ActorID
+	}
+	if filter.Action != "" {
+		query["action"] = filter.Action
+	}
+	if filter.TargetType != "" {
+		query["targetType"] = filter.TargetType
+	}
+	if filter.TargetID != "" {
+		query["targetId"] = filter.TargetID
+	}
+	if filter.DeniedOnly {
+		query["denied"] = true
+	}
+	if filter.Since != 0 || filter.Until != 0 {
+		createdAt := bson.M{}
+		if filter.Since != 0 {
+			createdAt["$gte"] = filter.Since
+		}
+		if filter.Until != 0 {
+			createdAt["$lt"] = filter.Until
+		}
+		query["createdAt"] = createdAt
+	}
+
+	options := mongoOptions.Find()
+	options.SetSort(bson.M{"number": 1})
+	if limit != 0 {
+		options.SetLimit(int64(limit))
+	}
+	if offset != 0 {
+		options.SetSkip(int64(offset))
+	}
+	ctx := sto.newTimeoutContext()
+	cursor, err := sto.db().Collection(auditRecordsCollectionName).Find(ctx, query, options)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var records []models.AuditRecord
+	err = cursor.All(ctx, &records)
+	return records, err
+}
+
+//Webhook related methods
+
+func (sto *Storage) SaveWebhook(webhook models.Webhook) error {
+	_, err := sto.db().Collection(webhooksCollectionName).InsertOne(sto.newTimeoutContext(), &webhook)
+	if isDuplicateKeyError(err) {
+		return &istorage.AlreadyExistsError{Model: "webhook", Field: "ID"}
+	}
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (sto *Storage) GetWebhook(id string) (webhook models.Webhook, err error) {
+	result := sto.db().Collection(webhooksCollectionName).FindOne(sto.newTimeoutContext(), bson.M{"_id": id})
+	err = result.Err()
+
+	if err == mongo.ErrNoDocuments {
+		err = istorage.NewNotFoundError("webhook", "ID", id)
+	}
+	if err != nil {
+		err = fmt.Errorf("error searching webhook with id \"%s\":%w", id, err)
+		return
+	}
+	if err = result.Decode(&webhook); err != nil {
+		err = fmt.Errorf("error deconding webhook with id \"%s\":%w", id, err)
+		return
+	}
+	return
+}
+
+func (sto *Storage) ListWebhooks(ownerID string, limit, offset uint) ([]models.Webhook, error) {
+	filter := bson.M{}
+	if ownerID != "" {
+		filter["ownerId"] = ownerID
+	}
+	options := mongoOptions.Find()
+	options.SetSort(bson.M{"createdAt": 1})
+	if limit != 0 {
+		options.SetLimit(int64(limit))
+	}
+	if offset != 0 {
+		options.SetSkip(int64(offset))
+	}
+	return sto.findWebhooks(filter, options)
+}
+
+func (sto *Storage) ListWebhooksByEvent(event models.WebhookEvent, ownerID string) ([]models.Webhook, error) {
+	owners := bson.A{""}
+	if ownerID != "" {
+		owners = append(owners, ownerID)
+	}
+	return sto.findWebhooks(bson.M{"events": event, "ownerId": bson.M{"$in": owners}}, mongoOptions.Find())
+}
+
+func (sto *Storage) findWebhooks(filter bson.M, options *mongoOptions.FindOptions) ([]models.Webhook, error) {
+	ctx := sto.newTimeoutContext()
+	cursor, err := sto.db().Collection(webhooksCollectionName).Find(ctx, filter, options)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var webhooks []models.Webhook
+	err = cursor.All(ctx, &webhooks)
+	return webhooks, err
+}
+
+func (sto *Storage) DeleteWebhook(id string) error {
+	result, err := sto.db().Collection(webhooksCollectionName).DeleteOne(sto.newTimeoutContext(), bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("error removing the webhook with id \"%s\":%w", id, err)
+	}
+	if result.DeletedCount == 0 {
+		return istorage.NewNotFoundError("webhook", "ID", id)
+	}
+
+	return nil
+}
+
+func (sto *Storage) SaveWebhookDelivery(delivery models.WebhookDelivery) error {
+	options := mongoOptions.Replace().SetUpsert(true)
+	_, err := sto.db().Collection(webhookDeliveriesCollectionName).
+		ReplaceOne(sto.newTimeoutContext(), bson.M{"_id": delivery.ID}, &delivery, options)
+	if err != nil {
+		return fmt.Errorf("error saving the webhook delivery with id \"%s\":%w", delivery.ID, err)
+	}
+
+	return nil
+}
+
+func (sto *Storage) GetWebhookDelivery(id string) (delivery models.WebhookDelivery, err error) {
+	result := sto.db().Collection(webhookDeliveriesCollectionName).FindOne(sto.newTimeoutContext(), bson.M{"_id": id})
+	err = result.Err()
+
+	if err == mongo.ErrNoDocuments {
+		err = istorage.NewNotFoundError("webhook delivery", "ID", id)
+	}
+	if err != nil {
+		err = fmt.Errorf("error searching webhook delivery with id \"%s\":%w", id, err)
+		return
+	}
+	if err = result.Decode(&delivery); err != nil {
+		err = fmt.Errorf("error deconding webhook delivery with id \"%s\":%w", id, err)
+		return
+	}
+	return
+}
+
+func (sto *Storage) ListWebhookDeliveries(webhookID string, limit, offset uint) ([]models.WebhookDelivery, error) {
+	options := mongoOptions.Find()
+	options.SetSort(bson.M{"createdAt": -1})
+	if limit != 0 {
+		options.SetLimit(int64(limit))
+	}
+	if offset != 0 {
+		options.SetSkip(int64(offset))
+	}
+	ctx := sto.newTimeoutContext()
+	cursor, err := sto.db().Collection(webhookDeliveriesCollectionName).Find(ctx, bson.M{"webhookId": webhookID}, options)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var deliveries []models.WebhookDelivery
+	err = cursor.All(ctx, &deliveries)
+	return deliveries, err
+}
+func (sto *Storage) ListPendingWebhookDeliveries(afterID string, limit uint) ([]models.WebhookDelivery, error) {
+	filter := bson.M{"status": models.WebhookDeliveryPending}
+	if afterID != "" {
+		filter["_id"] = bson.M{"$gt": afterID}
+	}
+	options := mongoOptions.Find().SetSort(bson.M{"_id": 1})
+	if limit != 0 {
+		options.SetLimit(int64(limit))
+	}
+	ctx := sto.newTimeoutContext()
+	cursor, err := sto.db().Collection(webhookDeliveriesCollectionName).Find(ctx, filter, options)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	var deliveries []models.WebhookDelivery
+	err = cursor.All(ctx, &deliveries)
+	return deliveries, err
+}
+
+//Quota related methods
+
+func (sto *Storage) SaveUserQuota(quota models.UserQuota) error {
+	options := mongoOptions.Replace().SetUpsert(true)
+	_, err := sto.db().Collection(quotasCollectionName).
+		ReplaceOne(sto.newTimeoutContext(), bson.M{"_id": quota.UserID}, &quota, options)
+	if err != nil {
+		return fmt.Errorf("error saving the quota of the user with id \"%s\":%w", quota.UserID, err)
+	}
+
+	return nil
+}
+
+func (sto *Storage) GetUserQuota(userID string) (quota models.UserQuota, err error) {
+	result := sto.db().Collection(quotasCollectionName).FindOne(sto.newTimeoutContext(), bson.M{"_id": userID})
+	err = result.Err()
+
+	if err == mongo.ErrNoDocuments {
+		err = istorage.NewNotFoundError("quota", "UserID", userID)
+	}
+	if err != nil {
+		err = fmt.Errorf("error searching the quota of the user with id \"%s\":%w", userID, err)
+		return
+	}
+	if err = result.Decode(&quota); err != nil {
+		err = fmt.Errorf("error deconding the quota of the user with id \"%s\":%w", userID, err)
+		return
+	}
+	return
+}
+
+func (sto *Storage) DeleteUserQuota(userID string) error {
+	if userID == "" {
+		return istorage.NewNotFoundError("quotas", "userId", "")
+	}
+	result, err := sto.db().Collection(quotasCollectionName).DeleteOne(sto.newTimeoutContext(), bson.M{"_id": userID})
+	if err != nil {
+		return fmt.Errorf("error removing the quota of the user with id \"%s\":%w", userID, err)
+	}
+	if result.DeletedCount == 0 {
+		return istorage.NewNotFoundError("quotas", "userId", userID)
+	}
+
+	return nil
+}
+
+//Counter related methods
+
+func (sto *Storage) IncreaseCounter(name string) (uint64, error) {
+	options := mongoOptions.FindOneAndUpdate().
+		SetUpsert(true).
+		SetReturnDocument(mongoOptions.After)
+	result := sto.db().Collection(countersCollectionName).
+		FindOneAndUpdate(sto.newTimeoutContext(),
+			bson.M{"_id": name},
+			bson.M{"$inc": bson.M{"value": int64(1)}},
+			options)
+	var counter struct {
+		Value int64 `bson:"value"`
+	}
+	if err := result.Decode(&counter); err != nil {
+		return 0, fmt.Errorf("error increasing counter \"%s\":%w", name, err)
+	}
+
+	return uint64(counter.Value), nil
+}
+
+func (sto *Storage) GetCounter(name string) (uint64, error) {
+	result := sto.db().Collection(countersCollectionName).FindOne(sto.newTimeoutContext(), bson.M{"_id": name})
+	var counter struct {
+		Value int64 `bson:"value"`
+	}
+	if err := result.Decode(&counter); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("error getting counter \"%s\":%w", name, err)
+	}
+
+	return uint64(counter.Value), nil
+}
+
+//Rate limit related methods
+
+func (sto *Storage) GetRateLimitBucket(key string) (bucket models.RateLimitBucket, err error) {
+	result := sto.db().Collection(rateLimitBucketsCollectionName).FindOne(sto.newTimeoutContext(), bson.M{"_id": key})
+	err = result.Err()
+
+	if err == mongo.ErrNoDocuments {
+		err = istorage.NewNotFoundError("rate limit bucket", "Key", key)
+	}
+	if err != nil {
+		err = fmt.Errorf("error searching rate limit bucket with key \"%s\":%w", key, err)
+		return
+	}
+	if err = result.Decode(&bucket); err != nil {
+		err = fmt.Errorf("error deconding rate limit bucket with key \"%s\":%w", key, err)
+		return
+	}
+	return
+}
+
+func (sto *Storage) SaveRateLimitBucket(bucket models.RateLimitBucket, previousUpdatedAt int64) error {
+	collection := sto.db().Collection(rateLimitBucketsCollectionName)
+	if previousUpdatedAt == 0 {
+		_, err := collection.InsertOne(sto.newTimeoutContext(), &bucket)
+		if isDuplicateKeyError(err) {
+			return istorage.NewConflictError("rate limit bucket", bucket.Key)
+		}
+		if err != nil {
+			return fmt.Errorf("error saving rate limit bucket with key \"%s\":%w", bucket.Key, err)
+		}
+		return nil
+	}
+
+	result, err := collection.ReplaceOne(sto.newTimeoutContext(),
+		bson.M{"_id": bucket.Key, "updatedAt": previousUpdatedAt},
+		&bucket)
+	if err != nil {
+		return fmt.Errorf("error saving rate limit bucket with key \"%s\":%w", bucket.Key, err)
+	}
+	if result.MatchedCount == 0 {
+		return istorage.NewConflictError("rate limit bucket", bucket.Key)
+	}
+
+	return nil
+}
+
+// Session related methods
+
+func (sto *Storage) SaveSession(session models.Session) error {
+	_, err := sto.db().Collection(sessionsCollectionName).InsertOne(sto.newTimeoutContext(), &session)
+	if isDuplicateKeyError(err) {
+		return &istorage.AlreadyExistsError{Model: "session", Field: "ID"}
+	}
+	if err != nil {
+		return fmt.Errorf("error saving the session with id \"%s\":%w", session.ID, err)
+	}
+
+	return nil
+}
+
+func (sto *Storage) GetSession(id string) (session models.Session, err error) {
+	result := sto.db().Collection(sessionsCollectionName).FindOne(sto.newTimeoutContext(), bson.M{"_id": id})
+	err = result.Err()
+
+	if err == mongo.ErrNoDocuments {
+		err = istorage.NewNotFoundError("session", "ID", id)
+	}
+	if err != nil {
+		err = fmt.Errorf("error searching session with id \"%s\":%w", id, err)
+		return
+	}
+	if err = result.Decode(&session); err != nil {
+		err = fmt.Errorf("error deconding session with id \"%s\":%w", id, err)
+		return
+	}
+	return
+}
+
+
+func (sto *Storage) ListSessions(ownerID string, limit, offset uint) ([]models.Session, error) {
+	panic("not implemented")
+}
+
+
+func (sto *Storage) UpdateSessionToken(id string, tokenID string) error {
+	panic("not implemented")
+}
+
+
+func (sto *Storage) DeleteSession(id string) error {
+	result, err := sto.db().Collection(sessionsCollectionName).DeleteOne(sto.newTimeoutContext(), bson.M{"_id": id})
+	if err != nil {
+		return fmt.Errorf("error removing the session with id \"%s\":%w", id, err)
+	}
+	if result.DeletedCount == 0 {
+		return istorage.NewNotFoundError("session", "ID", id)
+	}
+
+	return nil
 }
@@ -2,11 +2,14 @@ package mongo
 
 import (
 	"errors"
+	"github.com/nethruster/linksh/pkg/interfaces/link_repository"
 	istorage "github.com/nethruster/linksh/pkg/interfaces/storage"
 	"github.com/nethruster/linksh/pkg/interfaces/user_repository"
 	"github.com/nethruster/linksh/pkg/models"
 	"os"
 	"reflect"
+	"sort"
+	"sync"
 	"testing"
 	"time"
 )
@@ -229,8 +232,10 @@ func TestLinkRelatedMethods(t *testing.T) {
 	defer mongoSto.close()
 	sto = mongoSto
 
-	if err = mongoSto.client.Database(mongoSto.databaseName).Collection(linksCollectionName).Drop(mongoSto.newTimeoutContext()); err != nil {
-		t.Errorf("Error reseting the collection: %+v", err)
+	for _, collection := range []string{linksCollectionName, linkKeysCollectionName} {
+		if err = mongoSto.client.Database(mongoSto.databaseName).Collection(collection).Drop(mongoSto.newTimeoutContext()); err != nil {
+			t.Errorf("Error reseting the collection: %+v", err)
+		}
 	}
 
 	t.Run("save", func(t *testing.T) {
@@ -261,7 +266,15 @@ func TestLinkRelatedMethods(t *testing.T) {
 			t.Error(err)
 		}
 
-		//TODO check for collision
+		t.Run("conflict", func(t *testing.T) {
+			err = sto.SaveLink(link)
+			var conflictErr *istorage.AlreadyExistsError
+			if !errors.As(err, &conflictErr) {
+				t.Errorf("Expected conflic error, got %v: %v", reflect.TypeOf(err), err)
+			} else if conflictErr.Field != "ID" {
+				t.Errorf("Expected conflic in field ID but it was on field %s instead", conflictErr.Field)
+			}
+		})
 	})
 
 	t.Run("get", func(t *testing.T) {
@@ -313,6 +326,28 @@ func TestLinkRelatedMethods(t *testing.T) {
 			}
 		})
 
+		t.Run("after an ID", func(t *testing.T) {
+			first, err := sto.ListLinksAfter("", 1)
+			if err != nil {
+				t.Error(err)
+			}
+			if len(first) != 1 {
+				t.Fatalf("Expected 1 link, got %d", len(first))
+			}
+			rest, err := sto.ListLinksAfter(first[0].ID, 0)
+			if err != nil {
+				t.Error(err)
+			}
+			if len(rest) != len(links)-1 {
+				t.Errorf("Expected %d links after %s, got %d", len(links)-1, first[0].ID, len(rest))
+			}
+			for _, link := range rest {
+				if link.ID <= first[0].ID {
+					t.Errorf("The link %s is not after %s", link.ID, first[0].ID)
+				}
+			}
+		})
+
 		t.Run("ownerID set", func(t *testing.T) {
 				links, err = sto.ListLinks("abc",0,0)
 				if err != nil {
@@ -403,3 +438,1216 @@ func TestLinkRelatedMethods(t *testing.T) {
 		})
 	})
 }
+
+func TestLinkTransferRelatedMethods(t *testing.T) {
+	var sto istorage.IStorage
+	var err error
+
+	mongoSto, err := newStorage()
+	if err != nil {
+		panic("CDatabase connection failed: " + err.Error())
+	}
+	defer mongoSto.close()
+	sto = mongoSto
+
+	for _, collection := range []string{linksCollectionName, linkKeysCollectionName, linkTransfersCollectionName} {
+		if err = mongoSto.client.Database(mongoSto.databaseName).Collection(collection).Drop(mongoSto.newTimeoutContext()); err != nil {
+			t.Errorf("Error reseting the collection: %+v", err)
+		}
+	}
+
+	t.Run("update owner", func(t *testing.T) {
+		for _, id := range []string{"abc", "abcd"} {
+			if err = sto.SaveLink(models.Link{ID: id, Content: "example.tld", OwnerID: "abc"}); err != nil {
+				t.Error(err)
+			}
+		}
+
+		err = sto.UpdateLinksOwner([]models.LinkTransferItem{{LinkID: "abc", PreviousOwnerID: "abc"}, {LinkID: "abcd", PreviousOwnerID: "abc"}}, "xyz")
+		if err != nil {
+			t.Error(err)
+		}
+		links, err := sto.ListLinks("xyz", 0, 0)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(links) != 2 {
+			t.Errorf("Expected 2 links owned by \"xyz\", got %v", len(links))
+		}
+
+		t.Run("not found", func(t *testing.T) {
+			err = sto.UpdateLinksOwner([]models.LinkTransferItem{{LinkID: "404"}}, "xyz")
+			if !errors.As(err, &istorage.NotFoundError{}) {
+				t.Errorf("Expected NotFound got %v: %v", reflect.TypeOf(err), err)
+			}
+		})
+
+		t.Run("changed hands", func(t *testing.T) {
+			items := []models.LinkTransferItem{{LinkID: "abc", PreviousOwnerID: "xyz"}, {LinkID: "abcd", PreviousOwnerID: "abc"}}
+			err = sto.UpdateLinksOwner(items, "other")
+			if !errors.As(err, &istorage.ConflictError{}) {
+				t.Errorf("Expected Conflict got %v: %v", reflect.TypeOf(err), err)
+			}
+			links, err := sto.ListLinks("xyz", 0, 0)
+			if err != nil {
+				t.Error(err)
+			}
+			if len(links) != 2 {
+				t.Errorf("The links should keep their owners when any of them changed hands, got %+v", links)
+			}
+		})
+	})
+
+	t.Run("save", func(t *testing.T) {
+		transfer := models.LinkTransfer{
+			ID:          "abc",
+			Items:       []models.LinkTransferItem{{LinkID: "abc", PreviousOwnerID: "abc"}},
+			ToID:        "xyz",
+			RequesterID: "abc",
+			Status:      models.LinkTransferPending,
+			CreatedAt:   100,
+		}
+		if err = sto.SaveLinkTransfer(transfer); err != nil {
+			t.Error(err)
+		}
+
+		transfer.ID += "d"
+		transfer.ToID = "abcd"
+		transfer.RequesterID = ""
+		transfer.CreatedAt++
+		if err = sto.SaveLinkTransfer(transfer); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("get", func(t *testing.T) {
+		transfer, err := sto.GetLinkTransfer("abc")
+		if err != nil {
+			t.Error(err)
+		}
+		if len(transfer.Items) != 1 || transfer.Items[0].LinkID != "abc" {
+			t.Errorf("The transfer items were not the expected %+v", transfer.Items)
+		}
+
+		_, err = sto.GetLinkTransfer("404")
+		if !errors.As(err, &istorage.NotFoundError{}) {
+			t.Errorf("Expected NotFound got %v: %v", reflect.TypeOf(err), err)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		transfers, err := sto.ListLinkTransfers("", 0, 0)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(transfers) != 2 {
+			t.Errorf("Expected 2 transfers, got %v", len(transfers))
+		}
+
+		transfers, err = sto.ListLinkTransfers("xyz", 0, 0)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(transfers) != 1 || transfers[0].ID != "abc" {
+			t.Errorf("Expected only the transfer received by \"xyz\", got %+v", transfers)
+		}
+
+		transfers, err = sto.ListLinkTransfers("abc", 1, 0)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(transfers) != 1 {
+			t.Errorf("The limit was set to 1 but %v results were returned", len(transfers))
+		}
+	})
+
+	t.Run("update status", func(t *testing.T) {
+		err = sto.UpdateLinkTransferStatus("abc", models.LinkTransferCompleted, 200)
+		if err != nil {
+			t.Error(err)
+		}
+		transfer, err := sto.GetLinkTransfer("abc")
+		if err != nil {
+			panic(err)
+		}
+		if transfer.Status != models.LinkTransferCompleted || transfer.ResolvedAt != 200 {
+			t.Errorf("The transfer was not updated, got status %s resolved at %v", transfer.Status, transfer.ResolvedAt)
+		}
+
+		t.Run("not found", func(t *testing.T) {
+			err = sto.UpdateLinkTransferStatus("404", models.LinkTransferRejected, 200)
+			if !errors.As(err, &istorage.NotFoundError{}) {
+				t.Errorf("Expected NotFound got %v: %v", reflect.TypeOf(err), err)
+			}
+		})
+
+		t.Run("not pending", func(t *testing.T) {
+			err = sto.UpdateLinkTransferStatus("abc", models.LinkTransferRejected, 300)
+			if !errors.As(err, &istorage.ConflictError{}) {
+				t.Errorf("Expected Conflict got %v: %v", reflect.TypeOf(err), err)
+			}
+			transfer, err := sto.GetLinkTransfer("abc")
+			if err != nil {
+				panic(err)
+			}
+			if transfer.Status != models.LinkTransferCompleted {
+				t.Errorf("A resolved transfer should not be resolved again, got status %s", transfer.Status)
+			}
+		})
+	})
+}
+
+func TestQuotaRelatedMethods(t *testing.T) {
+	var sto istorage.IStorage
+	var err error
+
+	mongoSto, err := newStorage()
+	if err != nil {
+		panic("CDatabase connection failed: " + err.Error())
+	}
+	defer mongoSto.close()
+	sto = mongoSto
+
+	for _, collection := range []string{linksCollectionName, linkKeysCollectionName, quotasCollectionName} {
+		if err = mongoSto.client.Database(mongoSto.databaseName).Collection(collection).Drop(mongoSto.newTimeoutContext()); err != nil {
+			t.Errorf("Error reseting the collection: %+v", err)
+		}
+	}
+
+	t.Run("count links", func(t *testing.T) {
+		for i, id := range []string{"abc", "abcd", "abcde"} {
+			if err = sto.SaveLink(models.Link{ID: id, Content: "example.tld", CreatedAt: int64(100 + i), OwnerID: "abc"}); err != nil {
+				t.Error(err)
+			}
+		}
+		if err = sto.SaveLink(models.Link{ID: "xyz", Content: "example.tld", CreatedAt: 200, OwnerID: "xyz"}); err != nil {
+			t.Error(err)
+		}
+
+		count, err := sto.CountLinks("", 0)
+		if err != nil {
+			t.Error(err)
+		}
+		if count != 4 {
+			t.Errorf("Expected 4 links, got %v", count)
+		}
+
+		count, err = sto.CountLinks("abc", 101)
+		if err != nil {
+			t.Error(err)
+		}
+		if count != 2 {
+			t.Errorf("Expected 2 links owned by \"abc\" created since 101, got %v", count)
+		}
+	})
+
+	t.Run("save", func(t *testing.T) {
+		quota := models.UserQuota{UserID: "abc", Quota: models.Quota{MaxLinks: 10}}
+		if err = sto.SaveUserQuota(quota); err != nil {
+			t.Error(err)
+		}
+
+		quota.MaxLinksPerDay = 5
+		if err = sto.SaveUserQuota(quota); err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("get", func(t *testing.T) {
+		quota, err := sto.GetUserQuota("abc")
+		if err != nil {
+			t.Error(err)
+		}
+		if quota.MaxLinks != 10 || quota.MaxLinksPerDay != 5 {
+			t.Errorf("The quota was not the expected %+v", quota)
+		}
+
+		_, err = sto.GetUserQuota("404")
+		if !errors.As(err, &istorage.NotFoundError{}) {
+			t.Errorf("Expected NotFound got %v: %v", reflect.TypeOf(err), err)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		err = sto.DeleteUserQuota("abc")
+		if err != nil {
+			t.Error(err)
+		}
+
+		if _, err = sto.GetUserQuota("abc"); !errors.As(err, &istorage.NotFoundError{}) {
+			t.Error("The quota was not deleted from the database")
+		}
+
+		t.Run("not found", func(t *testing.T) {
+			err = sto.DeleteUserQuota("404")
+			if !errors.As(err, &istorage.NotFoundError{}) {
+				t.Errorf("Expected NotFound got %v: %v", reflect.TypeOf(err), err)
+			}
+		})
+	})
+}
+
+func TestRateLimitRelatedMethods(t *testing.T) {
+	var sto istorage.IStorage
+	var err error
+
+	mongoSto, err := newStorage()
+	if err != nil {
+		panic("CDatabase connection failed: " + err.Error())
+	}
+	defer mongoSto.close()
+	sto = mongoSto
+
+	if err = mongoSto.client.Database(mongoSto.databaseName).Collection(rateLimitBucketsCollectionName).Drop(mongoSto.newTimeoutContext()); err != nil {
+		t.Errorf("Error reseting the collection: %+v", err)
+	}
+
+	t.Run("save", func(t *testing.T) {
+		bucket := models.RateLimitBucket{Key: "ip:192.0.2.1", Tokens: 4, UpdatedAt: 100}
+		if err = sto.SaveRateLimitBucket(bucket, 0); err != nil {
+			t.Error(err)
+		}
+
+		t.Run("conflict on create", func(t *testing.T) {
+			err = sto.SaveRateLimitBucket(bucket, 0)
+			if !errors.As(err, &istorage.ConflictError{}) {
+				t.Errorf("Expected Conflict got %v: %v", reflect.TypeOf(err), err)
+			}
+		})
+
+		bucket.Tokens = 3
+		bucket.UpdatedAt = 200
+		if err = sto.SaveRateLimitBucket(bucket, 100); err != nil {
+			t.Error(err)
+		}
+
+		t.Run("conflict on update", func(t *testing.T) {
+			bucket.UpdatedAt = 300
+			err = sto.SaveRateLimitBucket(bucket, 100)
+			if !errors.As(err, &istorage.ConflictError{}) {
+				t.Errorf("Expected Conflict got %v: %v", reflect.TypeOf(err), err)
+			}
+		})
+	})
+
+	t.Run("get", func(t *testing.T) {
+		bucket, err := sto.GetRateLimitBucket("ip:192.0.2.1")
+		if err != nil {
+			t.Error(err)
+		}
+		if bucket.Tokens != 3 || bucket.UpdatedAt != 200 {
+			t.Errorf("The bucket was not the expected %+v", bucket)
+		}
+
+		_, err = sto.GetRateLimitBucket("404")
+		if !errors.As(err, &istorage.NotFoundError{}) {
+			t.Errorf("Expected NotFound got %v: %v", reflect.TypeOf(err), err)
+		}
+	})
+}
+
+func TestLinkHealthRelatedMethods(t *testing.T) {
+	var sto istorage.IStorage
+	var err error
+
+	mongoSto, err := newStorage()
+	if err != nil {
+		panic("CDatabase connection failed: " + err.Error())
+	}
+	defer mongoSto.close()
+	sto = mongoSto
+
+	for _, collection := range []string{linksCollectionName, linkKeysCollectionName} {
+		if err = mongoSto.client.Database(mongoSto.databaseName).Collection(collection).Drop(mongoSto.newTimeoutContext()); err != nil {
+			t.Errorf("Error reseting the collection: %+v", err)
+		}
+	}
+	for _, link := range []models.Link{
+		{ID: "abc", Content: "https://example.tld", OwnerID: "abc"},
+		{ID: "abcd", Content: "https://example.tld", OwnerID: "abc"},
+		{ID: "abcde", Content: "https://example.tld", OwnerID: "abcd"},
+	} {
+		if err = sto.SaveLink(link); err != nil {
+			t.Error(err)
+		}
+	}
+
+	t.Run("update", func(t *testing.T) {
+		health := models.LinkHealth{StatusCode: 404, FinalURL: "https://example.tld", Dead: true, CheckedAt: 100}
+		for _, id := range []string{"abc", "abcde"} {
+			if err = sto.UpdateLinkHealth(id, "https://example.tld", health); err != nil {
+				t.Error(err)
+			}
+		}
+		link, err := sto.GetLink("abc")
+		if err != nil {
+			panic(err)
+		}
+		if link.Health != health {
+			t.Errorf("The health was not updated, expected %+v got %+v", health, link.Health)
+		}
+
+		t.Run("not found", func(t *testing.T) {
+			err = sto.UpdateLinkHealth("404", "https://example.tld", health)
+			if !errors.As(err, &istorage.NotFoundError{}) {
+				t.Errorf("Expected NotFound got %v: %v", reflect.TypeOf(err), err)
+			}
+		})
+
+		t.Run("content changed", func(t *testing.T) {
+			err = sto.UpdateLinkHealth("abcd", "https://old.example.tld", health)
+			if !errors.As(err, &istorage.ConflictError{}) {
+				t.Errorf("Expected Conflict got %v: %v", reflect.TypeOf(err), err)
+			}
+			link, err := sto.GetLink("abcd")
+			if err != nil {
+				panic(err)
+			}
+			if link.Health != (models.LinkHealth{}) {
+				t.Errorf("The health of an outdated check was saved: %+v", link.Health)
+			}
+		})
+	})
+
+	t.Run("list broken", func(t *testing.T) {
+		links, err := sto.ListBrokenLinks("", 0, 0)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(links) != 2 {
+			t.Errorf("Expected 2 broken links, got %v", len(links))
+		}
+
+		links, err = sto.ListBrokenLinks("abc", 0, 0)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(links) != 1 || links[0].ID != "abc" {
+			t.Errorf("Expected only the broken link owned by \"abc\", got %+v", links)
+		}
+	})
+
+	t.Run("reset on content update", func(t *testing.T) {
+		if err = sto.UpdateLinkContent("abc", "https://example2.tld"); err != nil {
+			t.Error(err)
+		}
+		link, err := sto.GetLink("abc")
+		if err != nil {
+			panic(err)
+		}
+		if link.Health.CheckedAt != 0 {
+			t.Errorf("The health should be reset when the content changes, got %+v", link.Health)
+		}
+	})
+}
+
+func TestCounterRelatedMethods(t *testing.T) {
+	var sto istorage.IStorage
+	var err error
+
+	mongoSto, err := newStorage()
+	if err != nil {
+		panic("CDatabase connection failed: " + err.Error())
+	}
+	defer mongoSto.close()
+	sto = mongoSto
+
+	if err = mongoSto.client.Database(mongoSto.databaseName).Collection(countersCollectionName).Drop(mongoSto.newTimeoutContext()); err != nil {
+		t.Errorf("Error reseting the collection: %+v", err)
+	}
+
+	for _, expected := range []uint64{1, 2, 3} {
+		value, err := sto.IncreaseCounter("links")
+		if err != nil {
+			t.Error(err)
+		}
+		if value != expected {
+			t.Errorf("Expected the counter to be %v, got %v", expected, value)
+		}
+	}
+
+	value, err := sto.IncreaseCounter("other")
+	if err != nil {
+		t.Error(err)
+	}
+	if value != 1 {
+		t.Errorf("Each counter should be independent, expected 1 got %v", value)
+	}
+
+	for name, expected := range map[string]uint64{"links": 3, "404": 0} {
+		value, err = sto.GetCounter(name)
+		if err != nil {
+			t.Error(err)
+		}
+		if value != expected {
+			t.Errorf("Expected the counter %s to be %v, got %v", name, expected, value)
+		}
+	}
+}
+
+func TestLinkSettingsRelatedMethods(t *testing.T) {
+	var sto istorage.IStorage
+	var err error
+
+	mongoSto, err := newStorage()
+	if err != nil {
+		panic("CDatabase connection failed: " + err.Error())
+	}
+	defer mongoSto.close()
+	sto = mongoSto
+
+	for _, collection := range []string{linksCollectionName, linkKeysCollectionName} {
+		if err = mongoSto.client.Database(mongoSto.databaseName).Collection(collection).Drop(mongoSto.newTimeoutContext()); err != nil {
+			t.Errorf("Error reseting the collection: %+v", err)
+		}
+	}
+	for _, id := range []string{"abc", "abcd"} {
+		if err = sto.SaveLink(models.Link{ID: id, Content: "https://example.tld/{path}", OwnerID: "abc"}); err != nil {
+			t.Error(err)
+		}
+	}
+
+	t.Run("get many", func(t *testing.T) {
+		links, err := sto.GetLinks([]string{"abc", "abcd", "404"})
+		if err != nil {
+			t.Error(err)
+		}
+		if len(links) != 2 {
+			t.Errorf("Expected the 2 existing links, got %+v", links)
+		}
+	})
+
+	t.Run("update", func(t *testing.T) {
+		linkType := models.LinkTypePrefix
+		mode := models.RedirectInterstitial
+		payload := link_repository.UpdatePayload{ID: "abc", Type: &linkType, RedirectMode: &mode}
+		if err = sto.UpdateLink(payload); err != nil {
+			t.Error(err)
+		}
+		link, err := sto.GetLink("abc")
+		if err != nil {
+			panic(err)
+		}
+		if link.Type != models.LinkTypePrefix {
+			t.Errorf("The type was not updated, expected %s got %s", models.LinkTypePrefix, link.Type)
+		}
+		if link.RedirectMode != models.RedirectInterstitial {
+			t.Errorf("The redirect mode was not updated, expected %s got %s", models.RedirectInterstitial, link.RedirectMode)
+		}
+
+		t.Run("not found", func(t *testing.T) {
+			payload.ID = "404"
+			err = sto.UpdateLink(payload)
+			if !errors.As(err, &istorage.NotFoundError{}) {
+				t.Errorf("Expected NotFound got %v: %v", reflect.TypeOf(err), err)
+			}
+		})
+	})
+
+	t.Run("variant hits", func(t *testing.T) {
+		variants := []models.LinkVariant{{Name: "a", Content: "https://a.example.tld/", Weight: 1}, {Name: "b", Content: "https://b.example.tld/", Weight: 1}}
+		if err = sto.UpdateLink(link_repository.UpdatePayload{ID: "abcd", Variants: &variants}); err != nil {
+			t.Error(err)
+		}
+		if err = sto.IncreaseLinkVariantHitCount("abcd", "b"); err != nil {
+			t.Error(err)
+		}
+		link, err := sto.GetLink("abcd")
+		if err != nil {
+			panic(err)
+		}
+		if link.Hits != 1 || len(link.Variants) != 2 || link.Variants[0].Hits != 0 || link.Variants[1].Hits != 1 {
+			t.Errorf("The hit should be attributed to the variant b, got %+v", link)
+		}
+
+		t.Run("kept on update", func(t *testing.T) {
+			variants := []models.LinkVariant{{Name: "b", Content: "https://b.example.tld/new", Weight: 3, Hits: 100}, {Name: "c", Content: "$c", Weight: 1, Hits: 100}}
+			if err = sto.UpdateLink(link_repository.UpdatePayload{ID: "abcd", Variants: &variants}); err != nil {
+				t.Error(err)
+			}
+			link, err := sto.GetLink("abcd")
+			if err != nil {
+				panic(err)
+			}
+			if len(link.Variants) != 2 || link.Variants[0].Hits != 1 || link.Variants[0].Weight != 3 || link.Variants[1].Hits != 0 || link.Variants[1].Content != "$c" {
+				t.Errorf("The stored hits should be kept and the provided ones ignored, got %+v", link.Variants)
+			}
+		})
+
+		t.Run("not found", func(t *testing.T) {
+			err = sto.IncreaseLinkVariantHitCount("abcd", "c")
+			if !errors.As(err, &istorage.NotFoundError{}) {
+				t.Errorf("Expected NotFound got %v: %v", reflect.TypeOf(err), err)
+			}
+		})
+	})
+
+	t.Run("rule hits", func(t *testing.T) {
+		rules := []models.LinkRule{{Name: "stores", Platforms: []models.Platform{models.PlatformIOS}, Content: "https://example.tld/install"}}
+		if err = sto.UpdateLink(link_repository.UpdatePayload{ID: "abc", Rules: &rules}); err != nil {
+			t.Error(err)
+		}
+		if err = sto.IncreaseLinkRuleHitCount("abc", "stores"); err != nil {
+			t.Error(err)
+		}
+		link, err := sto.GetLink("abc")
+		if err != nil {
+			panic(err)
+		}
+		if link.Hits != 1 || len(link.Rules) != 1 || link.Rules[0].Hits != 1 || link.Rules[0].Platforms[0] != models.PlatformIOS {
+			t.Errorf("The hit should be attributed to the rule stores, got %+v", link)
+		}
+	})
+
+	t.Run("schedule", func(t *testing.T) {
+		activatesAt, deactivatesAt, fallback := int64(100), int64(200), "https://example.tld/soon"
+		payload := link_repository.UpdatePayload{ID: "abcd", ActivatesAt: &activatesAt, DeactivatesAt: &deactivatesAt, Fallback: &fallback}
+		if err = sto.UpdateLink(payload); err != nil {
+			t.Error(err)
+		}
+		link, err := sto.GetLink("abcd")
+		if err != nil {
+			panic(err)
+		}
+		if link.ActivatesAt != activatesAt || link.DeactivatesAt != deactivatesAt || link.Fallback != fallback {
+			t.Errorf("The schedule was not updated, got %+v", link)
+		}
+
+		if err = sto.IncreaseLinkFallbackHitCount("abcd"); err != nil {
+			t.Error(err)
+		}
+		if link, _ = sto.GetLink("abcd"); link.FallbackHits != 1 {
+			t.Errorf("The fallback hits were not increased, got %+v", link)
+		}
+	})
+
+	t.Run("suggestion keys", func(t *testing.T) {
+		if err = sto.UpdateLinkSuggestionKeys("abc", []string{"abc", "bc", "ac", "ab"}); err != nil {
+			t.Error(err)
+		}
+		if err = sto.UpdateLinkSuggestionKeys("abcd", []string{"abcd", "bcd", "acd", "abd", "abc"}); err != nil {
+			t.Error(err)
+		}
+		ids := func(links []models.Link) []string {
+			var ids []string
+			for _, link := range links {
+				ids = append(ids, link.ID)
+			}
+			sort.Strings(ids)
+			return ids
+		}
+
+		links, err := sto.ListLinksBySuggestionKeys([]string{"ab"}, "", 0)
+		if err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(ids(links), []string{"abc"}) {
+			t.Errorf("Expected the link abc, got %v", ids(links))
+		}
+		links, err = sto.ListLinksBySuggestionKeys([]string{"zz"}, "abc", 0)
+		if err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(ids(links), []string{"abc", "abcd"}) {
+			t.Errorf("Expected the links abc and abcd, got %v", ids(links))
+		}
+		links, err = sto.ListLinksBySuggestionKeys(nil, "a.c", 1)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(links) != 0 {
+			t.Errorf("The prefix should not be used as a regex, got %v", ids(links))
+		}
+
+		t.Run("not found", func(t *testing.T) {
+			err = sto.UpdateLinkSuggestionKeys("404", nil)
+			if !errors.As(err, &istorage.NotFoundError{}) {
+				t.Errorf("Expected NotFound got %v: %v", reflect.TypeOf(err), err)
+			}
+		})
+	})
+}
+
+func TestLinkAliasRelatedMethods(t *testing.T) {
+	var sto istorage.IStorage
+	var err error
+
+	mongoSto, err := newStorage()
+	if err != nil {
+		panic("CDatabase connection failed: " + err.Error())
+	}
+	defer mongoSto.close()
+	sto = mongoSto
+
+	for _, collection := range []string{linksCollectionName, linkKeysCollectionName} {
+		if err = mongoSto.client.Database(mongoSto.databaseName).Collection(collection).Drop(mongoSto.newTimeoutContext()); err != nil {
+			t.Errorf("Error reseting the collection: %+v", err)
+		}
+	}
+	if err = mongoSto.ensureIndexes(); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"docs", "gh"} {
+		if err = sto.SaveLink(models.Link{ID: id, Content: "https://example.tld/" + id}); err != nil {
+			t.Error(err)
+		}
+	}
+
+	t.Run("add", func(t *testing.T) {
+		if err = sto.AddLinkAlias("docs", "d"); err != nil {
+			t.Error(err)
+		}
+		for _, alias := range []string{"d", "docs"} {
+			var alreadyExistsError *istorage.AlreadyExistsError
+			if err = sto.AddLinkAlias("gh", alias); !errors.As(err, &alreadyExistsError) {
+				t.Errorf("Expected AlreadyExists for %s got %v: %v", alias, reflect.TypeOf(err), err)
+			}
+		}
+		var alreadyExistsError *istorage.AlreadyExistsError
+		if err = sto.SaveLink(models.Link{ID: "d", Content: "https://example.tld/d"}); !errors.As(err, &alreadyExistsError) {
+			t.Errorf("Expected AlreadyExists got %v: %v", reflect.TypeOf(err), err)
+		}
+		if err = sto.AddLinkAlias("404", "x"); !errors.As(err, &istorage.NotFoundError{}) {
+			t.Errorf("Expected NotFound got %v: %v", reflect.TypeOf(err), err)
+		}
+	})
+
+	t.Run("get", func(t *testing.T) {
+		link, err := sto.GetLink("d")
+		if err != nil {
+			t.Error(err)
+		}
+		if link.ID != "docs" {
+			t.Errorf("The alias should return the link docs, got %+v", link)
+		}
+		links, err := sto.GetLinks([]string{"d", "gh"})
+		if err != nil {
+			t.Error(err)
+		}
+		if len(links) != 2 {
+			t.Errorf("Expected the links docs and gh, got %+v", links)
+		}
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		if err = sto.RemoveLinkAlias("docs", "d"); err != nil {
+			t.Error(err)
+		}
+		if err = sto.RemoveLinkAlias("docs", "d"); !errors.As(err, &istorage.NotFoundError{}) {
+			t.Errorf("Expected NotFound got %v: %v", reflect.TypeOf(err), err)
+		}
+		if _, err = sto.GetLink("d"); !errors.As(err, &istorage.NotFoundError{}) {
+			t.Errorf("Expected NotFound got %v: %v", reflect.TypeOf(err), err)
+		}
+		if err = sto.SaveLink(models.Link{ID: "d", Content: "https://example.tld/d"}); err != nil {
+			t.Errorf("The removed alias should be released, got %v", err)
+		}
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			errs[0] = sto.SaveLink(models.Link{ID: "x", Content: "https://example.tld/x"})
+		}()
+		go func() {
+			defer wg.Done()
+			errs[1] = sto.AddLinkAlias("docs", "x")
+		}()
+		wg.Wait()
+		if (errs[0] == nil) == (errs[1] == nil) {
+			t.Errorf("Only one of the ID and the alias should be saved, got %v and %v", errs[0], errs[1])
+		}
+	})
+}
+
+func TestLinkVersionRelatedMethods(t *testing.T) {
+	var sto istorage.IStorage
+	var err error
+
+	mongoSto, err := newStorage()
+	if err != nil {
+		panic("CDatabase connection failed: " + err.Error())
+	}
+	defer mongoSto.close()
+	sto = mongoSto
+
+	if err = mongoSto.client.Database(mongoSto.databaseName).Collection(linkVersionsCollectionName).Drop(mongoSto.newTimeoutContext()); err != nil {
+		t.Errorf("Error reseting the collection: %+v", err)
+	}
+	versions := []models.LinkVersion{
+		{ID: "v1", LinkID: "abc", Number: 1, Content: "https://example.tld/1", EditorID: "owner", CreatedAt: 100},
+		{ID: "v2", LinkID: "abc", Number: 2, Content: "https://example.tld/2", PreviousContent: "https://example.tld/1", EditorID: "admin", CreatedAt: 100},
+		{ID: "v3", LinkID: "other", Number: 1, Content: "https://example.tld/other", CreatedAt: 100},
+	}
+	for _, version := range versions {
+		if err = sto.SaveLinkVersion(version); err != nil {
+			t.Error(err)
+		}
+	}
+
+	t.Run("conflict", func(t *testing.T) {
+		var alreadyExistsError *istorage.AlreadyExistsError
+		if err = sto.SaveLinkVersion(versions[0]); !errors.As(err, &alreadyExistsError) {
+			t.Errorf("Expected AlreadyExists got %v: %v", reflect.TypeOf(err), err)
+		}
+	})
+
+	t.Run("get", func(t *testing.T) {
+		version, err := sto.GetLinkVersion("v2")
+		if err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(version, versions[1]) {
+			t.Errorf("Expected %+v got %+v", versions[1], version)
+		}
+		if _, err = sto.GetLinkVersion("404"); !errors.As(err, &istorage.NotFoundError{}) {
+			t.Errorf("Expected NotFound got %v: %v", reflect.TypeOf(err), err)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		list, err := sto.ListLinkVersions("abc", 0, 0)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(list) != 2 || list[0].ID != "v2" || list[1].ID != "v1" {
+			t.Errorf("Expected the versions of abc, the newest first, got %+v", list)
+		}
+		list, err = sto.ListLinkVersions("abc", 1, 1)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(list) != 1 || list[0].ID != "v1" {
+			t.Errorf("Expected the version v1, got %+v", list)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if err = sto.DeleteLinkVersion("v2"); err != nil {
+			t.Error(err)
+		}
+		if _, err = sto.GetLinkVersion("v2"); !errors.As(err, &istorage.NotFoundError{}) {
+			t.Errorf("Expected NotFound got %v: %v", reflect.TypeOf(err), err)
+		}
+		if err = sto.DeleteLinkVersion("v2"); !errors.As(err, &istorage.NotFoundError{}) {
+			t.Errorf("Expected NotFound got %v: %v", reflect.TypeOf(err), err)
+		}
+	})
+}
+
+func TestTrashRelatedMethods(t *testing.T) {
+	var sto istorage.IStorage
+	var err error
+
+	mongoSto, err := newStorage()
+	if err != nil {
+		panic("CDatabase connection failed: " + err.Error())
+	}
+	defer mongoSto.close()
+	sto = mongoSto
+
+	for _, collection := range []string{linksCollectionName, linkKeysCollectionName, userCollectionName, linkVersionsCollectionName, linkTransfersCollectionName, countersCollectionName} {
+		if err = mongoSto.client.Database(mongoSto.databaseName).Collection(collection).Drop(mongoSto.newTimeoutContext()); err != nil {
+			t.Errorf("Error reseting the collection: %+v", err)
+		}
+	}
+	if err = mongoSto.ensureIndexes(); err != nil {
+		t.Error(err)
+	}
+	if err = sto.SaveUser(models.User{ID: "owner", Name: "owner"}); err != nil {
+		t.Error(err)
+	}
+	for _, link := range []models.Link{
+		{ID: "old", OwnerID: "owner", Content: "https://example.tld/old", Aliases: []string{"o"}},
+		{ID: "recent", OwnerID: "owner", Content: "https://example.tld/recent"},
+	} {
+		if err = sto.SaveLink(link); err != nil {
+			t.Error(err)
+		}
+		if err = sto.SaveLinkVersion(models.LinkVersion{ID: "v-" + link.ID, LinkID: link.ID, Number: 1, Content: link.Content}); err != nil {
+			t.Error(err)
+		}
+		for _, counter := range []string{istorage.LinkVersionsCounterName(link.ID), istorage.LinkRotationCounterName(link.ID), istorage.LinkMilestoneCounterName(link.ID, 100)} {
+			if _, err = sto.IncreaseCounter(counter); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+	if err = sto.SaveLinkTransfer(models.LinkTransfer{ID: "both", ToID: "owner", Items: []models.LinkTransferItem{{LinkID: "old"}, {LinkID: "recent"}}}); err != nil {
+		t.Error(err)
+	}
+	if err = sto.SaveLinkTransfer(models.LinkTransfer{ID: "old", ToID: "owner", Items: []models.LinkTransferItem{{LinkID: "old"}}}); err != nil {
+		t.Error(err)
+	}
+
+	t.Run("trash", func(t *testing.T) {
+		if err = sto.TrashLink("old", 100); err != nil {
+			t.Error(err)
+		}
+		if err = sto.TrashLink("recent", 200); err != nil {
+			t.Error(err)
+		}
+		if err = sto.TrashLink("old", 300); !errors.As(err, &istorage.NotFoundError{}) {
+			t.Errorf("Expected NotFound got %v: %v", reflect.TypeOf(err), err)
+		}
+		if err = sto.TrashUser("owner", 100); err != nil {
+			t.Error(err)
+		}
+		if _, err = sto.GetLink("o"); !errors.As(err, &istorage.NotFoundError{}) {
+			t.Errorf("Expected NotFound got %v: %v", reflect.TypeOf(err), err)
+		}
+		if _, err = sto.GetUser("owner"); !errors.As(err, &istorage.NotFoundError{}) {
+			t.Errorf("Expected NotFound got %v: %v", reflect.TypeOf(err), err)
+		}
+		if links, err := sto.ListLinks("", 0, 0); err != nil || len(links) != 0 {
+			t.Errorf("Expected no links got %+v %v", links, err)
+		}
+	})
+
+	t.Run("reserved", func(t *testing.T) {
+		var alreadyExistsError *istorage.AlreadyExistsError
+		for _, id := range []string{"old", "o"} {
+			if err = sto.SaveLink(models.Link{ID: id, Content: "https://example.tld/"}); !errors.As(err, &alreadyExistsError) {
+				t.Errorf("Expected AlreadyExists got %v: %v", reflect.TypeOf(err), err)
+			}
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		links, err := sto.ListTrashedLinks("owner", 0, 0)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(links) != 2 || links[0].ID != "recent" || links[1].ID != "old" {
+			t.Errorf("Expected the deleted links, the last deleted first, got %+v", links)
+		}
+		link, err := sto.GetTrashedLink("o")
+		if err != nil || link.ID != "old" || link.DeletedAt != 100 {
+			t.Errorf("Expected the link old deleted at 100, got %+v %v", link, err)
+		}
+		users, err := sto.ListTrashedUsers(0, 0)
+		if err != nil || len(users) != 1 || users[0].ID != "owner" {
+			t.Errorf("Expected the user owner, got %+v %v", users, err)
+		}
+	})
+
+	t.Run("writes", func(t *testing.T) {
+		mode := models.RedirectPermanent
+		for name, write := range map[string]func() error{
+			"content":       func() error { return sto.UpdateLinkContent("recent", "https://example.tld/new") },
+			"settings":      func() error { return sto.UpdateLink(link_repository.UpdatePayload{ID: "recent", RedirectMode: &mode}) },
+			"alias":         func() error { return sto.AddLinkAlias("recent", "r") },
+			"hits":          func() error { return sto.IncreaseLinkHitCount("recent") },
+			"fallback hits": func() error { return sto.IncreaseLinkFallbackHitCount("recent") },
+		} {
+			if err := write(); !errors.As(err, &istorage.NotFoundError{}) {
+				t.Errorf("Expected NotFound on the %s of a deleted link got %v: %v", name, reflect.TypeOf(err), err)
+			}
+		}
+		if link, err := sto.GetTrashedLink("recent"); err != nil || link.Content != "https://example.tld/recent" || link.Hits != 0 || len(link.Aliases) != 0 {
+			t.Errorf("Expected the deleted link unchanged, got %+v %v", link, err)
+		}
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		if err = sto.RestoreUser("owner"); err != nil {
+			t.Error(err)
+		}
+		if err = sto.RestoreUser("owner"); !errors.As(err, &istorage.NotFoundError{}) {
+			t.Errorf("Expected NotFound got %v: %v", reflect.TypeOf(err), err)
+		}
+		if user, err := sto.GetUser("owner"); err != nil || user.DeletedAt != 0 {
+			t.Errorf("Expected the restored user, got %+v %v", user, err)
+		}
+	})
+
+	t.Run("purge", func(t *testing.T) {
+		purged, err := sto.PurgeLinks(150)
+		if err != nil || purged != 1 {
+			t.Errorf("Expected to purge 1 link, got %d %v", purged, err)
+		}
+		if _, err = sto.GetTrashedLink("old"); !errors.As(err, &istorage.NotFoundError{}) {
+			t.Errorf("Expected NotFound got %v: %v", reflect.TypeOf(err), err)
+		}
+		if err = sto.SaveLink(models.Link{ID: "o", Content: "https://example.tld/"}); err != nil {
+			t.Errorf("The purged IDs should be available again, got %v", err)
+		}
+		if versions, err := sto.ListLinkVersions("old", 0, 0); err != nil || len(versions) != 0 {
+			t.Errorf("The versions of the purged link should be removed, got %+v %v", versions, err)
+		}
+		if versions, err := sto.ListLinkVersions("recent", 0, 0); err != nil || len(versions) != 1 {
+			t.Errorf("The versions of the other links should be kept, got %+v %v", versions, err)
+		}
+		for _, counter := range []string{istorage.LinkVersionsCounterName("old"), istorage.LinkRotationCounterName("old"), istorage.LinkMilestoneCounterName("old", 100)} {
+			if value, err := sto.GetCounter(counter); err != nil || value != 0 {
+				t.Errorf("The counter %s of the purged link should be removed, got %d %v", counter, value, err)
+			}
+		}
+		if value, err := sto.GetCounter(istorage.LinkVersionsCounterName("recent")); err != nil || value != 1 {
+			t.Errorf("The counters of the other links should be kept, got %d %v", value, err)
+		}
+		if transfer, err := sto.GetLinkTransfer("both"); err != nil || len(transfer.Items) != 1 || transfer.Items[0].LinkID != "recent" {
+			t.Errorf("The purged link should be removed from its transfers, got %+v %v", transfer, err)
+		}
+		if _, err = sto.GetLinkTransfer("old"); !errors.As(err, &istorage.NotFoundError{}) {
+			t.Errorf("The transfers left without links should be removed, got %v: %v", reflect.TypeOf(err), err)
+		}
+		if err = sto.RestoreLink("recent"); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestAuditRelatedMethods(t *testing.T) {
+	var sto istorage.IStorage
+	var err error
+
+	mongoSto, err := newStorage()
+	if err != nil {
+		panic("CDatabase connection failed: " + err.Error())
+	}
+	defer mongoSto.close()
+	sto = mongoSto
+
+	if err = mongoSto.client.Database(mongoSto.databaseName).Collection(auditRecordsCollectionName).Drop(mongoSto.newTimeoutContext()); err != nil {
+		t.Errorf("Error reseting the collection: %+v", err)
+	}
+	records := []models.AuditRecord{
+		{ID: "r1", Number: 1, ActorID: "owner", Action: models.AuditCreate, TargetType: models.AuditTargetLink, TargetID: "abc",
+			Changes: []models.AuditChange{{Field: "content", After: `"https://example.tld/"`}}, CreatedAt: 100},
+		{ID: "r2", Number: 2, ActorID: "other", Action: models.AuditDelete, TargetType: models.AuditTargetLink, TargetID: "abc",
+			Denied: true, Request: models.RequestMetadata{IP: "192.0.2.1"}, CreatedAt: 200},
+		{ID: "r3", Number: 3, Action: models.AuditUpdate, TargetType: models.AuditTargetUser, TargetID: "owner", CreatedAt: 300},
+	}
+	for _, record := range records {
+		if err = sto.SaveAuditRecord(record); err != nil {
+			t.Error(err)
+		}
+	}
+
+	t.Run("conflict", func(t *testing.T) {
+		var alreadyExistsError *istorage.AlreadyExistsError
+		if err = sto.SaveAuditRecord(records[0]); !errors.As(err, &alreadyExistsError) {
+			t.Errorf("Expected AlreadyExists got %v: %v", reflect.TypeOf(err), err)
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		list, err := sto.ListAuditRecords(models.AuditFilter{}, 0, 0)
+		if err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(list, records) {
+			t.Errorf("Expected %+v got %+v", records, list)
+		}
+		for _, test := range []struct {
+			filter   models.AuditFilter
+			expected []string
+		}{
+			{models.AuditFilter{TargetType: models.AuditTargetLink, TargetID: "abc"}, []string{"r1", "r2"}},
+			{models.AuditFilter{ActorID: "owner"}, []string{"r1"}},
+			{models.AuditFilter{DeniedOnly: true}, []string{"r2"}},
+			{models.AuditFilter{Since: 200, Until: 300}, []string{"r2"}},
+			{models.AuditFilter{Action: models.AuditUpdate}, []string{"r3"}},
+		} {
+			list, err = sto.ListAuditRecords(test.filter, 0, 0)
+			if err != nil {
+				t.Error(err)
+			}
+			var ids []string
+			for _, record := range list {
+				ids = append(ids, record.ID)
+			}
+			if !reflect.DeepEqual(ids, test.expected) {
+				t.Errorf("Expected %v for %+v, got %v", test.expected, test.filter, ids)
+			}
+		}
+		list, err = sto.ListAuditRecords(models.AuditFilter{}, 1, 1)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(list) != 1 || list[0].ID != "r2" {
+			t.Errorf("Expected the record r2, got %+v", list)
+		}
+	})
+}
+
+func TestWebhookRelatedMethods(t *testing.T) {
+	var sto istorage.IStorage
+	var err error
+
+	mongoSto, err := newStorage()
+	if err != nil {
+		panic("CDatabase connection failed: " + err.Error())
+	}
+	defer mongoSto.close()
+	sto = mongoSto
+
+	for _, collection := range []string{webhooksCollectionName, webhookDeliveriesCollectionName} {
+		if err = mongoSto.client.Database(mongoSto.databaseName).Collection(collection).Drop(mongoSto.newTimeoutContext()); err != nil {
+			t.Errorf("Error reseting the collection: %+v", err)
+		}
+	}
+	webhooks := []models.Webhook{
+		{ID: "w1", URL: "https://example.tld/all", Events: []models.WebhookEvent{models.WebhookLinkCreated}, Secret: "s1", CreatedAt: 100},
+		{ID: "w2", OwnerID: "owner", URL: "https://example.tld/owner", Events: []models.WebhookEvent{models.WebhookLinkCreated, models.WebhookUserUpdated}, Secret: "s2", CreatedAt: 200},
+		{ID: "w3", OwnerID: "other", URL: "https://example.tld/other", Events: []models.WebhookEvent{models.WebhookLinkCreated}, Secret: "s3", CreatedAt: 300},
+	}
+	for _, webhook := range webhooks {
+		if err = sto.SaveWebhook(webhook); err != nil {
+			t.Error(err)
+		}
+	}
+
+	t.Run("conflict", func(t *testing.T) {
+		var alreadyExistsError *istorage.AlreadyExistsError
+		if err = sto.SaveWebhook(webhooks[0]); !errors.As(err, &alreadyExistsError) {
+			t.Errorf("Expected AlreadyExists got %v: %v", reflect.TypeOf(err), err)
+		}
+	})
+
+	t.Run("get and list", func(t *testing.T) {
+		webhook, err := sto.GetWebhook("w2")
+		if err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(webhook, webhooks[1]) {
+			t.Errorf("Expected %+v got %+v", webhooks[1], webhook)
+		}
+		list, err := sto.ListWebhooks("", 0, 0)
+		if err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(list, webhooks) {
+			t.Errorf("Expected %+v got %+v", webhooks, list)
+		}
+		list, err = sto.ListWebhooks("owner", 0, 0)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(list) != 1 || list[0].ID != "w2" {
+			t.Errorf("Expected the webhook w2, got %+v", list)
+		}
+		list, err = sto.ListWebhooksByEvent(models.WebhookLinkCreated, "owner")
+		if err != nil {
+			t.Error(err)
+		}
+		if len(list) != 2 || list[0].ID != "w1" || list[1].ID != "w2" {
+			t.Errorf("Expected the webhooks w1 and w2, got %+v", list)
+		}
+		list, err = sto.ListWebhooksByEvent(models.WebhookUserUpdated, "other")
+		if err != nil {
+			t.Error(err)
+		}
+		if len(list) != 0 {
+			t.Errorf("Expected no webhooks, got %+v", list)
+		}
+	})
+
+	t.Run("deliveries", func(t *testing.T) {
+		deliveries := []models.WebhookDelivery{
+			{ID: "d1", WebhookID: "w1", Event: models.WebhookLinkCreated, Payload: "{}", Status: models.WebhookDeliveryPending, CreatedAt: 100},
+			{ID: "d2", WebhookID: "w1", Event: models.WebhookLinkCreated, Payload: "{}", Status: models.WebhookDeliveryPending, RedeliveryOf: "d1", CreatedAt: 200},
+		}
+		for _, delivery := range deliveries {
+			if err = sto.SaveWebhookDelivery(delivery); err != nil {
+				t.Error(err)
+			}
+		}
+		deliveries[0].Status, deliveries[0].Attempts, deliveries[0].StatusCode, deliveries[0].LastAttemptAt = models.WebhookDeliverySucceeded, 1, 200, 150
+		if err = sto.SaveWebhookDelivery(deliveries[0]); err != nil {
+			t.Error(err)
+		}
+		delivery, err := sto.GetWebhookDelivery("d1")
+		if err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(delivery, deliveries[0]) {
+			t.Errorf("Expected %+v got %+v", deliveries[0], delivery)
+		}
+		list, err := sto.ListWebhookDeliveries("w1", 0, 0)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(list) != 2 || list[0].ID != "d2" || list[1].ID != "d1" {
+			t.Errorf("Expected the deliveries d2 and d1, got %+v", list)
+		}
+		pending, err := sto.ListPendingWebhookDeliveries("", 0)
+		if err != nil {
+			t.Error(err)
+		}
+		if len(pending) != 1 || pending[0].ID != "d2" {
+			t.Errorf("Expected the pending delivery d2, got %+v", pending)
+		}
+		if pending, err = sto.ListPendingWebhookDeliveries("d2", 0); err != nil || len(pending) != 0 {
+			t.Errorf("Expected no deliveries after d2, got %+v %v", pending, err)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if err = sto.DeleteWebhook("w1"); err != nil {
+			t.Error(err)
+		}
+		if _, err = sto.GetWebhook("w1"); !errors.As(err, &istorage.NotFoundError{}) {
+			t.Errorf("Expected NotFound got %v: %v", reflect.TypeOf(err), err)
+		}
+		if err = sto.DeleteWebhook("w1"); !errors.As(err, &istorage.NotFoundError{}) {
+			t.Errorf("Expected NotFound got %v: %v", reflect.TypeOf(err), err)
+		}
+	})
+}
+
+func TestSessionRelatedMethods(t *testing.T) {
+	var sto istorage.IStorage
+	var err error
+
+	mongoSto, err := newStorage()
+	if err != nil {
+		panic("CDatabase connection failed: " + err.Error())
+	}
+	defer mongoSto.close()
+	sto = mongoSto
+
+	if err = mongoSto.client.Database(mongoSto.databaseName).Collection(sessionsCollectionName).Drop(mongoSto.newTimeoutContext()); err != nil {
+		t.Errorf("Error reseting the collection: %+v", err)
+	}
+	session := models.Session{ID: "s1", UserID: "abc", LastToken: "t1", CreatedAt: 100, ExpireDate: 200}
+	if err = sto.SaveSession(session); err != nil {
+		t.Error(err)
+	}
+
+	t.Run("conflict", func(t *testing.T) {
+		var alreadyExistsError *istorage.AlreadyExistsError
+		if err = sto.SaveSession(session); !errors.As(err, &alreadyExistsError) {
+			t.Errorf("Expected AlreadyExists got %v: %v", reflect.TypeOf(err), err)
+		}
+	})
+
+	t.Run("get", func(t *testing.T) {
+		got, err := sto.GetSession("s1")
+		if err != nil {
+			t.Error(err)
+		}
+		if !reflect.DeepEqual(got, session) {
+			t.Errorf("Expected %+v got %+v", session, got)
+		}
+		if _, err = sto.GetSession("404"); !errors.As(err, &istorage.NotFoundError{}) {
+			t.Errorf("Expected NotFound got %v: %v", reflect.TypeOf(err), err)
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if err = sto.DeleteSession("s1"); err != nil {
+			t.Error(err)
+		}
+		if _, err = sto.GetSession("s1"); !errors.As(err, &istorage.NotFoundError{}) {
+			t.Errorf("Expected NotFound got %v: %v", reflect.TypeOf(err), err)
+		}
+		if err = sto.DeleteSession("s1"); !errors.As(err, &istorage.NotFoundError{}) {
+			t.Errorf("Expected NotFound got %v: %v", reflect.TypeOf(err), err)
+		}
+	})
+}
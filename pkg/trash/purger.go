@@ -0,0 +1,76 @@
+package trash
+
+import (
+	"fmt"
+	sto "github.com/nethruster/linksh/pkg/interfaces/storage"
+	"sync"
+	"time"
+)
+
+//DefaultRetention is the time the deleted links and users are kept before being purged
+const DefaultRetention = 30 * 24 * time.Hour
+
+//Purger periodically removes from the storage the links and users deleted longer than the retention ago
+//Until then their IDs stay reserved and they can be restored
+type Purger struct {
+	Storage sto.IStorage
+	//Retention is the time the deleted links and users are kept, DefaultRetention if 0
+	Retention time.Duration
+	//OnError is called with the errors found while purging in the background, if nil they are ignored
+	OnError func(error)
+
+	now func() time.Time
+}
+
+//New creates a Purger with the provided retention, DefaultRetention if 0
+func New(storage sto.IStorage, retention time.Duration) *Purger {
+	return &Purger{
+		Storage:   storage,
+		Retention: retention,
+		now:       time.Now,
+	}
+}
+
+//Start purges the storage every interval in the background
+//The returned function stops the purges
+func (p *Purger) Start(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			if _, _, err := p.PurgeAll(); err != nil && p.OnError != nil {
+				p.OnError(err)
+			}
+			select {
+			case <-ticker.C:
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+//PurgeAll removes the links and users deleted longer than the retention ago and returns how many of each were removed
+func (p *Purger) PurgeAll() (links, users uint, err error) {
+	now, retention := p.now, p.Retention
+	if now == nil {
+		now = time.Now
+	}
+	if retention == 0 {
+		retention = DefaultRetention
+	}
+	deletedBefore := now().Add(-retention).Unix()
+	if links, err = p.Storage.PurgeLinks(deletedBefore); err != nil {
+		return 0, 0, fmt.Errorf("error purging the deleted links:%w", err)
+	}
+	if users, err = p.Storage.PurgeUsers(deletedBefore); err != nil {
+		return links, 0, fmt.Errorf("error purging the deleted users:%w", err)
+	}
+	return
+}
@@ -0,0 +1,76 @@
+package trash
+
+import (
+	istorage "github.com/nethruster/linksh/pkg/interfaces/storage"
+	"testing"
+	"time"
+)
+
+//fakeStorage implements the purge methods of IStorage keeping the deletion time of each item
+type fakeStorage struct {
+	istorage.IStorage
+	links map[string]int64
+	users map[string]int64
+}
+
+func purge(items map[string]int64, deletedBefore int64) (count uint) {
+	for id, deletedAt := range items {
+		if deletedAt < deletedBefore {
+			delete(items, id)
+			count++
+		}
+	}
+	return
+}
+
+func (fs *fakeStorage) PurgeLinks(deletedBefore int64) (uint, error) {
+	return purge(fs.links, deletedBefore), nil
+}
+
+func (fs *fakeStorage) PurgeUsers(deletedBefore int64) (uint, error) {
+	return purge(fs.users, deletedBefore), nil
+}
+
+func TestPurgeAll(t *testing.T) {
+	now := time.Unix(1000000, 0)
+	storage := &fakeStorage{
+		links: map[string]int64{"old": now.Add(-2 * time.Hour).Unix(), "recent": now.Add(-30 * time.Minute).Unix()},
+		users: map[string]int64{"old": now.Add(-61 * time.Minute).Unix()},
+	}
+	purger := New(storage, time.Hour)
+	purger.now = func() time.Time { return now }
+
+	links, users, err := purger.PurgeAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if links != 1 || users != 1 {
+		t.Errorf("Expected to purge 1 link and 1 user, got %d and %d", links, users)
+	}
+	if _, ok := storage.links["recent"]; !ok {
+		t.Error("The link deleted within the retention was purged")
+	}
+	if _, ok := storage.links["old"]; ok {
+		t.Error("The link deleted before the retention was not purged")
+	}
+}
+
+func TestPurgerZeroValue(t *testing.T) {
+	now := time.Now()
+	storage := &fakeStorage{
+		links: map[string]int64{"old": now.Add(-DefaultRetention - time.Hour).Unix(), "recent": now.Add(-time.Hour).Unix()},
+		users: map[string]int64{},
+	}
+	purger := &Purger{Storage: storage}
+
+	links, _, err := purger.PurgeAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if links != 1 {
+		t.Errorf("Expected to purge 1 link, got %d", links)
+	}
+	if _, ok := storage.links["recent"]; !ok {
+		t.Error("A Purger without retention should keep the links deleted within the default retention")
+	}
+}
@@ -0,0 +1,70 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+)
+
+//ErrForbiddenAddress is returned when a webhook resolves to a loopback, link-local, private or unspecified address
+var ErrForbiddenAddress = errors.New("forbidden address")
+
+//privateNetworks are the ranges of the private networks not covered by the methods of net.IP
+var privateNetworks = parseNetworks("0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7")
+
+//defaultClient is the client of the dispatchers without one
+var defaultClient = NewClient()
+
+//NewClient returns a client that refuses to connect to the addresses rejected by IsPublicIP
+//The addresses are checked once resolved, so the redirects and the names resolving to internal addresses are rejected too
+func NewClient() *http.Client {
+	dialer := &net.Dialer{Timeout: DefaultTimeout, Control: checkAddress}
+	return &http.Client{
+		Timeout: DefaultTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: DefaultTimeout,
+		},
+	}
+}
+
+//IsPublicIP tells whether an address can be reached by the webhooks
+//The loopback, link-local, private, multicast and unspecified addresses can't, as they would let the owners of the webhooks probe the network of the instance
+func IsPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() || ip.IsUnspecified() {
+		return false
+	}
+	for _, network := range privateNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+//checkAddress is the Control function of the dialer of NewClient, it runs right before connecting to the resolved address
+func checkAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !IsPublicIP(ip) {
+		return fmt.Errorf("%w %s", ErrForbiddenAddress, host)
+	}
+	return nil
+}
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
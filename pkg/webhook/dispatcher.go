@@ -0,0 +1,423 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	gonanoid "github.com/matoous/go-nanoid"
+	"github.com/nethruster/linksh/pkg/events"
+	sto "github.com/nethruster/linksh/pkg/interfaces/storage"
+	"github.com/nethruster/linksh/pkg/models"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	//DefaultTimeout is the time a delivery waits for a response
+	DefaultTimeout = 10 * time.Second
+	//DefaultMaxAttempts is the number of times a payload is sent before the delivery fails
+	DefaultMaxAttempts = 5
+	//DefaultRetryDelay is the time waited before the first retry, it is doubled on every other retry
+	DefaultRetryDelay = 30 * time.Second
+	//DefaultConcurrency is the number of deliveries sent at once
+	DefaultConcurrency = 4
+	//resumeBatchSize is the number of pending deliveries loaded from the storage at once while resuming them
+	resumeBatchSize = 100
+
+	//EventHeader carries the event of the payload
+	EventHeader = "X-Linksh-Event"
+	//DeliveryHeader carries the ID of the delivery, it differs from the one in the payload for the redeliveries
+	DeliveryHeader = "X-Linksh-Delivery"
+	//SignatureHeader carries "sha256=" followed by the hex encoded HMAC-SHA256 of the body, keyed with the secret of the webhook
+	SignatureHeader = "X-Linksh-Signature-256"
+)
+
+//ErrNoDispatcher is returned when redelivering or resuming the deliveries without a Dispatcher
+var ErrNoDispatcher = errors.New("There is no webhook dispatcher")
+
+//DefaultMilestones are the hits of a link notified with a WebhookLinkMilestone event
+var DefaultMilestones = []uint{100, 1000, 10000, 100000, 1000000}
+
+//Dispatcher sends the events to the webhooks subscribed to them in the background, retrying the failed deliveries
+//Every delivery and its attempts are saved in the storage, so the pending ones can be resumed with ResumePending after a restart
+//Dispatch, LinkHit and Wait can be called on a nil Dispatcher, then no event is sent, and Redeliver and ResumePending return an ErrNoDispatcher
+type Dispatcher struct {
+	Storage sto.IStorage
+	//Client sends the deliveries, if nil the one returned by NewClient is used
+	Client *http.Client
+	//MaxAttempts is the number of times a payload is sent before the delivery fails
+	MaxAttempts uint
+	//RetryDelay is the time waited before the first retry, it is doubled on every other retry
+	RetryDelay time.Duration
+	//Concurrency is the number of deliveries sent at once, DefaultConcurrency if 0
+	//The rest wait in a queue, and the ones waiting for a retry only hold a timer
+	Concurrency uint
+	//Milestones are the hits of a link notified with a WebhookLinkMilestone event
+	Milestones []uint
+	//OnError is called with the errors found while sending the events in the background, if nil they are ignored
+	OnError func(error)
+
+	inFlight     sync.WaitGroup
+	startWorkers sync.Once
+	queueMutex   sync.Mutex
+	queueReady   *sync.Cond
+	queue        []attempt
+}
+
+//attempt is a pending delivery waiting to be sent to its webhook
+type attempt struct {
+	webhook  models.Webhook
+	delivery models.WebhookDelivery
+}
+
+//New creates a Dispatcher with the default settings
+func New(storage sto.IStorage) *Dispatcher {
+	return &Dispatcher{
+		Storage:     storage,
+		Client:      NewClient(),
+		MaxAttempts: DefaultMaxAttempts,
+		RetryDelay:  DefaultRetryDelay,
+		Concurrency: DefaultConcurrency,
+		Milestones:  DefaultMilestones,
+	}
+}
+
+//Subscribe sends the changes of the links and the users published to the bus to the webhooks, and the hits reaching a milestone
+//The link events go to the webhooks of the owner of the link, and the user events to the ones of the user
+//The returned function cancels the subscription
+func (d *Dispatcher) Subscribe(bus *events.Bus) (unsubscribe func()) {
+	return bus.Subscribe(d.handle, events.LinkCreatedName, events.LinkUpdatedName, events.LinkContentUpdatedName, events.LinkDeletedName,
+		events.LinkHitName, events.UserCreatedName, events.UserUpdatedName, events.UserDeletedName)
+}
+
+//handle sends an event published to the bus to the webhooks subscribed to it
+func (d *Dispatcher) handle(event events.Event) {
+	switch event := event.(type) {
+	case events.LinkCreated:
+		d.Dispatch(models.WebhookLinkCreated, event.Link.OwnerID, event.Link)
+	case events.LinkUpdated:
+		d.Dispatch(models.WebhookLinkUpdated, event.Link.OwnerID, event.Link)
+	case events.LinkContentUpdated:
+		d.Dispatch(models.WebhookLinkUpdated, event.Link.OwnerID, event.Link)
+	case events.LinkDeleted:
+		d.Dispatch(models.WebhookLinkDeleted, event.Link.OwnerID, event.Link)
+	case events.LinkHit:
+		d.LinkHit(event.Link)
+	case events.UserCreated:
+		d.Dispatch(models.WebhookUserCreated, event.User.ID, event.User)
+	case events.UserUpdated:
+		d.Dispatch(models.WebhookUserUpdated, event.User.ID, event.User)
+	case events.UserDeleted:
+		d.Dispatch(models.WebhookUserDeleted, event.User.ID, event.User)
+	}
+}
+
+//Dispatch sends the event to the webhooks subscribed to it owned by the specified user or by nobody
+//The data is the link or the user of the event
+func (d *Dispatcher) Dispatch(event models.WebhookEvent, ownerID string, data interface{}) {
+	if d == nil {
+		return
+	}
+	payload := models.WebhookPayload{Event: event, CreatedAt: time.Now().Unix(), Data: data}
+
+	d.inFlight.Add(1)
+	go func() {
+		defer d.inFlight.Done()
+		webhooks, err := d.Storage.ListWebhooksByEvent(event, ownerID)
+		if err != nil {
+			d.fail(fmt.Errorf("error listing the webhooks of the event %s:%w", event, err))
+			return
+		}
+		for _, webhook := range webhooks {
+			d.inFlight.Add(1)
+			go func(webhook models.Webhook) {
+				defer d.inFlight.Done()
+				delivery, err := d.newDelivery(webhook, payload)
+				if err != nil {
+					d.fail(err)
+					return
+				}
+				d.enqueue(attempt{webhook: webhook, delivery: delivery}, 0)
+			}(webhook)
+		}
+	}()
+}
+
+//LinkHit sends a WebhookLinkMilestone event if the visit counted in the hits of the link reached one of the milestones
+//The link must be the one read before counting the visit, every milestone is sent once per link
+func (d *Dispatcher) LinkHit(link models.Link) {
+	if d == nil {
+		return
+	}
+	hits := link.Hits + 1
+	for _, milestone := range d.Milestones {
+		if milestone != hits {
+			continue
+		}
+		//The concurrent visits could read the same hits
+		count, err := d.Storage.IncreaseCounter(sto.LinkMilestoneCounterName(link.ID, milestone))
+		if err != nil {
+			d.fail(err)
+			return
+		}
+		if count == 1 {
+			link.Hits = hits
+			d.Dispatch(models.WebhookLinkMilestone, link.OwnerID, models.WebhookMilestone{Link: link, Hits: hits})
+		}
+	}
+}
+
+//Redeliver sends again the payload of a delivery as a new delivery, with its own attempts
+//If the delivery or its webhook does not exists in the storage an NotFoundError would be returned
+func (d *Dispatcher) Redeliver(deliveryID string) (models.WebhookDelivery, error) {
+	if d == nil {
+		return models.WebhookDelivery{}, ErrNoDispatcher
+	}
+	original, err := d.Storage.GetWebhookDelivery(deliveryID)
+	if err != nil {
+		return original, err
+	}
+	webhook, err := d.Storage.GetWebhook(original.WebhookID)
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+
+	delivery, err := newPendingDelivery(original.WebhookID, original.Event)
+	if err != nil {
+		return delivery, err
+	}
+	delivery.Payload = original.Payload
+	delivery.RedeliveryOf = original.ID
+	if original.RedeliveryOf != "" {
+		delivery.RedeliveryOf = original.RedeliveryOf
+	}
+	if err = d.Storage.SaveWebhookDelivery(delivery); err != nil {
+		return delivery, err
+	}
+
+	d.enqueue(attempt{webhook: webhook, delivery: delivery}, 0)
+	return delivery, nil
+}
+
+//ResumePending queues again the deliveries left pending by a previous run and returns how many were resumed
+//It should be called once at startup, the deliveries whose retry is due are sent right away and the rest when it is
+//The deliveries of the webhooks deleted in the meantime are marked as failed
+func (d *Dispatcher) ResumePending() (uint, error) {
+	if d == nil {
+		return 0, ErrNoDispatcher
+	}
+	webhooks := make(map[string]*models.Webhook)
+	var resumed uint
+	for afterID := ""; ; {
+		deliveries, err := d.Storage.ListPendingWebhookDeliveries(afterID, resumeBatchSize)
+		if err != nil {
+			return resumed, fmt.Errorf("error listing the pending webhook deliveries:%w", err)
+		}
+		for _, delivery := range deliveries {
+			webhook, ok := webhooks[delivery.WebhookID]
+			if !ok {
+				found, err := d.Storage.GetWebhook(delivery.WebhookID)
+				if err != nil && !errors.As(err, &sto.NotFoundError{}) {
+					return resumed, err
+				}
+				if err == nil {
+					webhook = &found
+				}
+				webhooks[delivery.WebhookID] = webhook
+			}
+			if webhook == nil {
+				delivery.Status, delivery.Error = models.WebhookDeliveryFailed, "the webhook was deleted"
+				if err = d.Storage.SaveWebhookDelivery(delivery); err != nil {
+					return resumed, fmt.Errorf("error saving the delivery with id \"%s\":%w", delivery.ID, err)
+				}
+				continue
+			}
+
+			var wait time.Duration
+			if delivery.Attempts > 0 {
+				wait = time.Until(time.Unix(delivery.LastAttemptAt, 0).Add(d.retryDelay(delivery.Attempts)))
+			}
+			d.enqueue(attempt{webhook: *webhook, delivery: delivery}, wait)
+			resumed++
+		}
+		if len(deliveries) < resumeBatchSize {
+			return resumed, nil
+		}
+		afterID = deliveries[len(deliveries)-1].ID
+	}
+}
+
+//Wait blocks until the events dispatched so far are delivered or run out of attempts
+func (d *Dispatcher) Wait() {
+	if d != nil {
+		d.inFlight.Wait()
+	}
+}
+
+//Sign returns the value of the SignatureHeader of a body for a webhook with the specified secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+//newDelivery encodes the payload for a webhook and saves it as a pending delivery
+func (d *Dispatcher) newDelivery(webhook models.Webhook, payload models.WebhookPayload) (models.WebhookDelivery, error) {
+	delivery, err := newPendingDelivery(webhook.ID, payload.Event)
+	if err != nil {
+		return delivery, err
+	}
+	payload.DeliveryID = delivery.ID
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return delivery, err
+	}
+	delivery.Payload = string(body)
+
+	if err = d.Storage.SaveWebhookDelivery(delivery); err != nil {
+		return delivery, fmt.Errorf("error saving the delivery of the event %s to the webhook with id \"%s\":%w", payload.Event, webhook.ID, err)
+	}
+	return delivery, nil
+}
+
+//newPendingDelivery creates a delivery of an event to a webhook that was not attempted yet
+func newPendingDelivery(webhookID string, event models.WebhookEvent) (models.WebhookDelivery, error) {
+	id, err := gonanoid.Nanoid()
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+	return models.WebhookDelivery{
+		ID:        id,
+		WebhookID: webhookID,
+		Event:     event,
+		Status:    models.WebhookDeliveryPending,
+		CreatedAt: time.Now().Unix(),
+	}, nil
+}
+
+//enqueue queues a pending delivery to be sent after the specified wait, counting it as in flight until it succeeds or fails
+func (d *Dispatcher) enqueue(next attempt, wait time.Duration) {
+	d.inFlight.Add(1)
+	if wait > 0 {
+		time.AfterFunc(wait, func() { d.push(next) })
+	} else {
+		d.push(next)
+	}
+}
+
+//push adds a delivery to the queue read by the workers, starting them the first time
+func (d *Dispatcher) push(next attempt) {
+	d.startWorkers.Do(func() {
+		d.queueReady = sync.NewCond(&d.queueMutex)
+		concurrency := d.Concurrency
+		if concurrency == 0 {
+			concurrency = DefaultConcurrency
+		}
+		for i := uint(0); i < concurrency; i++ {
+			go d.work()
+		}
+	})
+	d.queueMutex.Lock()
+	d.queue = append(d.queue, next)
+	d.queueMutex.Unlock()
+	d.queueReady.Signal()
+}
+
+//work sends the queued deliveries one at a time
+func (d *Dispatcher) work() {
+	for {
+		d.queueMutex.Lock()
+		for len(d.queue) == 0 {
+			d.queueReady.Wait()
+		}
+		next := d.queue[0]
+		d.queue = d.queue[1:]
+		d.queueMutex.Unlock()
+
+		d.deliver(next)
+	}
+}
+
+//deliver sends a pending delivery once and saves the attempt
+//If it fails and has attempts left it is queued again after the retry delay, otherwise it stops being in flight
+func (d *Dispatcher) deliver(next attempt) {
+	maxAttempts := d.MaxAttempts
+	if maxAttempts == 0 {
+		maxAttempts = 1
+	}
+	delivery := next.delivery
+
+	delivery.StatusCode, delivery.Error = 0, ""
+	response, err := d.send(next.webhook, delivery)
+	if err != nil {
+		delivery.Error = err.Error()
+	} else {
+		delivery.StatusCode = response.StatusCode
+	}
+	delivery.Attempts++
+	delivery.LastAttemptAt = time.Now().Unix()
+
+	switch {
+	case err == nil && response.StatusCode >= 200 && response.StatusCode < 300:
+		delivery.Status = models.WebhookDeliverySucceeded
+	case delivery.Attempts >= maxAttempts:
+		delivery.Status = models.WebhookDeliveryFailed
+	}
+	if err = d.Storage.SaveWebhookDelivery(delivery); err != nil {
+		d.fail(fmt.Errorf("error saving the delivery with id \"%s\":%w", delivery.ID, err))
+	}
+
+	if delivery.Status == models.WebhookDeliveryPending {
+		next.delivery = delivery
+		d.enqueue(next, d.retryDelay(delivery.Attempts))
+	}
+	d.inFlight.Done()
+}
+
+//retryDelay returns the time waited before retrying a delivery after the specified number of attempts
+func (d *Dispatcher) retryDelay(attempts uint) time.Duration {
+	delay := d.RetryDelay
+	for i := uint(1); i < attempts; i++ {
+		delay *= 2
+	}
+	return delay
+}
+
+//send posts the payload of a delivery to the webhook, the response body is discarded
+func (d *Dispatcher) send(webhook models.Webhook, delivery models.WebhookDelivery) (*http.Response, error) {
+	body := []byte(delivery.Payload)
+	request, err := http.NewRequest(http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "linksh-webhook")
+	request.Header.Set(EventHeader, string(delivery.Event))
+	request.Header.Set(DeliveryHeader, delivery.ID)
+	request.Header.Set(SignatureHeader, Sign(webhook.Secret, body))
+
+	client := d.Client
+	if client == nil {
+		client = defaultClient
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	io.Copy(ioutil.Discard, response.Body)
+	response.Body.Close()
+	return response, nil
+}
+
+func (d *Dispatcher) fail(err error) {
+	if d.OnError != nil {
+		d.OnError(err)
+	}
+}
@@ -0,0 +1,352 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/nethruster/linksh/pkg/events"
+	istorage "github.com/nethruster/linksh/pkg/interfaces/storage"
+	"github.com/nethruster/linksh/pkg/models"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+//fakeStorage implements the webhook methods of IStorage keeping everything in memory
+type fakeStorage struct {
+	istorage.IStorage
+	mutex      sync.Mutex
+	webhooks   []models.Webhook
+	deliveries map[string]models.WebhookDelivery
+	counters   map[string]uint64
+}
+
+func newFakeStorage(webhooks ...models.Webhook) *fakeStorage {
+	return &fakeStorage{webhooks: webhooks, deliveries: make(map[string]models.WebhookDelivery), counters: make(map[string]uint64)}
+}
+
+func (fs *fakeStorage) GetWebhook(id string) (models.Webhook, error) {
+	for _, webhook := range fs.webhooks {
+		if webhook.ID == id {
+			return webhook, nil
+		}
+	}
+	return models.Webhook{}, istorage.NewNotFoundError("webhook", "ID", id)
+}
+
+func (fs *fakeStorage) ListWebhooksByEvent(event models.WebhookEvent, ownerID string) ([]models.Webhook, error) {
+	var webhooks []models.Webhook
+	for _, webhook := range fs.webhooks {
+		if webhook.OwnerID != "" && webhook.OwnerID != ownerID {
+			continue
+		}
+		for _, subscribed := range webhook.Events {
+			if subscribed == event {
+				webhooks = append(webhooks, webhook)
+				break
+			}
+		}
+	}
+	return webhooks, nil
+}
+
+func (fs *fakeStorage) SaveWebhookDelivery(delivery models.WebhookDelivery) error {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	fs.deliveries[delivery.ID] = delivery
+	return nil
+}
+
+func (fs *fakeStorage) GetWebhookDelivery(id string) (models.WebhookDelivery, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	if delivery, ok := fs.deliveries[id]; ok {
+		return delivery, nil
+	}
+	return models.WebhookDelivery{}, istorage.NewNotFoundError("webhook delivery", "ID", id)
+}
+
+func (fs *fakeStorage) ListPendingWebhookDeliveries(afterID string, limit uint) ([]models.WebhookDelivery, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	var deliveries []models.WebhookDelivery
+	for _, delivery := range fs.deliveries {
+		if delivery.Status == models.WebhookDeliveryPending && delivery.ID > afterID {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+	sort.Slice(deliveries, func(i, j int) bool { return deliveries[i].ID < deliveries[j].ID })
+	if limit != 0 && uint(len(deliveries)) > limit {
+		deliveries = deliveries[:limit]
+	}
+	return deliveries, nil
+}
+
+func (fs *fakeStorage) IncreaseCounter(name string) (uint64, error) {
+	fs.mutex.Lock()
+	defer fs.mutex.Unlock()
+	fs.counters[name]++
+	return fs.counters[name], nil
+}
+
+//receivedRequest is a request received by the receiver
+type receivedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+//receiver is a local webhook answering with the queued statuses, then with 204
+type receiver struct {
+	mutex    sync.Mutex
+	statuses []int
+	requests []receivedRequest
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.requests = append(r.requests, receivedRequest{header: req.Header, body: body})
+	status := http.StatusNoContent
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func newTestDispatcher(t *testing.T, statuses ...int) (*Dispatcher, *fakeStorage, *receiver) {
+	recv := &receiver{statuses: statuses}
+	server := httptest.NewServer(recv)
+	t.Cleanup(server.Close)
+
+	storage := newFakeStorage(
+		models.Webhook{ID: "all", URL: server.URL, Events: []models.WebhookEvent{models.WebhookLinkCreated, models.WebhookLinkMilestone}, Secret: "secret"},
+		models.Webhook{ID: "other", OwnerID: "other", URL: server.URL, Events: []models.WebhookEvent{models.WebhookLinkCreated}, Secret: "secret"},
+	)
+	dispatcher := New(storage)
+	//The test server listens on the loopback, which the default client refuses to reach
+	dispatcher.Client = server.Client()
+	dispatcher.RetryDelay = time.Millisecond
+	dispatcher.MaxAttempts = 3
+	dispatcher.OnError = func(err error) { t.Error(err) }
+	return dispatcher, storage, recv
+}
+
+func TestDispatch(t *testing.T) {
+	dispatcher, storage, recv := newTestDispatcher(t)
+	link := models.Link{ID: "abc", OwnerID: "owner", Content: "https://example.com"}
+	dispatcher.Dispatch(models.WebhookLinkCreated, link.OwnerID, link)
+	dispatcher.Dispatch(models.WebhookLinkUpdated, link.OwnerID, link)
+	dispatcher.Wait()
+
+	if len(recv.requests) != 1 {
+		t.Fatalf("Expected 1 request, got %d", len(recv.requests))
+	}
+	request := recv.requests[0]
+	if signature := request.header.Get(SignatureHeader); signature != Sign("secret", request.body) {
+		t.Errorf("Invalid signature %s", signature)
+	}
+	if event := request.header.Get(EventHeader); event != string(models.WebhookLinkCreated) {
+		t.Errorf("Expected the event %s, got %s", models.WebhookLinkCreated, event)
+	}
+
+	var payload struct {
+		DeliveryID string
+		Event      models.WebhookEvent
+		Data       models.Link
+	}
+	if err := json.Unmarshal(request.body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.DeliveryID != request.header.Get(DeliveryHeader) || payload.Data.ID != link.ID {
+		t.Errorf("Unexpected payload %s", request.body)
+	}
+	delivery := storage.deliveries[payload.DeliveryID]
+	if delivery.Status != models.WebhookDeliverySucceeded || delivery.Attempts != 1 || delivery.StatusCode != http.StatusNoContent {
+		t.Errorf("Unexpected delivery %+v", delivery)
+	}
+}
+
+func TestDeliveryRetries(t *testing.T) {
+	dispatcher, storage, recv := newTestDispatcher(t, http.StatusInternalServerError, http.StatusBadGateway)
+	dispatcher.Dispatch(models.WebhookLinkCreated, "", models.Link{ID: "abc"})
+	dispatcher.Wait()
+
+	if len(recv.requests) != 3 {
+		t.Fatalf("Expected 3 requests, got %d", len(recv.requests))
+	}
+	for _, delivery := range storage.deliveries {
+		if delivery.Status != models.WebhookDeliverySucceeded || delivery.Attempts != 3 {
+			t.Errorf("Unexpected delivery %+v", delivery)
+		}
+	}
+
+	recv.statuses = []int{500, 500, 500}
+	dispatcher.Dispatch(models.WebhookLinkCreated, "", models.Link{ID: "def"})
+	dispatcher.Wait()
+	failed := 0
+	for _, delivery := range storage.deliveries {
+		if delivery.Status == models.WebhookDeliveryFailed {
+			failed++
+			if delivery.Attempts != 3 || delivery.StatusCode != 500 {
+				t.Errorf("Unexpected delivery %+v", delivery)
+			}
+		}
+	}
+	if failed != 1 {
+		t.Errorf("Expected 1 failed delivery, got %d", failed)
+	}
+}
+
+func TestRedeliver(t *testing.T) {
+	dispatcher, storage, recv := newTestDispatcher(t, 500, 500, 500)
+	dispatcher.Dispatch(models.WebhookLinkCreated, "", models.Link{ID: "abc"})
+	dispatcher.Wait()
+	var original models.WebhookDelivery
+	for _, delivery := range storage.deliveries {
+		original = delivery
+	}
+
+	redelivery, err := dispatcher.Redeliver(original.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatcher.Wait()
+	if redelivery.ID == original.ID || redelivery.RedeliveryOf != original.ID {
+		t.Errorf("Unexpected redelivery %+v", redelivery)
+	}
+	if saved := storage.deliveries[redelivery.ID]; saved.Status != models.WebhookDeliverySucceeded || saved.Payload != original.Payload {
+		t.Errorf("Unexpected redelivery %+v", saved)
+	}
+	if last := recv.requests[len(recv.requests)-1]; last.header.Get(DeliveryHeader) != redelivery.ID {
+		t.Errorf("Expected the redelivery header %s, got %s", redelivery.ID, last.header.Get(DeliveryHeader))
+	}
+
+	if _, err = dispatcher.Redeliver("missing"); err == nil {
+		t.Error("Expected an error redelivering a missing delivery")
+	}
+}
+
+func TestLinkHit(t *testing.T) {
+	dispatcher, _, recv := newTestDispatcher(t)
+	link := models.Link{ID: "abc", Hits: 98}
+	dispatcher.LinkHit(link)
+	link.Hits = 99
+	dispatcher.LinkHit(link)
+	dispatcher.LinkHit(link)
+	dispatcher.Wait()
+
+	if len(recv.requests) != 1 {
+		t.Fatalf("Expected 1 milestone, got %d", len(recv.requests))
+	}
+	var payload struct{ Data models.WebhookMilestone }
+	if err := json.Unmarshal(recv.requests[0].body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Data.Hits != 100 || payload.Data.Link.ID != link.ID {
+		t.Errorf("Unexpected milestone %+v", payload.Data)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	dispatcher, _, recv := newTestDispatcher(t)
+	bus := events.New()
+	unsubscribe := dispatcher.Subscribe(bus)
+	link := models.Link{ID: "abc", OwnerID: "other", Hits: 99}
+	bus.Publish(events.LinkCreated{Link: link})
+	bus.Publish(events.LinkUpdated{Link: link})
+	bus.Publish(events.LinkHit{Link: link})
+	unsubscribe()
+	bus.Publish(events.LinkCreated{Link: link})
+	dispatcher.Wait()
+
+	received := make(map[string]int)
+	for _, request := range recv.requests {
+		received[request.header.Get(EventHeader)]++
+	}
+	if len(recv.requests) != 3 || received[string(models.WebhookLinkCreated)] != 2 || received[string(models.WebhookLinkMilestone)] != 1 {
+		t.Errorf("Expected the creation for both webhooks and the milestone, got %v", received)
+	}
+}
+
+func TestResumePending(t *testing.T) {
+	dispatcher, storage, recv := newTestDispatcher(t)
+	storage.deliveries["new"] = models.WebhookDelivery{ID: "new", WebhookID: "all", Event: models.WebhookLinkCreated, Status: models.WebhookDeliveryPending}
+	storage.deliveries["retried"] = models.WebhookDelivery{ID: "retried", WebhookID: "all", Event: models.WebhookLinkCreated, Status: models.WebhookDeliveryPending,
+		Attempts: 1, LastAttemptAt: time.Now().Unix()}
+	storage.deliveries["deleted"] = models.WebhookDelivery{ID: "deleted", WebhookID: "deleted", Event: models.WebhookLinkCreated, Status: models.WebhookDeliveryPending}
+	storage.deliveries["done"] = models.WebhookDelivery{ID: "done", WebhookID: "all", Event: models.WebhookLinkCreated, Status: models.WebhookDeliverySucceeded, Attempts: 1}
+
+	resumed, err := dispatcher.ResumePending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dispatcher.Wait()
+	if resumed != 2 || len(recv.requests) != 2 {
+		t.Errorf("Expected to resume and send 2 deliveries, got %d and %d", resumed, len(recv.requests))
+	}
+	for _, id := range []string{"new", "retried"} {
+		if delivery := storage.deliveries[id]; delivery.Status != models.WebhookDeliverySucceeded {
+			t.Errorf("Unexpected delivery %+v", delivery)
+		}
+	}
+	if delivery := storage.deliveries["deleted"]; delivery.Status != models.WebhookDeliveryFailed {
+		t.Errorf("The deliveries of the deleted webhooks should fail, got %+v", delivery)
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	var mutex sync.Mutex
+	running, maxRunning := 0, 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mutex.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+	}))
+	defer server.Close()
+
+	storage := newFakeStorage(models.Webhook{ID: "all", URL: server.URL, Events: []models.WebhookEvent{models.WebhookLinkCreated}})
+	dispatcher := &Dispatcher{Storage: storage, Client: server.Client(), Concurrency: 2}
+	for i := 0; i < 10; i++ {
+		dispatcher.Dispatch(models.WebhookLinkCreated, "", models.Link{ID: "abc"})
+	}
+	dispatcher.Wait()
+	if maxRunning != 2 {
+		t.Errorf("Expected 2 deliveries at once, got %d", maxRunning)
+	}
+}
+
+func TestNewClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	if _, err := NewClient().Get(server.URL); !errors.Is(err, ErrForbiddenAddress) {
+		t.Errorf("The client should refuse to reach the loopback, got %v", err)
+	}
+	for address, public := range map[string]bool{
+		"127.0.0.1": false, "::1": false, "169.254.169.254": false, "10.1.2.3": false, "172.20.0.1": false,
+		"192.168.1.1": false, "fd00::1": false, "0.0.0.0": false, "93.184.216.34": true, "2606:4700::1111": true,
+	} {
+		if IsPublicIP(net.ParseIP(address)) != public {
+			t.Errorf("Expected IsPublicIP(%s) to be %v", address, public)
+		}
+	}
+}
+
+func TestNilDispatcher(t *testing.T) {
+	var dispatcher *Dispatcher
+	if _, err := dispatcher.Redeliver("abc"); !errors.Is(err, ErrNoDispatcher) {
+		t.Errorf("Expected ErrNoDispatcher, got %v", err)
+	}
+}